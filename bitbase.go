@@ -0,0 +1,747 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WDL is a game-theoretic result from the point of view of the side to move.
+type WDL int
+
+const (
+	WDLLoss WDL = -2
+	WDLDraw WDL = 0
+	WDLWin  WDL = 2
+)
+
+func (w WDL) String() string {
+	switch {
+	case w >= WDLWin:
+		return "win"
+	case w <= WDLLoss:
+		return "loss"
+	case w == WDLCursedWin:
+		return "cursed win"
+	case w == WDLBlessedLoss:
+		return "blessed loss"
+	default:
+		return "draw"
+	}
+}
+
+// Bitbase stores, for one ending with a lone defending king, whether the stronger side
+// wins each position. Positions are indexed by side to move and piece squares, with the
+// strong king folded into the a1-d1-d4 triangle (a-d files when pawns are present).
+type Bitbase struct {
+	Signature string      // e.g. "KPK", "KBNK": strong side pieces first, then the lone king
+	pieces    []PieceKind // strong side pieces other than the king, in signature order
+	hasPawns  bool
+	wins      []uint64 // bitset: strong side wins
+}
+
+// bitbasePieceOrder fixes the canonical order of pieces in signatures.
+var bitbasePieceOrder = map[PieceKind]int{Queen: 0, Rook: 1, Bishop: 2, Knight: 3, Pawn: 4}
+
+// maxBitbasePieces limits tables to four men: larger tables do not fit comfortably in memory.
+const maxBitbasePieces = 2
+
+// triangleSquares are the strong king squares used for pawnless tables.
+var triangleSquares = []uint64{0, 1, 2, 3, 9, 10, 11, 18, 19, 27}
+
+var triangleSlot = func() [64]int {
+	var slots [64]int
+	for i := range slots {
+		slots[i] = -1
+	}
+	for slot, sq := range triangleSquares {
+		slots[sq] = slot
+	}
+	return slots
+}()
+
+// parseBitbaseSignature validates a signature like "KRK" and returns the strong side's extra pieces.
+func parseBitbaseSignature(signature string) ([]PieceKind, error) {
+	sig := strings.ToUpper(signature)
+	if len(sig) < 3 || sig[0] != 'K' || sig[len(sig)-1] != 'K' {
+		return nil, fmt.Errorf("bitbase: signature %q must look like K<pieces>K", signature)
+	}
+	var pieces []PieceKind
+	for _, c := range sig[1 : len(sig)-1] {
+		kind, _, ok := fenCharToPiece(c)
+		if !ok || kind == King {
+			return nil, fmt.Errorf("bitbase: bad piece %q in signature %q", c, signature)
+		}
+		pieces = append(pieces, kind)
+	}
+	if len(pieces) == 0 || len(pieces) > maxBitbasePieces {
+		return nil, fmt.Errorf("bitbase: signature %q must have 1 to %d extra pieces", signature, maxBitbasePieces)
+	}
+	sort.SliceStable(pieces, func(i, j int) bool { return bitbasePieceOrder[pieces[i]] < bitbasePieceOrder[pieces[j]] })
+	return pieces, nil
+}
+
+func bitbaseSignature(pieces []PieceKind) string {
+	var sb strings.Builder
+	sb.WriteString("K")
+	for _, kind := range pieces {
+		sb.WriteString(pieceKindToFEN(kind, White))
+	}
+	sb.WriteString("K")
+	return sb.String()
+}
+
+func newBitbase(signature string) (*Bitbase, error) {
+	pieces, err := parseBitbaseSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bitbase{Signature: bitbaseSignature(pieces), pieces: pieces}
+	for _, kind := range pieces {
+		if kind == Pawn {
+			b.hasPawns = true
+		}
+	}
+	b.wins = make([]uint64, (b.size()+63)/64)
+	return b, nil
+}
+
+func (b *Bitbase) kingSlots() int {
+	if b.hasPawns {
+		return 32
+	}
+	return len(triangleSquares)
+}
+
+// size returns the number of indexes in the table.
+func (b *Bitbase) size() int {
+	n := 2 * b.kingSlots() * 64
+	for range b.pieces {
+		n *= 64
+	}
+	return n
+}
+
+// bitbasePlacement is a decoded table entry: white is always the strong side.
+type bitbasePlacement struct {
+	strongKing   uint64
+	pieces       [maxBitbasePieces]uint64
+	weakKing     uint64
+	strongToMove bool
+}
+
+func flipFileIndex(sq uint64) uint64 { return sq ^ 7 }
+func flipRankIndex(sq uint64) uint64 { return sq ^ 56 }
+func flipDiagIndex(sq uint64) uint64 { return (sq>>3)|(sq&7)<<3 }
+
+// index normalizes a placement by symmetry and returns its table index.
+func (b *Bitbase) index(pl bitbasePlacement) int {
+	n := len(b.pieces)
+	transform := func(f func(uint64) uint64) {
+		pl.strongKing = f(pl.strongKing)
+		pl.weakKing = f(pl.weakKing)
+		for i := 0; i < n; i++ {
+			pl.pieces[i] = f(pl.pieces[i])
+		}
+	}
+	if pl.strongKing&7 > 3 {
+		transform(flipFileIndex)
+	}
+	var slot int
+	if b.hasPawns {
+		slot = int(pl.strongKing>>3)*4 + int(pl.strongKing&7)
+	} else {
+		if pl.strongKing>>3 > 3 {
+			transform(flipRankIndex)
+		}
+		if pl.strongKing>>3 > pl.strongKing&7 {
+			transform(flipDiagIndex)
+		}
+		slot = triangleSlot[pl.strongKing]
+	}
+	idx := slot
+	if pl.strongToMove {
+		idx += b.kingSlots()
+	}
+	for i := 0; i < n; i++ {
+		idx = idx*64 + int(pl.pieces[i])
+	}
+	return idx*64 + int(pl.weakKing)
+}
+
+// placement decodes a table index.
+func (b *Bitbase) placement(idx int) bitbasePlacement {
+	var pl bitbasePlacement
+	pl.weakKing = uint64(idx % 64)
+	idx /= 64
+	for i := len(b.pieces) - 1; i >= 0; i-- {
+		pl.pieces[i] = uint64(idx % 64)
+		idx /= 64
+	}
+	slot := idx % b.kingSlots()
+	pl.strongToMove = idx >= b.kingSlots()
+	if b.hasPawns {
+		pl.strongKing = uint64(slot/4*8 + slot%4)
+	} else {
+		pl.strongKing = triangleSquares[slot]
+	}
+	return pl
+}
+
+func (b *Bitbase) winsAt(idx int) bool {
+	return b.wins[idx/64]&(1<<(idx%64)) != 0
+}
+
+// whitePawnAttacks returns the squares a white pawn on sq attacks.
+func whitePawnAttacks(sq uint64) Bitboard {
+	file, rank := indexToFileRank(sq)
+	return FromFileRank(file-1, rank+1).Or(FromFileRank(file+1, rank+1))
+}
+
+// strongAttacks returns every square attacked by the strong side for the given occupancy,
+// skipping the piece at index skip (a captured piece); skip < 0 skips nothing.
+func (b *Bitbase) strongAttacks(pl *bitbasePlacement, occupancy Bitboard, skip int) Bitboard {
+	attacks := KingMoves[pl.strongKing]
+	for i, kind := range b.pieces {
+		if i == skip {
+			continue
+		}
+		sq := pl.pieces[i]
+		switch kind {
+		case Knight:
+			attacks |= KnightMoves[sq]
+		case Bishop:
+			attacks |= GetRayAttacks(sq, occupancy).Diagonal()
+		case Rook:
+			attacks |= GetRayAttacks(sq, occupancy).Orthogonal()
+		case Queen:
+			attacks |= GetRayAttacks(sq, occupancy).All()
+		case Pawn:
+			attacks |= whitePawnAttacks(sq)
+		}
+	}
+	return attacks
+}
+
+const (
+	bbUnknown uint8 = iota
+	bbInvalid
+	bbWin
+	bbDraw
+)
+
+// bitbaseGenerator holds the working state while a table is solved by forward iteration.
+type bitbaseGenerator struct {
+	table  *Bitbase
+	status []uint8
+	lookup func(kinds []PieceKind, squares []uint64, strongKing, weakKing uint64, strongToMove bool) bool
+}
+
+// GenerateBitbase solves an ending by retrograde analysis: mates are seeded as wins, then
+// positions are resolved repeatedly (strong side to move wins if any move wins, defender to move
+// loses if every move loses) until nothing changes; the remainder are draws. Endings reached by
+// captures or promotions are generated first and consulted as sub-tables.
+func GenerateBitbase(signature string) (*Bitbase, error) {
+	return generateBitbase(signature, map[string]*Bitbase{})
+}
+
+func generateBitbase(signature string, done map[string]*Bitbase) (*Bitbase, error) {
+	table, err := newBitbase(signature)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := done[table.Signature]; ok {
+		return existing, nil
+	}
+
+	// Sub-tables: every ending reachable by one capture or promotion
+	for i, kind := range table.pieces {
+		rest := append(append([]PieceKind{}, table.pieces[:i]...), table.pieces[i+1:]...)
+		var reachable [][]PieceKind
+		reachable = append(reachable, rest)
+		if kind == Pawn {
+			reachable = append(reachable, append(append([]PieceKind{}, rest...), Queen), append(append([]PieceKind{}, rest...), Rook))
+		}
+		for _, pieces := range reachable {
+			if bitbaseIsDeadDraw(pieces) {
+				continue
+			}
+			if _, err := generateBitbase(bitbaseSignature(pieces), done); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	gen := &bitbaseGenerator{table: table, status: make([]uint8, table.size())}
+	gen.lookup = func(kinds []PieceKind, squares []uint64, strongKing, weakKing uint64, strongToMove bool) bool {
+		if bitbaseIsDeadDraw(kinds) {
+			return false
+		}
+		sub := done[bitbaseSignature(sortedKinds(kinds))]
+		return sub != nil && sub.probePlacement(kinds, squares, strongKing, weakKing, strongToMove)
+	}
+	gen.solve()
+	done[table.Signature] = table
+	return table, nil
+}
+
+func sortedKinds(kinds []PieceKind) []PieceKind {
+	sorted := append([]PieceKind{}, kinds...)
+	sort.SliceStable(sorted, func(i, j int) bool { return bitbasePieceOrder[sorted[i]] < bitbasePieceOrder[sorted[j]] })
+	return sorted
+}
+
+// bitbaseIsDeadDraw reports material the strong side can never win with against a lone king.
+func bitbaseIsDeadDraw(pieces []PieceKind) bool {
+	if len(pieces) == 0 {
+		return true
+	}
+	return len(pieces) == 1 && (pieces[0] == Bishop || pieces[0] == Knight)
+}
+
+// probePlacement looks up pieces given in any order.
+func (b *Bitbase) probePlacement(kinds []PieceKind, squares []uint64, strongKing, weakKing uint64, strongToMove bool) bool {
+	pl := bitbasePlacement{strongKing: strongKing, weakKing: weakKing, strongToMove: strongToMove}
+	used := make([]bool, len(kinds))
+	for i, want := range b.pieces {
+		for j, kind := range kinds {
+			if !used[j] && kind == want {
+				pl.pieces[i] = squares[j]
+				used[j] = true
+				break
+			}
+		}
+	}
+	return b.winsAt(b.index(pl))
+}
+
+func (g *bitbaseGenerator) solve() {
+	table := g.table
+	n := table.size()
+
+	// Seed: invalid positions, mates and stalemates
+	for idx := 0; idx < n; idx++ {
+		pl := table.placement(idx)
+		if !table.validPlacement(&pl) {
+			g.status[idx] = bbInvalid
+			continue
+		}
+		if !pl.strongToMove {
+			g.status[idx] = g.resolveDefender(&pl)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for idx := 0; idx < n; idx++ {
+			if g.status[idx] != bbUnknown {
+				continue
+			}
+			pl := table.placement(idx)
+			var result uint8
+			if pl.strongToMove {
+				result = g.resolveAttacker(&pl)
+			} else {
+				result = g.resolveDefender(&pl)
+			}
+			if result != bbUnknown {
+				g.status[idx] = result
+				changed = true
+			}
+		}
+	}
+
+	for idx, s := range g.status {
+		if s == bbWin {
+			table.wins[idx/64] |= 1 << (idx % 64)
+		}
+	}
+}
+
+// validPlacement rejects overlapping pieces, pawns on the back ranks, touching kings,
+// and the defender being in check with the strong side to move.
+func (b *Bitbase) validPlacement(pl *bitbasePlacement) bool {
+	occupancy := FromIndex(pl.strongKing)
+	if occupancy.IsSet(pl.weakKing) {
+		return false
+	}
+	occupancy = occupancy.Set(pl.weakKing)
+	for i, kind := range b.pieces {
+		sq := pl.pieces[i]
+		if occupancy.IsSet(sq) {
+			return false
+		}
+		if kind == Pawn && (sq < 8 || sq >= 56) {
+			return false
+		}
+		occupancy = occupancy.Set(sq)
+	}
+	if KingMoves[pl.strongKing].IsSet(pl.weakKing) {
+		return false
+	}
+	if pl.strongToMove && b.strongAttacks(pl, occupancy, -1).IsSet(pl.weakKing) {
+		return false
+	}
+	return true
+}
+
+func (b *Bitbase) occupancy(pl *bitbasePlacement) Bitboard {
+	occupancy := FromIndex(pl.strongKing).Set(pl.weakKing)
+	for i := range b.pieces {
+		occupancy = occupancy.Set(pl.pieces[i])
+	}
+	return occupancy
+}
+
+// resolveAttacker returns bbWin if some strong move reaches a won position.
+func (g *bitbaseGenerator) resolveAttacker(pl *bitbasePlacement) uint8 {
+	table := g.table
+	occupancy := table.occupancy(pl)
+	own := occupancy.Clear(pl.weakKing)
+
+	next := *pl
+	next.strongToMove = false
+	winsAfter := func(candidate bitbasePlacement) bool {
+		return g.status[table.index(candidate)] == bbWin
+	}
+
+	kingTargets := KingMoves[pl.strongKing] &^ own &^ KingMoves[pl.weakKing]
+	for targets := kingTargets; targets != 0; targets &= targets - 1 {
+		candidate := next
+		candidate.strongKing = targets.FirstSet()
+		if winsAfter(candidate) {
+			return bbWin
+		}
+	}
+
+	for i, kind := range table.pieces {
+		sq := pl.pieces[i]
+		var targets Bitboard
+		switch kind {
+		case Knight:
+			targets = KnightMoves[sq]
+		case Bishop:
+			targets = GetRayAttacks(sq, occupancy).Diagonal()
+		case Rook:
+			targets = GetRayAttacks(sq, occupancy).Orthogonal()
+		case Queen:
+			targets = GetRayAttacks(sq, occupancy).All()
+		case Pawn:
+			if one := sq + 8; !occupancy.IsSet(one) {
+				targets = targets.Set(one)
+				if two := sq + 16; sq < 16 && !occupancy.IsSet(two) {
+					targets = targets.Set(two)
+				}
+			}
+		}
+		targets &^= occupancy
+		for ; targets != 0; targets &= targets - 1 {
+			to := targets.FirstSet()
+			if kind == Pawn && to >= 56 {
+				// Promotion leaves this table: consult the queen and rook endings
+				kinds := append([]PieceKind{}, table.pieces...)
+				squares := append([]uint64{}, pl.pieces[:len(table.pieces)]...)
+				squares[i] = to
+				for _, promo := range []PieceKind{Queen, Rook} {
+					kinds[i] = promo
+					if g.lookup(kinds, squares, pl.strongKing, pl.weakKing, false) {
+						return bbWin
+					}
+				}
+				continue
+			}
+			candidate := next
+			candidate.pieces[i] = to
+			if winsAfter(candidate) {
+				return bbWin
+			}
+		}
+	}
+	return bbUnknown
+}
+
+// resolveDefender returns bbWin when every defender move loses, bbDraw for stalemate or a
+// move that escapes to a drawn ending, and bbUnknown otherwise.
+func (g *bitbaseGenerator) resolveDefender(pl *bitbasePlacement) uint8 {
+	table := g.table
+	occupancy := table.occupancy(pl)
+	withoutKing := occupancy.Clear(pl.weakKing)
+	inCheck := table.strongAttacks(pl, occupancy, -1).IsSet(pl.weakKing)
+	attacked := table.strongAttacks(pl, withoutKing, -1)
+
+	hasMove := false
+	allLose := true
+	for targets := KingMoves[pl.weakKing] &^ KingMoves[pl.strongKing]; targets != 0; targets &= targets - 1 {
+		to := targets.FirstSet()
+		captured := -1
+		for i := range table.pieces {
+			if pl.pieces[i] == to {
+				captured = i
+			}
+		}
+		if captured >= 0 {
+			if table.strongAttacks(pl, withoutKing, captured).IsSet(to) {
+				continue
+			}
+			hasMove = true
+			kinds := make([]PieceKind, 0, len(table.pieces)-1)
+			squares := make([]uint64, 0, len(table.pieces)-1)
+			for i, kind := range table.pieces {
+				if i != captured {
+					kinds = append(kinds, kind)
+					squares = append(squares, pl.pieces[i])
+				}
+			}
+			if !g.lookup(kinds, squares, pl.strongKing, to, true) {
+				return bbDraw
+			}
+			continue
+		}
+		if attacked.IsSet(to) {
+			continue
+		}
+		hasMove = true
+		candidate := *pl
+		candidate.weakKing = to
+		candidate.strongToMove = true
+		switch g.status[table.index(candidate)] {
+		case bbWin:
+		case bbDraw:
+			return bbDraw
+		default:
+			allLose = false
+		}
+	}
+	if !hasMove {
+		if inCheck {
+			return bbWin
+		}
+		return bbDraw
+	}
+	if allLose {
+		return bbWin
+	}
+	return bbUnknown
+}
+
+// WriteTo serializes the table: magic "CXBB", version, signature, bit count and the bitset.
+func (b *Bitbase) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	header := []byte("CXBB\x01")
+	header = append(header, byte(len(b.Signature)))
+	header = append(header, b.Signature...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(b.size()))
+	written, err := bw.Write(header)
+	if err != nil {
+		return int64(written), err
+	}
+	var buf [8]byte
+	for _, word := range b.wins {
+		binary.LittleEndian.PutUint64(buf[:], word)
+		n, err := bw.Write(buf[:])
+		written += n
+		if err != nil {
+			return int64(written), err
+		}
+	}
+	return int64(written), bw.Flush()
+}
+
+// ReadBitbase deserializes a table written by WriteTo.
+func ReadBitbase(r io.Reader) (*Bitbase, error) {
+	br := bufio.NewReader(r)
+	var header [6]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, fmt.Errorf("bitbase: reading header: %w", err)
+	}
+	if string(header[:5]) != "CXBB\x01" {
+		return nil, fmt.Errorf("bitbase: bad magic or version")
+	}
+	sig := make([]byte, header[5])
+	if _, err := io.ReadFull(br, sig); err != nil {
+		return nil, fmt.Errorf("bitbase: reading signature: %w", err)
+	}
+	b, err := newBitbase(string(sig))
+	if err != nil {
+		return nil, err
+	}
+	var count [4]byte
+	if _, err := io.ReadFull(br, count[:]); err != nil {
+		return nil, fmt.Errorf("bitbase: reading size: %w", err)
+	}
+	if int(binary.LittleEndian.Uint32(count[:])) != b.size() {
+		return nil, fmt.Errorf("bitbase: %s has %d entries, expected %d", b.Signature, binary.LittleEndian.Uint32(count[:]), b.size())
+	}
+	var buf [8]byte
+	for i := range b.wins {
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return nil, fmt.Errorf("bitbase: reading %s: %w", b.Signature, err)
+		}
+		b.wins[i] = binary.LittleEndian.Uint64(buf[:])
+	}
+	return b, nil
+}
+
+// bitbaseFileExtension is used by WriteBitbaseFiles and LoadBitbases.
+const bitbaseFileExtension = ".cxbb"
+
+var bitbases = struct {
+	sync.RWMutex
+	tables map[string]*Bitbase
+}{tables: map[string]*Bitbase{}}
+
+// RegisterBitbase makes a table available to EndgameProbe.
+func RegisterBitbase(b *Bitbase) {
+	bitbases.Lock()
+	defer bitbases.Unlock()
+	bitbases.tables[b.Signature] = b
+}
+
+// LoadBitbases registers every table file found in dir and returns the loaded signatures.
+func LoadBitbases(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+bitbaseFileExtension))
+	if err != nil {
+		return nil, err
+	}
+	var loaded []string
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return loaded, err
+		}
+		b, err := ReadBitbase(f)
+		f.Close()
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", path, err)
+		}
+		RegisterBitbase(b)
+		loaded = append(loaded, b.Signature)
+	}
+	return loaded, nil
+}
+
+// loadBitbaseDir loads the tables in dir, failing when there are none.
+func loadBitbaseDir(dir string) error {
+	loaded, err := LoadBitbases(dir)
+	if err == nil && len(loaded) == 0 {
+		err = fmt.Errorf("no %s files in %s", bitbaseFileExtension, dir)
+	}
+	return err
+}
+
+// WriteBitbaseFiles generates the given endings (and the sub-endings they depend on)
+// and writes one file per table into dir.
+func WriteBitbaseFiles(dir string, signatures ...string) error {
+	done := map[string]*Bitbase{}
+	for _, sig := range signatures {
+		if _, err := generateBitbase(sig, done); err != nil {
+			return err
+		}
+	}
+	for sig, b := range done {
+		f, err := os.Create(filepath.Join(dir, sig+bitbaseFileExtension))
+		if err != nil {
+			return err
+		}
+		if _, err := b.WriteTo(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EndgameProbe returns the result of a standard chess position from the side to move's point
+// of view, if a registered bitbase covers its material. Positions with castling rights are not covered.
+func EndgameProbe(pos *Position) (WDL, bool) {
+	if pos == nil || pos.variant != Standard || pos.castling != 0 {
+		return WDLDraw, false
+	}
+	var strong Color
+	switch {
+	case pos.whiteOccupancy.Count() == 1 && pos.blackOccupancy.Count() > 1:
+		strong = Black
+	case pos.blackOccupancy.Count() == 1 && pos.whiteOccupancy.Count() > 1:
+		strong = White
+	default:
+		return WDLDraw, false
+	}
+
+	var kinds []PieceKind
+	var squares []uint64
+	var strongKing, weakKing uint64
+	for i := range pos.pieces {
+		piece := &pos.pieces[i]
+		sq := piece.Location.FirstSet()
+		if strong == Black {
+			// Mirror vertically so that the strong side is always white
+			sq = flipRankIndex(sq)
+		}
+		switch {
+		case piece.Kind == King && piece.Color == strong:
+			strongKing = sq
+		case piece.Kind == King:
+			weakKing = sq
+		default:
+			kinds = append(kinds, piece.Kind)
+			squares = append(squares, sq)
+		}
+	}
+	if len(kinds) == 0 || len(kinds) > maxBitbasePieces {
+		return WDLDraw, false
+	}
+	strongToMove := pos.toMove == strong
+	if bitbaseIsDeadDraw(kinds) {
+		return WDLDraw, true
+	}
+
+	bitbases.RLock()
+	table := bitbases.tables[bitbaseSignature(sortedKinds(kinds))]
+	bitbases.RUnlock()
+	if table == nil {
+		return WDLDraw, false
+	}
+	if !table.probePlacement(kinds, squares, strongKing, weakKing, strongToMove) {
+		return WDLDraw, true
+	}
+	if strongToMove {
+		return WDLWin, true
+	}
+	return WDLLoss, true
+}
+
+// defaultBitbases are the endings "bitbase" writes when none are named.
+var defaultBitbases = []string{"KPK", "KQK", "KRK", "KBNK"}
+
+// runBitbase implements "bitbase [-dir DIR] [SIGNATURE...]", generating bitbases and
+// writing them to files that BitbasePath and -bitbases load.
+func runBitbase(args []string, out io.Writer) error {
+	flags := commandFlags("bitbase", out)
+	dir := flags.String("dir", "bitbases", "directory to write the tables to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	signatures := flags.Args()
+	if len(signatures) == 0 {
+		signatures = defaultBitbases
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := WriteBitbaseFiles(*dir, signatures...); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Wrote %s to %s in %v\n", strings.Join(signatures, ", "), *dir, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+)
+
+func registerTestBitbases(t *testing.T, signatures ...string) {
+	t.Helper()
+	done := map[string]*Bitbase{}
+	for _, sig := range signatures {
+		if _, err := generateBitbase(sig, done); err != nil {
+			t.Fatalf("generate %s: %v", sig, err)
+		}
+	}
+	for _, b := range done {
+		RegisterBitbase(b)
+	}
+}
+
+func TestGenerateBitbase_KPKStatistics(t *testing.T) {
+	b, err := GenerateBitbase("KPK")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	// Legal position counts match the published KPK totals (331,352 positions), and the win
+	// counts agree with the reference solve of TestKPK_AgainstMoveGenerator.
+	cases := []struct {
+		strongToMove bool
+		legal, wins  int
+	}{
+		{true, 163328, 124960},
+		{false, 168024, 97604},
+	}
+	for _, tc := range cases {
+		legal, wins := 0, 0
+		for wk := uint64(0); wk < 64; wk++ {
+			for p := uint64(8); p < 56; p++ {
+				for bk := uint64(0); bk < 64; bk++ {
+					pl := bitbasePlacement{strongKing: wk, weakKing: bk, strongToMove: tc.strongToMove}
+					pl.pieces[0] = p
+					if !b.validPlacement(&pl) {
+						continue
+					}
+					legal++
+					if b.probePlacement([]PieceKind{Pawn}, []uint64{p}, wk, bk, tc.strongToMove) {
+						wins++
+					}
+				}
+			}
+		}
+		if legal != tc.legal || wins != tc.wins {
+			t.Errorf("strongToMove=%v: legal=%d wins=%d, want legal=%d wins=%d", tc.strongToMove, legal, wins, tc.legal, tc.wins)
+		}
+	}
+}
+
+func TestEndgameProbe_KnownPositions(t *testing.T) {
+	registerTestBitbases(t, "KPK", "KQK", "KRK")
+	cases := []struct {
+		name string
+		fen  string
+		want WDL
+	}{
+		{"rook pawn, king in the corner", "k7/8/8/P7/1K6/8/8/8 w - - 0 1", WDLDraw},
+		{"rook pawn, king in the corner, black to move", "k7/8/8/P7/1K6/8/8/8 b - - 0 1", WDLDraw},
+		{"king on key square", "4k3/8/4K3/8/4P3/8/8/8 w - - 0 1", WDLWin},
+		{"king on key square, black to move", "4k3/8/4K3/8/4P3/8/8/8 b - - 0 1", WDLLoss},
+		{"defender has the opposition", "8/4k3/8/4K3/4P3/8/8/8 w - - 0 1", WDLDraw},
+		{"attacker has the opposition", "8/4k3/8/4K3/4P3/8/8/8 b - - 0 1", WDLLoss},
+		{"mirrored: black pawn, defender has the opposition", "8/8/8/4p3/4k3/8/4K3/8 b - - 0 1", WDLDraw},
+		{"mirrored: black pawn, attacker has the opposition", "8/8/8/4p3/4k3/8/4K3/8 w - - 0 1", WDLLoss},
+		{"queen wins", "8/8/8/3k4/8/8/8/KQ6 w - - 0 1", WDLWin},
+		{"hanging queen is taken", "8/8/8/8/8/8/1k6/KQ6 b - - 0 1", WDLDraw},
+		{"stalemate", "k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", WDLDraw},
+		{"rook mate", "k7/8/1K6/8/8/8/8/R7 b - - 0 1", WDLLoss},
+		{"lone bishop", "k7/8/1K6/8/8/8/8/B7 w - - 0 1", WDLDraw},
+	}
+	for _, tc := range cases {
+		pos, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatalf("%s: parse fen: %v", tc.name, err)
+		}
+		got, ok := EndgameProbe(pos)
+		if !ok {
+			t.Errorf("%s: expected probe to succeed", tc.name)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	unsupported, _ := ParseFEN("4k3/4q3/8/8/8/8/4Q3/4K3 w - - 0 1")
+	if _, ok := EndgameProbe(unsupported); ok {
+		t.Errorf("expected no probe result for KQKQ")
+	}
+}
+
+// TestEndgameProbe_ConsistentWithLegalMoves checks sampled positions against the move
+// generator: a win needs a move to a lost position, a loss needs every move to reach a win.
+func TestEndgameProbe_ConsistentWithLegalMoves(t *testing.T) {
+	registerTestBitbases(t, "KPK", "KQK", "KRK")
+	rng := rand.New(rand.NewSource(7))
+	kinds := []PieceKind{Pawn, Rook, Queen}
+	checked := 0
+	for checked < 600 {
+		kind := kinds[checked%len(kinds)]
+		pos := NewPosition()
+		squares := rng.Perm(64)[:3]
+		pos.SetPiece(squares[0]%8, squares[0]/8, King, White)
+		pos.SetPiece(squares[1]%8, squares[1]/8, kind, White)
+		pos.SetPiece(squares[2]%8, squares[2]/8, King, Black)
+		if rng.Intn(2) == 0 {
+			pos.SetToMove(Black)
+		}
+		if kind == Pawn && (squares[1]/8 == 0 || squares[1]/8 == 7) {
+			continue
+		}
+		if KingMoves[uint64(squares[0])].IsSet(uint64(squares[2])) || pos.IsKingInCheck(pos.toMove.Opponent()) {
+			continue
+		}
+		result, ok := EndgameProbe(pos)
+		if !ok {
+			t.Fatalf("probe failed for %s", pos.FEN())
+		}
+		legal := generateLegalMoves(pos)
+		if len(legal) == 0 {
+			want := WDLDraw
+			if pos.IsKingInCheck(pos.toMove) {
+				want = WDLLoss
+			}
+			if result != want {
+				t.Fatalf("%s: no moves, got %s want %s", pos.FEN(), result, want)
+			}
+			checked++
+			continue
+		}
+		best := WDLLoss
+		for _, ap := range legal {
+			after, ok := EndgameProbe(ap.Position)
+			if !ok {
+				// Captures of the only piece leave bare kings
+				after = WDLDraw
+			}
+			if -after > best {
+				best = -after
+			}
+		}
+		if best != result {
+			t.Fatalf("%s: probe says %s but best move gives %s", pos.FEN(), result, best)
+		}
+		checked++
+	}
+}
+
+func TestSearch_UsesBitbases(t *testing.T) {
+	registerTestBitbases(t, "KPK")
+	// Only Kb2 keeps the win; a shallow search without the bitbase plays Kb1
+	pos, _ := ParseFEN("8/8/8/8/5k2/8/3P4/K7 w - - 0 1")
+	if ap, _ := (Dumbfish{Depth: 2}).SelectMove(pos); ap.Move.UCINotation() != "a1b2" {
+		t.Errorf("root move %s, want the only winning move a1b2", ap.Move.UCINotation())
+	}
+
+	cases := []struct {
+		fen      string
+		win      bool
+		bestMove string
+	}{
+		{"4k3/8/4K3/8/4P3/8/8/8 w - - 0 1", true, "e4e5"},
+		{"k7/8/8/P7/1K6/8/8/8 w - - 0 1", false, ""},
+	}
+	for _, tc := range cases {
+		pos, _ := ParseFEN(tc.fen)
+		var last SearchInfo
+		ap, ok := Dumbfish{}.Search(t.Context(), pos, SearchLimits{Depth: 3}, func(info SearchInfo) { last = info })
+		if !ok {
+			t.Fatalf("%s: no move", tc.fen)
+		}
+		if tc.win && (last.Score.Centipawns < tbWinScore-maxSearchPly || ap.Move.UCINotation() != tc.bestMove) {
+			t.Errorf("%s: %s with score %+v, want %s with a bitbase win", tc.fen, ap.Move.UCINotation(), last.Score, tc.bestMove)
+		}
+		if !tc.win && last.Score != (Score{}) {
+			t.Errorf("%s: score %+v, want the bitbase draw", tc.fen, last.Score)
+		}
+	}
+}
+
+func TestBitbase_SerializationRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteBitbaseFiles(dir, "KRK"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	loaded, err := LoadBitbases(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	sort.Strings(loaded)
+	if len(loaded) != 1 || loaded[0] != "KRK" {
+		t.Fatalf("expected KRK to be loaded, got %v", loaded)
+	}
+
+	original, err := GenerateBitbase("KRK")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := original.WriteTo(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	data := buf.Bytes()
+	read, err := ReadBitbase(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	for i := range original.wins {
+		if original.wins[i] != read.wins[i] {
+			t.Fatalf("word %d differs after round trip", i)
+		}
+	}
+	if _, err := ReadBitbase(bytes.NewReader(data[:len(data)-3])); err == nil {
+		t.Fatalf("expected error for truncated table")
+	}
+}
+
+func TestParseBitbaseSignature(t *testing.T) {
+	pieces, err := parseBitbaseSignature("knbk")
+	if err != nil || bitbaseSignature(pieces) != "KBNK" {
+		t.Fatalf("expected KNBK to normalize to KBNK, got %v, %v", pieces, err)
+	}
+	for _, bad := range []string{"KK", "QK", "KQRPK", "KXK"} {
+		if _, err := parseBitbaseSignature(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestGenerateBitbase_KBNK(t *testing.T) {
+	if os.Getenv("CHESSX_SLOW") != "1" {
+		t.Skip("CHESSX_SLOW env not set; skipping KBNK generation (about 30s)")
+	}
+	registerTestBitbases(t, "KBNK")
+	pos, err := ParseFEN("7k/8/5KBN/8/8/8/8/8 w - - 0 1")
+	if err != nil {
+		t.Fatalf("parse fen: %v", err)
+	}
+	if got, ok := EndgameProbe(pos); !ok || got != WDLWin {
+		t.Fatalf("expected KBNK win, got %s, %v", got, ok)
+	}
+	// The defender to move takes the undefended knight
+	fork, err := ParseFEN("8/8/8/8/8/2k5/2N5/K1B5 b - - 0 1")
+	if err != nil {
+		t.Fatalf("parse fen: %v", err)
+	}
+	if got, ok := EndgameProbe(fork); !ok || got != WDLDraw {
+		t.Fatalf("expected draw after the knight falls, got %s, %v", got, ok)
+	}
+}
+
+// TestKPK_AgainstMoveGenerator solves KPK again by plain iteration over the legal moves of
+// every position, with no code from the bitbase generator, and compares the win counts.
+// Promotions are scored directly: KQK and KRK are won unless the new piece hangs or the
+// defender is stalemated.
+func TestKPK_AgainstMoveGenerator(t *testing.T) {
+	const unknown, win, notWin = 0, 1, 2
+	key := func(wk, p, bk uint64, whiteToMove bool) int {
+		k := int(wk)<<12 | int(p)<<6 | int(bk)
+		if whiteToMove {
+			k |= 1 << 18
+		}
+		return k
+	}
+	type node struct {
+		key      int
+		children []int // keys of the positions reached, or -1 for a win and -2 for a draw
+	}
+	var nodes []node
+	legalCounts := map[bool]int{}
+	result := make([]uint8, 1<<19)
+	for _, whiteToMove := range []bool{true, false} {
+		for wk := uint64(0); wk < 64; wk++ {
+			for p := uint64(8); p < 56; p++ {
+				for bk := uint64(0); bk < 64; bk++ {
+					if wk == p || wk == bk || p == bk || KingMoves[wk].IsSet(bk) {
+						continue
+					}
+					pos := NewPosition()
+					pos.SetPiece(int(wk%8), int(wk/8), King, White)
+					pos.SetPiece(int(p%8), int(p/8), Pawn, White)
+					pos.SetPiece(int(bk%8), int(bk/8), King, Black)
+					if !whiteToMove {
+						pos.SetToMove(Black)
+					}
+					if pos.IsKingInCheck(pos.toMove.Opponent()) {
+						continue
+					}
+					legalCounts[whiteToMove]++
+					n := node{key: key(wk, p, bk, whiteToMove)}
+					legal := generateLegalMoves(pos)
+					if len(legal) == 0 {
+						result[n.key] = notWin
+						if pos.IsKingInCheck(Black) {
+							result[n.key] = win
+						}
+						continue
+					}
+					for _, ap := range legal {
+						n.children = append(n.children, kpkChild(ap))
+					}
+					nodes = append(nodes, n)
+				}
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, n := range nodes {
+			if result[n.key] != unknown {
+				continue
+			}
+			whiteToMove := n.key&(1<<18) != 0
+			wins := 0
+			for _, child := range n.children {
+				if child == -1 || child >= 0 && result[child] == win {
+					wins++
+				}
+			}
+			if whiteToMove && wins > 0 || !whiteToMove && wins == len(n.children) {
+				result[n.key], changed = win, true
+			}
+		}
+	}
+
+	counts := map[bool]int{}
+	for k, r := range result {
+		if r == win {
+			counts[k&(1<<18) != 0]++
+		}
+	}
+	if legalCounts[true] != 163328 || legalCounts[false] != 168024 {
+		t.Errorf("reference solve: %d and %d legal positions, want 163328 and 168024", legalCounts[true], legalCounts[false])
+	}
+	if counts[true] != 124960 || counts[false] != 97604 {
+		t.Errorf("reference solve: %d wins with White to move, %d with Black, want 124960 and 97604", counts[true], counts[false])
+	}
+}
+
+// kpkChild returns the key of the KPK position a move reaches, or -1 when it promotes to a
+// won KQK or KRK and -2 when it leaves a draw.
+func kpkChild(ap AppliedMove) int {
+	after := ap.Position
+	var wk, p, bk uint64 = 64, 64, 64
+	promoted := false
+	for _, piece := range after.pieces {
+		if piece.Location.IsEmpty() {
+			continue
+		}
+		switch {
+		case piece.Kind == King && piece.Color == White:
+			wk = piece.Location.FirstSet()
+		case piece.Kind == King:
+			bk = piece.Location.FirstSet()
+		case piece.Kind == Pawn:
+			p = piece.Location.FirstSet()
+		default:
+			promoted = true
+		}
+	}
+	if promoted {
+		if ap.Move.Promotion != Queen && ap.Move.Promotion != Rook {
+			return -2
+		}
+		replies := generateLegalMoves(after)
+		if len(replies) == 0 {
+			if after.IsKingInCheck(Black) {
+				return -1
+			}
+			return -2
+		}
+		for _, reply := range replies {
+			if reply.Move.IsCapture {
+				return -2
+			}
+		}
+		return -1
+	}
+	if p == 64 {
+		return -2 // the pawn was taken
+	}
+	k := int(wk)<<12 | int(p)<<6 | int(bk)
+	if after.toMove == White {
+		k |= 1 << 18
+	}
+	return k
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// command is a chessx subcommand.
+type command struct {
+	name    string
+	args    string // the arguments shown after the name in its usage line
+	summary string
+	run     func(args []string, in io.Reader, out io.Writer) error
+}
+
+// commands returns the subcommands in the order "chessx help" lists them. It is a function
+// rather than a variable because the commands look themselves up for their help text.
+func commands() []command {
+	return []command{
+		{"play", "[-fen FEN] [-color white|black|random] [-engine NAME] [-tc 300+3]", "play an engine in the terminal", runPlay},
+		{"uci", "", "speak UCI to a chess GUI", runUCICommand},
+		{"xboard", "[-engine NAME] [-options Name=Value,...]", "speak CECP to XBoard, WinBoard or an ICS bridge", runXBoard},
+		{"perft", "[-depth N] [FEN]", "count the move paths of a given length from a position", withoutInput(runPerft)},
+		{"divide", "[-depth N] [FEN]", "count the move paths of a given length after each legal move", withoutInput(runDivide)},
+		{"eval", "[FEN]", "show the static evaluation of a position term by term", withoutInput(runEval)},
+		{"analyze", "[-multipv N] [-depth D] [-threads T] FEN", "show the best lines for a position", withoutInput(runAnalyze)},
+		{"pgn", "[-out FILE] [-fen] FILE...", "check the games in PGN files and write them out again", withoutInput(runPGN)},
+		{"bench", "[-depth D]", "search a fixed set of positions and print node counts", withoutInput(runBench)},
+		{"serve", "[-addr HOST:PORT] [-engine NAME] ...", "serve a JSON API for web tools", withoutInput(runServe)},
+		{"live", "[-addr HOST:PORT] [-color white|black] [-tc TC] ...", "play an engine on a board in the browser while others watch", withoutInput(runLive)},
+		{"lichess", "[-token T] [-url URL] ...", "play on Lichess as a bot account", withoutInput(runLichess)},
+		{"ics", "[-addr HOST:PORT] [-handle H -password P] ...", "play on an Internet Chess Server such as FICS", withoutInput(runICS)},
+		{"correspondence", "-player NAME=TOKEN ... [-store FILE]", "host correspondence games between players", withoutInput(runCorrespondence)},
+		{"bitbase", "[-dir DIR] [SIGNATURE...]", "generate endgame bitbases such as KPK and write them to files", withoutInput(runBitbase)},
+		{"probe", "[-syzygy DIR] FEN", "probe Syzygy tablebases for a position", withoutInput(runProbe)},
+		{"tune", "-data FILE [-out FILE] [-method gd|local]", "fit the evaluation parameters to labelled positions", withoutInput(runTune)},
+		{"selfplay", "[-games N] [-pgn FILE] [-data FILE] ...", "play Dumbfish against itself for training data", withoutInput(runSelfPlay)},
+		{"match", "[-engine1 NAME] [-engine2 NAME] [-games N] [-tc TC] [-sprt]", "play a match between two engines", withoutInput(runMatch)},
+		{"tournament", "-player NAME=SPEC[@OPTIONS] ... [-format roundrobin|swiss]", "run a tournament between engine configurations", withoutInput(runTournament)},
+		{"engines", "", "list the engines that can be selected by name", withoutInput(runEngines)},
+		{"help", "[COMMAND]", "show the commands, or the flags of one", runHelp},
+	}
+}
+
+// withoutInput adapts a command that does not read standard input.
+func withoutInput(run func(args []string, out io.Writer) error) func([]string, io.Reader, io.Writer) error {
+	return func(args []string, in io.Reader, out io.Writer) error { return run(args, out) }
+}
+
+// lookupCommand returns the subcommand called name.
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// commandFlags returns the flag set of the subcommand called name, which prints the
+// command's usage line, summary and flags to out when asked for help or given a bad flag.
+func commandFlags(name string, out io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		cmd, _ := lookupCommand(name)
+		fmt.Fprintf(out, "Usage: chessx %s\n\n%s.\n", strings.TrimSpace(name+" "+cmd.args), capitalize(cmd.summary))
+		hasFlags := false
+		flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(out, "\nFlags:")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// runCLI runs the subcommand named by args[0]. With no arguments, or flags only, it plays
+// in the terminal as chessx always has. Asking for help is not an error.
+func runCLI(args []string, in io.Reader, out io.Writer) error {
+	name := "play"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := lookupCommand(name)
+	if !ok {
+		return fmt.Errorf("unknown command %q (run \"chessx help\" for a list)", name)
+	}
+	if err := cmd.run(args, in, out); !errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return nil
+}
+
+// runHelp implements "help [COMMAND]", listing the commands or showing one's usage.
+func runHelp(args []string, in io.Reader, out io.Writer) error {
+	flags := commandFlags("help", out)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if args = flags.Args(); len(args) > 0 {
+		cmd, ok := lookupCommand(args[0])
+		if !ok {
+			return fmt.Errorf("unknown command %q", args[0])
+		}
+		return cmd.run([]string{"-help"}, in, out)
+	}
+	fmt.Fprint(out, "chessx plays, analyzes and serves chess.\n\nUsage: chessx <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(out, "  %-15s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprint(out, "\nWithout a command chessx plays in the terminal. Run \"chessx help <command>\" for the flags of a command.\n")
+	return nil
+}
+
+// runEngines implements "engines", listing the engines that -engine flags accept by name.
+func runEngines(args []string, out io.Writer) error {
+	flags := commandFlags("engines", out)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	for _, e := range engineRegistry {
+		fmt.Fprintf(out, "  %-12s %s\n", e.name, e.description)
+	}
+	fmt.Fprintln(out, "\nAny other engine name is run as the command line of a UCI engine.")
+	return nil
+}
+
+// runUCICommand implements "uci", speaking UCI on standard input and output.
+func runUCICommand(args []string, in io.Reader, out io.Writer) error {
+	flags := commandFlags("uci", out)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return RunUCI(in, out)
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// runAnalyze implements "analyze [-multipv N] [-depth D] [-threads T] <fen>", printing the best lines
+// of the deepest completed iteration in SAN.
+func runAnalyze(args []string, out io.Writer) error {
+	flags := commandFlags("analyze", out)
+	multiPV := flags.Int("multipv", 3, "number of lines to show")
+	depth := flags.Int("depth", 4, "search depth in plies")
+	threads := flags.Int("threads", 1, "search threads")
+	bitbaseDir := flags.String("bitbases", "", `directory of endgame bitbases written by "chessx bitbase"`)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *bitbaseDir != "" {
+		if err := loadBitbaseDir(*bitbaseDir); err != nil {
+			return err
+		}
+	}
+	if flags.NArg() == 0 {
+		return errors.New("usage: analyze [-multipv N] [-depth D] [-threads T] <fen>")
+	}
+	pos, err := ParseFEN(strings.Join(flags.Args(), " "))
+	if err != nil {
+		return err
+	}
+
+	var lines []SearchInfo
+	limits := SearchLimits{Depth: max(*depth, 1), MultiPV: max(*multiPV, 1)}
+	_, ok := Dumbfish{Threads: *threads}.Search(context.Background(), pos, limits, func(info SearchInfo) {
+		if info.MultiPV == 1 {
+			lines = lines[:0]
+		}
+		lines = append(lines, info)
+	})
+	if !ok {
+		return errors.New("no legal moves")
+	}
+	fmt.Fprintf(out, "Depth %d, %d nodes\n", lines[0].Depth, lines[len(lines)-1].Nodes)
+	for _, line := range lines {
+		fmt.Fprintf(out, "%2d. %6s  %s\n", line.MultiPV, line.Score, formatSANLine(pos, line.PV))
+	}
+	return nil
+}
+
+// benchFENs are the positions searched by "bench": openings, middlegames and endgames.
+var benchFENs = []string{
+	standardStartFEN,
+	"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+	"r3k2r/pp1n1ppp/2pbpn2/q7/2PP4/2N1PN2/PP1B1PPP/R2QKB1R w KQkq - 2 9",
+	"r1bq1rk1/pp2bppp/2n1pn2/3p4/2PP4/2N1PN2/PP2BPPP/R2QKB1R w KQ - 0 8",
+	"2r3k1/pp3ppp/2n1b3/3p4/3P4/2PB1N2/P4PPP/R5K1 b - - 0 20",
+	"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	"8/8/4k3/3p4/3P4/4K3/8/8 w - - 0 1",
+}
+
+// runBench implements "bench [-depth D]", searching benchFENs to a fixed depth on one
+// thread and printing the nodes searched. Single-threaded search is deterministic, so the
+// total changes exactly when the search does and shows regressions in pruning or ordering.
+func runBench(args []string, out io.Writer) error {
+	flags := commandFlags("bench", out)
+	depth := flags.Int("depth", 6, "search depth in plies")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	total := 0
+	start := time.Now()
+	for i, fen := range benchFENs {
+		pos, err := ParseFEN(fen)
+		if err != nil {
+			return err
+		}
+		nodes := 0
+		engine := Dumbfish{Hash: NewTranspositionTable(defaultHashMB)}
+		engine.Search(context.Background(), pos, SearchLimits{Depth: max(*depth, 1)}, func(info SearchInfo) {
+			nodes = info.Nodes
+		})
+		fmt.Fprintf(out, "%2d. %9d nodes  %s\n", i+1, nodes, fen)
+		total += nodes
+	}
+	elapsed := time.Since(start)
+	fmt.Fprintf(out, "Total: %d nodes in %v (%d nps)\n", total, elapsed.Round(time.Millisecond),
+		int(float64(total)/max(elapsed.Seconds(), 1e-9)))
+	return nil
+}
+
+// stringList is a flag that can be given several times.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// positionArgs reads the position given as the remaining arguments of a command, which may
+// be a FEN split over several arguments, or the standard start position when there are none.
+func positionArgs(args []string) (*Position, error) {
+	if len(args) == 0 {
+		return NewVariantPosition(Standard), nil
+	}
+	pos, err := ParseFEN(strings.Join(args, " "))
+	if err != nil {
+		return nil, fmt.Errorf("parse FEN: %w", err)
+	}
+	return pos, nil
+}
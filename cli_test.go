@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCommand runs chessx with args and input, returning what it printed.
+func runCommand(t *testing.T, input string, args ...string) string {
+	t.Helper()
+	var out strings.Builder
+	if err := runCLI(args, strings.NewReader(input), &out); err != nil {
+		t.Fatalf("chessx %s: %v\n%s", strings.Join(args, " "), err, out.String())
+	}
+	return out.String()
+}
+
+func TestCLI_Help(t *testing.T) {
+	list := runCommand(t, "", "help")
+	for _, cmd := range commands() {
+		if !strings.Contains(list, "  "+cmd.name+" ") {
+			t.Errorf("help lacks %s:\n%s", cmd.name, list)
+		}
+	}
+	// Every command explains itself, whether asked with help or -h
+	for _, cmd := range commands() {
+		usage := runCommand(t, "", "help", cmd.name)
+		if !strings.HasPrefix(usage, "Usage: chessx "+cmd.name) || !strings.Contains(usage, capitalize(cmd.summary)) {
+			t.Errorf("help %s:\n%s", cmd.name, usage)
+		}
+		if got := runCommand(t, "", cmd.name, "-h"); got != usage {
+			t.Errorf("%s -h:\n%s\nwant\n%s", cmd.name, got, usage)
+		}
+	}
+	if usage := runCommand(t, "", "help", "play"); !strings.Contains(usage, "-tc string") || !strings.Contains(usage, "-color string") {
+		t.Errorf("play flags:\n%s", usage)
+	}
+	// Every -tc flag takes the same unit
+	for _, name := range []string{"play", "live", "match", "tournament"} {
+		if usage := runCommand(t, "", "help", name); !strings.Contains(usage, "time control in seconds") {
+			t.Errorf("%s -tc does not say it takes seconds:\n%s", name, usage)
+		}
+	}
+
+	var out strings.Builder
+	if err := runCLI([]string{"castle"}, strings.NewReader(""), &out); err == nil {
+		t.Error("unknown command accepted")
+	}
+	if err := runCLI([]string{"perft", "-deep", "3"}, strings.NewReader(""), &out); err == nil {
+		t.Error("unknown flag accepted")
+	}
+}
+
+func TestCLI_PerftDivideEval(t *testing.T) {
+	kiwipete := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+	if out := runCommand(t, "", "perft", "-depth", "3"); !strings.HasPrefix(out, "Depth 3: 8902 nodes") {
+		t.Errorf("perft: %s", out)
+	}
+	if out := runCommand(t, "", append([]string{"perft", "-depth", "2"}, strings.Fields(kiwipete)...)...); !strings.HasPrefix(out, "Depth 2: 2039 nodes") {
+		t.Errorf("perft of a FEN: %s", out)
+	}
+	out := runCommand(t, "", "divide", "-depth", "2", kiwipete)
+	if !strings.Contains(out, "e1g1: 43\n") || !strings.HasSuffix(out, "\nMoves: 48\nNodes: 2039\n") || strings.Index(out, "a1b1") > strings.Index(out, "e1c1") {
+		t.Errorf("divide:\n%s", out)
+	}
+
+	out = runCommand(t, "", "eval", "4k3/8/8/8/8/8/8/3QK3 b - - 0 1")
+	for _, want := range []string{"Phase: 4 ", "Material          ", "For the side to move: -", "(Black)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("eval lacks %q:\n%s", want, out)
+		}
+	}
+	var buf strings.Builder
+	if err := runCLI([]string{"eval", "not", "a", "fen"}, strings.NewReader(""), &buf); err == nil {
+		t.Error("bad FEN accepted")
+	}
+}
+
+func TestCLI_PGN(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.pgn")
+	pgn := `[White "A"]
+[Black "B"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+
+[White "C"]
+[Black "D"]
+[Result "*"]
+
+1. e4 e5 2. Ke3 *
+`
+	if err := os.WriteFile(in, []byte(pgn), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, "out.pgn")
+	var out strings.Builder
+	err := runCLI([]string{"pgn", "-fen", "-out", outPath, in}, strings.NewReader(""), &out)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 games") {
+		t.Errorf("error %v", err)
+	}
+	for _, want := range []string{"game 1 (A - B): 4 plies, 0-1", "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", "game 2 (C - D): ply 3:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+	written, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "1. f3 e5 2. g4 Qh4# 0-1") || strings.Contains(string(written), "Ke3") {
+		t.Errorf("written games:\n%s", written)
+	}
+}
+
+func TestCLI_Play(t *testing.T) {
+	// Fool's mate played by the person as Black, against a random White
+	out := runCommand(t, "e5\nQh4#\nq\n", "play", "-color", "black", "-engine", "random",
+		"-fen", "rnbqkbnr/pppppppp/8/8/6P1/5P2/PPPPP2P/RNBQKBNR w KQkq - 0 2")
+	if !strings.Contains(out, "You play Black against Random") || !strings.Contains(out, "1  R  N  B  K  Q  B  N  R    White  <") {
+		t.Errorf("play:\n%s", out)
+	}
+
+	// Dumbfish answers, a bad move is reported, and resigning ends the game
+	out = runCommand(t, "e4\nKe3\n\nresign\n", "play", "-tc", "3+1")
+	for _, want := range []string{"Dumbfish is thinking", `illegal move "Ke3". Press Enter`, "White  0:0", "Game over: 0-1 (White resigned)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("play lacks %q:\n%s", want, out)
+		}
+	}
+	// Input ends the game quietly
+	runCommand(t, "", "play", "-engine", "random")
+
+	var buf strings.Builder
+	for _, args := range [][]string{{"-color", "green"}, {"-tc", "fast"}, {"-board", "fancy"}, {"-engine", "random", "-options", "Hash=1"}} {
+		if err := runCLI(append([]string{"play"}, args...), strings.NewReader(""), &buf); err == nil {
+			t.Errorf("play %v accepted", args)
+		}
+	}
+}
+
+func TestCLI_Bitbase(t *testing.T) {
+	dir := t.TempDir()
+	if out := runCommand(t, "", "bitbase", "-dir", dir, "KPK"); !strings.HasPrefix(out, "Wrote KPK to ") {
+		t.Errorf("bitbase: %s", out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "KPK.cxbb")); err != nil {
+		t.Fatal(err)
+	}
+	if out := runCommand(t, "", "analyze", "-bitbases", dir, "-depth", "1", "-multipv", "1", "4k3/8/4K3/8/4P3/8/8/8 w - - 0 1"); !strings.Contains(out, "+899.99  1. e5") {
+		t.Errorf("analyze with bitbases:\n%s", out)
+	}
+	if _, _, err := openEngine("dumbfish", "BitbasePath="+t.TempDir()); err == nil {
+		t.Error("empty bitbase directory accepted")
+	}
+}
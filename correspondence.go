@@ -0,0 +1,557 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CorrespondenceGame is a stored correspondence game. Each move must be made within
+// DaysPerMove days of the previous one, or the side to move loses on time. Games created
+// with a DaysPerMove of 0 have no time limit.
+type CorrespondenceGame struct {
+	ID          string    `json:"id"`
+	White       string    `json:"white"`
+	Black       string    `json:"black"`
+	StartFEN    string    `json:"startFen"`
+	Moves       []string  `json:"moves"`       // in UCI
+	DaysPerMove int       `json:"daysPerMove"` // 0 = no time limit
+	Created     time.Time `json:"created"`
+	Deadline    time.Time `json:"deadline,omitzero"` // when the side to move forfeits, while the game is on
+	Result      string    `json:"result"`            // "*" while the game is on
+	Reason      string    `json:"reason,omitempty"`
+	DrawOffer   string    `json:"drawOffer,omitempty"` // the player offering a draw
+}
+
+// replay rebuilds the game's moves and off-board result.
+func (g *CorrespondenceGame) replay() (*Game, error) {
+	start, err := ParseFEN(g.StartFEN)
+	if err != nil {
+		return nil, fmt.Errorf("game %s: %w", g.ID, err)
+	}
+	game := NewGame(start, nil)
+	for _, uci := range g.Moves {
+		ap, ok := findUCIMove(game.Position(), uci)
+		if !ok {
+			return nil, fmt.Errorf("game %s: illegal move %s", g.ID, uci)
+		}
+		game.Play(ap)
+	}
+	if result := parseGameResult(g.Result); result != Ongoing {
+		game.End(Outcome{Result: result, Reason: g.Reason})
+	}
+	return game, nil
+}
+
+// player returns the player of color.
+func (g *CorrespondenceGame) player(color Color) string {
+	if color == White {
+		return g.White
+	}
+	return g.Black
+}
+
+// color returns the color player has, and false when player is not in the game.
+func (g *CorrespondenceGame) color(player string) (Color, bool) {
+	switch player {
+	case g.White:
+		return White, true
+	case g.Black:
+		return Black, true
+	}
+	return White, false
+}
+
+// settle records a result the moves or the deadline have decided.
+func (g *CorrespondenceGame) settle(game *Game, now time.Time) {
+	if g.Result != "*" {
+		return
+	}
+	outcome := game.Outcome()
+	if !outcome.IsOver() && !g.Deadline.IsZero() && now.After(g.Deadline) {
+		outcome = Outcome{Result: winnerAgainst(game.Position().toMove), Reason: "time forfeit"}
+		game.End(outcome)
+	}
+	if outcome.IsOver() {
+		g.Result, g.Reason, g.DrawOffer, g.Deadline = outcome.Result.String(), outcome.Reason, "", time.Time{}
+	}
+}
+
+// CorrespondenceStore keeps correspondence games in a JSON file, rewritten in full after
+// every change. It is safe for concurrent use.
+type CorrespondenceStore struct {
+	path string
+
+	mu     sync.Mutex
+	nextID int
+	games  map[string]*CorrespondenceGame
+}
+
+// correspondenceFile is the store's file format.
+type correspondenceFile struct {
+	NextID int                   `json:"nextId"`
+	Games  []*CorrespondenceGame `json:"games"`
+}
+
+// OpenCorrespondenceStore loads the store at path, which is created on the first change
+// if it does not exist.
+func OpenCorrespondenceStore(path string) (*CorrespondenceStore, error) {
+	s := &CorrespondenceStore{path: path, nextID: 1, games: map[string]*CorrespondenceGame{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file correspondenceFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.nextID = max(file.NextID, 1)
+	for _, g := range file.Games {
+		s.games[g.ID] = g
+	}
+	return s, nil
+}
+
+// save writes every game, through a temporary file so a crash cannot leave half a store.
+func (s *CorrespondenceStore) save() error {
+	file := correspondenceFile{NextID: s.nextID}
+	for _, g := range s.games {
+		file.Games = append(file.Games, g)
+	}
+	slices.SortFunc(file.Games, compareCorrespondenceIDs)
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func compareCorrespondenceIDs(a, b *CorrespondenceGame) int {
+	x, _ := strconv.Atoi(a.ID)
+	y, _ := strconv.Atoi(b.ID)
+	return x - y
+}
+
+// clone copies g so callers cannot change the stored game.
+func (g *CorrespondenceGame) clone() *CorrespondenceGame {
+	c := *g
+	c.Moves = slices.Clone(g.Moves)
+	return &c
+}
+
+// Create stores a new game, giving it the next ID.
+func (s *CorrespondenceStore) Create(g CorrespondenceGame) (*CorrespondenceGame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g.ID = strconv.Itoa(s.nextID)
+	s.nextID++
+	s.games[g.ID] = g.clone()
+	if err := s.save(); err != nil {
+		delete(s.games, g.ID)
+		s.nextID--
+		return nil, err
+	}
+	return g.clone(), nil
+}
+
+// List returns every game in the order they were created.
+func (s *CorrespondenceStore) List() []*CorrespondenceGame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	games := make([]*CorrespondenceGame, 0, len(s.games))
+	for _, g := range s.games {
+		games = append(games, g.clone())
+	}
+	slices.SortFunc(games, compareCorrespondenceIDs)
+	return games
+}
+
+// Update changes game id with fn and saves the store. Nothing changes when fn fails. A
+// missing game is reported as os.ErrNotExist.
+func (s *CorrespondenceStore) Update(id string, fn func(*CorrespondenceGame) error) (*CorrespondenceGame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.games[id]
+	if !ok {
+		return nil, fmt.Errorf("game %s: %w", id, os.ErrNotExist)
+	}
+	g := stored.clone()
+	if err := fn(g); err != nil {
+		return nil, err
+	}
+	s.games[id] = g
+	if err := s.save(); err != nil {
+		s.games[id] = stored
+		return nil, err
+	}
+	return g.clone(), nil
+}
+
+// CorrespondenceOptions configures the correspondence server.
+type CorrespondenceOptions struct {
+	Store        *CorrespondenceStore
+	Tokens       map[string]string // bearer token → player name
+	DaysPerMove  int               // for games created without a daysPerMove (3)
+	MaxBodyBytes int64             // largest request body accepted (64 KiB)
+	Clock        Clock             // decides deadlines (the system clock)
+}
+
+type correspondenceServer struct {
+	opts    CorrespondenceOptions
+	players []string
+}
+
+// NewCorrespondenceServer returns a handler for the correspondence API. Every request must
+// carry "Authorization: Bearer <token>" for one of the players; anyone may read any game,
+// but only its players may act in it.
+//
+//	GET  /api/games               every game
+//	POST /api/games               create a game: "opponent", "color", "fen", "daysPerMove" (0 untimed)
+//	GET  /api/games/{id}          a game with its position, SAN and legal moves
+//	POST /api/games/{id}/move     play "move" (UCI or SAN) on your turn
+//	POST /api/games/{id}/resign   resign
+//	POST /api/games/{id}/draw     offer a draw, or accept the opponent's offer
+//	GET  /api/games/{id}/pgn      the game as PGN
+func NewCorrespondenceServer(opts CorrespondenceOptions) http.Handler {
+	if opts.DaysPerMove <= 0 {
+		opts.DaysPerMove = 3
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = 64 << 10
+	}
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+	s := &correspondenceServer{opts: opts}
+	for _, player := range opts.Tokens {
+		if !slices.Contains(s.players, player) {
+			s.players = append(s.players, player)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/games", s.auth(s.list))
+	mux.HandleFunc("POST /api/games", s.auth(s.create))
+	mux.HandleFunc("GET /api/games/{id}", s.auth(s.get))
+	mux.HandleFunc("POST /api/games/{id}/move", s.auth(s.move))
+	mux.HandleFunc("POST /api/games/{id}/resign", s.auth(s.resign))
+	mux.HandleFunc("POST /api/games/{id}/draw", s.auth(s.draw))
+	mux.HandleFunc("GET /api/games/{id}/pgn", s.auth(s.pgn))
+	return mux
+}
+
+// auth resolves the request's token to a player before calling fn.
+func (s *correspondenceServer) auth(fn func(w http.ResponseWriter, r *http.Request, player string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		player, known := s.opts.Tokens[token]
+		if !ok || !known {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, apiErrorf(http.StatusUnauthorized, "missing or unknown token"))
+			return
+		}
+		fn(w, r, player)
+	}
+}
+
+// decode reads a JSON request body into v.
+func (s *correspondenceServer) decode(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.opts.MaxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return apiErrorf(http.StatusRequestEntityTooLarge, "request body over %d bytes", tooLarge.Limit)
+		}
+		return apiErrorf(http.StatusBadRequest, "request: %v", err)
+	}
+	return nil
+}
+
+// correspondenceView is a game as the API returns it.
+type correspondenceView struct {
+	*CorrespondenceGame
+	FEN        string   `json:"fen"`
+	SAN        []string `json:"san"`
+	ToMove     string   `json:"toMove,omitempty"` // the player to move, while the game is on
+	LegalMoves []string `json:"legalMoves,omitempty"`
+}
+
+func (s *correspondenceServer) view(g *CorrespondenceGame) (correspondenceView, error) {
+	game, err := g.replay()
+	if err != nil {
+		return correspondenceView{}, err
+	}
+	pos := game.Position()
+	v := correspondenceView{CorrespondenceGame: g, FEN: pos.FEN(), SAN: slices.Clone(game.SAN())}
+	if v.SAN == nil {
+		v.SAN = []string{}
+	}
+	if g.Result == "*" {
+		v.ToMove = g.player(pos.toMove)
+		for _, ap := range generateLegalMoves(pos) {
+			v.LegalMoves = append(v.LegalMoves, ap.Move.UCINotation())
+		}
+	}
+	return v, nil
+}
+
+// settled returns game id with any result its deadline has decided since it was stored.
+func (s *correspondenceServer) settled(id string) (*CorrespondenceGame, error) {
+	return s.update(id, "", nil)
+}
+
+// update applies fn to game id after settling it. With a player, fn only runs while the
+// game is on and the player is in it.
+func (s *correspondenceServer) update(id, player string, fn func(g *CorrespondenceGame, game *Game, color Color) error) (*CorrespondenceGame, error) {
+	g, err := s.opts.Store.Update(id, func(g *CorrespondenceGame) error {
+		game, err := g.replay()
+		if err != nil {
+			return err
+		}
+		now := s.opts.Clock.Now()
+		g.settle(game, now)
+		if player == "" {
+			return nil
+		}
+		color, ok := g.color(player)
+		if !ok {
+			return apiErrorf(http.StatusForbidden, "%s is not playing game %s", player, id)
+		}
+		if g.Result != "*" {
+			return apiErrorf(http.StatusConflict, "game %s is over: %s (%s)", id, g.Result, g.Reason)
+		}
+		if err := fn(g, game, color); err != nil {
+			return err
+		}
+		g.settle(game, now)
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, apiErrorf(http.StatusNotFound, "no game %s", id)
+	}
+	return g, err
+}
+
+// respond writes the view of g, or err.
+func (s *correspondenceServer) respond(w http.ResponseWriter, status int, g *CorrespondenceGame, err error) {
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	v, err := s.view(g)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, status, v)
+}
+
+func (s *correspondenceServer) list(w http.ResponseWriter, r *http.Request, player string) {
+	views := []correspondenceView{}
+	for _, g := range s.opts.Store.List() {
+		if g.Result == "*" && !g.Deadline.IsZero() && s.opts.Clock.Now().After(g.Deadline) {
+			var err error
+			if g, err = s.settled(g.ID); err != nil {
+				writeAPIError(w, err)
+				return
+			}
+		}
+		v, err := s.view(g)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		views = append(views, v)
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+type createRequest struct {
+	Opponent    string `json:"opponent"`
+	Color       string `json:"color"` // "white" (the default) or "black"
+	FEN         string `json:"fen"`
+	DaysPerMove *int   `json:"daysPerMove"` // 0 for no time limit; the server's default when absent
+}
+
+func (s *correspondenceServer) create(w http.ResponseWriter, r *http.Request, player string) {
+	var req createRequest
+	if err := s.decode(w, r, &req); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if !slices.Contains(s.players, req.Opponent) || req.Opponent == player {
+		writeAPIError(w, apiErrorf(http.StatusBadRequest, "unknown opponent %q", req.Opponent))
+		return
+	}
+	start := NewVariantPosition(Standard)
+	if req.FEN != "" {
+		var err error
+		if start, err = ParseStrictFEN(req.FEN); err != nil {
+			writeAPIError(w, apiErrorf(http.StatusBadRequest, "fen: %v", err))
+			return
+		}
+	}
+	days := s.opts.DaysPerMove
+	if req.DaysPerMove != nil {
+		days = *req.DaysPerMove
+	}
+	if days < 0 {
+		writeAPIError(w, apiErrorf(http.StatusBadRequest, "negative daysPerMove"))
+		return
+	}
+	now := s.opts.Clock.Now().UTC()
+	g := CorrespondenceGame{White: player, Black: req.Opponent, StartFEN: start.FEN(), Moves: []string{},
+		DaysPerMove: days, Created: now, Result: "*"}
+	switch strings.ToLower(req.Color) {
+	case "", "white":
+	case "black":
+		g.White, g.Black = g.Black, g.White
+	default:
+		writeAPIError(w, apiErrorf(http.StatusBadRequest, "color must be white or black"))
+		return
+	}
+	if g.DaysPerMove > 0 {
+		g.Deadline = now.Add(time.Duration(g.DaysPerMove) * 24 * time.Hour)
+	}
+	if outcome := start.Outcome(); outcome.IsOver() {
+		writeAPIError(w, apiErrorf(http.StatusUnprocessableEntity, "the game would be over at once: %s", outcome.Reason))
+		return
+	}
+	created, err := s.opts.Store.Create(g)
+	s.respond(w, http.StatusCreated, created, err)
+}
+
+func (s *correspondenceServer) get(w http.ResponseWriter, r *http.Request, player string) {
+	g, err := s.settled(r.PathValue("id"))
+	s.respond(w, http.StatusOK, g, err)
+}
+
+type correspondenceMoveRequest struct {
+	Move string `json:"move"`
+}
+
+func (s *correspondenceServer) move(w http.ResponseWriter, r *http.Request, player string) {
+	var req correspondenceMoveRequest
+	if err := s.decode(w, r, &req); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	g, err := s.update(r.PathValue("id"), player, func(g *CorrespondenceGame, game *Game, color Color) error {
+		if game.Position().toMove != color {
+			return apiErrorf(http.StatusConflict, "it is %s's move", g.player(color.Opponent()))
+		}
+		ap, err := game.PlayInput(req.Move)
+		if err != nil {
+			return apiErrorf(http.StatusUnprocessableEntity, "move %q: %v", req.Move, err)
+		}
+		g.Moves = append(g.Moves, ap.Move.UCINotation())
+		if g.DrawOffer != player {
+			// Moving declines the opponent's offer; our own stands for them to answer
+			g.DrawOffer = ""
+		}
+		if g.DaysPerMove > 0 {
+			g.Deadline = s.opts.Clock.Now().UTC().Add(time.Duration(g.DaysPerMove) * 24 * time.Hour)
+		}
+		return nil
+	})
+	s.respond(w, http.StatusOK, g, err)
+}
+
+func (s *correspondenceServer) resign(w http.ResponseWriter, r *http.Request, player string) {
+	g, err := s.update(r.PathValue("id"), player, func(g *CorrespondenceGame, game *Game, color Color) error {
+		game.Resign(color)
+		return nil
+	})
+	s.respond(w, http.StatusOK, g, err)
+}
+
+func (s *correspondenceServer) draw(w http.ResponseWriter, r *http.Request, player string) {
+	g, err := s.update(r.PathValue("id"), player, func(g *CorrespondenceGame, game *Game, color Color) error {
+		if g.DrawOffer == g.player(color.Opponent()) {
+			game.End(Outcome{Result: Draw, Reason: "draw agreed"})
+		} else {
+			g.DrawOffer = player
+		}
+		return nil
+	})
+	s.respond(w, http.StatusOK, g, err)
+}
+
+func (s *correspondenceServer) pgn(w http.ResponseWriter, r *http.Request, player string) {
+	g, err := s.settled(r.PathValue("id"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	game, err := g.replay()
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	tags := map[string]string{
+		"Event": "Correspondence game " + g.ID,
+		"Site":  "chessx",
+		"Date":  g.Created.Format("2006.01.02"),
+		"White": g.White,
+		"Black": g.Black,
+	}
+	if g.DaysPerMove > 0 {
+		tags["TimeControl"] = fmt.Sprintf("1/%d", g.DaysPerMove*24*60*60)
+	}
+	w.Header().Set("Content-Type", "application/x-chess-pgn")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="game-%s.pgn"`, g.ID))
+	game.PGN(tags).WriteTo(w)
+}
+
+// runCorrespondence implements "correspondence [-store FILE] -player NAME=TOKEN ...",
+// hosting correspondence games between the players until the process is stopped.
+func runCorrespondence(args []string, out io.Writer) error {
+	flags := commandFlags("correspondence", out)
+	addr := flags.String("addr", "localhost:8082", "address to listen on")
+	path := flags.String("store", "correspondence.json", "file keeping the games")
+	days := flags.Int("days", 3, "days per move in games created without a daysPerMove")
+	var players stringList
+	flags.Var(&players, "player", "a player and their API token as NAME=TOKEN (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	tokens := map[string]string{}
+	for _, player := range players {
+		name, token, ok := strings.Cut(player, "=")
+		if !ok || name == "" || token == "" {
+			return fmt.Errorf("-player %q: want NAME=TOKEN", player)
+		}
+		tokens[token] = name
+	}
+	if len(tokens) < 2 {
+		return errors.New("correspondence needs at least two -player NAME=TOKEN")
+	}
+	store, err := OpenCorrespondenceStore(*path)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           NewCorrespondenceServer(CorrespondenceOptions{Store: store, Tokens: tokens, DaysPerMove: *days}),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+	}
+	fmt.Fprintf(out, "Serving correspondence games from %s on http://%s/api/games\n", *path, *addr)
+	return server.ListenAndServe()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// correspondenceTest is a correspondence server over a store in a temporary directory.
+type correspondenceTest struct {
+	t       *testing.T
+	path    string
+	clock   *fakeClock
+	handler http.Handler
+}
+
+func newCorrespondenceTest(t *testing.T) *correspondenceTest {
+	c := &correspondenceTest{t: t, path: filepath.Join(t.TempDir(), "games.json"),
+		clock: &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}}
+	store, err := OpenCorrespondenceStore(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handler = NewCorrespondenceServer(CorrespondenceOptions{Store: store, Clock: c.clock,
+		Tokens: map[string]string{"alice-token": "alice", "bob-token": "bob", "carol-token": "carol"}})
+	return c
+}
+
+// call makes a request as the player with token and decodes a JSON answer.
+func (c *correspondenceTest) call(method, path, token, body string) (int, map[string]any) {
+	c.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, req)
+	var response map[string]any
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") && strings.HasPrefix(w.Body.String(), "{") {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			c.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return w.Code, response
+}
+
+// expect makes a request and checks its status.
+func (c *correspondenceTest) expect(status int, method, path, token, body string) map[string]any {
+	c.t.Helper()
+	got, response := c.call(method, path, token, body)
+	if got != status {
+		c.t.Fatalf("%s %s %s: status %d, want %d: %v", method, path, body, got, status, response)
+	}
+	return response
+}
+
+func TestCorrespondence_Game(t *testing.T) {
+	c := newCorrespondenceTest(t)
+	game := c.expect(http.StatusCreated, "POST", "/api/games", "alice-token", `{"opponent": "bob"}`)
+	if game["id"] != "1" || game["white"] != "alice" || game["toMove"] != "alice" || game["result"] != "*" ||
+		game["deadline"] != "2024-03-04T12:00:00Z" || len(game["legalMoves"].([]any)) != 20 {
+		t.Fatalf("new game %v", game)
+	}
+
+	c.expect(http.StatusConflict, "POST", "/api/games/1/move", "bob-token", `{"move": "e5"}`)
+	c.expect(http.StatusForbidden, "POST", "/api/games/1/move", "carol-token", `{"move": "e4"}`)
+	c.expect(http.StatusOK, "POST", "/api/games/1/move", "alice-token", `{"move": "e4"}`)
+	c.expect(http.StatusUnprocessableEntity, "POST", "/api/games/1/move", "bob-token", `{"move": "Ke7"}`)
+	c.expect(http.StatusBadRequest, "POST", "/api/games/1/move", "bob-token", `{"mvoe": "e5"}`)
+	c.clock.now = c.clock.now.Add(48 * time.Hour)
+	game = c.expect(http.StatusOK, "POST", "/api/games/1/move", "bob-token", `{"move": "e7e5"}`)
+	if game["deadline"] != "2024-03-06T12:00:00Z" || game["toMove"] != "alice" || game["fen"] != "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2" {
+		t.Errorf("after 1...e5: %v", game)
+	}
+
+	// An offer stands until the opponent moves, and is accepted with an offer back
+	if game := c.expect(http.StatusOK, "POST", "/api/games/1/draw", "alice-token", ""); game["drawOffer"] != "alice" {
+		t.Errorf("offer: %v", game)
+	}
+	c.expect(http.StatusOK, "POST", "/api/games/1/move", "alice-token", `{"move": "Nf3"}`)
+	if game := c.expect(http.StatusOK, "POST", "/api/games/1/move", "bob-token", `{"move": "Nc6"}`); game["drawOffer"] != nil {
+		t.Errorf("declined offer: %v", game)
+	}
+	c.expect(http.StatusOK, "POST", "/api/games/1/draw", "bob-token", "")
+	game = c.expect(http.StatusOK, "POST", "/api/games/1/draw", "alice-token", "")
+	if game["result"] != "1/2-1/2" || game["reason"] != "draw agreed" || game["toMove"] != nil {
+		t.Errorf("agreed draw: %v", game)
+	}
+	c.expect(http.StatusConflict, "POST", "/api/games/1/move", "alice-token", `{"move": "Bc4"}`)
+
+	req := httptest.NewRequest("GET", "/api/games/1/pgn", nil)
+	req.Header.Set("Authorization", "Bearer carol-token")
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, req)
+	pgn := w.Body.String()
+	for _, want := range []string{`[White "alice"]`, `[Black "bob"]`, `[Date "2024.03.01"]`, `[Result "1/2-1/2"]`, `[TimeControl "1/259200"]`, "1. e4 e5 2. Nf3 Nc6 1/2-1/2"} {
+		if !strings.Contains(pgn, want) {
+			t.Errorf("PGN lacks %q:\n%s", want, pgn)
+		}
+	}
+
+	// The store survives a restart
+	store, err := OpenCorrespondenceStore(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if games := store.List(); len(games) != 1 || games[0].Result != "1/2-1/2" || strings.Join(games[0].Moves, " ") != "e2e4 e7e5 g1f3 b8c6" {
+		t.Errorf("reloaded %+v", games)
+	}
+}
+
+func TestCorrespondence_Results(t *testing.T) {
+	c := newCorrespondenceTest(t)
+	// Checkmate, from a position Black starts in
+	c.expect(http.StatusCreated, "POST", "/api/games", "alice-token",
+		`{"opponent": "bob", "color": "black", "fen": "rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq g3 0 2"}`)
+	game := c.expect(http.StatusOK, "POST", "/api/games/1/move", "alice-token", `{"move": "Qh4#"}`)
+	if game["result"] != "0-1" || game["reason"] != "checkmate" {
+		t.Errorf("mate: %v", game)
+	}
+
+	// Time forfeit, seen when the game is next read
+	c.expect(http.StatusCreated, "POST", "/api/games", "bob-token", `{"opponent": "carol", "daysPerMove": 1}`)
+	c.clock.now = c.clock.now.Add(25 * time.Hour)
+	if game := c.expect(http.StatusOK, "GET", "/api/games/2", "alice-token", ""); game["result"] != "0-1" || game["reason"] != "time forfeit" {
+		t.Errorf("forfeit: %v", game)
+	}
+
+	// Resignation, and the list of games
+	c.expect(http.StatusCreated, "POST", "/api/games", "carol-token", `{"opponent": "alice"}`)
+	c.expect(http.StatusOK, "POST", "/api/games/3/resign", "alice-token", "")
+	c.expect(http.StatusConflict, "POST", "/api/games/3/resign", "carol-token", "")
+
+	// No time limit: a daysPerMove of 0 is kept rather than replaced by the default
+	c.expect(http.StatusCreated, "POST", "/api/games", "alice-token", `{"opponent": "carol", "daysPerMove": 0}`)
+	c.clock.now = c.clock.now.Add(365 * 24 * time.Hour)
+	if game := c.expect(http.StatusOK, "GET", "/api/games/4", "carol-token", ""); game["result"] != "*" || game["deadline"] != nil || game["daysPerMove"] != 0.0 {
+		t.Errorf("untimed: %v", game)
+	}
+	req := httptest.NewRequest("GET", "/api/games", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, req)
+	var games []CorrespondenceGame
+	if err := json.Unmarshal(w.Body.Bytes(), &games); err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 4 || games[2].Result != "1-0" || games[2].Reason != "Black resigned" {
+		t.Errorf("games %+v", games)
+	}
+}
+
+func TestCorrespondence_BadRequests(t *testing.T) {
+	c := newCorrespondenceTest(t)
+	c.expect(http.StatusUnauthorized, "GET", "/api/games", "", "")
+	c.expect(http.StatusUnauthorized, "GET", "/api/games", "mallory-token", "")
+	c.expect(http.StatusBadRequest, "POST", "/api/games", "alice-token", `{"opponent": "alice"}`)
+	c.expect(http.StatusBadRequest, "POST", "/api/games", "alice-token", `{"opponent": "mallory"}`)
+	c.expect(http.StatusBadRequest, "POST", "/api/games", "alice-token", `{"opponent": "bob", "fen": "nonsense"}`)
+	c.expect(http.StatusBadRequest, "POST", "/api/games", "alice-token", `{"opponent": "bob", "fen": "kk6/8/8/8/8/8/8/KK6 w - - 0 1"}`)
+	c.expect(http.StatusBadRequest, "POST", "/api/games", "alice-token", `{"opponent": "bob", "fen": "7k/8/8/8/8/8/8/K6Q w - - 0 1"}`)
+	c.expect(http.StatusBadRequest, "POST", "/api/games", "alice-token", `{"opponent": "bob", "color": "green"}`)
+	c.expect(http.StatusNotFound, "GET", "/api/games/7", "alice-token", "")
+	c.expect(http.StatusNotFound, "POST", "/api/games/7/move", "alice-token", `{"move": "e4"}`)
+}
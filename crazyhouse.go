@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pocketKinds lists droppable piece kinds in the order they are written in FEN pockets and generated as drops.
+var pocketKinds = []PieceKind{Queen, Rook, Bishop, Knight, Pawn}
+
+func (p *Position) SetVariant(variant Variant) {
+	p.variant = variant
+}
+
+func (p *Position) GetVariant() Variant {
+	return p.variant
+}
+
+// PocketCount returns how many pieces of the given kind the color holds in hand (Crazyhouse).
+func (p *Position) PocketCount(color Color, kind PieceKind) int {
+	if kind <= Empty || kind >= King {
+		return 0
+	}
+	return p.pockets[color][kind]
+}
+
+// SetPocketCount sets how many pieces of the given kind the color holds in hand (Crazyhouse).
+func (p *Position) SetPocketCount(color Color, kind PieceKind, count int) {
+	if kind <= Empty || kind >= King || count < 0 {
+		return
+	}
+	p.pockets[color][kind] = count
+}
+
+// IsPromoted reports whether the piece on the given index was created by promotion.
+// Captured promoted pieces revert to pawns in the capturer's pocket.
+func (p *Position) IsPromoted(index uint64) bool {
+	return p.promoted.IsSet(index)
+}
+
+// SetPromoted marks or unmarks the piece on the given index as promoted.
+func (p *Position) SetPromoted(index uint64, promoted bool) {
+	if promoted {
+		p.promoted = p.promoted.Set(index)
+	} else {
+		p.promoted = p.promoted.Clear(index)
+	}
+}
+
+// pocketFEN renders both pockets in FEN bracket order, e.g. "QNPPqp" (white first, then black).
+func (p *Position) pocketFEN() string {
+	var sb strings.Builder
+	for _, color := range []Color{White, Black} {
+		for _, kind := range pocketKinds {
+			for i := 0; i < p.pockets[color][kind]; i++ {
+				sb.WriteString(pieceKindToFEN(kind, color))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// parsePocketFEN fills the pockets from FEN pocket letters (the part between brackets).
+// "-" denotes empty pockets.
+func (p *Position) parsePocketFEN(pocket string) error {
+	if pocket == "-" {
+		return nil
+	}
+	for _, char := range pocket {
+		kind, color, ok := fenCharToPiece(char)
+		if !ok || kind == King {
+			return fmt.Errorf("invalid FEN: bad pocket piece %q", char)
+		}
+		p.pockets[color][kind]++
+	}
+	return nil
+}
+
+// addDropMoves appends pseudo-legal Crazyhouse drops for the side to move: any pocket piece
+// onto any empty square, except pawns which may not be dropped on the first or last rank.
+// Drops that fail to resolve a check are filtered out with the other illegal moves in generateLegalMoves.
+func addDropMoves(pos *Position, dst *[]GeneratedMove) {
+	if pos.variant != Crazyhouse {
+		return
+	}
+	empty := pos.GetAllOccupancy().Not()
+	for _, kind := range pocketKinds {
+		if pos.pockets[pos.toMove][kind] == 0 {
+			continue
+		}
+		targets := empty
+		if kind == Pawn {
+			targets = targets.And(pawnDropMask)
+		}
+		for _, toIndex := range targets.ToIndexes() {
+			toSquare := squareFromIndex(toIndex)
+			*dst = append(*dst, GeneratedMove{
+				To:        toSquare,
+				Notation:  dropLetter(kind) + "@" + toSquare,
+				Promotion: Empty,
+				Kind:      kind,
+				Color:     pos.toMove,
+				IsDrop:    true,
+			})
+		}
+	}
+}
+
+// pawnDropMask covers ranks 2..7, the only ranks pawns may be dropped on.
+var pawnDropMask = Bitboard(0x00FFFFFFFFFFFF00)
+
+// dropLetter returns the upper-case letter used for drops in both UCI and SAN (P@e4, N@f3).
+func dropLetter(kind PieceKind) string {
+	if kind == Pawn {
+		return "P"
+	}
+	return pieceSANLetter(kind)
+}
+
+// applyDrop returns a new position with the drop move applied.
+func (p *Position) applyDrop(move GeneratedMove) *Position {
+	newPosition := p.Clone()
+	toFile, toRank, ok := squareToFileRank(move.To)
+	if !ok || newPosition.GetPiece(toFile, toRank) != nil || newPosition.pockets[move.Color][move.Kind] == 0 {
+		return newPosition
+	}
+	newPosition.pockets[move.Color][move.Kind]--
+	newPosition.SetPiece(toFile, toRank, move.Kind, move.Color)
+	newPosition.SetPromoted(fileRankToIndex(toFile, toRank), false)
+	newPosition.enpassant = EmptyBitboard()
+
+	if move.Kind == Pawn {
+		newPosition.halfmoves = 0
+	} else {
+		newPosition.halfmoves = p.halfmoves + 1
+	}
+	if p.toMove == Black {
+		newPosition.moveNumber = p.moveNumber + 1
+	}
+	if p.toMove == White {
+		newPosition.toMove = Black
+	} else {
+		newPosition.toMove = White
+	}
+	return newPosition
+}
+
+// pocketCapture adds a piece captured on index to the capturer's pocket; promoted pieces revert to pawns.
+func (p *Position) pocketCapture(capturer Color, kind PieceKind, index uint64) {
+	if p.promoted.IsSet(index) {
+		kind = Pawn
+	}
+	if kind > Empty && kind < King {
+		p.pockets[capturer][kind]++
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseFEN_CrazyhousePocket(t *testing.T) {
+	fen := "rnb1kbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNB1KBNR[Qq] w KQkq - 0 3"
+	pos, err := ParseFEN(fen)
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	if pos.GetVariant() != Crazyhouse {
+		t.Fatalf("expected crazyhouse variant from pocket notation, got %s", pos.GetVariant())
+	}
+	if pos.PocketCount(White, Queen) != 1 || pos.PocketCount(Black, Queen) != 1 {
+		t.Fatalf("expected one queen in each pocket, got white=%d black=%d",
+			pos.PocketCount(White, Queen), pos.PocketCount(Black, Queen))
+	}
+	if got := pos.FEN(); got != fen {
+		t.Fatalf("FEN round trip mismatch:\n got %s\nwant %s", got, fen)
+	}
+
+	slashed, err := ParseFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR/Pn w KQkq - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse slashed pocket fen: %v", err)
+	}
+	if slashed.PocketCount(White, Pawn) != 1 || slashed.PocketCount(Black, Knight) != 1 {
+		t.Fatalf("expected P and n in pockets, got %s", slashed.pocketFEN())
+	}
+}
+
+func TestCrazyhouse_KingNeverInPocket(t *testing.T) {
+	pos := NewVariantPosition(Crazyhouse)
+	pos.SetPocketCount(White, King, 1)
+	pos.pockets[Black][King] = 1 // as if set directly; the accessor still must not count it
+	if pos.PocketCount(White, King) != 0 || pos.PocketCount(Black, King) != 0 {
+		t.Fatalf("king counted in a pocket: white=%d black=%d", pos.PocketCount(White, King), pos.PocketCount(Black, King))
+	}
+	if _, err := ParseFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[K] w KQkq - 0 1"); err == nil {
+		t.Fatal("expected a king in a FEN pocket to be rejected")
+	}
+}
+
+func TestParseFEN_PromotedMarker(t *testing.T) {
+	fen := "4k3/8/8/8/8/8/8/Q~3K3[] b - - 0 1"
+	pos, err := ParseFEN(fen)
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	if !pos.IsPromoted(fileRankToIndex(0, 0)) {
+		t.Fatalf("expected queen on a1 to be marked promoted")
+	}
+	if p := pos.GetPieceAtSquare("e1"); p == nil || p.Kind != King {
+		t.Fatalf("expected king on e1 after promoted marker, got %+v", p)
+	}
+	if got := pos.FEN(); got != fen {
+		t.Fatalf("FEN round trip mismatch:\n got %s\nwant %s", got, fen)
+	}
+}
+
+func TestCrazyhouse_CaptureGoesToPocket(t *testing.T) {
+	pos, err := ParseFEN("4k3/8/8/3p4/4P3/8/8/4K3[] w - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	var next *Position
+	for _, ap := range generateLegalMoves(pos) {
+		if ap.Move.UCINotation() == "e4d5" {
+			next = ap.Position
+		}
+	}
+	if next == nil {
+		t.Fatalf("expected exd5 to be legal")
+	}
+	if next.PocketCount(White, Pawn) != 1 {
+		t.Fatalf("expected captured pawn in white pocket, got %s", next.pocketFEN())
+	}
+}
+
+func TestCrazyhouse_CapturedPromotedPieceBecomesPawn(t *testing.T) {
+	pos, err := ParseFEN("4k3/8/8/8/8/8/1r6/Q~3K3[] b - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	next := pos.ApplyMove(GeneratedMove{From: "b2", To: "a1", Kind: Rook, Color: Black, IsCapture: true})
+	if next.PocketCount(Black, Pawn) != 1 || next.PocketCount(Black, Queen) != 0 {
+		t.Fatalf("expected promoted queen to enter pocket as pawn, got %s", next.pocketFEN())
+	}
+	if next.IsPromoted(fileRankToIndex(0, 0)) {
+		t.Fatalf("capturing rook should not inherit promoted mark")
+	}
+
+	promo, err := ParseFEN("4k3/P7/8/8/8/8/8/4K3[] w - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	after := promo.ApplyMove(GeneratedMove{From: "a7", To: "a8", Kind: Pawn, Color: White, Promotion: Queen})
+	if !after.IsPromoted(fileRankToIndex(0, 7)) {
+		t.Fatalf("expected promoted queen on a8 to be tracked")
+	}
+	moved := after.ApplyMove(GeneratedMove{From: "e8", To: "d7", Kind: King, Color: Black})
+	moved = moved.ApplyMove(GeneratedMove{From: "a8", To: "a1", Kind: Queen, Color: White})
+	if !moved.IsPromoted(fileRankToIndex(0, 0)) || moved.IsPromoted(fileRankToIndex(0, 7)) {
+		t.Fatalf("expected promoted mark to follow the queen from a8 to a1")
+	}
+}
+
+func TestCrazyhouse_DropGeneration(t *testing.T) {
+	pos, err := ParseFEN("4k3/8/8/8/8/8/8/4K3[PN] w - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	pawnDrops, knightDrops := 0, 0
+	for _, ap := range generateLegalMoves(pos) {
+		if !ap.Move.IsDrop {
+			continue
+		}
+		switch ap.Move.Kind {
+		case Pawn:
+			pawnDrops++
+			if r := ap.Move.To[1]; r == '1' || r == '8' {
+				t.Fatalf("pawn dropped on back rank: %s", ap.Move.UCINotation())
+			}
+		case Knight:
+			knightDrops++
+		}
+	}
+	// 62 empty squares; 48 of them on ranks 2..7
+	if pawnDrops != 48 {
+		t.Fatalf("expected 48 pawn drops, got %d", pawnDrops)
+	}
+	if knightDrops != 62 {
+		t.Fatalf("expected 62 knight drops, got %d", knightDrops)
+	}
+
+	next, ok := findUCIMove(pos, "N@f3")
+	if !ok {
+		t.Fatalf("expected N@f3 to be accepted")
+	}
+	if p := next.Position.GetPieceAtSquare("f3"); p == nil || p.Kind != Knight || p.Color != White {
+		t.Fatalf("expected white knight on f3 after drop, got %+v", p)
+	}
+	if next.Position.PocketCount(White, Knight) != 0 {
+		t.Fatalf("expected knight to leave the pocket")
+	}
+	if next.Move.Notation != "N@f3" {
+		t.Fatalf("expected SAN N@f3, got %s", next.Move.Notation)
+	}
+}
+
+func TestCrazyhouse_DropsBlockCheck(t *testing.T) {
+	// White king on e1 checked by rook on e8; only interpositions on e2..e7 or king moves are legal
+	pos, err := ParseFEN("k3r3/8/8/8/8/8/8/4K3[N] w - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	drops := 0
+	for _, ap := range generateLegalMoves(pos) {
+		if ap.Move.IsDrop {
+			drops++
+			if ap.Move.To[0] != 'e' {
+				t.Fatalf("drop %s does not resolve check", ap.Move.UCINotation())
+			}
+		}
+	}
+	if drops != 6 {
+		t.Fatalf("expected 6 blocking drops, got %d", drops)
+	}
+}
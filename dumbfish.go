@@ -1,14 +1,77 @@
 package main
 
-type Dumbfish struct{}
+import "context"
+
+// Dumbfish searches with a material-only evaluation, or with a Network when one is loaded.
+// Without limits it searches Depth plies,
+// and with Depth 0 it plays the first legal move it finds. An optional Syzygy tablebase is
+// probed at the root and in search. With Threads above 1 helper threads search alongside
+// the main one, sharing the transposition table; a single thread searches deterministically.
+type Dumbfish struct {
+	Depth     int
+	Threads   int
+	Tablebase *SyzygyTablebase
+	Hash      *TranspositionTable // kept across searches; nil gives each search a small table
+	Options   *SearchOptions      // selective search features; nil means DefaultSearchOptions
+	Network   *Network            // evaluation network; nil means the material evaluation
+	Clock     Clock               // time source for time controls; nil means the system clock
+}
 
 func (d Dumbfish) Name() string { return "Dumbfish" }
 
-// SelectMove returns the first legal move and resulting position, if any.
+// NewGame forgets the previous game by clearing the transposition table.
+func (d Dumbfish) NewGame() error {
+	if d.Hash != nil {
+		d.Hash.Clear()
+	}
+	return nil
+}
+
+// SelectMove returns the chosen legal move and resulting position, if any.
 func (d Dumbfish) SelectMove(pos *Position) (AppliedMove, bool) {
-	legal := generateLegalMoves(pos)
-	if len(legal) == 0 {
-		return AppliedMove{}, false
+	if d.Depth <= 0 && !d.Tablebase.supports(pos) {
+		legal := generateLegalMoves(pos)
+		if len(legal) == 0 {
+			return AppliedMove{}, false
+		}
+		return legal[0], true
+	}
+	return d.Search(context.Background(), pos, SearchLimits{Depth: max(d.Depth, 1)}, nil)
+}
+
+// Search iteratively deepens until the limits are reached or ctx is done, reporting each
+// completed iteration to info. Zero limits fall back to SelectMove.
+func (d Dumbfish) Search(ctx context.Context, pos *Position, limits SearchLimits, info func(SearchInfo)) (AppliedMove, bool) {
+	if limits.IsZero() {
+		if limits.MultiPV <= 1 {
+			return d.SelectMove(pos)
+		}
+		limits.Depth = max(d.Depth, 1)
+	}
+	tt := d.Hash
+	if tt == nil {
+		tt = NewTranspositionTable(1)
+	}
+	tt.NewSearch()
+	opts := DefaultSearchOptions()
+	if d.Options != nil {
+		opts = *d.Options
+	}
+	s := &searcher{
+		ctx:      ctx,
+		info:     info,
+		tb:       d.Tablebase,
+		tm:       NewTimeManager(limits, pos.toMove, d.Clock),
+		tt:       tt,
+		opts:     opts,
+		net:      d.Network,
+		shared:   &searchShared{},
+		maxNodes: limits.Nodes,
+		multiPV:  limits.MultiPV,
+	}
+	maxDepth := limits.Depth
+	if maxDepth <= 0 {
+		maxDepth = maxSearchPly
 	}
-	return legal[0], true
+	return searchLazySMP(s, min(max(d.Threads, 1), maxThreads), pos, maxDepth, limits.Mate)
 }
@@ -1,8 +1,86 @@
 package main
 
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
 // Engine is a minimal interface for a move-selecting engine.
 // It returns an applied legal move and the resulting position, or false when no moves exist.
+// Search does the same under clock, depth or node limits; it stops early when ctx is
+// cancelled and reports progress to info (which may be nil) while it thinks.
 type Engine interface {
 	Name() string
 	SelectMove(pos *Position) (AppliedMove, bool)
+	Search(ctx context.Context, pos *Position, limits SearchLimits, info func(SearchInfo)) (AppliedMove, bool)
+}
+
+// Score is a search score from the side to move's point of view.
+type Score struct {
+	Centipawns int
+	Mate       int // moves to mate when non-zero; negative when getting mated
+}
+
+// scoreFromSearch converts an internal search score, where mates are encoded near mateScore.
+func scoreFromSearch(score int) Score {
+	switch {
+	case score >= mateScore-maxSearchPly:
+		return Score{Mate: (mateScore - score + 1) / 2}
+	case score <= -mateScore+maxSearchPly:
+		return Score{Mate: -(mateScore + score) / 2}
+	}
+	return Score{Centipawns: score}
+}
+
+// String formats the score for people: "+0.35" in pawns, or "#3" / "#-3" for mates.
+func (s Score) String() string {
+	if s.Mate != 0 {
+		return fmt.Sprintf("#%d", s.Mate)
+	}
+	return fmt.Sprintf("%+.2f", float64(s.Centipawns)/100)
+}
+
+// UCI formats the score as in a UCI "info" line: "cp 35" or "mate -3".
+func (s Score) UCI() string {
+	if s.Mate != 0 {
+		return fmt.Sprintf("mate %d", s.Mate)
+	}
+	return fmt.Sprintf("cp %d", s.Centipawns)
+}
+
+// MarshalJSON encodes the score as {"cp": 35} or {"mate": -3}.
+func (s Score) MarshalJSON() ([]byte, error) {
+	if s.Mate != 0 {
+		return fmt.Appendf(nil, `{"mate":%d}`, s.Mate), nil
+	}
+	return fmt.Appendf(nil, `{"cp":%d}`, s.Centipawns), nil
+}
+
+// SearchInfo is a progress report, sent after each completed iteration.
+type SearchInfo struct {
+	Depth    int
+	MultiPV  int // 1-based rank of the line this report is about
+	SelDepth int // deepest ply reached
+	Score    Score
+	Nodes    int
+	NPS      int
+	Time     time.Duration
+	PV       []GeneratedMove
+	HashFull int // permille of the transposition table in use (0 without one)
+}
+
+// UCI formats the report as a UCI "info" line without the leading "info ".
+func (i SearchInfo) UCI() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "depth %d seldepth %d multipv %d score %s nodes %d nps %d time %d hashfull %d",
+		i.Depth, i.SelDepth, max(i.MultiPV, 1), i.Score.UCI(), i.Nodes, i.NPS, i.Time.Milliseconds(), i.HashFull)
+	if len(i.PV) > 0 {
+		sb.WriteString(" pv")
+		for _, move := range i.PV {
+			sb.WriteString(" " + move.UCINotation())
+		}
+	}
+	return sb.String()
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EngineFactory starts a registered engine with the values of its options. The returned
+// function, if not nil, shuts the engine down.
+type EngineFactory func(options map[string]string) (Engine, func() error, error)
+
+// registeredEngine is an engine that can be selected by name wherever an engine is asked for.
+type registeredEngine struct {
+	name        string
+	description string
+	factory     EngineFactory
+}
+
+// engineRegistry holds the engines known by name, kept sorted by name.
+var engineRegistry []registeredEngine
+
+func init() {
+	RegisterEngine("dumbfish", "the built-in engine (options Threads, Hash, EvalFile, BitbasePath and the search switches such as NullMove)",
+		func(options map[string]string) (Engine, func() error, error) {
+			engine, err := dumbfishWithOptions(options)
+			return engine, nil, err
+		})
+	RegisterEngine("random", "plays a random legal move", func(options map[string]string) (Engine, func() error, error) {
+		for name := range options {
+			return nil, nil, fmt.Errorf("unknown option %q", name)
+		}
+		return RandomEngine{}, nil, nil
+	})
+	RegisterEngine("stockfish", "Stockfish, found on $PATH and spoken to over UCI", uciEngineFactory("stockfish"))
+}
+
+// RegisterEngine makes an engine selectable by name, case-insensitively, replacing any
+// engine already registered under that name.
+func RegisterEngine(name, description string, factory EngineFactory) {
+	name = strings.ToLower(name)
+	for i, e := range engineRegistry {
+		if e.name == name {
+			engineRegistry[i] = registeredEngine{name, description, factory}
+			return
+		}
+	}
+	engineRegistry = append(engineRegistry, registeredEngine{name, description, factory})
+	sort.Slice(engineRegistry, func(i, j int) bool { return engineRegistry[i].name < engineRegistry[j].name })
+}
+
+// lookupEngine returns the engine registered under name.
+func lookupEngine(name string) (registeredEngine, bool) {
+	for _, e := range engineRegistry {
+		if strings.EqualFold(e.name, name) {
+			return e, true
+		}
+	}
+	return registeredEngine{}, false
+}
+
+// uciEngineFactory starts the external UCI engine run by command.
+func uciEngineFactory(command string) EngineFactory {
+	return func(options map[string]string) (Engine, func() error, error) {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return nil, nil, errors.New("empty engine command")
+		}
+		engine, err := NewUCIEngine(exec.Command(fields[0], fields[1:]...), options)
+		if err != nil {
+			return nil, nil, err
+		}
+		return engine, engine.Close, nil
+	}
+}
+
+// engineFlagHelp describes the value of the flags that select an engine.
+const engineFlagHelp = `engine: a name listed by "chessx engines" or the command line of a UCI engine`
+
+// openEngine starts the engine described by spec: the name of a registered engine, or the
+// command line of an external UCI engine. options is a comma-separated list of Name=Value
+// UCI options. The returned function, if not nil, shuts the engine down.
+func openEngine(spec, options string) (Engine, func() error, error) {
+	values := map[string]string{}
+	for _, option := range strings.Split(options, ",") {
+		if strings.TrimSpace(option) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(option, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("option %q: expected Name=Value", option)
+		}
+		values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	if e, ok := lookupEngine(strings.TrimSpace(spec)); ok {
+		return e.factory(values)
+	}
+	return uciEngineFactory(spec)(values)
+}
+
+// dumbfishWithOptions configures Dumbfish from the values of its UCI options.
+func dumbfishWithOptions(values map[string]string) (Dumbfish, error) {
+	engine := Dumbfish{Hash: NewTranspositionTable(defaultHashMB)}
+	opts := DefaultSearchOptions()
+	engine.Options = &opts
+	for name, value := range values {
+		switch strings.ToLower(name) {
+		case "threads":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxThreads {
+				return engine, fmt.Errorf("Threads: bad value %q", value)
+			}
+			engine.Threads = n
+		case "hash":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxHashMB {
+				return engine, fmt.Errorf("Hash: bad value %q", value)
+			}
+			engine.Hash = NewTranspositionTable(n)
+		case "bitbasepath":
+			if err := loadBitbaseDir(value); err != nil {
+				return engine, err
+			}
+		case "evalfile":
+			network, err := LoadNetwork(value)
+			if err != nil {
+				return engine, err
+			}
+			engine.Network = network
+		default:
+			found := false
+			for _, opt := range searchOptionFlags(&opts) {
+				if strings.EqualFold(opt.name, name) {
+					enabled, err := strconv.ParseBool(value)
+					if err != nil {
+						return engine, fmt.Errorf("%s: %v", opt.name, err)
+					}
+					*opt.flag, found = enabled, true
+				}
+			}
+			if !found {
+				return engine, fmt.Errorf("unknown option %q", name)
+			}
+		}
+	}
+	return engine, nil
+}
+
+// RandomEngine plays a uniformly random legal move. It is the weakest of opponents, and
+// answers at once, which makes it handy for trying out front ends.
+type RandomEngine struct{}
+
+func (RandomEngine) Name() string { return "Random" }
+
+// SelectMove returns a random legal move and the resulting position, if any.
+func (RandomEngine) SelectMove(pos *Position) (AppliedMove, bool) {
+	legal := generateLegalMoves(pos)
+	if len(legal) == 0 {
+		return AppliedMove{}, false
+	}
+	return legal[rand.Intn(len(legal))], true
+}
+
+// Search ignores the limits and reports nothing: the move is random either way.
+func (r RandomEngine) Search(ctx context.Context, pos *Position, limits SearchLimits, info func(SearchInfo)) (AppliedMove, bool) {
+	return r.SelectMove(pos)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEngineRegistry(t *testing.T) {
+	for _, name := range []string{"dumbfish", "Random", "STOCKFISH"} {
+		if _, ok := lookupEngine(name); !ok {
+			t.Errorf("%s is not registered", name)
+		}
+	}
+	engine, closer, err := openEngine("random", "")
+	if err != nil || closer != nil {
+		t.Fatalf("random: %v", err)
+	}
+	pos := NewVariantPosition(Standard)
+	if ap, ok := engine.Search(t.Context(), pos, SearchLimits{Depth: 3}, nil); !ok || !isLegal(pos, ap) {
+		t.Errorf("random move %v", ap.Move.UCINotation())
+	}
+
+	RegisterEngine("First", "plays the first legal move", func(options map[string]string) (Engine, func() error, error) {
+		return Dumbfish{}, nil, nil
+	})
+	defer func() {
+		for i, e := range engineRegistry {
+			if e.name == "first" {
+				engineRegistry = append(engineRegistry[:i], engineRegistry[i+1:]...)
+			}
+		}
+	}()
+	if engine, _, err := openEngine("first", ""); err != nil || engine.Name() != "Dumbfish" {
+		t.Errorf("registered engine: %v, %v", engine, err)
+	}
+	if out := runCommand(t, "", "engines"); !strings.Contains(out, "  first ") || strings.Index(out, "first") > strings.Index(out, "random") {
+		t.Errorf("engines:\n%s", out)
+	}
+}
+
+// isLegal reports whether ap is a legal move in pos.
+func isLegal(pos *Position, ap AppliedMove) bool {
+	for _, legal := range generateLegalMoves(pos) {
+		if legal.Move.UCINotation() == ap.Move.UCINotation() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScoreFromSearch(t *testing.T) {
+	cases := []struct {
+		score int
+		want  string
+	}{
+		{35, "cp 35"},
+		{-tbWinScore + 3, "cp -89997"},
+		{mateScore - 1, "mate 1"},
+		{mateScore - 3, "mate 2"},
+		{-mateScore + 2, "mate -1"},
+		{-mateScore + 4, "mate -2"},
+	}
+	for _, tc := range cases {
+		if got := scoreFromSearch(tc.score).UCI(); got != tc.want {
+			t.Errorf("score %d: got %q, want %q", tc.score, got, tc.want)
+		}
+	}
+}
+
+func TestDumbfishSearch_StreamsInfo(t *testing.T) {
+	pos, _ := ParseFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	var infos []SearchInfo
+	best, ok := Dumbfish{}.Search(context.Background(), pos, SearchLimits{Depth: 3}, func(info SearchInfo) {
+		infos = append(infos, info)
+	})
+	if !ok || best.Move.UCINotation() != "a1a8" {
+		t.Fatalf("expected a1a8, got %s", best.Move.UCINotation())
+	}
+	if len(infos) != 3 {
+		t.Fatalf("expected one report per iteration, got %d", len(infos))
+	}
+	for i, info := range infos {
+		if info.Depth != i+1 || info.Nodes == 0 || len(info.PV) == 0 {
+			t.Errorf("unexpected report %+v", info)
+		}
+		// Mate is only seen once the reply is searched
+		if info.Depth >= 2 && (info.Score.Mate != 1 || info.PV[0].UCINotation() != "a1a8") {
+			t.Errorf("depth %d: expected mate 1, got %s", info.Depth, info.Score.UCI())
+		}
+	}
+	if infos[2].SelDepth < 3 || !strings.HasPrefix(infos[2].UCI(), "depth 3 seldepth") {
+		t.Errorf("unexpected info line %q", infos[2].UCI())
+	}
+}
+
+func TestDumbfishSearch_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	best, ok := Dumbfish{}.Search(ctx, NewVariantPosition(Standard), SearchLimits{Infinite: true}, nil)
+	if !ok || best.Move.UCINotation() == "" {
+		t.Fatalf("a cancelled search must still return a legal move")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("cancelled search took %v", time.Since(start))
+	}
+}
+
+// TestUCI_StopInfiniteSearch drives the UCI loop through a pipe: an infinite search keeps
+// streaming info lines until "stop" makes it send bestmove.
+func TestUCI_StopInfiniteSearch(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- RunUCI(inR, outW)
+		outW.Close()
+	}()
+	lines := bufio.NewScanner(outR)
+	expect := func(prefix string) string {
+		t.Helper()
+		for lines.Scan() {
+			if strings.HasPrefix(lines.Text(), prefix) {
+				return lines.Text()
+			}
+		}
+		t.Fatalf("no line starting with %q", prefix)
+		return ""
+	}
+
+	io.WriteString(inW, "position startpos moves e2e4\ngo infinite\n")
+	expect("info depth 1 ")
+	io.WriteString(inW, "isready\n")
+	expect("readyok")
+	io.WriteString(inW, "stop\n")
+	best := expect("bestmove ")
+	if best == "bestmove 0000" {
+		t.Fatalf("expected a real move, got %q", best)
+	}
+	io.WriteString(inW, "quit\n")
+	go func() {
+		// drain anything left so the server never blocks on output
+		for lines.Scan() {
+		}
+	}()
+	if err := <-errc; err != nil {
+		t.Fatalf("uci: %v", err)
+	}
+}
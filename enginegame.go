@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Adjudication ends engine games early. A game is adjudicated as won once both engines have
+// agreed for ResignMoves moves each that the same side is at least ResignScore centipawns
+// ahead, and as drawn once both have scored it within DrawScore of zero for DrawMoves moves
+// each, from move DrawAfter on, or once it has lasted MaxMoves moves. A zero count disables
+// that rule.
+type Adjudication struct {
+	ResignScore, ResignMoves        int
+	DrawScore, DrawMoves, DrawAfter int
+	MaxMoves                        int
+}
+
+// TimeControl is a chess clock setting: Base time for every Moves moves (0 = for the whole
+// game), plus Increment after each move.
+type TimeControl struct {
+	Moves     int
+	Base      time.Duration
+	Increment time.Duration
+}
+
+// ParseTimeControl reads a time control in seconds such as "60+0.6" (a minute plus 0.6
+// seconds a move), "40/120" (two minutes for every 40 moves) or "300".
+func ParseTimeControl(s string) (TimeControl, error) {
+	var tc TimeControl
+	rest := s
+	if moves, after, ok := strings.Cut(rest, "/"); ok {
+		n, err := strconv.Atoi(moves)
+		if err != nil || n <= 0 {
+			return tc, fmt.Errorf("time control %q: bad move count", s)
+		}
+		tc.Moves, rest = n, after
+	}
+	base, inc, hasInc := strings.Cut(rest, "+")
+	var err error
+	if tc.Base, err = parseSeconds(base); err != nil || tc.Base <= 0 {
+		return tc, fmt.Errorf("time control %q: bad base time", s)
+	}
+	if hasInc {
+		if tc.Increment, err = parseSeconds(inc); err != nil || tc.Increment < 0 {
+			return tc, fmt.Errorf("time control %q: bad increment", s)
+		}
+	}
+	return tc, nil
+}
+
+func parseSeconds(s string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// String formats the time control as ParseTimeControl reads it, which is also the form of
+// the PGN TimeControl tag.
+func (tc TimeControl) String() string {
+	var sb strings.Builder
+	if tc.Moves > 0 {
+		fmt.Fprintf(&sb, "%d/", tc.Moves)
+	}
+	sb.WriteString(strconv.FormatFloat(tc.Base.Seconds(), 'f', -1, 64))
+	if tc.Increment > 0 {
+		sb.WriteString("+" + strconv.FormatFloat(tc.Increment.Seconds(), 'f', -1, 64))
+	}
+	return sb.String()
+}
+
+// engineGame is a game between two engines, played from an opening to the end.
+type engineGame struct {
+	players [2]Engine // indexed by Color
+	pos     *Position
+	pgn     PGNGame
+	outcome Outcome
+	samples []TrainingSample // positions searched, not in check and not scored as mates
+	seen    map[uint64]int   // occurrences of each position, for repetitions
+
+	clocks [2]time.Duration // time left, with a TimeControl
+	moves  [2]int           // moves made in the current time control period
+}
+
+// newEngineGame sets up a game from start between white and black, with the given tags
+// besides the players, result and starting position.
+func newEngineGame(white, black Engine, start *Position, tags map[string]string) *engineGame {
+	g := &engineGame{
+		players: [2]Engine{white, black},
+		pos:     start,
+		pgn:     PGNGame{Tags: map[string]string{}},
+		seen:    map[uint64]int{searchKey(start): 1},
+	}
+	for name, value := range tags {
+		g.pgn.Tags[name] = value
+	}
+	g.pgn.Tags["White"] = white.Name()
+	g.pgn.Tags["Black"] = black.Name()
+	g.pgn.Tags["Termination"] = "normal"
+	if fen := start.FEN(); fen != standardStartFEN {
+		g.pgn.Tags["FEN"] = fen
+		g.pgn.Tags["SetUp"] = "1"
+	}
+	return g
+}
+
+// play makes move ap.
+func (g *engineGame) play(ap AppliedMove) {
+	g.pgn.Moves = append(g.pgn.Moves, formatSAN(g.pos, ap))
+	g.pos = ap.Position
+	g.seen[searchKey(g.pos)]++
+}
+
+// playOpening plays the mainline of opening, whose start position must be the game's.
+func (g *engineGame) playOpening(opening PGNGame) error {
+	moves, err := opening.Replay()
+	if err != nil {
+		return err
+	}
+	for _, ap := range moves {
+		if g.pos.Outcome().IsOver() {
+			break
+		}
+		g.play(ap)
+	}
+	return nil
+}
+
+// run lets the engines play the game out, each move searched with limits or, when tc is not
+// nil, against the clock. It returns an error when an engine fails to move or ctx is done.
+func (g *engineGame) run(ctx context.Context, limits SearchLimits, tc *TimeControl, adj Adjudication) error {
+	if tc != nil {
+		g.clocks = [2]time.Duration{tc.Base, tc.Base}
+		g.pgn.Tags["TimeControl"] = tc.String()
+	}
+	var adjudicator adjudicator
+	for {
+		if g.outcome = g.pos.Outcome(); g.outcome.IsOver() {
+			break
+		}
+		if g.seen[searchKey(g.pos)] >= 3 {
+			g.outcome = Outcome{Result: Draw, Reason: "threefold repetition"}
+			break
+		}
+		if adj.MaxMoves > 0 && len(g.pgn.Moves) >= 2*adj.MaxMoves {
+			g.adjudicate(Outcome{Result: Draw, Reason: "move limit"})
+			break
+		}
+
+		toMove := g.pos.toMove
+		if tc != nil {
+			limits = g.clockLimits(*tc)
+		}
+		var last SearchInfo
+		searched := false
+		start := time.Now()
+		ap, ok := g.players[toMove].Search(ctx, g.pos, limits, func(info SearchInfo) {
+			if info.MultiPV <= 1 {
+				last, searched = info, true
+			}
+		})
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s returned no move in %s", g.players[toMove].Name(), g.pos.FEN())
+		}
+		if tc != nil {
+			if g.clocks[toMove] -= time.Since(start); g.clocks[toMove] < 0 {
+				g.outcome = Outcome{Result: winnerAgainst(toMove), Reason: "time forfeit"}
+				g.pgn.Tags["Termination"] = "time forfeit"
+				break
+			}
+			g.clocks[toMove] += tc.Increment
+			if g.moves[toMove]++; tc.Moves > 0 && g.moves[toMove] == tc.Moves {
+				g.clocks[toMove] += tc.Base
+				g.moves[toMove] = 0
+			}
+		}
+		if searched {
+			score := scoreForAdjudication(last.Score)
+			if toMove == Black {
+				score = -score
+			}
+			if last.Score.Mate == 0 && !g.pos.IsKingInCheck(toMove) {
+				g.samples = append(g.samples, TrainingSample{FEN: g.pos.FEN(), Score: score})
+			}
+			if outcome, over := adjudicator.update(score, g.pos.moveNumber, adj); over {
+				g.adjudicate(outcome)
+				break
+			}
+		}
+		g.play(ap)
+	}
+	g.pgn.Result = g.outcome.Result.String()
+	g.pgn.Tags["Result"] = g.pgn.Result
+	return nil
+}
+
+// adjudicate ends the game with outcome by adjudication.
+func (g *engineGame) adjudicate(outcome Outcome) {
+	g.outcome = outcome
+	g.pgn.Tags["Termination"] = "adjudication"
+}
+
+// clockLimits returns the search limits for the side to move under tc.
+func (g *engineGame) clockLimits(tc TimeControl) SearchLimits {
+	limits := SearchLimits{
+		WTime: g.clocks[White], BTime: g.clocks[Black],
+		WInc: tc.Increment, BInc: tc.Increment,
+	}
+	if tc.Moves > 0 {
+		limits.MovesToGo = tc.Moves - g.moves[g.pos.toMove]
+	}
+	return limits
+}
+
+// winnerAgainst returns the result of a game lost by color.
+func winnerAgainst(color Color) GameResult {
+	if color == White {
+		return BlackWins
+	}
+	return WhiteWins
+}
+
+// scoreForAdjudication converts a score to centipawns, with mates beyond any evaluation.
+func scoreForAdjudication(s Score) int {
+	switch {
+	case s.Mate > 0:
+		return mateScore - 2*s.Mate
+	case s.Mate < 0:
+		return -mateScore - 2*s.Mate
+	}
+	return s.Centipawns
+}
+
+// adjudicator tracks how long the engines' scores have agreed on a result.
+type adjudicator struct {
+	winPlies, drawPlies int
+	winner              GameResult
+}
+
+// update records the score of the move just searched, from White's point of view, and
+// reports whether the game can now be adjudicated under adj.
+func (a *adjudicator) update(score, moveNumber int, adj Adjudication) (Outcome, bool) {
+	winner := Ongoing
+	if adj.ResignMoves > 0 && abs(score) >= adj.ResignScore {
+		winner = WhiteWins
+		if score < 0 {
+			winner = BlackWins
+		}
+	}
+	if winner != Ongoing && winner == a.winner {
+		a.winPlies++
+	} else {
+		a.winner, a.winPlies = winner, 1
+	}
+	if winner != Ongoing && a.winPlies >= 2*adj.ResignMoves {
+		return Outcome{Result: winner, Reason: "adjudicated by score"}, true
+	}
+
+	if adj.DrawMoves > 0 && moveNumber >= adj.DrawAfter && abs(score) <= adj.DrawScore {
+		a.drawPlies++
+	} else {
+		a.drawPlies = 0
+	}
+	if adj.DrawMoves > 0 && a.drawPlies >= 2*adj.DrawMoves {
+		return Outcome{Result: Draw, Reason: "adjudicated by score"}, true
+	}
+	return Outcome{}, false
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdjudicator(t *testing.T) {
+	adj := Adjudication{ResignScore: 500, ResignMoves: 2, DrawScore: 10, DrawMoves: 2, DrawAfter: 30}
+	cases := []struct {
+		name       string
+		moveNumber int
+		scores     []int
+		want       GameResult // Ongoing when the game goes on
+	}{
+		{"white wins", 20, []int{600, 550, 700, 900}, WhiteWins},
+		{"black wins", 20, []int{-600, -550, -700, -900}, BlackWins},
+		{"engines disagree", 20, []int{600, 550, 300, 900, 800, 700}, Ongoing},
+		{"sides swap", 20, []int{600, 550, -700, -900}, Ongoing},
+		{"drawn", 40, []int{0, 5, -10, 3}, Draw},
+		{"too early to draw", 20, []int{0, 5, -10, 3}, Ongoing},
+		{"not quite drawn", 40, []int{0, 5, 20, 3, 0}, Ongoing},
+	}
+	for _, tc := range cases {
+		var a adjudicator
+		got := Ongoing
+		for _, score := range tc.scores {
+			if outcome, over := a.update(score, tc.moveNumber, adj); over {
+				got = outcome.Result
+				break
+			}
+		}
+		if got != tc.want {
+			t.Errorf("%s: adjudicated %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	var a adjudicator
+	for range 10 {
+		if _, over := a.update(2000, 50, Adjudication{}); over {
+			t.Fatal("adjudicated with the rules disabled")
+		}
+	}
+}
+
+func TestParseTimeControl(t *testing.T) {
+	cases := []struct {
+		in   string
+		want TimeControl
+	}{
+		{"60+0.6", TimeControl{Base: time.Minute, Increment: 600 * time.Millisecond}},
+		{"40/120", TimeControl{Moves: 40, Base: 2 * time.Minute}},
+		{"300", TimeControl{Base: 5 * time.Minute}},
+		{"0.5+0.05", TimeControl{Base: 500 * time.Millisecond, Increment: 50 * time.Millisecond}},
+	}
+	for _, tc := range cases {
+		got, err := ParseTimeControl(tc.in)
+		if err != nil {
+			t.Errorf("%s: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.in, got, tc.want)
+		}
+		if got.String() != tc.in {
+			t.Errorf("%s: formatted as %s", tc.in, got)
+		}
+	}
+	for _, bad := range []string{"", "abc", "0", "40/", "x/60", "60+", "60+-1"} {
+		if _, err := ParseTimeControl(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+// sleepyEngine thinks for a fixed time, then plays Dumbfish's move.
+type sleepyEngine struct{ delay time.Duration }
+
+func (e sleepyEngine) Name() string { return "Sleepy" }
+func (e sleepyEngine) SelectMove(pos *Position) (AppliedMove, bool) {
+	return Dumbfish{}.SelectMove(pos)
+}
+func (e sleepyEngine) Search(ctx context.Context, pos *Position, limits SearchLimits, info func(SearchInfo)) (AppliedMove, bool) {
+	time.Sleep(e.delay)
+	return Dumbfish{}.SelectMove(pos)
+}
+
+func TestEngineGame_TimeForfeit(t *testing.T) {
+	tc := TimeControl{Base: 50 * time.Millisecond}
+	g := newEngineGame(Dumbfish{Depth: 1}, sleepyEngine{100 * time.Millisecond}, NewVariantPosition(Standard), nil)
+	if err := g.run(context.Background(), SearchLimits{}, &tc, Adjudication{}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if g.outcome.Result != WhiteWins || g.pgn.Tags["Termination"] != "time forfeit" {
+		t.Errorf("expected Black to lose on time, got %+v, tags %v", g.outcome, g.pgn.Tags)
+	}
+	if len(g.pgn.Moves) != 1 || g.pgn.Tags["TimeControl"] != "0.05" {
+		t.Errorf("moves %v, time control tag %q", g.pgn.Moves, g.pgn.Tags["TimeControl"])
+	}
+}
+
+func TestEngineGame_ClockLimits(t *testing.T) {
+	tc := TimeControl{Moves: 2, Base: time.Second, Increment: 100 * time.Millisecond}
+	g := newEngineGame(Dumbfish{}, Dumbfish{}, NewVariantPosition(Standard), nil)
+	g.clocks = [2]time.Duration{tc.Base, tc.Base}
+	var limits []SearchLimits
+	recorder := searchRecorder{limits: &limits}
+	g.players = [2]Engine{recorder, recorder}
+	if err := g.run(context.Background(), SearchLimits{}, &tc, Adjudication{MaxMoves: 3}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(limits) != 6 {
+		t.Fatalf("expected 6 searches, got %d", len(limits))
+	}
+	if limits[0].MovesToGo != 2 || limits[2].MovesToGo != 1 || limits[4].MovesToGo != 2 {
+		t.Errorf("moves to go %d %d %d, want 2 1 2", limits[0].MovesToGo, limits[2].MovesToGo, limits[4].MovesToGo)
+	}
+	// After two moves White has had two increments and a new period of Base added
+	if limits[4].WTime < 2*tc.Base || limits[4].WTime > 2*tc.Base+2*tc.Increment {
+		t.Errorf("White's clock after the first period: %v", limits[4].WTime)
+	}
+	if limits[1].WInc != tc.Increment || limits[1].BTime != tc.Base {
+		t.Errorf("unexpected limits for Black's first move: %+v", limits[1])
+	}
+}
+
+// searchRecorder plays the first legal move and records the limits it was given.
+type searchRecorder struct{ limits *[]SearchLimits }
+
+func (r searchRecorder) Name() string { return "Recorder" }
+func (r searchRecorder) SelectMove(pos *Position) (AppliedMove, bool) {
+	return Dumbfish{}.SelectMove(pos)
+}
+func (r searchRecorder) Search(ctx context.Context, pos *Position, limits SearchLimits, info func(SearchInfo)) (AppliedMove, bool) {
+	*r.limits = append(*r.limits, limits)
+	return Dumbfish{}.SelectMove(pos)
+}
+
+func TestEngineGame_OpeningFromFEN(t *testing.T) {
+	opening := PGNGame{
+		Tags:  map[string]string{"FEN": "4k3/8/8/8/8/8/4P3/4K2R w K - 0 1"},
+		Moves: []string{"O-O", "Kd7"},
+	}
+	start, err := opening.StartPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newEngineGame(Dumbfish{}, Dumbfish{}, start, map[string]string{"Event": "Opening"})
+	if err := g.playOpening(opening); err != nil {
+		t.Fatalf("opening: %v", err)
+	}
+	if g.pgn.Tags["FEN"] != opening.Tags["FEN"] || g.pgn.Tags["SetUp"] != "1" || g.pgn.Tags["Event"] != "Opening" {
+		t.Errorf("unexpected tags %v", g.pgn.Tags)
+	}
+	if strings.Join(g.pgn.Moves, " ") != "O-O Kd7" || g.pos.toMove != White {
+		t.Errorf("opening not played: %v", g.pgn.Moves)
+	}
+	if g := newEngineGame(Dumbfish{}, Dumbfish{}, NewVariantPosition(Standard), nil); g.pgn.Tags["FEN"] != "" {
+		t.Errorf("standard start position given a FEN tag %q", g.pgn.Tags["FEN"])
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Piece values in centipawns, used for move ordering and exchange evaluation.
+var pieceValues = map[PieceKind]int{
+	Pawn:   100,
+	Knight: 320,
+	Bishop: 330,
+	Rook:   500,
+	Queen:  900,
+}
+
+// EvalParams are the weights of the static evaluation, in centipawns. Each term has a
+// middlegame and an endgame weight, blended by the game phase. Arrays are indexed by
+// PieceKind, and piece-square tables by square from White's side (a1 = 0, h8 = 63); Black's
+// pieces use the vertically mirrored square. The compiled-in set, defaultEvalParams, is
+// generated by the "tune" command.
+type EvalParams struct {
+	MaterialMG, MaterialEG [7]int
+	PSTMG, PSTEG           [7][64]int
+}
+
+// phaseWeights add up to totalPhase for the starting material; pawns and kings do not count.
+var phaseWeights = [7]int{Knight: 1, Bishop: 1, Rook: 2, Queen: 4}
+
+const totalPhase = 24
+
+// gamePhase returns how much non-pawn material is left, from totalPhase (opening) to 0.
+func gamePhase(pos *Position) int {
+	phase := 0
+	for i := range pos.pieces {
+		phase += phaseWeights[pos.pieces[i].Kind]
+	}
+	return min(phase, totalPhase)
+}
+
+// pstSquare returns the piece-square table index of a piece of color on square index.
+func pstSquare(index uint64, color Color) int {
+	if color == Black {
+		return int(index ^ 56)
+	}
+	return int(index)
+}
+
+// Evaluate returns a static score in centipawns from the side to move's point of view,
+// using defaultEvalParams. Crazyhouse pockets count as material.
+func Evaluate(pos *Position) int {
+	return defaultEvalParams.Evaluate(pos)
+}
+
+// Evaluate returns the score of pos under p from the side to move's point of view.
+func (p *EvalParams) Evaluate(pos *Position) int {
+	var mg, eg int
+	for i := range pos.pieces {
+		piece := &pos.pieces[i]
+		if piece.Location.IsEmpty() {
+			continue
+		}
+		sq := pstSquare(piece.Location.FirstSet(), piece.Color)
+		pieceMG := p.MaterialMG[piece.Kind] + p.PSTMG[piece.Kind][sq]
+		pieceEG := p.MaterialEG[piece.Kind] + p.PSTEG[piece.Kind][sq]
+		if piece.Color == White {
+			mg, eg = mg+pieceMG, eg+pieceEG
+		} else {
+			mg, eg = mg-pieceMG, eg-pieceEG
+		}
+	}
+	if pos.variant == Crazyhouse {
+		for _, kind := range pocketKinds {
+			n := pos.pockets[White][kind] - pos.pockets[Black][kind]
+			mg += p.MaterialMG[kind] * n
+			eg += p.MaterialEG[kind] * n
+		}
+	}
+	phase := gamePhase(pos)
+	score := (mg*phase + eg*(totalPhase-phase)) / totalPhase
+	if pos.toMove == Black {
+		return -score
+	}
+	return score
+}
+
+// EvalTerm is the middlegame and endgame weight of an evaluation term, from White's point
+// of view.
+type EvalTerm struct {
+	MG int `json:"mg"`
+	EG int `json:"eg"`
+}
+
+// EvalBreakdown itemizes an evaluation under EvalParams.
+type EvalBreakdown struct {
+	Phase       int      `json:"phase"` // from totalPhase (opening) to 0
+	Material    EvalTerm `json:"material"`
+	PieceSquare EvalTerm `json:"pieceSquare"`
+	Pockets     EvalTerm `json:"pockets"` // Crazyhouse pockets
+	White       int      `json:"white"`   // tapered total from White's point of view
+	Score       int      `json:"score"`   // the same from the side to move's, as Evaluate returns it
+}
+
+// Breakdown evaluates pos as Evaluate does, keeping the terms apart.
+func (p *EvalParams) Breakdown(pos *Position) EvalBreakdown {
+	var b EvalBreakdown
+	for i := range pos.pieces {
+		piece := &pos.pieces[i]
+		if piece.Location.IsEmpty() {
+			continue
+		}
+		sign := 1
+		if piece.Color == Black {
+			sign = -1
+		}
+		sq := pstSquare(piece.Location.FirstSet(), piece.Color)
+		b.Material.MG += sign * p.MaterialMG[piece.Kind]
+		b.Material.EG += sign * p.MaterialEG[piece.Kind]
+		b.PieceSquare.MG += sign * p.PSTMG[piece.Kind][sq]
+		b.PieceSquare.EG += sign * p.PSTEG[piece.Kind][sq]
+	}
+	if pos.variant == Crazyhouse {
+		for _, kind := range pocketKinds {
+			n := pos.pockets[White][kind] - pos.pockets[Black][kind]
+			b.Pockets.MG += p.MaterialMG[kind] * n
+			b.Pockets.EG += p.MaterialEG[kind] * n
+		}
+	}
+	b.Phase = gamePhase(pos)
+	mg := b.Material.MG + b.PieceSquare.MG + b.Pockets.MG
+	eg := b.Material.EG + b.PieceSquare.EG + b.Pockets.EG
+	b.White = (mg*b.Phase + eg*(totalPhase-b.Phase)) / totalPhase
+	b.Score = b.White
+	if pos.toMove == Black {
+		b.Score = -b.Score
+	}
+	return b
+}
+
+// runEval implements "eval [FEN]", printing the terms of the static evaluation.
+func runEval(args []string, out io.Writer) error {
+	flags := commandFlags("eval", out)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	pos, err := positionArgs(flags.Args())
+	if err != nil {
+		return err
+	}
+	b := defaultEvalParams.Breakdown(pos)
+	fmt.Fprintf(out, "Phase: %d (%d = opening, 0 = endgame)\n\n", b.Phase, totalPhase)
+	fmt.Fprintf(out, "%-14s %6s %6s\n", "Term", "MG", "EG")
+	for _, term := range []struct {
+		name string
+		EvalTerm
+	}{{"Material", b.Material}, {"Piece-square", b.PieceSquare}, {"Pockets", b.Pockets}} {
+		fmt.Fprintf(out, "%-14s %6d %6d\n", term.name, term.MG, term.EG)
+	}
+	fmt.Fprintf(out, "\nFor White:            %s\nFor the side to move: %s (%s)\n", Score{Centipawns: b.White}, Score{Centipawns: b.Score}, colorToString(pos.toMove))
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrGameOver is returned when a move is played in a game that has ended.
+var ErrGameOver = errors.New("game is over")
+
+// Game is a game in progress: the moves played from a start position and, under a
+// TimeControl, the players' clocks. Unlike Position.Outcome it sees the whole game, so it
+// also ends games by threefold repetition, time forfeit and resignation. A Game is not safe
+// for concurrent use.
+type Game struct {
+	start *Position
+	moves []AppliedMove
+	sans  []string
+
+	tc        *TimeControl
+	clock     Clock
+	clocks    [2]time.Duration // time left at the start of the current turn
+	period    [2]int           // moves made in the current time control period
+	turnStart time.Time
+
+	ended Outcome // a result not visible on the board: resignation or time forfeit
+}
+
+// NewGame starts a game from start, with clocks when tc is not nil. The clock of the side
+// to move starts running at once.
+func NewGame(start *Position, tc *TimeControl) *Game {
+	g := &Game{start: start, tc: tc, clock: systemClock{}}
+	if tc != nil {
+		g.clocks = [2]time.Duration{tc.Base, tc.Base}
+	}
+	g.turnStart = g.clock.Now()
+	return g
+}
+
+// Start returns the position the game started from.
+func (g *Game) Start() *Position { return g.start }
+
+// Position returns the current position.
+func (g *Game) Position() *Position {
+	if len(g.moves) == 0 {
+		return g.start
+	}
+	return g.moves[len(g.moves)-1].Position
+}
+
+// Moves returns the moves played so far.
+func (g *Game) Moves() []AppliedMove { return g.moves }
+
+// SAN returns the moves played so far in SAN.
+func (g *Game) SAN() []string { return g.sans }
+
+// TimeControl returns the game's time control, or nil when it is untimed.
+func (g *Game) TimeControl() *TimeControl { return g.tc }
+
+// Remaining returns the time left on color's clock, counting the current turn. It is zero
+// in untimed games and negative once the flag has fallen.
+func (g *Game) Remaining(color Color) time.Duration {
+	left := g.clocks[color]
+	if g.tc != nil && color == g.Position().toMove && !g.ended.IsOver() && !g.boardOutcome().IsOver() {
+		left -= g.clock.Now().Sub(g.turnStart)
+	}
+	return left
+}
+
+// Outcome reports whether the game is over and why.
+func (g *Game) Outcome() Outcome {
+	if g.ended.IsOver() {
+		return g.ended
+	}
+	if outcome := g.boardOutcome(); outcome.IsOver() {
+		return outcome
+	}
+	if toMove := g.Position().toMove; g.tc != nil && g.Remaining(toMove) < 0 {
+		return Outcome{Result: winnerAgainst(toMove), Reason: "time forfeit"}
+	}
+	return Outcome{Result: Ongoing}
+}
+
+// boardOutcome reports the end of the game by the moves alone, repetitions included.
+func (g *Game) boardOutcome() Outcome {
+	if outcome := g.Position().Outcome(); outcome.IsOver() {
+		return outcome
+	}
+	if g.repetitions() >= 3 {
+		return Outcome{Result: Draw, Reason: "threefold repetition"}
+	}
+	return Outcome{Result: Ongoing}
+}
+
+// repetitions counts the occurrences of the current position in the game.
+func (g *Game) repetitions() int {
+	key := searchKey(g.Position())
+	n := 0
+	if searchKey(g.start) == key {
+		n++
+	}
+	for _, ap := range g.moves {
+		if searchKey(ap.Position) == key {
+			n++
+		}
+	}
+	return n
+}
+
+// Play makes move ap, which must be legal in the current position, and passes the clock
+// to the other side. A move made after the flag fell loses on time instead.
+func (g *Game) Play(ap AppliedMove) error {
+	if g.Outcome().IsOver() {
+		return ErrGameOver
+	}
+	pos := g.Position()
+	if g.tc != nil {
+		mover := pos.toMove
+		if g.clocks[mover] = g.Remaining(mover); g.clocks[mover] < 0 {
+			g.ended = Outcome{Result: winnerAgainst(mover), Reason: "time forfeit"}
+			return ErrGameOver
+		}
+		g.clocks[mover] += g.tc.Increment
+		if g.period[mover]++; g.tc.Moves > 0 && g.period[mover] == g.tc.Moves {
+			g.clocks[mover] += g.tc.Base
+			g.period[mover] = 0
+		}
+	}
+	g.sans = append(g.sans, formatSAN(pos, ap))
+	g.moves = append(g.moves, ap)
+	g.turnStart = g.clock.Now()
+	return nil
+}
+
+// PlayInput plays a move typed by a person: UCI such as e2e4, or SAN such as Nf3.
+func (g *Game) PlayInput(input string) (AppliedMove, error) {
+	if g.Outcome().IsOver() {
+		return AppliedMove{}, ErrGameOver
+	}
+	pos := g.Position()
+	ap, ok := findUCIMove(pos, input)
+	if !ok {
+		var err error
+		if ap, err = parseSAN(pos, input); err != nil {
+			return AppliedMove{}, err
+		}
+	}
+	return ap, g.Play(ap)
+}
+
+// Resign ends the game with a loss for color.
+func (g *Game) Resign(color Color) {
+	g.End(Outcome{Result: winnerAgainst(color), Reason: colorToString(color) + " resigned"})
+}
+
+// End ends the game with an outcome decided off the board, such as a draw by agreement,
+// unless it is already over.
+func (g *Game) End(outcome Outcome) {
+	if !g.Outcome().IsOver() {
+		g.clocks[g.Position().toMove] = g.Remaining(g.Position().toMove)
+		g.ended = outcome
+	}
+}
+
+// Limits returns clock limits for a search by the side to move, or zero limits in an
+// untimed game.
+func (g *Game) Limits() SearchLimits {
+	if g.tc == nil {
+		return SearchLimits{}
+	}
+	limits := SearchLimits{
+		WTime: max(g.Remaining(White), 0), BTime: max(g.Remaining(Black), 0),
+		WInc: g.tc.Increment, BInc: g.tc.Increment,
+	}
+	if g.tc.Moves > 0 {
+		limits.MovesToGo = g.tc.Moves - g.period[g.Position().toMove]
+	}
+	return limits
+}
+
+// PGN returns the game as PGN with tags, adding the result, the start position when it is
+// not the standard one, and the time control.
+func (g *Game) PGN(tags map[string]string) PGNGame {
+	game := PGNGame{Tags: map[string]string{}, Moves: append([]string(nil), g.sans...)}
+	for name, value := range tags {
+		game.Tags[name] = value
+	}
+	if fen := g.start.FEN(); fen != standardStartFEN {
+		game.Tags["FEN"] = fen
+		game.Tags["SetUp"] = "1"
+	}
+	if g.tc != nil {
+		game.Tags["TimeControl"] = g.tc.String()
+	}
+	game.Result = g.Outcome().Result.String()
+	game.Tags["Result"] = game.Result
+	return game
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// playInputs plays moves typed as a person would, failing the test on any error.
+func playInputs(t *testing.T, g *Game, inputs ...string) {
+	t.Helper()
+	for _, input := range inputs {
+		if _, err := g.PlayInput(input); err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+	}
+}
+
+func TestGame_MovesAndOutcome(t *testing.T) {
+	g := NewGame(NewVariantPosition(Standard), nil)
+	playInputs(t, g, "f3", "e7e5", "g4")
+	if _, err := g.PlayInput("Qh5"); err == nil {
+		t.Error("illegal move accepted")
+	}
+	playInputs(t, g, "Qh4#")
+	if got := g.SAN(); len(got) != 4 || got[0] != "f3" || got[1] != "e5" || got[3] != "Qh4#" {
+		t.Errorf("SAN %v", got)
+	}
+	if outcome := g.Outcome(); outcome.Result != BlackWins || outcome.Reason != "checkmate" {
+		t.Errorf("outcome %+v", outcome)
+	}
+	if _, err := g.PlayInput("a3"); !errors.Is(err, ErrGameOver) {
+		t.Errorf("move after mate: %v", err)
+	}
+	pgn := g.PGN(map[string]string{"Event": "Test"})
+	if pgn.Result != "0-1" || pgn.Tags["Event"] != "Test" || pgn.Tags["FEN"] != "" || len(pgn.Moves) != 4 {
+		t.Errorf("PGN %+v", pgn)
+	}
+}
+
+func TestGame_RejectsAmbiguousInput(t *testing.T) {
+	g := NewGame(NewVariantPosition(Standard), nil)
+	playInputs(t, g, "d4", "d5", "Nf3", "Nf6")
+	// Both knights reach d2, so a person must say which
+	for _, input := range []string{"Nd2", "d2", "Nzz", "Kd9"} {
+		if _, err := g.PlayInput(input); err == nil {
+			t.Errorf("%q accepted", input)
+		}
+	}
+	if _, err := g.PlayInput("Nd2"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Nd2: %v", err)
+	}
+	playInputs(t, g, "Nbd2", "Nfd7", "e2e4")
+	if got := g.SAN(); len(got) != 7 || got[4] != "Nbd2" || got[6] != "e4" {
+		t.Errorf("SAN %v", got)
+	}
+}
+
+func TestGame_RepetitionAndResignation(t *testing.T) {
+	g := NewGame(NewVariantPosition(Standard), nil)
+	playInputs(t, g, "Nf3", "Nf6", "Ng1", "Ng8", "Nf3", "Nf6", "Ng1")
+	if g.Outcome().IsOver() {
+		t.Fatal("game over before the third repetition")
+	}
+	playInputs(t, g, "Ng8")
+	if outcome := g.Outcome(); outcome.Result != Draw || outcome.Reason != "threefold repetition" {
+		t.Errorf("outcome %+v", outcome)
+	}
+
+	g = NewGame(NewVariantPosition(Standard), nil)
+	g.Resign(White)
+	if outcome := g.Outcome(); outcome.Result != BlackWins || outcome.Reason != "White resigned" {
+		t.Errorf("outcome %+v", outcome)
+	}
+}
+
+func TestGame_Clocks(t *testing.T) {
+	clock := &fakeClock{}
+	g := NewGame(NewVariantPosition(Standard), &TimeControl{Moves: 2, Base: time.Minute, Increment: time.Second})
+	g.clock, g.turnStart = clock, clock.now
+
+	clock.now = clock.now.Add(10 * time.Second)
+	if got := g.Remaining(White); got != 50*time.Second {
+		t.Errorf("White's clock runs: %v", got)
+	}
+	if got := g.Remaining(Black); got != time.Minute {
+		t.Errorf("Black's clock stands: %v", got)
+	}
+	playInputs(t, g, "e4")
+	if got := g.Remaining(White); got != 51*time.Second {
+		t.Errorf("after the increment: %v", got)
+	}
+	if limits := g.Limits(); limits.BTime != time.Minute || limits.WTime != 51*time.Second || limits.MovesToGo != 2 || limits.BInc != time.Second {
+		t.Errorf("limits %+v", limits)
+	}
+	playInputs(t, g, "e5", "Nf3")
+	// Second move of the period: a new minute is added
+	if got := g.Remaining(White); got != 51*time.Second+time.Second+time.Minute {
+		t.Errorf("after the time control: %v", got)
+	}
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	if outcome := g.Outcome(); outcome.Result != WhiteWins || outcome.Reason != "time forfeit" {
+		t.Errorf("outcome after Black's flag falls: %+v", outcome)
+	}
+	if _, err := g.PlayInput("Nc6"); !errors.Is(err, ErrGameOver) {
+		t.Errorf("move after the flag fell: %v", err)
+	}
+	if pgn := g.PGN(nil); pgn.Result != "1-0" || pgn.Tags["TimeControl"] != "2/60+1" {
+		t.Errorf("PGN tags %v", pgn.Tags)
+	}
+}
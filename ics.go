@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ICSOptions configures a session on an Internet Chess Server such as FICS. Zero values
+// take the defaults given.
+type ICSOptions struct {
+	Addr         string                           // host:port ("freechess.org:5000")
+	Handle       string                           // the account; empty logs in as a guest
+	Password     string                           // for a registered handle
+	Engine       Engine                           // plays the games (Dumbfish)
+	Accept       ChallengeRules                   // which seeks to answer and challenges to accept; Variants and MaxGames are ignored
+	Depth        int                              // search depth in untimed games (defaultSearchDepth)
+	MoveOverhead time.Duration                    // kept back from our clock for lag (500ms)
+	Logf         func(format string, args ...any) // called for events and errors, if not nil
+}
+
+// icsStandardTypes are the game types of standard chess; the client plays nothing else.
+var icsStandardTypes = []string{"lightning", "blitz", "standard", "untimed"}
+
+var (
+	icsSeekRE      = regexp.MustCompile(`^(\w+)((?:\([A-Z*]+\))*) \(\s*([^)]*)\) seeking (\d+) (\d+) (rated|unrated) (\S+).*\("play (\d+)" to respond\)`)
+	icsChallengeRE = regexp.MustCompile(`^Challenge: (\w+)((?:\([A-Z*]+\))*) \(\s*[^)]*\)(?: \[\w+\])? \w+(?:\([A-Z*]+\))* \(\s*[^)]*\) (rated|unrated) (\S+) (\d+) (\d+)`)
+	icsGameEndRE   = regexp.MustCompile(`^\{Game (\d+) \(([^)]*)\) ([^}]*)\} (\S+)`)
+	icsSessionRE   = regexp.MustCompile(`^\*\*\*\* Starting FICS session as (\w+)`)
+	icsGuestRE     = regexp.MustCompile(`^Press return to enter the server as "(\w+)"`)
+)
+
+// icsBoard is a style-12 board update: the server's one-line description of a game.
+type icsBoard struct {
+	Position   *Position
+	Game       int
+	White      string
+	Black      string
+	Relation   int // 1 our move, -1 the opponent's, 0 observing, others examining
+	Base       time.Duration
+	Increment  time.Duration
+	WhiteTime  time.Duration
+	BlackTime  time.Duration
+	MoveNumber int
+}
+
+// parseStyle12 reads a "<12> ..." line. Clocks are in milliseconds after "iset ms 1" and
+// in seconds otherwise. The position carries no history, so repetitions are not seen.
+func parseStyle12(line string, ms bool) (icsBoard, error) {
+	f := strings.Fields(line)
+	if len(f) < 30 || f[0] != "<12>" {
+		return icsBoard{}, fmt.Errorf("malformed style-12 line %q", line)
+	}
+	f = f[1:]
+	var fen strings.Builder
+	for i, rank := range f[:8] {
+		if len(rank) != 8 {
+			return icsBoard{}, fmt.Errorf("malformed rank %q", rank)
+		}
+		if i > 0 {
+			fen.WriteByte('/')
+		}
+		empty := 0
+		for _, c := range rank {
+			if c == '-' {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				fen.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			fen.WriteRune(c)
+		}
+		if empty > 0 {
+			fen.WriteString(strconv.Itoa(empty))
+		}
+	}
+	toMove := strings.ToLower(f[8])
+	fmt.Fprintf(&fen, " %s ", toMove)
+	castling := ""
+	for i, right := range "KQkq" {
+		if f[10+i] == "1" {
+			castling += string(right)
+		}
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	fen.WriteString(castling)
+	enPassant := "-"
+	if file, err := strconv.Atoi(f[9]); err == nil && file >= 0 && file < 8 {
+		enPassant = string(rune('a'+file)) + map[string]string{"w": "6", "b": "3"}[toMove]
+	}
+	numbers := make([]int, 0, 10)
+	for _, i := range []int{14, 15, 18, 19, 20, 23, 24, 25} {
+		n, err := strconv.Atoi(f[i])
+		if err != nil {
+			return icsBoard{}, fmt.Errorf("style-12 field %d: %w", i+1, err)
+		}
+		numbers = append(numbers, n)
+	}
+	fmt.Fprintf(&fen, " %s %d %d", enPassant, numbers[0], max(numbers[7], 1))
+	pos, err := ParseFEN(fen.String())
+	if err != nil {
+		return icsBoard{}, err
+	}
+	unit := time.Second
+	if ms {
+		unit = time.Millisecond
+	}
+	return icsBoard{
+		Position:   pos,
+		Game:       numbers[1],
+		White:      f[16],
+		Black:      f[17],
+		Relation:   numbers[2],
+		Base:       time.Duration(numbers[3]) * time.Minute,
+		Increment:  time.Duration(numbers[4]) * time.Second,
+		WhiteTime:  time.Duration(numbers[5]) * unit,
+		BlackTime:  time.Duration(numbers[6]) * unit,
+		MoveNumber: numbers[7],
+	}, nil
+}
+
+// icsOffer turns a seek or challenge into the challenge ChallengeRules judge.
+func icsOffer(id, handle, titles, rated, kind, base, increment string) lichessChallenge {
+	var ch lichessChallenge
+	ch.ID = id
+	ch.Challenger = lichessUser{ID: strings.ToLower(handle), Name: handle}
+	if strings.Contains(titles, "(C)") {
+		ch.Challenger.Title = "BOT"
+	}
+	ch.Variant.Key = "standard"
+	ch.Rated = rated == "rated"
+	ch.Speed = kind
+	minutes, _ := strconv.Atoi(base)
+	seconds, _ := strconv.Atoi(increment)
+	if minutes == 0 && seconds == 0 {
+		ch.TimeControl.Type = "unlimited"
+	} else {
+		ch.TimeControl.Type = "clock"
+		ch.TimeControl.Limit, ch.TimeControl.Increment = minutes*60, seconds
+	}
+	return ch
+}
+
+// ICSClient plays standard chess on an Internet Chess Server: it logs in, answers seeks
+// and challenges that pass its rules, and moves whenever a style-12 update says it is its
+// turn, one game at a time.
+type ICSClient struct {
+	opts ICSOptions
+	conn net.Conn
+
+	mu      sync.Mutex // guards writes, and the fields below
+	self    string     // our handle, as the server knows us
+	playing bool
+	search  string             // the game, move and side being searched
+	cancel  context.CancelFunc // stops that search
+
+	wg sync.WaitGroup // searches
+}
+
+// RunICS connects to the server and plays until ctx is cancelled or the server closes the
+// connection.
+func RunICS(ctx context.Context, opts ICSOptions) error {
+	if opts.Addr == "" {
+		opts.Addr = "freechess.org:5000"
+	}
+	if opts.Engine == nil {
+		opts.Engine = Dumbfish{}
+	}
+	if opts.Depth <= 0 {
+		opts.Depth = defaultSearchDepth
+	}
+	if opts.MoveOverhead <= 0 {
+		opts.MoveOverhead = 500 * time.Millisecond
+	}
+	opts.Accept.Variants = []string{"standard"}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", opts.Addr)
+	if err != nil {
+		return err
+	}
+	c := &ICSClient{opts: opts, conn: conn}
+	defer c.wg.Wait()
+	defer c.stopSearch()
+	stopped := context.AfterFunc(ctx, func() {
+		c.send("quit")
+		conn.Close()
+	})
+	defer stopped()
+	defer conn.Close()
+	err = c.read(ctx)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (c *ICSClient) logf(format string, args ...any) {
+	if c.opts.Logf != nil {
+		c.opts.Logf(format, args...)
+	}
+}
+
+// send writes a command line.
+func (c *ICSClient) send(command string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.conn, "%s\n", command)
+}
+
+// read handles the server's output until the connection ends.
+func (c *ICSClient) read(ctx context.Context) error {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(nil, 64<<10)
+	scanner.Split(scanICSLines)
+	loggedIn := false
+	for scanner.Scan() {
+		line := cleanICSLine(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !loggedIn {
+			done, err := c.login(line)
+			if err != nil {
+				return err
+			}
+			loggedIn = done
+			continue
+		}
+		c.handle(ctx, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !loggedIn {
+		return errors.New("ics: connection closed before logging in")
+	}
+	return nil
+}
+
+// scanICSLines splits the server's output into lines ending in "\n" or "\n\r", and also
+// returns the prompts of the login dialogue, which do not end a line.
+func scanICSLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	trimmed := bytes.TrimSpace(data)
+	for _, prompt := range []string{"login:", "password:", `":`} {
+		if bytes.HasSuffix(trimmed, []byte(prompt)) {
+			return len(data), data, nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// cleanICSLine drops telnet negotiation, carriage returns and the prompts preceding a line.
+func cleanICSLine(line string) string {
+	for {
+		i := strings.IndexByte(line, 0xFF)
+		if i < 0 || i+2 >= len(line) {
+			break
+		}
+		line = line[:i] + line[i+3:]
+	}
+	line = strings.TrimSpace(strings.ReplaceAll(line, "\r", ""))
+	for strings.HasPrefix(line, "fics%") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "fics%"))
+	}
+	return line
+}
+
+// login answers the login dialogue and reports when the session has started.
+func (c *ICSClient) login(line string) (bool, error) {
+	switch {
+	case strings.HasSuffix(line, "login:"):
+		handle := c.opts.Handle
+		if handle == "" {
+			handle = "guest"
+		}
+		c.send(handle)
+	case strings.HasSuffix(line, "password:"):
+		c.send(c.opts.Password)
+	case icsGuestRE.MatchString(line):
+		c.self = icsGuestRE.FindStringSubmatch(line)[1]
+		c.send("")
+	case strings.Contains(line, "Invalid password"):
+		return false, errors.New("ics: invalid password")
+	case icsSessionRE.MatchString(line):
+		c.self = icsSessionRE.FindStringSubmatch(line)[1]
+		c.logf("logged in as %s", c.self)
+		for _, command := range []string{"set style 12", "iset ms 1", "set seek 1", "set bell 0"} {
+			c.send(command)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// handle acts on a line of a started session.
+func (c *ICSClient) handle(ctx context.Context, line string) {
+	c.mu.Lock()
+	playing := c.playing
+	c.mu.Unlock()
+	switch {
+	case strings.HasPrefix(line, "<12> "):
+		board, err := parseStyle12(line, true)
+		if err != nil {
+			c.logf("%v", err)
+			return
+		}
+		c.update(ctx, board)
+	case icsGameEndRE.MatchString(line):
+		m := icsGameEndRE.FindStringSubmatch(line)
+		if strings.HasPrefix(m[3], "Creating") || strings.HasPrefix(m[3], "Continuing") {
+			return
+		}
+		c.logf("game %s (%s): %s %s", m[1], m[2], m[3], m[4])
+		c.stopSearch()
+		c.mu.Lock()
+		c.playing = false
+		c.mu.Unlock()
+	case icsSeekRE.MatchString(line):
+		m := icsSeekRE.FindStringSubmatch(line)
+		if playing || strings.EqualFold(m[1], c.self) {
+			return
+		}
+		offer := icsOffer(m[8], m[1], m[2], m[6], m[7], m[4], m[5])
+		if reason := c.judge(offer); reason != "" {
+			return
+		}
+		c.logf("answering seek %s by %s", m[8], m[1])
+		c.send("play " + m[8])
+	case icsChallengeRE.MatchString(line):
+		m := icsChallengeRE.FindStringSubmatch(line)
+		offer := icsOffer(m[1], m[1], m[2], m[3], m[4], m[5], m[6])
+		reason := c.judge(offer)
+		if reason == "" && playing {
+			reason = "later"
+		}
+		if reason != "" {
+			c.logf("declining challenge by %s: %s", m[1], reason)
+			c.send("decline " + m[1])
+			return
+		}
+		c.logf("accepting challenge by %s", m[1])
+		c.send("accept " + m[1])
+	}
+}
+
+// judge returns why an offer breaks the rules, or "" to take it.
+func (c *ICSClient) judge(offer lichessChallenge) string {
+	for _, kind := range icsStandardTypes {
+		if offer.Speed == kind {
+			return c.opts.Accept.declineReason(offer)
+		}
+	}
+	return "variant"
+}
+
+// update searches and moves when a board update says it is our turn.
+func (c *ICSClient) update(ctx context.Context, board icsBoard) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if board.Relation != 1 && board.Relation != -1 {
+		return
+	}
+	c.playing = true
+	if board.Relation != 1 {
+		return
+	}
+	pos := board.Position
+	key := fmt.Sprintf("%d %d %s", board.Game, board.MoveNumber, colorToString(pos.toMove))
+	if key == c.search {
+		return // a repeated update, such as after a draw offer
+	}
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.search = key
+	limits := SearchLimits{Depth: c.opts.Depth}
+	if board.Base > 0 || board.Increment > 0 {
+		limits = SearchLimits{WTime: board.WhiteTime, BTime: board.BlackTime, WInc: board.Increment, BInc: board.Increment}
+		own := &limits.WTime
+		if pos.toMove == Black {
+			own = &limits.BTime
+		}
+		*own = max(*own-c.opts.MoveOverhead, time.Millisecond)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer cancel()
+		best, ok := c.opts.Engine.Search(ctx, pos, limits, nil)
+		if !ok || ctx.Err() != nil {
+			return
+		}
+		// Servers take SAN without the check suffix
+		c.send(strings.TrimRight(formatSAN(pos, best), "+#"))
+	}()
+}
+
+// stopSearch abandons the search in progress, if any.
+func (c *ICSClient) stopSearch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+}
+
+// runICS implements "ics [-addr HOST:PORT] [-handle H] ...", playing on an Internet Chess
+// Server until the process is interrupted or the server hangs up.
+func runICS(args []string, out io.Writer) error {
+	flags := commandFlags("ics", out)
+	addr := flags.String("addr", "freechess.org:5000", "server to connect to")
+	handle := flags.String("handle", "", "account to log in as (default a guest)")
+	password := flags.String("password", os.Getenv("ICS_PASSWORD"), "the account's password")
+	speeds := flags.String("speeds", "", "comma-separated game types to play, such as blitz,standard (default any)")
+	mode := flags.String("mode", "", "play only rated or only unrated games (default either)")
+	minBase := flags.Duration("min-base", 0, "shortest initial clock to play")
+	maxBase := flags.Duration("max-base", 0, "longest initial clock to play (default any)")
+	noBots := flags.Bool("no-bots", false, "ignore seeks and challenges from computer accounts")
+	depth := flags.Int("depth", defaultSearchDepth, "search depth in untimed games")
+	spec := flags.String("engine", "dumbfish", engineFlagHelp)
+	options := flags.String("options", "", "UCI options as Name=Value,...")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *mode == "unrated" {
+		*mode = "casual"
+	}
+	engine, closer, err := openEngine(*spec, *options)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer()
+	}
+	rules := ChallengeRules{Speeds: splitList(*speeds), Mode: *mode, MinBase: *minBase, MaxBase: *maxBase, NoBots: *noBots}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return RunICS(ctx, ICSOptions{Addr: *addr, Handle: *handle, Password: *password, Engine: engine, Accept: rules, Depth: *depth,
+		Logf: func(format string, args ...any) { fmt.Fprintf(out, format+"\n", args...) }})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// icsScript plays the server's side of a session on a local TCP port.
+type icsScript struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// startICSScript listens on a local port and runs script on the first connection.
+func startICSScript(t *testing.T, script func(s *icsScript)) (addr string, done chan struct{}) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		script(&icsScript{t: t, conn: conn, r: bufio.NewReader(conn)})
+	}()
+	return listener.Addr().String(), done
+}
+
+// send writes server output as is; lines end in "\n\r" as on FICS.
+func (s *icsScript) send(text string) {
+	s.conn.Write([]byte(text))
+}
+
+// read returns the client's next command line.
+func (s *icsScript) read() string {
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		s.t.Errorf("reading a command: %v", err)
+	}
+	return strings.TrimSpace(line)
+}
+
+func (s *icsScript) expect(commands ...string) {
+	for _, want := range commands {
+		if got := s.read(); got != want {
+			s.t.Errorf("got command %q, want %q", got, want)
+		}
+	}
+}
+
+// afterE4 is the style-12 update of 1.e4 in a 5 3 game where chessx has Black, clocks in
+// milliseconds.
+const afterE4 = "<12> rnbqkbnr pppppppp -------- -------- ----P--- -------- PPPP-PPP RNBQKBNR B 4 1 1 1 1 0 12 Guest chessx 1 5 3 0 1500 300000 295000 1 P/e2-e4 (0:05) e4 1 0 0\n\r"
+
+func TestParseStyle12(t *testing.T) {
+	board, err := parseStyle12(strings.TrimSpace(afterE4), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fen := board.Position.FEN(); fen != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1" {
+		t.Errorf("FEN %s", fen)
+	}
+	if board.Game != 12 || board.White != "Guest" || board.Black != "chessx" || board.Relation != 1 ||
+		board.Base != 5*time.Minute || board.Increment != 3*time.Second || board.BlackTime != 295*time.Second {
+		t.Errorf("board %+v", board)
+	}
+	if board, _ := parseStyle12(strings.TrimSpace(afterE4), false); board.WhiteTime != 300000*time.Second {
+		t.Errorf("clocks in seconds: %v", board.WhiteTime)
+	}
+	if _, err := parseStyle12("<12> rnbqkbnr pppppppp", true); err == nil {
+		t.Error("truncated line accepted")
+	}
+}
+
+func TestICS_SeeksAndGames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, done := startICSScript(t, func(s *icsScript) {
+		s.send("\xff\xfb\x01Welcome to the test ICS\n\rlogin: ")
+		s.expect("chessx")
+		s.send("password: ")
+		s.expect("secret")
+		s.send("**** Starting FICS session as chessx(C) ****\n\rfics% ")
+		s.expect("set style 12", "iset ms 1", "set seek 1", "set bell 0")
+
+		// Too fast, a computer, a variant, then one to answer
+		s.send("fics% Foo (1500) seeking 1 0 rated lightning (\"play 3\" to respond)\n\r")
+		s.send("Bar(C) (1800) seeking 5 0 unrated blitz (\"play 4\" to respond)\n\r")
+		s.send("Baz (1600) seeking 5 3 unrated wild/fr (\"play 5\" to respond)\n\r")
+		s.send("Guest (++++) seeking 5 3 unrated blitz f (\"play 6\" to respond)\n\r")
+		s.expect("play 6")
+
+		s.send("Creating: Guest (++++) chessx (----) unrated blitz 5 3\n\r{Game 12 (Guest vs. chessx) Creating unrated blitz match.}\n\r")
+		s.send(afterE4)
+		pos, _ := parseStyle12(strings.TrimSpace(afterE4), true)
+		if move := s.read(); move == "" || strings.ContainsAny(move, "+#") {
+			s.t.Errorf("move %q", move)
+		} else if _, err := parseSAN(pos.Position, move); err != nil {
+			s.t.Errorf("move %q: %v", move, err)
+		}
+		// The same update again does not start another search
+		s.send(afterE4)
+		s.send("Challenge: Qux (1700) chessx (----) unrated blitz 5 0.\n\r")
+		s.expect("decline Qux")
+		s.send("{Game 12 (Guest vs. chessx) Guest resigns} 0-1\n\r")
+		s.send("Challenge: Qux (1700) chessx (----) unrated blitz 5 0.\n\r")
+		s.expect("accept Qux")
+		cancel()
+		s.expect("quit")
+	})
+	var limits []SearchLimits
+	err := RunICS(ctx, ICSOptions{Addr: addr, Handle: "chessx", Password: "secret", Engine: searchRecorder{&limits},
+		Accept: ChallengeRules{MinBase: 3 * time.Minute, NoBots: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if len(limits) != 1 || limits[0].BTime != 295*time.Second-500*time.Millisecond || limits[0].WTime != 300*time.Second || limits[0].WInc != 3*time.Second {
+		t.Errorf("limits %+v", limits)
+	}
+}
+
+func TestICS_Login(t *testing.T) {
+	addr, done := startICSScript(t, func(s *icsScript) {
+		s.send("login: ")
+		s.expect("guest")
+		s.send("\n\rPress return to enter the server as \"GuestABCD\":")
+		s.expect("")
+		s.send("**** Starting FICS session as GuestABCD(U) ****\n\r")
+		s.expect("set style 12", "iset ms 1", "set seek 1", "set bell 0")
+		// The session ends when the server hangs up
+	})
+	if err := RunICS(context.Background(), ICSOptions{Addr: addr}); err != nil {
+		t.Errorf("guest session: %v", err)
+	}
+	<-done
+
+	addr, done = startICSScript(t, func(s *icsScript) {
+		s.send("login: ")
+		s.expect("chessx")
+		s.send("password: ")
+		s.expect("wrong")
+		s.send("\n\r**** Invalid password! ****\n\r")
+	})
+	if err := RunICS(context.Background(), ICSOptions{Addr: addr, Handle: "chessx", Password: "wrong"}); err == nil || !strings.Contains(err.Error(), "invalid password") {
+		t.Errorf("bad password: %v", err)
+	}
+	<-done
+}
@@ -0,0 +1,607 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errLichessUnauthorized stops the bot: retrying a rejected token cannot help.
+var errLichessUnauthorized = errors.New("lichess: token rejected")
+
+// LichessOptions configures a bot account on Lichess or any server speaking its Bot API.
+// Zero values take the defaults given.
+type LichessOptions struct {
+	BaseURL      string                           // the server ("https://lichess.org")
+	Token        string                           // a personal API token with the bot:play scope
+	Engine       Engine                           // plays every game; shared when several run at once (Dumbfish)
+	Accept       ChallengeRules                   // which challenges to accept
+	Depth        int                              // search depth in games without a clock (defaultSearchDepth)
+	MoveOverhead time.Duration                    // kept back from our clock for network lag (300ms)
+	MinBackoff   time.Duration                    // first wait before reconnecting a dropped stream (1s)
+	MaxBackoff   time.Duration                    // longest wait, also used after HTTP 429 (1 minute)
+	StallTimeout time.Duration                    // reconnect a stream silent for this long; the server sends keep-alives (30s)
+	Client       *http.Client                     // http.DefaultClient
+	Logf         func(format string, args ...any) // called for events and errors, if not nil
+}
+
+// ChallengeRules decide which challenges the bot accepts. Empty fields accept anything.
+type ChallengeRules struct {
+	Variants     []string      // variant keys such as "standard" (["standard"])
+	Speeds       []string      // speeds such as "blitz" or "correspondence"
+	Mode         string        // "rated" or "casual"
+	MinBase      time.Duration // shortest initial clock
+	MaxBase      time.Duration // longest initial clock
+	MaxIncrement time.Duration // largest increment
+	NoBots       bool          // decline other bots
+	Blocked      []string      // user ids always declined
+	MaxGames     int           // games played at once (1)
+}
+
+// lichessChallenge is the challenge object of the event stream.
+type lichessChallenge struct {
+	ID          string         `json:"id"`
+	Challenger  lichessUser    `json:"challenger"`
+	Variant     lichessVariant `json:"variant"`
+	Rated       bool           `json:"rated"`
+	Speed       string         `json:"speed"`
+	TimeControl struct {
+		Type      string `json:"type"`      // "clock", "correspondence" or "unlimited"
+		Limit     int    `json:"limit"`     // seconds, for "clock"
+		Increment int    `json:"increment"` // seconds, for "clock"
+	} `json:"timeControl"`
+}
+
+type lichessUser struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Title  string `json:"title"`
+	Rating int    `json:"rating"`
+}
+
+type lichessVariant struct {
+	Key string `json:"key"`
+}
+
+// lichessEvent is a line of /api/stream/event.
+type lichessEvent struct {
+	Type      string           `json:"type"` // "challenge", "gameStart", "gameFinish", ...
+	Challenge lichessChallenge `json:"challenge"`
+	Game      struct {
+		ID     string `json:"id"`
+		GameID string `json:"gameId"`
+	} `json:"game"`
+}
+
+// lichessGameEvent is a line of /api/bot/game/stream/{id}: "gameFull" once on connecting,
+// then "gameState" after every move or clock change.
+type lichessGameEvent struct {
+	Type       string           `json:"type"`
+	White      lichessUser      `json:"white"`
+	Black      lichessUser      `json:"black"`
+	Variant    lichessVariant   `json:"variant"`
+	InitialFEN string           `json:"initialFen"`
+	Clock      *json.RawMessage `json:"clock"` // null in games without a clock
+	State      lichessGameState `json:"state"`
+	lichessGameState
+}
+
+type lichessGameState struct {
+	Moves  string `json:"moves"` // in UCI, space-separated
+	WTime  int64  `json:"wtime"` // milliseconds
+	BTime  int64  `json:"btime"`
+	WInc   int64  `json:"winc"`
+	BInc   int64  `json:"binc"`
+	Status string `json:"status"` // "started" until the game ends
+	Winner string `json:"winner"`
+}
+
+// LichessBot accepts challenges and plays them with an engine. Both the account's event
+// stream and every game stream reconnect with exponential backoff when they drop.
+type LichessBot struct {
+	opts LichessOptions
+	id   string // the account's user id, to tell our color
+
+	mu      sync.Mutex
+	games   map[string]bool // games being played
+	pending map[string]bool // challenges accepted whose games have not started
+	wg      sync.WaitGroup
+}
+
+// NewLichessBot returns a bot; Run connects it.
+func NewLichessBot(opts LichessOptions) *LichessBot {
+	if opts.BaseURL == "" {
+		opts.BaseURL = "https://lichess.org"
+	}
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	if opts.Engine == nil {
+		opts.Engine = Dumbfish{}
+	}
+	if opts.Depth <= 0 {
+		opts.Depth = defaultSearchDepth
+	}
+	if opts.MoveOverhead <= 0 {
+		opts.MoveOverhead = 300 * time.Millisecond
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Minute
+	}
+	if opts.StallTimeout <= 0 {
+		opts.StallTimeout = 30 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if len(opts.Accept.Variants) == 0 {
+		opts.Accept.Variants = []string{"standard"}
+	}
+	if opts.Accept.MaxGames <= 0 {
+		opts.Accept.MaxGames = 1
+	}
+	return &LichessBot{opts: opts, games: map[string]bool{}, pending: map[string]bool{}}
+}
+
+// Run plays until ctx is cancelled or the token is rejected, then waits for the games in
+// progress to stop.
+func (b *LichessBot) Run(ctx context.Context) error {
+	defer b.wg.Wait()
+	var account lichessUser
+	if err := b.request(ctx, "GET", "/api/account", nil, &account); err != nil {
+		return err
+	}
+	b.id = account.ID
+	b.logf("connected as %s", account.ID)
+	err := b.stream(ctx, "/api/stream/event", func(line []byte) bool {
+		var event lichessEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			b.logf("bad event %s: %v", line, err)
+			return true
+		}
+		b.handleEvent(ctx, event)
+		return true
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (b *LichessBot) logf(format string, args ...any) {
+	if b.opts.Logf != nil {
+		b.opts.Logf(format, args...)
+	}
+}
+
+func (b *LichessBot) handleEvent(ctx context.Context, event lichessEvent) {
+	switch event.Type {
+	case "challenge":
+		ch := event.Challenge
+		if ch.Challenger.ID == b.id {
+			return // our own challenge to someone else
+		}
+		b.mu.Lock()
+		busy := len(b.games)+len(b.pending) >= b.opts.Accept.MaxGames
+		reason := b.opts.Accept.declineReason(ch)
+		if reason == "" && busy {
+			reason = "later"
+		}
+		if reason == "" {
+			// Held against MaxGames until the game starts or the challenge is cancelled
+			b.pending[ch.ID] = true
+		}
+		b.mu.Unlock()
+		if reason != "" {
+			b.logf("declining challenge %s from %s: %s", ch.ID, ch.Challenger.Name, reason)
+			form := url.Values{"reason": {reason}}
+			if err := b.request(ctx, "POST", "/api/challenge/"+ch.ID+"/decline", form, nil); err != nil {
+				b.logf("decline %s: %v", ch.ID, err)
+			}
+			return
+		}
+		b.logf("accepting challenge %s from %s", ch.ID, ch.Challenger.Name)
+		if err := b.request(ctx, "POST", "/api/challenge/"+ch.ID+"/accept", nil, nil); err != nil {
+			b.logf("accept %s: %v", ch.ID, err)
+			b.mu.Lock()
+			delete(b.pending, ch.ID)
+			b.mu.Unlock()
+		}
+	case "challengeCanceled":
+		b.mu.Lock()
+		delete(b.pending, event.Challenge.ID)
+		b.mu.Unlock()
+	case "gameStart":
+		id := event.Game.GameID
+		if id == "" {
+			id = event.Game.ID
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.pending, id) // a challenge's game has the challenge's id
+		if id == "" || b.games[id] {
+			return // the stream repeats games in progress when it reconnects
+		}
+		b.games[id] = true
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.play(ctx, id)
+			b.mu.Lock()
+			delete(b.games, id)
+			b.mu.Unlock()
+		}()
+	}
+}
+
+// declineReason returns why ch breaks the rules, as one of the reasons the Bot API takes,
+// or "" to accept it.
+func (r ChallengeRules) declineReason(ch lichessChallenge) string {
+	switch {
+	case slices.Contains(r.Blocked, ch.Challenger.ID):
+		return "generic"
+	case r.NoBots && ch.Challenger.Title == "BOT":
+		return "noBot"
+	case !slices.ContainsFunc(r.Variants, func(v string) bool { return strings.EqualFold(v, ch.Variant.Key) }):
+		return "variant"
+	case r.Mode == "rated" && !ch.Rated:
+		return "casual"
+	case r.Mode == "casual" && ch.Rated:
+		return "rated"
+	case len(r.Speeds) > 0 && !slices.Contains(r.Speeds, ch.Speed):
+		return "timeControl"
+	}
+	if ch.TimeControl.Type != "clock" {
+		if r.MaxBase > 0 {
+			return "tooSlow"
+		}
+		return ""
+	}
+	base := time.Duration(ch.TimeControl.Limit) * time.Second
+	increment := time.Duration(ch.TimeControl.Increment) * time.Second
+	switch {
+	case base < r.MinBase:
+		return "tooFast"
+	case r.MaxBase > 0 && base > r.MaxBase, r.MaxIncrement > 0 && increment > r.MaxIncrement:
+		return "tooSlow"
+	}
+	return ""
+}
+
+// lichessGame is the state of one game the bot plays.
+type lichessGame struct {
+	id      string
+	color   Color
+	start   *Position
+	clocked bool
+	cancel  context.CancelFunc // stops that search
+
+	mu  sync.Mutex // guards ply, which is reset when a move cannot be posted
+	ply int        // the ply we last searched or moved at, -1 for none
+}
+
+// play follows a game's stream, moving whenever it is the bot's turn, until the game ends.
+func (b *LichessBot) play(ctx context.Context, id string) {
+	b.logf("game %s started", id)
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	g := &lichessGame{id: id, ply: -1}
+	defer func() {
+		if g.cancel != nil {
+			g.cancel()
+		}
+	}()
+	err := b.stream(ctx, "/api/bot/game/stream/"+id, func(line []byte) bool {
+		var event lichessGameEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			b.logf("game %s: bad event %s: %v", id, line, err)
+			return true
+		}
+		switch event.Type {
+		case "gameFull":
+			if err := g.setup(event, b.id); err != nil {
+				b.logf("game %s: %v", id, err)
+				return false
+			}
+			return b.update(ctx, g, event.State)
+		case "gameState":
+			if g.start == nil {
+				return true
+			}
+			return b.update(ctx, g, event.lichessGameState)
+		}
+		return true
+	})
+	if err != nil && ctx.Err() == nil {
+		b.logf("game %s: %v", id, err)
+	}
+}
+
+// setup reads the players and the start position from a gameFull event.
+func (g *lichessGame) setup(event lichessGameEvent, self string) error {
+	switch self {
+	case event.White.ID:
+		g.color = White
+	case event.Black.ID:
+		g.color = Black
+	default:
+		return fmt.Errorf("not a player (white %s, black %s)", event.White.ID, event.Black.ID)
+	}
+	key := event.Variant.Key
+	if strings.EqualFold(key, "fromPosition") {
+		key = "standard"
+	}
+	variant, err := ParseVariant(key)
+	if err != nil {
+		return err
+	}
+	if event.InitialFEN == "" || event.InitialFEN == "startpos" {
+		g.start = NewVariantPosition(variant)
+	} else {
+		if g.start, err = ParseFEN(event.InitialFEN); err != nil {
+			return fmt.Errorf("initial FEN: %w", err)
+		}
+		g.start.SetVariant(variant)
+	}
+	g.clocked = event.Clock != nil && string(*event.Clock) != "null"
+	return nil
+}
+
+// update replays the game's moves and, on the bot's turn, searches and posts a move in the
+// background. It returns false once the game is over.
+func (b *LichessBot) update(ctx context.Context, g *lichessGame, state lichessGameState) bool {
+	if state.Status != "started" && state.Status != "created" {
+		b.logf("game %s over: %s %s", g.id, state.Status, state.Winner)
+		return false
+	}
+	pos := g.start
+	moves := strings.Fields(state.Moves)
+	for _, uci := range moves {
+		ap, ok := findUCIMove(pos, uci)
+		if !ok {
+			b.logf("game %s: illegal move %s in %s", g.id, uci, state.Moves)
+			return false
+		}
+		pos = ap.Position
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if pos.toMove != g.color || g.ply == len(moves) {
+		// Not our turn, or a draw offer or clock update while we think
+		return true
+	}
+	if g.cancel != nil {
+		g.cancel()
+	}
+	ply := len(moves)
+	g.ply = ply
+	limits := SearchLimits{Depth: b.opts.Depth}
+	var deadline time.Time // when our flag falls; zero in untimed games
+	if g.clocked {
+		limits = SearchLimits{
+			WTime: time.Duration(state.WTime) * time.Millisecond,
+			BTime: time.Duration(state.BTime) * time.Millisecond,
+			WInc:  time.Duration(state.WInc) * time.Millisecond,
+			BInc:  time.Duration(state.BInc) * time.Millisecond,
+		}
+		own := &limits.WTime
+		if g.color == Black {
+			own = &limits.BTime
+		}
+		deadline = time.Now().Add(*own)
+		*own = max(*own-b.opts.MoveOverhead, time.Millisecond)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	g.cancel = cancel
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer cancel()
+		best, ok := b.opts.Engine.Search(ctx, pos, limits, nil)
+		if !ok || ctx.Err() != nil {
+			return
+		}
+		move := best.Move.UCINotation()
+		if err := b.postMove(ctx, g.id, move, deadline); err != nil {
+			b.logf("game %s: move %s: %v", g.id, move, err)
+			// Search again on the next update rather than wait for a move that was not made
+			g.mu.Lock()
+			if g.ply == ply {
+				g.ply = -1
+			}
+			g.mu.Unlock()
+		}
+	}()
+	return true
+}
+
+// lichessMoveRetry is the first wait before posting a move again after a failure.
+const lichessMoveRetry = 100 * time.Millisecond
+
+// postMove posts a move, retrying failures after a backoff that doubles up to MaxBackoff,
+// for as long as the next attempt would come before deadline, unless deadline is zero.
+func (b *LichessBot) postMove(ctx context.Context, id, move string, deadline time.Time) error {
+	wait := lichessMoveRetry
+	for {
+		err := b.request(ctx, "POST", "/api/bot/game/"+id+"/move/"+move, nil, nil)
+		if err == nil || errors.Is(err, errLichessUnauthorized) || ctx.Err() != nil {
+			return err
+		}
+		if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+			return err
+		}
+		b.logf("game %s: move %s: %v; retrying in %v", id, move, err, wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, b.opts.MaxBackoff)
+	}
+}
+
+// request sends a request to the API with the token, decoding a JSON answer into result if
+// it is not nil.
+func (b *LichessBot) request(ctx context.Context, method, path string, form url.Values, result any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, b.opts.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("Authorization", "Bearer "+b.opts.Token)
+	resp, err := b.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := lichessStatus(resp); err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// lichessStatus turns an unsuccessful response into an error.
+func lichessStatus(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return errLichessUnauthorized
+	case resp.StatusCode >= 300:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// errLichessRateLimited makes stream wait the longest backoff, as the API asks after a 429.
+var errLichessRateLimited = errors.New("lichess: rate limited")
+
+// stream calls handle with each line of the NDJSON stream at path, skipping keep-alives,
+// until handle returns false or ctx is cancelled. Dropped, failed or stalled connections
+// are retried after a backoff that doubles up to MaxBackoff and resets once a connection
+// delivers data.
+func (b *LichessBot) stream(ctx context.Context, path string, handle func(line []byte) bool) error {
+	backoff := b.opts.MinBackoff
+	for {
+		received, done, err := b.streamOnce(ctx, path, handle)
+		if done || ctx.Err() != nil || errors.Is(err, errLichessUnauthorized) {
+			return err
+		}
+		if received {
+			backoff = b.opts.MinBackoff
+		}
+		wait := backoff
+		if errors.Is(err, errLichessRateLimited) {
+			wait = b.opts.MaxBackoff
+		}
+		if err == nil {
+			err = errors.New("stream closed")
+		}
+		b.logf("%s: %v; reconnecting in %v", path, err, wait)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, b.opts.MaxBackoff)
+	}
+}
+
+// streamOnce reads one connection of a stream. It reports whether any line arrived and
+// whether handle asked to stop.
+func (b *LichessBot) streamOnce(ctx context.Context, path string, handle func(line []byte) bool) (received, done bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stalled := time.AfterFunc(b.opts.StallTimeout, cancel)
+	defer stalled.Stop()
+	req, err := http.NewRequestWithContext(ctx, "GET", b.opts.BaseURL+path, nil)
+	if err != nil {
+		return false, true, err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.opts.Token)
+	req.Header.Set("Accept", "application/x-ndjson")
+	resp, err := b.opts.Client.Do(req)
+	if err != nil {
+		return false, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return false, false, errLichessRateLimited
+	}
+	if err := lichessStatus(resp); err != nil {
+		return false, false, err
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		stalled.Reset(b.opts.StallTimeout)
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		received = true
+		if !handle(line) {
+			return true, true, nil
+		}
+	}
+	return received, false, scanner.Err()
+}
+
+// runLichess implements "lichess [-token T] [-url URL] ...", playing as a bot account until
+// the process is interrupted.
+func runLichess(args []string, out io.Writer) error {
+	flags := commandFlags("lichess", out)
+	baseURL := flags.String("url", "https://lichess.org", "server speaking the Lichess Bot API")
+	token := flags.String("token", os.Getenv("LICHESS_TOKEN"), "API token with the bot:play scope")
+	variants := flags.String("variants", "standard", "comma-separated variants to accept")
+	speeds := flags.String("speeds", "", "comma-separated speeds to accept, such as blitz,rapid (default any)")
+	mode := flags.String("mode", "", "accept only rated or only casual games (default either)")
+	minBase := flags.Duration("min-base", 0, "shortest initial clock to accept")
+	maxBase := flags.Duration("max-base", 0, "longest initial clock to accept (default any)")
+	maxGames := flags.Int("max-games", 1, "games to play at once")
+	noBots := flags.Bool("no-bots", false, "decline challenges from other bots")
+	depth := flags.Int("depth", defaultSearchDepth, "search depth in games without a clock")
+	spec := flags.String("engine", "dumbfish", engineFlagHelp)
+	options := flags.String("options", "", "UCI options as Name=Value,...")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *token == "" {
+		return errors.New("lichess needs -token or $LICHESS_TOKEN")
+	}
+	engine, closer, err := openEngine(*spec, *options)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer()
+	}
+	rules := ChallengeRules{Variants: splitList(*variants), Speeds: splitList(*speeds), Mode: *mode,
+		MinBase: *minBase, MaxBase: *maxBase, NoBots: *noBots, MaxGames: *maxGames}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	bot := NewLichessBot(LichessOptions{BaseURL: *baseURL, Token: *token, Engine: engine, Accept: rules, Depth: *depth,
+		Logf: func(format string, args ...any) { fmt.Fprintf(out, format+"\n", args...) }})
+	return bot.Run(ctx)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLichess serves the parts of the Bot API the bot uses. Tests feed the streams line by
+// line; an empty line drops the connection. Every POST is reported on posts.
+type fakeLichess struct {
+	mu       sync.Mutex
+	streams  map[string]chan string // by path
+	connects map[string]int         // stream connections by path
+	fail     int                    // event stream connections to refuse with a 500
+	failMove int                    // move posts to refuse with a 500, reported as "FAIL path"
+	posts    chan string            // "POST path form"
+}
+
+func newFakeLichess(t *testing.T) (*fakeLichess, *httptest.Server) {
+	f := &fakeLichess{streams: map[string]chan string{}, connects: map[string]int{}, posts: make(chan string, 100)}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+// stream returns the channel feeding the stream at path.
+func (f *fakeLichess) stream(path string) chan string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.streams[path] == nil {
+		f.streams[path] = make(chan string, 100)
+	}
+	return f.streams[path]
+}
+
+func (f *fakeLichess) connections(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connects[path]
+}
+
+func (f *fakeLichess) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, `{"error": "No such token"}`, http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == "POST":
+		r.ParseForm()
+		f.mu.Lock()
+		refuse := strings.Contains(r.URL.Path, "/move/") && f.failMove > 0
+		if refuse {
+			f.failMove--
+		}
+		f.mu.Unlock()
+		if refuse {
+			f.posts <- "FAIL " + r.URL.Path
+			http.Error(w, "try again", http.StatusInternalServerError)
+			return
+		}
+		f.posts <- strings.TrimSpace("POST " + r.URL.Path + " " + r.PostForm.Encode())
+	case r.URL.Path == "/api/account":
+		fmt.Fprint(w, `{"id": "chessxbot", "username": "ChessxBot", "title": "BOT"}`)
+	default:
+		lines := f.stream(r.URL.Path)
+		f.mu.Lock()
+		f.connects[r.URL.Path]++
+		refuse := r.URL.Path == "/api/stream/event" && f.connects[r.URL.Path] <= f.fail
+		f.mu.Unlock()
+		if refuse {
+			http.Error(w, "try again", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case line := <-lines:
+				if line == "" {
+					return
+				}
+				// Tests wrap long events; NDJSON keeps each on one line
+				fmt.Fprintln(w, strings.ReplaceAll(line, "\n", " "))
+				w.(http.Flusher).Flush()
+			}
+		}
+	}
+}
+
+// expectPost waits for the next POST.
+func (f *fakeLichess) expectPost(t *testing.T) string {
+	t.Helper()
+	select {
+	case post := <-f.posts:
+		return post
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request from the bot")
+		return ""
+	}
+}
+
+// runBot runs a bot against server until the test ends or stop is called.
+func runBot(t *testing.T, opts LichessOptions) (stop func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- NewLichessBot(opts).Run(ctx) }()
+	var once sync.Once
+	var err error
+	stop = func() error {
+		once.Do(func() {
+			cancel()
+			err = <-done
+		})
+		return err
+	}
+	t.Cleanup(func() { stop() })
+	return stop
+}
+
+func TestLichessBot_Challenges(t *testing.T) {
+	f, server := newFakeLichess(t)
+	runBot(t, LichessOptions{BaseURL: server.URL, Token: "secret", Accept: ChallengeRules{
+		Speeds: []string{"blitz", "rapid"}, Mode: "rated", MinBase: 3 * time.Minute, NoBots: true,
+	}})
+	events := f.stream("/api/stream/event")
+	challenge := func(id, challenger, variant, speed string, rated bool, limit int) string {
+		return fmt.Sprintf(`{"type": "challenge", "challenge": {"id": %q, "challenger": {"id": %q, "name": %[2]q, "title": %q},
+			"variant": {"key": %q}, "rated": %t, "speed": %q, "timeControl": {"type": "clock", "limit": %d, "increment": 2}}}`,
+			id, challenger, map[bool]string{true: "BOT"}[challenger == "otherbot"], variant, rated, speed, limit)
+	}
+	for _, c := range []struct {
+		event, post string
+	}{
+		{challenge("c1", "alice", "standard", "blitz", true, 300), "POST /api/challenge/c1/accept"},
+		{challenge("c2", "alice", "atomic", "blitz", true, 300), "POST /api/challenge/c2/decline reason=variant"},
+		{challenge("c3", "otherbot", "standard", "blitz", true, 300), "POST /api/challenge/c3/decline reason=noBot"},
+		{challenge("c4", "alice", "standard", "blitz", false, 300), "POST /api/challenge/c4/decline reason=casual"},
+		{challenge("c5", "alice", "standard", "bullet", true, 60), "POST /api/challenge/c5/decline reason=timeControl"},
+		{challenge("c6", "alice", "standard", "blitz", true, 120), "POST /api/challenge/c6/decline reason=tooFast"},
+		{challenge("c7", "chessxbot", "atomic", "blitz", true, 300), ""}, // our own
+		// Busy with a game: later
+		{`{"type": "gameStart", "game": {"gameId": "g1", "id": "g1"}}`, ""},
+		{challenge("c8", "bob", "standard", "rapid", true, 600), "POST /api/challenge/c8/decline reason=later"},
+	} {
+		events <- c.event
+		if c.post != "" {
+			if got := f.expectPost(t); got != c.post {
+				t.Errorf("got %q, want %q", got, c.post)
+			}
+		}
+	}
+}
+
+func TestLichessBot_CountsAcceptedChallenges(t *testing.T) {
+	f, server := newFakeLichess(t)
+	runBot(t, LichessOptions{BaseURL: server.URL, Token: "secret"})
+	events := f.stream("/api/stream/event")
+	challenge := func(kind, id string) string {
+		return fmt.Sprintf(`{"type": %q, "challenge": {"id": %q, "challenger": {"id": "alice", "name": "alice"},
+			"variant": {"key": "standard"}, "speed": "blitz", "timeControl": {"type": "clock", "limit": 300, "increment": 2}}}`, kind, id)
+	}
+	for _, c := range []struct {
+		event, post string
+	}{
+		{challenge("challenge", "c1"), "POST /api/challenge/c1/accept"},
+		// c1's game has not started, but it is the one game allowed
+		{challenge("challenge", "c2"), "POST /api/challenge/c2/decline reason=later"},
+		{challenge("challengeCanceled", "c1"), ""},
+		{challenge("challenge", "c3"), "POST /api/challenge/c3/accept"},
+		{`{"type": "gameStart", "game": {"gameId": "c3", "id": "c3"}}`, ""},
+		{challenge("challenge", "c4"), "POST /api/challenge/c4/decline reason=later"},
+	} {
+		events <- c.event
+		if c.post != "" {
+			if got := f.expectPost(t); got != c.post {
+				t.Errorf("got %q, want %q", got, c.post)
+			}
+		}
+	}
+}
+
+func TestLichessBot_RetriesMove(t *testing.T) {
+	f, server := newFakeLichess(t)
+	f.failMove = 2
+	runBot(t, LichessOptions{BaseURL: server.URL, Token: "secret", Depth: 1})
+	f.stream("/api/stream/event") <- `{"type": "gameStart", "game": {"gameId": "g1"}}`
+	f.stream("/api/bot/game/stream/g1") <- `{"type": "gameFull", "id": "g1", "variant": {"key": "standard"}, "initialFen": "startpos",
+		"clock": {"initial": 60000, "increment": 0}, "white": {"id": "chessxbot"}, "black": {"id": "alice"},
+		"state": {"type": "gameState", "moves": "", "wtime": 60000, "btime": 60000, "status": "started"}}`
+	for i := 0; i < 2; i++ {
+		if got := f.expectPost(t); !strings.HasPrefix(got, "FAIL /api/bot/game/g1/move/") {
+			t.Fatalf("got %q, want a refused move", got)
+		}
+	}
+	if got := f.expectPost(t); !strings.HasPrefix(got, "POST /api/bot/game/g1/move/") {
+		t.Errorf("got %q, want the move posted again", got)
+	}
+}
+
+func TestLichessBot_PlaysGame(t *testing.T) {
+	f, server := newFakeLichess(t)
+	var limits []SearchLimits
+	stop := runBot(t, LichessOptions{BaseURL: server.URL, Token: "secret", Engine: searchRecorder{&limits}})
+	f.stream("/api/stream/event") <- `{"type": "gameStart", "game": {"gameId": "g1"}}`
+	game := f.stream("/api/bot/game/stream/g1")
+	game <- `{"type": "gameFull", "id": "g1", "variant": {"key": "standard"}, "initialFen": "startpos",
+		"clock": {"initial": 60000, "increment": 2000}, "white": {"id": "alice"}, "black": {"id": "chessxbot"},
+		"state": {"type": "gameState", "moves": "e2e4", "wtime": 60000, "btime": 55000, "winc": 2000, "binc": 2000, "status": "started"}}`
+
+	pos := NewVariantPosition(Standard)
+	moves := []string{"e2e4"}
+	play := func() {
+		t.Helper()
+		post := f.expectPost(t)
+		reply, ok := strings.CutPrefix(post, "POST /api/bot/game/g1/move/")
+		if !ok {
+			t.Fatalf("unexpected request %q", post)
+		}
+		moves = append(moves, reply)
+		p := pos
+		for _, uci := range moves {
+			ap, ok := findUCIMove(p, uci)
+			if !ok {
+				t.Fatalf("illegal move %s in %v", uci, moves)
+			}
+			p = ap.Position
+		}
+	}
+	play()
+	// The opponent answers; a draw offer repeats the position without a new move
+	moves = append(moves, "d2d4")
+	state := func(status string) string {
+		return fmt.Sprintf(`{"type": "gameState", "moves": %q, "wtime": 58000, "btime": 54000, "winc": 2000, "binc": 2000, "status": %q}`,
+			strings.Join(moves, " "), status)
+	}
+	game <- state("started")
+	game <- state("started")
+	play()
+	moves = append(moves, "g1f3")
+	game <- state("started")
+	play()
+	game <- state("resign")
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case post := <-f.posts:
+		t.Errorf("unexpected request %q", post)
+	default:
+	}
+	if len(limits) != 3 || limits[0].BTime != 55000*time.Millisecond-300*time.Millisecond || limits[0].WTime != 60*time.Second || limits[0].BInc != 2*time.Second {
+		t.Errorf("limits %+v", limits)
+	}
+}
+
+func TestLichessBot_Reconnects(t *testing.T) {
+	f, server := newFakeLichess(t)
+	f.fail = 2
+	var mu sync.Mutex
+	var logs []string
+	runBot(t, LichessOptions{BaseURL: server.URL, Token: "secret", MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 40 * time.Millisecond, StallTimeout: 200 * time.Millisecond,
+		Logf: func(format string, args ...any) {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, fmt.Sprintf(format, args...))
+		}})
+	// Two refusals, a connection that drops, then one that stalls, then one that stays up
+	events := f.stream("/api/stream/event")
+	events <- ""
+	deadline := time.Now().Add(5 * time.Second)
+	for f.connections("/api/stream/event") < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections", f.connections("/api/stream/event"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	events <- `{"type": "challenge", "challenge": {"id": "c1", "challenger": {"id": "alice"}, "variant": {"key": "standard"}, "timeControl": {"type": "unlimited"}}}`
+	if got := f.expectPost(t); got != "POST /api/challenge/c1/accept" {
+		t.Errorf("after reconnecting: %q", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if log := strings.Join(logs, "\n"); !strings.Contains(log, "500 Internal Server Error: try again; reconnecting in 10ms") ||
+		!strings.Contains(log, "reconnecting in 20ms") || !strings.Contains(log, "stream closed") {
+		t.Errorf("log:\n%s", log)
+	}
+}
+
+func TestLichessBot_RejectedToken(t *testing.T) {
+	_, server := newFakeLichess(t)
+	err := NewLichessBot(LichessOptions{BaseURL: server.URL, Token: "wrong"}).Run(context.Background())
+	if !errors.Is(err, errLichessUnauthorized) {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	_ "embed"
+)
+
+//go:embed web/live.html
+var liveHTML []byte
+
+// LiveOptions configures a live game between a person in the browser and an engine.
+type LiveOptions struct {
+	Engine      Engine
+	Human       Color        // the side played from the browser
+	Start       *Position    // nil = the standard start position
+	TimeControl *TimeControl // nil = untimed
+	Limits      SearchLimits // the engine's limits in untimed games (zero = default depth)
+}
+
+// LiveServer serves a board page and streams one game to every browser watching it over
+// WebSockets: the moves, the clocks and the engine's thinking. The first browser to connect
+// without ?watch plays; any number may watch. It drives a Game and an Engine the way the
+// terminal game of "chessx play" does: the person moves, then the engine searches and answers.
+type LiveServer struct {
+	opts LiveOptions
+
+	mu      sync.Mutex
+	game    *Game
+	gen     int                  // counts games, so that a stale search's move is dropped
+	cancel  context.CancelFunc   // stops the engine's search, if it is thinking
+	flag    *time.Timer          // fires when the side to move runs out of time
+	clients map[*liveClient]bool // connected browsers, true for the player
+	last    *liveInfo            // the engine's latest thinking on the current move
+}
+
+// liveSendQueue is how many messages may wait for a browser before it is dropped as too
+// slow to keep up.
+const liveSendQueue = 64
+
+// liveClient is a connected browser. Messages to it are queued on send and written by its
+// own goroutine, so that a slow connection never holds up the game or the other browsers.
+type liveClient struct {
+	conn *wsConn
+	send chan []byte // closed when the client is dropped
+}
+
+// liveMessage is what browsers send: {"type": "move", "move": "e2e4"}, {"type": "new",
+// "color": "black"} or {"type": "resign"}.
+type liveMessage struct {
+	Type  string `json:"type"`
+	Move  string `json:"move,omitempty"`
+	Color string `json:"color,omitempty"`
+}
+
+// liveState is sent to every browser when the game changes.
+type liveState struct {
+	Type     string         `json:"type"` // "state"
+	FEN      string         `json:"fen"`
+	Moves    []string       `json:"moves"` // in SAN
+	LastMove string         `json:"lastMove,omitempty"`
+	ToMove   string         `json:"toMove"`
+	Human    string         `json:"human"`
+	White    string         `json:"white"`
+	Black    string         `json:"black"`
+	Clocks   map[string]int `json:"clocks,omitempty"` // milliseconds left, in timed games
+	Result   string         `json:"result"`
+	Reason   string         `json:"reason,omitempty"`
+	Watchers int            `json:"watchers"`
+}
+
+// liveInfo streams the engine's thinking.
+type liveInfo struct {
+	Type  string `json:"type"` // "info"
+	Depth int    `json:"depth"`
+	Score Score  `json:"score"` // from the engine's point of view
+	Nodes int    `json:"nodes"`
+	PV    string `json:"pv"`
+}
+
+// NewLiveServer starts a game; the engine moves at once if it has White.
+func NewLiveServer(opts LiveOptions) *LiveServer {
+	if opts.Engine == nil {
+		opts.Engine = Dumbfish{}
+	}
+	if opts.Start == nil {
+		opts.Start = NewVariantPosition(Standard)
+	}
+	s := &LiveServer{opts: opts, clients: map[*liveClient]bool{}}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.newGame(opts.Human)
+	return s
+}
+
+// ServeHTTP serves the page at / and the game's WebSocket at /ws.
+func (s *LiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(liveHTML)
+	case "/ws":
+		s.serveWebSocket(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Close stops the engine and disconnects every browser.
+func (s *LiveServer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopThinking()
+	for c := range s.clients {
+		s.drop(c)
+	}
+}
+
+func (s *LiveServer) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := acceptWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	c := &liveClient{conn: conn, send: make(chan []byte, liveSendQueue)}
+	go c.writeLoop()
+	s.mu.Lock()
+	player := r.URL.Query().Get("watch") == "" && !s.hasPlayer()
+	s.clients[c] = player
+	role := "spectator"
+	if player {
+		role = "player"
+	}
+	s.sendTo(c, map[string]string{"type": "hello", "role": role})
+	s.broadcast(s.state())
+	if s.last != nil {
+		s.sendTo(c, s.last)
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.drop(c)
+		s.broadcast(s.state())
+		s.mu.Unlock()
+	}()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg liveMessage
+		s.mu.Lock()
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.sendTo(c, liveError("bad message: "+err.Error()))
+		} else if !s.clients[c] {
+			s.sendTo(c, liveError("spectators cannot play"))
+		} else if err := s.handle(msg); err != nil {
+			s.sendTo(c, liveError(err.Error()))
+		}
+		s.mu.Unlock()
+	}
+}
+
+// writeLoop writes the client's queued messages until it is dropped, then closes the
+// connection. A failed write closes it at once, which ends the client's read loop.
+func (c *liveClient) writeLoop() {
+	for data := range c.send {
+		if err := c.conn.WriteText(data); err != nil {
+			c.conn.conn.Close()
+			for range c.send {
+			}
+			return
+		}
+	}
+	c.conn.Close()
+}
+
+func liveError(message string) map[string]string {
+	return map[string]string{"type": "error", "message": message}
+}
+
+func (s *LiveServer) hasPlayer() bool {
+	for _, player := range s.clients {
+		if player {
+			return true
+		}
+	}
+	return false
+}
+
+// handle acts on a player's message.
+func (s *LiveServer) handle(msg liveMessage) error {
+	switch msg.Type {
+	case "move":
+		if s.game.Position().toMove != s.opts.Human {
+			return errors.New("it is not your move")
+		}
+		if _, err := s.game.PlayInput(msg.Move); err != nil {
+			return err
+		}
+		s.moved()
+	case "new":
+		human := s.opts.Human
+		switch strings.ToLower(msg.Color) {
+		case "white":
+			human = White
+		case "black":
+			human = Black
+		}
+		s.newGame(human)
+	case "resign":
+		s.game.Resign(s.opts.Human)
+		s.moved()
+	default:
+		return fmt.Errorf("unknown message type %q", msg.Type)
+	}
+	return nil
+}
+
+// newGame starts over with the person playing human.
+func (s *LiveServer) newGame(human Color) {
+	s.stopThinking()
+	s.opts.Human = human
+	s.game = NewGame(s.opts.Start, s.opts.TimeControl)
+	s.gen++
+	s.moved()
+}
+
+// moved tells everyone about a change in the game and, when it is the engine's move, lets
+// it think.
+func (s *LiveServer) moved() {
+	s.last = nil
+	s.broadcast(s.state())
+	if s.flag != nil {
+		s.flag.Stop()
+		s.flag = nil
+	}
+	if s.game.Outcome().IsOver() {
+		s.stopThinking()
+		return
+	}
+	if s.game.TimeControl() != nil {
+		gen, plies := s.gen, len(s.game.Moves())
+		s.flag = time.AfterFunc(s.game.Remaining(s.game.Position().toMove)+time.Millisecond, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.gen == gen && len(s.game.Moves()) == plies && s.game.Outcome().IsOver() {
+				s.stopThinking()
+				s.broadcast(s.state())
+			}
+		})
+	}
+	if s.game.Position().toMove != s.opts.Human {
+		s.think()
+	}
+}
+
+// think starts the engine's search in the background.
+func (s *LiveServer) think() {
+	pos, gen := s.game.Position(), s.gen
+	limits := s.game.Limits()
+	if limits.IsZero() {
+		limits = s.opts.Limits
+	}
+	if limits.IsZero() {
+		limits.Depth = defaultSearchDepth
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go func() {
+		defer cancel()
+		best, ok := s.opts.Engine.Search(ctx, pos, limits, func(info SearchInfo) {
+			if info.MultiPV > 1 {
+				return
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.gen == gen && s.game.Position() == pos {
+				s.last = &liveInfo{Type: "info", Depth: info.Depth, Score: info.Score, Nodes: info.Nodes,
+					PV: formatSANLine(pos, info.PV)}
+				s.broadcast(s.last)
+			}
+		})
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if ctx.Err() != nil || s.gen != gen || s.game.Position() != pos {
+			return
+		}
+		s.cancel = nil
+		if !ok {
+			s.game.Resign(pos.toMove)
+		} else {
+			// A move after the flag fell loses on time instead
+			s.game.Play(best)
+		}
+		s.moved()
+	}()
+}
+
+// stopThinking abandons the engine's search, if any.
+func (s *LiveServer) stopThinking() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+// state describes the game for the browsers.
+func (s *LiveServer) state() liveState {
+	pos := s.game.Position()
+	outcome := s.game.Outcome()
+	state := liveState{
+		Type:     "state",
+		FEN:      pos.FEN(),
+		Moves:    append([]string{}, s.game.SAN()...),
+		ToMove:   strings.ToLower(colorToString(pos.toMove)),
+		Human:    strings.ToLower(colorToString(s.opts.Human)),
+		White:    "You",
+		Black:    "You",
+		Result:   outcome.Result.String(),
+		Reason:   outcome.Reason,
+		Watchers: len(s.clients),
+	}
+	if s.opts.Human == White {
+		state.Black = s.opts.Engine.Name()
+	} else {
+		state.White = s.opts.Engine.Name()
+	}
+	if moves := s.game.Moves(); len(moves) > 0 {
+		state.LastMove = moves[len(moves)-1].Move.UCINotation()
+	}
+	if s.game.TimeControl() != nil {
+		state.Clocks = map[string]int{
+			"white": int(max(s.game.Remaining(White), 0).Milliseconds()),
+			"black": int(max(s.game.Remaining(Black), 0).Milliseconds()),
+		}
+	}
+	return state
+}
+
+// broadcast sends v to every browser.
+func (s *LiveServer) broadcast(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	for c := range s.clients {
+		s.queue(c, data)
+	}
+}
+
+// sendTo sends v to one browser.
+func (s *LiveServer) sendTo(c *liveClient, v any) {
+	if data, err := json.Marshal(v); err == nil {
+		s.queue(c, data)
+	}
+}
+
+// queue hands data to c's writer. A client whose queue is full is cut off at once rather
+// than left to write out its backlog.
+func (s *LiveServer) queue(c *liveClient, data []byte) {
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		s.drop(c)
+		c.conn.conn.Close()
+	}
+}
+
+// drop disconnects c once its writer has sent what is queued.
+func (s *LiveServer) drop(c *liveClient) {
+	if _, ok := s.clients[c]; ok {
+		delete(s.clients, c)
+		close(c.send)
+	}
+}
+
+// runLive implements "live [-addr HOST:PORT] [-color white|black] [-tc TC] ...", serving a
+// browser board on which one person plays the engine while others watch.
+func runLive(args []string, out io.Writer) error {
+	flags := commandFlags("live", out)
+	addr := flags.String("addr", "localhost:8081", "address to listen on")
+	color := flags.String("color", "white", "the side played in the browser: white or black")
+	tc := flags.String("tc", "", `time control in seconds, such as "300+3" or "40/300+2" (default untimed)`)
+	depth := flags.Int("depth", defaultSearchDepth, "the engine's search depth in untimed games")
+	fen := flags.String("fen", "", "starting position (default the standard one)")
+	spec := flags.String("engine", "dumbfish", engineFlagHelp)
+	options := flags.String("options", "", "UCI options as Name=Value,...")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	opts := LiveOptions{Limits: SearchLimits{Depth: *depth}}
+	switch strings.ToLower(*color) {
+	case "white":
+		opts.Human = White
+	case "black":
+		opts.Human = Black
+	default:
+		return fmt.Errorf("-color must be white or black, not %q", *color)
+	}
+	if *tc != "" {
+		control, err := ParseTimeControl(*tc)
+		if err != nil {
+			return err
+		}
+		opts.TimeControl = &control
+	}
+	if *fen != "" {
+		pos, err := ParseFEN(*fen)
+		if err != nil {
+			return fmt.Errorf("parse FEN: %w", err)
+		}
+		opts.Start = pos
+	}
+	engine, closer, err := openEngine(*spec, *options)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer()
+	}
+	opts.Engine = engine
+	live := NewLiveServer(opts)
+	defer live.Close()
+	server := &http.Server{Addr: *addr, Handler: live, ReadHeaderTimeout: 5 * time.Second}
+	fmt.Fprintf(out, "Play at http://%s/ (watch at http://%s/?watch=1)\n", *addr, *addr)
+	return server.ListenAndServe()
+}
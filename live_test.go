@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startLive serves a live game and returns its URL.
+func startLive(t *testing.T, opts LiveOptions) string {
+	live := NewLiveServer(opts)
+	server := httptest.NewServer(live)
+	t.Cleanup(func() {
+		live.Close()
+		server.Close()
+	})
+	return server.URL
+}
+
+// readLive reads messages from c until one satisfies done, failing after a few seconds.
+func readLive(t *testing.T, c *wsConn, done func(map[string]any) bool) map[string]any {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("decode %s: %v", data, err)
+		}
+		if done(msg) {
+			return msg
+		}
+	}
+}
+
+// stateWithMoves matches a state message after n moves.
+func stateWithMoves(n int) func(map[string]any) bool {
+	return func(msg map[string]any) bool {
+		moves, _ := msg["moves"].([]any)
+		return msg["type"] == "state" && len(moves) == n
+	}
+}
+
+func TestLiveServer_PlayAndWatch(t *testing.T) {
+	url := startLive(t, LiveOptions{Engine: Dumbfish{}, Human: White, Limits: SearchLimits{Depth: 2}})
+	resp, err := http.Get(url + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "new WebSocket(") || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("page not served: %s", resp.Header.Get("Content-Type"))
+	}
+
+	player := dialWebSocket(t, url+"/ws")
+	if hello := readLive(t, player, func(msg map[string]any) bool { return msg["type"] == "hello" }); hello["role"] != "player" {
+		t.Errorf("first browser is %v", hello["role"])
+	}
+	spectator := dialWebSocket(t, url+"/ws?watch=1")
+	if hello := readLive(t, spectator, func(msg map[string]any) bool { return msg["type"] == "hello" }); hello["role"] != "spectator" {
+		t.Errorf("watching browser is %v", hello["role"])
+	}
+	state := readLive(t, spectator, stateWithMoves(0))
+	if state["white"] != "You" || state["black"] != "Dumbfish" || state["watchers"] != 2.0 || state["clocks"] != nil {
+		t.Errorf("state %v", state)
+	}
+
+	spectator.WriteJSON(liveMessage{Type: "move", Move: "e2e4"})
+	if msg := readLive(t, spectator, func(msg map[string]any) bool { return msg["type"] == "error" }); msg["message"] != "spectators cannot play" {
+		t.Errorf("spectator move: %v", msg)
+	}
+	player.WriteJSON(liveMessage{Type: "move", Move: "e7e5"})
+	readLive(t, player, func(msg map[string]any) bool { return msg["type"] == "error" })
+
+	player.WriteJSON(liveMessage{Type: "move", Move: "Nf3"})
+	readLive(t, spectator, stateWithMoves(1))
+	info := readLive(t, spectator, func(msg map[string]any) bool { return msg["type"] == "info" })
+	if info["depth"] != 1.0 || info["pv"] == "" {
+		t.Errorf("info %v", info)
+	}
+	state = readLive(t, spectator, stateWithMoves(2))
+	if state["toMove"] != "white" || state["lastMove"] == "" || state["result"] != "*" {
+		t.Errorf("state after the engine's reply %v", state)
+	}
+
+	player.WriteJSON(liveMessage{Type: "resign"})
+	if state := readLive(t, player, func(msg map[string]any) bool { return msg["type"] == "state" && msg["result"] != "*" }); state["result"] != "0-1" || state["reason"] != "White resigned" {
+		t.Errorf("after resigning: %v", state)
+	}
+	// A new game as Black: the engine opens
+	player.WriteJSON(liveMessage{Type: "new", Color: "black"})
+	if state := readLive(t, player, stateWithMoves(1)); state["human"] != "black" || state["white"] != "Dumbfish" {
+		t.Errorf("new game: %v", state)
+	}
+}
+
+func TestLiveServer_FlagFalls(t *testing.T) {
+	url := startLive(t, LiveOptions{Human: White, TimeControl: &TimeControl{Base: 200 * time.Millisecond}})
+	c := dialWebSocket(t, url+"/ws")
+	state := readLive(t, c, stateWithMoves(0))
+	if clocks, _ := state["clocks"].(map[string]any); clocks["black"] != 200.0 {
+		t.Errorf("clocks %v", state["clocks"])
+	}
+	state = readLive(t, c, func(msg map[string]any) bool { return msg["type"] == "state" && msg["result"] != "*" })
+	if state["result"] != "0-1" || state["reason"] != "time forfeit" {
+		t.Errorf("state %v", state)
+	}
+}
+
+func TestLiveServer_DropsStalledBrowser(t *testing.T) {
+	live := NewLiveServer(LiveOptions{Engine: Dumbfish{}, Human: White, Limits: SearchLimits{Depth: 3}})
+	server := httptest.NewServer(live)
+	t.Cleanup(func() {
+		live.Close()
+		server.Close()
+	})
+
+	// A browser that never reads: writes to a pipe block until the other end reads
+	conn, other := net.Pipe()
+	defer other.Close()
+	stalled := &liveClient{conn: &wsConn{conn: conn, r: bufio.NewReader(conn)}, send: make(chan []byte, liveSendQueue)}
+	go stalled.writeLoop()
+	live.mu.Lock()
+	live.clients[stalled] = false
+	for range liveSendQueue + 2 { // one more than the queue and the message being written
+		live.broadcast(live.state())
+	}
+	_, kept := live.clients[stalled]
+	live.mu.Unlock()
+	if kept {
+		t.Error("a browser with a full queue was not dropped")
+	}
+
+	player := dialWebSocket(t, server.URL+"/ws")
+	readLive(t, player, stateWithMoves(0))
+	player.WriteJSON(liveMessage{Type: "move", Move: "e2e4"})
+	readLive(t, player, stateWithMoves(2))
+}
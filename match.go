@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MatchResult counts the games of a match from the first engine's point of view.
+type MatchResult struct {
+	Wins, Draws, Losses int
+}
+
+// Games returns the number of games played.
+func (r MatchResult) Games() int { return r.Wins + r.Draws + r.Losses }
+
+// Score returns the first engine's points per game, from 0 to 1.
+func (r MatchResult) Score() float64 {
+	if r.Games() == 0 {
+		return 0.5
+	}
+	return (float64(r.Wins) + float64(r.Draws)/2) / float64(r.Games())
+}
+
+// add counts a game that the first engine won, drew or lost by result, playing White when
+// firstIsWhite.
+func (r *MatchResult) add(result GameResult, firstIsWhite bool) {
+	switch {
+	case result == Draw:
+		r.Draws++
+	case (result == WhiteWins) == firstIsWhite:
+		r.Wins++
+	default:
+		r.Losses++
+	}
+}
+
+// statistics returns the mean and variance of the per-game score. Empty outcome counts are
+// replaced by a tiny fraction, so that a one-sided match still has some variance.
+func (r MatchResult) statistics() (mean, variance float64) {
+	n := float64(r.Games())
+	fractions := [3]float64{float64(r.Wins) / n, float64(r.Draws) / n, float64(r.Losses) / n}
+	total := 0.0
+	for i := range fractions {
+		if fractions[i] == 0 {
+			fractions[i] = 1e-3
+		}
+		total += fractions[i]
+	}
+	points := [3]float64{1, 0.5, 0}
+	for i := range fractions {
+		fractions[i] /= total
+		mean += fractions[i] * points[i]
+	}
+	for i := range fractions {
+		variance += fractions[i] * (points[i] - mean) * (points[i] - mean)
+	}
+	return mean, variance
+}
+
+// Elo returns the first engine's estimated Elo advantage and the half-width of its 95%
+// confidence interval.
+func (r MatchResult) Elo() (elo, margin float64) {
+	if r.Games() == 0 {
+		return 0, 0
+	}
+	mean, variance := r.statistics()
+	deviation := 1.959964 * math.Sqrt(variance/float64(r.Games()))
+	lo := eloFromScore(max(mean-deviation, 1e-6))
+	hi := eloFromScore(min(mean+deviation, 1-1e-6))
+	return eloFromScore(mean), (hi - lo) / 2
+}
+
+// String formats the result as "+W =D -L".
+func (r MatchResult) String() string {
+	return fmt.Sprintf("+%d =%d -%d", r.Wins, r.Draws, r.Losses)
+}
+
+// eloFromScore converts an expected score to an Elo difference under the logistic model.
+func eloFromScore(score float64) float64 {
+	return -400 * math.Log10(1/score-1)
+}
+
+// scoreFromElo is the inverse of eloFromScore.
+func scoreFromElo(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+// SPRT is a sequential probability ratio test of the hypotheses that the first engine is
+// Elo0 (H0) or Elo1 (H1) stronger, with false positive rate Alpha and false negative rate
+// Beta. It uses the generalized SPRT on the game score, so it needs no draw model.
+type SPRT struct {
+	Elo0, Elo1  float64
+	Alpha, Beta float64
+}
+
+// SPRTDecision is the state of an SPRT.
+type SPRTDecision int
+
+const (
+	SPRTContinue SPRTDecision = iota
+	SPRTAcceptH0
+	SPRTAcceptH1
+)
+
+func (d SPRTDecision) String() string {
+	return [...]string{"continue", "H0 accepted", "H1 accepted"}[d]
+}
+
+// Bounds returns the log-likelihood ratios at which the test accepts H0 and H1.
+func (t SPRT) Bounds() (lower, upper float64) {
+	return math.Log(t.Beta / (1 - t.Alpha)), math.Log((1 - t.Beta) / t.Alpha)
+}
+
+// LLR returns the log-likelihood ratio of H1 against H0 after the games of r.
+func (t SPRT) LLR(r MatchResult) float64 {
+	if r.Games() == 0 {
+		return 0
+	}
+	mean, variance := r.statistics()
+	s0, s1 := scoreFromElo(t.Elo0), scoreFromElo(t.Elo1)
+	return float64(r.Games()) * (s1 - s0) * (2*mean - s0 - s1) / (2 * variance)
+}
+
+// Decide returns the test's decision after the games of r.
+func (t SPRT) Decide(r MatchResult) SPRTDecision {
+	llr := t.LLR(r)
+	lower, upper := t.Bounds()
+	switch {
+	case llr >= upper:
+		return SPRTAcceptH1
+	case llr <= lower:
+		return SPRTAcceptH0
+	}
+	return SPRTContinue
+}
+
+// MatchOptions configures a match between two engines.
+//
+// Each opening is played twice with the engines swapping colours, in the order given and
+// starting over when the openings run out; without openings every game starts from the
+// initial position. Moves are searched with Limits, or against the clock with TimeControl.
+// With SPRT the match stops as soon as the test decides.
+type MatchOptions struct {
+	Games       int
+	Openings    []PGNGame
+	Limits      SearchLimits
+	TimeControl *TimeControl
+	SPRT        *SPRT
+	Event       string // PGN Event tag (empty = "chessx match")
+	Adjudication
+
+	Progress func(MatchGame, MatchResult) // called after each game, if not nil
+}
+
+// MatchGame is a finished game of a match.
+type MatchGame struct {
+	Round        int // from 1
+	FirstIsWhite bool
+	PGN          PGNGame
+	Outcome      Outcome
+}
+
+// newGamer is implemented by engines that want to know when a new game starts.
+type newGamer interface {
+	NewGame() error
+}
+
+// RunMatch plays a match between engines and writes its games to pgn (if not nil). It
+// returns the result from the first engine's point of view and, with opts.SPRT, the
+// decision of the test.
+func RunMatch(ctx context.Context, engines [2]Engine, opts MatchOptions, pgn io.Writer) (MatchResult, SPRTDecision, error) {
+	var result MatchResult
+	event := opts.Event
+	if event == "" {
+		event = "chessx match"
+	}
+	for round := 1; round <= opts.Games; round++ {
+		firstIsWhite := round%2 == 1
+		white, black := engines[0], engines[1]
+		if !firstIsWhite {
+			white, black = black, white
+		}
+		opening := PGNGame{Tags: map[string]string{}}
+		if len(opts.Openings) > 0 {
+			opening = opts.Openings[(round-1)/2%len(opts.Openings)]
+		}
+		start, err := opening.StartPosition()
+		if err != nil {
+			return result, SPRTContinue, fmt.Errorf("round %d: opening: %w", round, err)
+		}
+		for _, engine := range engines {
+			if g, ok := engine.(newGamer); ok {
+				if err := g.NewGame(); err != nil {
+					return result, SPRTContinue, fmt.Errorf("round %d: %s: %w", round, engine.Name(), err)
+				}
+			}
+		}
+
+		g := newEngineGame(white, black, start, map[string]string{
+			"Event": event,
+			"Site":  "?",
+			"Date":  time.Now().Format("2006.01.02"),
+			"Round": strconv.Itoa(round),
+		})
+		if err := g.playOpening(opening); err != nil {
+			return result, SPRTContinue, fmt.Errorf("round %d: opening: %w", round, err)
+		}
+		if err := g.run(ctx, opts.Limits, opts.TimeControl, opts.Adjudication); err != nil {
+			return result, SPRTContinue, fmt.Errorf("round %d: %w", round, err)
+		}
+		if pgn != nil {
+			if _, err := g.pgn.WriteTo(pgn); err != nil {
+				return result, SPRTContinue, err
+			}
+		}
+		result.add(g.outcome.Result, firstIsWhite)
+		if opts.Progress != nil {
+			opts.Progress(MatchGame{Round: round, FirstIsWhite: firstIsWhite, PGN: g.pgn, Outcome: g.outcome}, result)
+		}
+		if opts.SPRT != nil {
+			if decision := opts.SPRT.Decide(result); decision != SPRTContinue {
+				return result, decision, nil
+			}
+		}
+	}
+	return result, SPRTContinue, nil
+}
+
+// LoadOpenings reads an opening suite: the games of a PGN file (by its .pgn extension), or
+// otherwise one FEN or EPD position per line, skipping blank lines and '#' comments.
+func LoadOpenings(path string) ([]PGNGame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".pgn") {
+		return ReadPGN(f)
+	}
+	return readFENOpenings(f)
+}
+
+// readFENOpenings reads one FEN or EPD per line; EPD operations after the position are
+// ignored.
+func readFENOpenings(r io.Reader) ([]PGNGame, error) {
+	var openings []PGNGame
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: not a FEN or EPD position", line)
+		}
+		fen := fields[:4]
+		if len(fields) >= 6 && isNumber(fields[4]) && isNumber(fields[5]) {
+			fen = fields[:6]
+		}
+		pos, err := ParseFEN(strings.Join(fen, " "))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		openings = append(openings, PGNGame{Tags: map[string]string{"FEN": pos.FEN()}})
+	}
+	return openings, scanner.Err()
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// adjudicationFlags registers the adjudication settings of engine games on flags.
+func adjudicationFlags(flags *flag.FlagSet) *Adjudication {
+	adj := &Adjudication{}
+	flags.IntVar(&adj.ResignScore, "resign", 1000, "score in centipawns adjudicated as a win")
+	flags.IntVar(&adj.ResignMoves, "resign-moves", 3, "moves each both engines must agree on a win (0 = never)")
+	flags.IntVar(&adj.DrawScore, "draw", 10, "score in centipawns adjudicated as a draw")
+	flags.IntVar(&adj.DrawMoves, "draw-moves", 8, "moves each both engines must agree on a draw (0 = never)")
+	flags.IntVar(&adj.DrawAfter, "draw-after", 40, "first move number at which draws are adjudicated")
+	flags.IntVar(&adj.MaxMoves, "max-moves", 200, "moves after which the game is drawn (0 = no limit)")
+	return adj
+}
+
+// runMatch implements "match [-engine1 SPEC] [-engine2 SPEC] [-games N] [-tc TC] [-sprt]",
+// playing two engines against each other and reporting the score, Elo difference and SPRT.
+func runMatch(args []string, out io.Writer) error {
+	flags := commandFlags("match", out)
+	specs := [2]*string{
+		flags.String("engine1", "dumbfish", "first "+engineFlagHelp),
+		flags.String("engine2", "dumbfish", "second engine, like -engine1"),
+	}
+	options := [2]*string{
+		flags.String("options1", "", "UCI options of the first engine, as Name=Value,Name=Value"),
+		flags.String("options2", "", "UCI options of the second engine"),
+	}
+	games := flags.Int("games", 100, "maximum number of games")
+	openingsPath := flags.String("openings", "", "opening suite: a PGN file, or FEN or EPD lines")
+	tc := flags.String("tc", "", `time control in seconds, such as "10+0.1" or "40/60"`)
+	depth := flags.Int("depth", 4, "search depth in plies per move, without -tc or -nodes")
+	nodes := flags.Int("nodes", 0, "nodes per move, without -tc")
+	sprt := flags.Bool("sprt", false, "stop once an SPRT decides between -elo0 and -elo1")
+	elo0 := flags.Float64("elo0", 0, "SPRT: Elo difference of H0")
+	elo1 := flags.Float64("elo1", 5, "SPRT: Elo difference of H1")
+	alpha := flags.Float64("alpha", 0.05, "SPRT: false positive rate")
+	beta := flags.Float64("beta", 0.05, "SPRT: false negative rate")
+	pgnPath := flags.String("pgn", "match.pgn", "PGN file to write the games to")
+	adjudication := adjudicationFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	opts := MatchOptions{Games: *games, Limits: SearchLimits{Depth: max(*depth, 1)}, Adjudication: *adjudication}
+	if *nodes > 0 {
+		opts.Limits = SearchLimits{Nodes: *nodes}
+	}
+	if *tc != "" {
+		control, err := ParseTimeControl(*tc)
+		if err != nil {
+			return err
+		}
+		opts.TimeControl = &control
+	}
+	if *openingsPath != "" {
+		openings, err := LoadOpenings(*openingsPath)
+		if err != nil {
+			return err
+		}
+		opts.Openings = openings
+	}
+	if *sprt {
+		opts.SPRT = &SPRT{Elo0: *elo0, Elo1: *elo1, Alpha: *alpha, Beta: *beta}
+	}
+
+	var engines [2]Engine
+	for i := range engines {
+		engine, closer, err := openEngine(*specs[i], *options[i])
+		if err != nil {
+			return fmt.Errorf("engine%d: %w", i+1, err)
+		}
+		if closer != nil {
+			defer closer()
+		}
+		engines[i] = engine
+	}
+	pgn, err := os.Create(*pgnPath)
+	if err != nil {
+		return err
+	}
+	defer pgn.Close()
+
+	report := func(result MatchResult) string {
+		elo, margin := result.Elo()
+		line := fmt.Sprintf("%s  Elo %.1f +/- %.1f", result, elo, margin)
+		if opts.SPRT != nil {
+			lower, upper := opts.SPRT.Bounds()
+			line += fmt.Sprintf("  LLR %.2f (%.2f, %.2f)", opts.SPRT.LLR(result), lower, upper)
+		}
+		return line
+	}
+	opts.Progress = func(game MatchGame, result MatchResult) {
+		fmt.Fprintf(out, "Game %d: %s vs %s %s (%s)  %s\n", game.Round, game.PGN.Tags["White"], game.PGN.Tags["Black"],
+			game.Outcome.Result, game.Outcome.Reason, report(result))
+	}
+	result, decision, err := RunMatch(context.Background(), engines, opts, pgn)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Result: %s\n", report(result))
+	if opts.SPRT != nil {
+		fmt.Fprintf(out, "SPRT: %s\n", decision)
+	}
+	return pgn.Close()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchResult_Elo(t *testing.T) {
+	cases := []struct {
+		result    MatchResult
+		elo       float64
+		maxMargin float64
+	}{
+		{MatchResult{Wins: 60, Draws: 20, Losses: 20}, 147.2, 80},
+		{MatchResult{Wins: 20, Draws: 20, Losses: 60}, -147.2, 80},
+		{MatchResult{Wins: 500, Draws: 1000, Losses: 500}, 0, 12},
+	}
+	for _, tc := range cases {
+		elo, margin := tc.result.Elo()
+		if math.Abs(elo-tc.elo) > 0.1 {
+			t.Errorf("%s: Elo %.1f, want %.1f", tc.result, elo, tc.elo)
+		}
+		if margin <= 0 || margin > tc.maxMargin {
+			t.Errorf("%s: margin %.1f, want (0, %.0f]", tc.result, margin, tc.maxMargin)
+		}
+	}
+	// More games narrow the interval
+	_, few := MatchResult{Wins: 6, Draws: 2, Losses: 2}.Elo()
+	_, many := MatchResult{Wins: 600, Draws: 200, Losses: 200}.Elo()
+	if many >= few {
+		t.Errorf("margin did not shrink with games: %.1f vs %.1f", many, few)
+	}
+}
+
+func TestSPRT(t *testing.T) {
+	sprt := SPRT{Elo0: 0, Elo1: 10, Alpha: 0.05, Beta: 0.05}
+	lower, upper := sprt.Bounds()
+	if math.Abs(lower+2.944) > 1e-3 || math.Abs(upper-2.944) > 1e-3 {
+		t.Errorf("bounds (%.3f, %.3f), want (-2.944, 2.944)", lower, upper)
+	}
+	cases := []struct {
+		result MatchResult
+		want   SPRTDecision
+	}{
+		{MatchResult{}, SPRTContinue},
+		{MatchResult{Wins: 10, Draws: 10, Losses: 10}, SPRTContinue},
+		{MatchResult{Wins: 400, Draws: 400, Losses: 200}, SPRTAcceptH1},
+		{MatchResult{Wins: 200, Draws: 400, Losses: 400}, SPRTAcceptH0},
+		{MatchResult{Wins: 3000, Draws: 4000, Losses: 3000}, SPRTAcceptH0},
+		{MatchResult{Wins: 40}, SPRTAcceptH1},
+	}
+	for _, tc := range cases {
+		if got := sprt.Decide(tc.result); got != tc.want {
+			t.Errorf("%s: %s (LLR %.2f), want %s", tc.result, got, sprt.LLR(tc.result), tc.want)
+		}
+	}
+	// Halfway between the hypotheses the evidence is balanced
+	mid := MatchResult{Wins: 1029, Draws: 2000, Losses: 971}
+	if llr := sprt.LLR(mid); math.Abs(llr) > 0.5 {
+		t.Errorf("LLR %.2f at the midpoint", llr)
+	}
+}
+
+// firstMoveEngine plays the first legal move without searching.
+type firstMoveEngine struct{}
+
+func (firstMoveEngine) Name() string { return "First" }
+func (firstMoveEngine) SelectMove(pos *Position) (AppliedMove, bool) {
+	return Dumbfish{}.SelectMove(pos)
+}
+func (e firstMoveEngine) Search(ctx context.Context, pos *Position, limits SearchLimits, info func(SearchInfo)) (AppliedMove, bool) {
+	return e.SelectMove(pos)
+}
+
+func TestRunMatch_StopsOnSPRTDecision(t *testing.T) {
+	openings, err := readFENOpenings(strings.NewReader(strings.Join([]string{
+		"# two openings",
+		"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2",
+		"rnbqkbnr/ppp1pppp/8/3p4/3P4/8/PPP1PPPP/RNBQKBNR w KQkq - bm c4; id \"qgd\";",
+	}, "\n")))
+	if err != nil || len(openings) != 2 {
+		t.Fatalf("openings: %d, %v", len(openings), err)
+	}
+	var games []MatchGame
+	var pgn strings.Builder
+	opts := MatchOptions{
+		Games:        100,
+		Openings:     openings,
+		Limits:       SearchLimits{Depth: 2},
+		SPRT:         &SPRT{Elo0: 0, Elo1: 200, Alpha: 0.05, Beta: 0.05},
+		Adjudication: Adjudication{ResignScore: 500, ResignMoves: 2, MaxMoves: 100},
+		Progress:     func(game MatchGame, _ MatchResult) { games = append(games, game) },
+	}
+	result, decision, err := RunMatch(context.Background(), [2]Engine{Dumbfish{}, firstMoveEngine{}}, opts, &pgn)
+	if err != nil {
+		t.Fatalf("match: %v", err)
+	}
+	if decision != SPRTAcceptH1 || result.Games() >= opts.Games {
+		t.Fatalf("expected an early H1 decision, got %s after %s", decision, result)
+	}
+	if result.Wins < result.Games()-1 {
+		t.Errorf("searching engine only scored %s against the first legal move", result)
+	}
+	for i, game := range games {
+		if game.FirstIsWhite != (i%2 == 0) {
+			t.Errorf("game %d: colours not reversed", i+1)
+		}
+		if want := openings[i/2%2].Tags["FEN"]; game.PGN.Tags["FEN"] != want {
+			t.Errorf("game %d: started from %q, want %q", i+1, game.PGN.Tags["FEN"], want)
+		}
+	}
+	written, err := ReadPGN(strings.NewReader(pgn.String()))
+	if err != nil || len(written) != result.Games() {
+		t.Fatalf("PGN holds %d games, want %d: %v", len(written), result.Games(), err)
+	}
+	if _, err := written[len(written)-1].Replay(); err != nil {
+		t.Errorf("replay: %v", err)
+	}
+}
+
+func TestLoadOpenings(t *testing.T) {
+	dir := t.TempDir()
+	pgnPath := filepath.Join(dir, "book.pgn")
+	pgn := "[Event \"a\"]\n\n1. e4 e5 *\n\n[Event \"b\"]\n\n1. d4 d5 2. c4 *\n"
+	if err := os.WriteFile(pgnPath, []byte(pgn), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	openings, err := LoadOpenings(pgnPath)
+	if err != nil || len(openings) != 2 || len(openings[1].Moves) != 3 {
+		t.Fatalf("PGN openings %v: %v", openings, err)
+	}
+
+	epdPath := filepath.Join(dir, "book.epd")
+	if err := os.WriteFile(epdPath, []byte("not a position\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOpenings(epdPath); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected an error on line 1, got %v", err)
+	}
+}
+
+func TestRunMatchCommand(t *testing.T) {
+	dir := t.TempDir()
+	pgn := filepath.Join(dir, "match.pgn")
+	var out strings.Builder
+	args := []string{"-games", "2", "-depth", "1", "-max-moves", "20", "-options2", "NullMove=false,Hash=1",
+		"-sprt", "-pgn", pgn}
+	if err := runMatch(args, &out); err != nil {
+		t.Fatalf("match: %v", err)
+	}
+	for _, want := range []string{"Game 2: ", "Result: ", "LLR", "SPRT: continue"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+	if err := runMatch([]string{"-options1", "Bogus=1", "-pgn", pgn}, &out); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+	if err := runMatch([]string{"-tc", "fast", "-pgn", pgn}, &out); err == nil {
+		t.Error("expected an error for a bad time control")
+	}
+}
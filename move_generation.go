@@ -12,10 +12,14 @@ type GeneratedMove struct {
 	Color      Color
 	IsCastle   bool
 	CastleSide CastlingSide
+	IsDrop     bool // Crazyhouse drop of Kind from the pocket onto To; From is empty
 }
 
-// UCINotation returns the move encoded in UCI format, e.g. e2e4, e7e8q.
+// UCINotation returns the move encoded in UCI format, e.g. e2e4, e7e8q, or P@e4 for drops.
 func (m GeneratedMove) UCINotation() string {
+	if m.IsDrop {
+		return dropLetter(m.Kind) + "@" + m.To
+	}
 	uci := m.From + m.To
 	if m.Promotion != Empty {
 		switch m.Promotion {
@@ -163,6 +167,9 @@ func generatePossibleMoves(pos *Position) []GeneratedMove {
 	// Castling moves (pseudo-legal; checks filtered later)
 	addCastlingMoves(pos, &moves)
 
+	// Crazyhouse drops (pseudo-legal; drops that leave the king in check are filtered later)
+	addDropMoves(pos, &moves)
+
 	return moves
 }
 
@@ -221,7 +228,16 @@ type AppliedMove struct {
 
 // generateLegalMoves enumerates legal moves by filtering out pseudo-legal moves that
 // leave the moving side's king in check. Returns each move paired with its resulting position.
+// No moves are returned once a variant-specific game end (e.g. a Racing Kings finish) is reached.
 func generateLegalMoves(pos *Position) []AppliedMove {
+	if pos.isVariantEnd() {
+		return nil
+	}
+	return filterLegalMoves(pos)
+}
+
+// filterLegalMoves applies the check rules of the position's variant to the pseudo-legal moves.
+func filterLegalMoves(pos *Position) []AppliedMove {
 	possible := generatePossibleMoves(pos)
 	legal := make([]AppliedMove, 0, len(possible))
 	for _, mv := range possible {
@@ -230,6 +246,10 @@ func generateLegalMoves(pos *Position) []AppliedMove {
 		if after.IsKingInCheck(mv.Color) {
 			continue
 		}
+		// Racing Kings forbids giving check
+		if pos.variant == RacingKings && after.IsKingInCheck(mv.Color.Opponent()) {
+			continue
+		}
 		// For castling, ensure not castling through check
 		if mv.IsCastle {
 			if pos.IsCastlingThroughCheck(mv.Color, mv.CastleSide) {
@@ -0,0 +1,288 @@
+package main
+
+// pickStage is a stage of the move picker. Stages are tried in declaration order.
+type pickStage int
+
+const (
+	stageTT           pickStage = iota // the move stored in the transposition table
+	stageGoodCaptures                  // captures that do not lose material, by MVV-LVA
+	stagePromotions                    // quiet promotions, queen first
+	stageKillers                       // quiet moves that caused a cutoff at the same ply
+	stageCountermove                   // the quiet reply that last refuted the opponent's move
+	stageQuiets                        // remaining quiet moves by butterfly history
+	stageBadCaptures                   // captures that lose material, by SEE
+	stageDone
+)
+
+func (st pickStage) String() string {
+	return [...]string{"tt", "good captures", "promotions", "killers", "countermove", "quiets", "bad captures", "done"}[st]
+}
+
+// maxHistory bounds butterfly history scores in both directions.
+const maxHistory = 1 << 14
+
+// scoredMove is a legal move waiting in the picker with its ordering key.
+type scoredMove struct {
+	index  int // into the picker's legal moves
+	packed uint16
+	score  int
+}
+
+// movePicker hands out the legal moves of a node one at a time, stage by stage, so that the
+// moves most likely to cause a cutoff come first and the rest need not be scored or sorted
+// when they do.
+type movePicker struct {
+	s     *searcher
+	pos   *Position
+	legal []AppliedMove
+	stage pickStage // stage of the move last returned by next
+
+	ttMove  uint16
+	killers [2]uint16
+	counter uint16
+
+	list       []scoredMove // moves of the current stage not yet returned
+	captures   []scoredMove
+	promotions []scoredMove
+	quiets     []scoredMove
+	bad        []scoredMove
+}
+
+// newMovePicker classifies legal for ordering at ply. The heuristics come from s; prev is
+// the opponent's move that led to pos (zero at the root).
+func newMovePicker(s *searcher, pos *Position, legal []AppliedMove, ttMove uint16, ply int, prev uint16) *movePicker {
+	mp := &movePicker{s: s, pos: pos, legal: legal, ttMove: ttMove, stage: stageTT}
+	mp.killers = s.killers[ply]
+	if prev != 0 {
+		mp.counter = s.countermoves[pos.toMove][prev&(1<<12-1)]
+	}
+	for i := range legal {
+		m := &legal[i].Move
+		sm := scoredMove{index: i, packed: packMove(*m)}
+		switch {
+		case m.IsCapture:
+			mp.captures = append(mp.captures, sm)
+		case m.Promotion != Empty:
+			sm.score = pieceValues[m.Promotion]
+			mp.promotions = append(mp.promotions, sm)
+		default:
+			mp.quiets = append(mp.quiets, sm)
+		}
+	}
+	mp.list = mp.find(ttMove, mp.captures, mp.promotions, mp.quiets)
+	return mp
+}
+
+// next returns the next move to search, or false when all moves have been returned.
+func (mp *movePicker) next() (AppliedMove, bool) {
+	for {
+		if i := mp.pickBest(); i >= 0 {
+			return mp.legal[i], true
+		}
+		if mp.stage == stageDone {
+			return AppliedMove{}, false
+		}
+		mp.stage++
+		mp.list = nil
+		switch mp.stage {
+		case stageGoodCaptures:
+			for _, sm := range mp.captures {
+				m := mp.legal[sm.index].Move
+				if see := staticExchange(mp.pos, m); see < 0 {
+					sm.score = see
+					mp.bad = append(mp.bad, sm)
+					continue
+				}
+				sm.score = 10*pieceValues[capturedKind(mp.pos, m)] - pieceValues[m.Kind]/10
+				mp.list = append(mp.list, sm)
+			}
+		case stagePromotions:
+			mp.list = mp.promotions
+		case stageKillers:
+			mp.list = append(mp.find(mp.killers[0], mp.quiets), mp.find(mp.killers[1], mp.quiets)...)
+			for i := range mp.list {
+				mp.list[i].score = -i // keep the newer killer first
+			}
+		case stageCountermove:
+			if mp.counter != mp.killers[0] && mp.counter != mp.killers[1] {
+				mp.list = mp.find(mp.counter, mp.quiets)
+			}
+		case stageQuiets:
+			history := &mp.s.history[mp.pos.toMove]
+			mp.list = mp.quiets
+			for i := range mp.list {
+				mp.list[i].score = history[mp.list[i].packed&(1<<12-1)]
+			}
+		case stageBadCaptures:
+			mp.list = mp.bad
+		}
+	}
+}
+
+// pickBest removes the highest scoring move of the current stage from the list and returns
+// its index, skipping moves an earlier stage already returned. It returns -1 once the list
+// is empty. Ties go to the earlier move, so the order is reproducible.
+func (mp *movePicker) pickBest() int {
+	for len(mp.list) > 0 {
+		best := 0
+		for i := 1; i < len(mp.list); i++ {
+			if mp.list[i].score > mp.list[best].score {
+				best = i
+			}
+		}
+		sm := mp.list[best]
+		mp.list = append(mp.list[:best], mp.list[best+1:]...)
+		if mp.stage > stageTT && sm.packed == mp.ttMove ||
+			mp.stage > stageKillers && (sm.packed == mp.killers[0] || sm.packed == mp.killers[1]) ||
+			mp.stage > stageCountermove && sm.packed == mp.counter {
+			continue
+		}
+		return sm.index
+	}
+	return -1
+}
+
+// find returns a fresh one-element list holding the move packed as target, if it is among lists.
+func (mp *movePicker) find(target uint16, lists ...[]scoredMove) []scoredMove {
+	if target == 0 {
+		return nil
+	}
+	for _, list := range lists {
+		for _, sm := range list {
+			if sm.packed == target {
+				return []scoredMove{sm}
+			}
+		}
+	}
+	return nil
+}
+
+// rememberCutoff updates the killers, countermove and history after the quiet move best
+// failed high at ply, penalising the quiet moves searched before it.
+func (s *searcher) rememberCutoff(pos *Position, best uint16, tried []uint16, depth, ply int) {
+	if s.killers[ply][0] != best {
+		s.killers[ply][1], s.killers[ply][0] = s.killers[ply][0], best
+	}
+	if ply > 0 && s.moves[ply-1] != 0 {
+		s.countermoves[pos.toMove][s.moves[ply-1]&(1<<12-1)] = best
+	}
+	bonus := min(depth*depth, maxHistory/4)
+	history := &s.history[pos.toMove]
+	updateHistory(&history[best&(1<<12-1)], bonus)
+	for _, m := range tried {
+		updateHistory(&history[m&(1<<12-1)], -bonus)
+	}
+}
+
+// updateHistory moves h towards ±maxHistory by bonus, slowing down as it gets close.
+func updateHistory(h *int, bonus int) {
+	*h += bonus - *h*abs(bonus)/maxHistory
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// capturedKind returns the kind of piece m captures; en passant captures a pawn.
+func capturedKind(pos *Position, m GeneratedMove) PieceKind {
+	if idx, ok := squareToIndex(m.To); ok && pos.board[idx] >= 0 {
+		return pos.pieces[pos.board[idx]].Kind
+	}
+	return Pawn
+}
+
+// seeValue is the exchange value of a piece; the king outweighs everything else.
+func seeValue(kind PieceKind) int {
+	if kind == King {
+		return 20000
+	}
+	return pieceValues[kind]
+}
+
+// staticExchange estimates the material won by capture m once all captures on its target
+// square have been played out, each side recapturing with its least valuable attacker and
+// free to stop when that pays. Pins are ignored.
+func staticExchange(pos *Position, m GeneratedMove) int {
+	from, _ := squareToIndex(m.From)
+	to, _ := squareToIndex(m.To)
+	occupancy := pos.GetAllOccupancy().Clear(from)
+	if pos.board[to] < 0 {
+		// En passant: the captured pawn is not on the target square
+		file, _ := indexToFileRank(to)
+		_, rank := indexToFileRank(from)
+		occupancy = occupancy.Clear(fileRankToIndex(file, rank))
+	}
+
+	var gain [32]int
+	gain[0] = seeValue(capturedKind(pos, m))
+	onSquare := seeValue(m.Kind)
+	if m.Promotion != Empty {
+		gain[0] += seeValue(m.Promotion) - seeValue(Pawn)
+		onSquare = seeValue(m.Promotion)
+	}
+	side := m.Color.Opponent()
+	d := 0
+	for d < len(gain)-1 {
+		attacker := leastValuableAttacker(pos, to, side, occupancy)
+		if attacker == nil {
+			break
+		}
+		d++
+		gain[d] = onSquare - gain[d-1]
+		occupancy = occupancy.Clear(attacker.Location.FirstSet())
+		onSquare = seeValue(attacker.Kind)
+		side = side.Opponent()
+	}
+	for ; d > 0; d-- {
+		gain[d-1] = -max(-gain[d-1], gain[d])
+	}
+	return gain[0]
+}
+
+// leastValuableAttacker returns the cheapest piece of color on occupancy attacking target,
+// seeing through pieces already removed from occupancy.
+func leastValuableAttacker(pos *Position, target uint64, color Color, occupancy Bitboard) *Piece {
+	var best *Piece
+	for i := range pos.pieces {
+		piece := &pos.pieces[i]
+		if piece.Color != color || occupancy.And(piece.Location).IsEmpty() {
+			continue
+		}
+		if best != nil && seeValue(piece.Kind) >= seeValue(best.Kind) {
+			continue
+		}
+		if attacksSquare(piece, target, occupancy) {
+			best = piece
+		}
+	}
+	return best
+}
+
+// attacksSquare reports whether piece attacks target when the board holds occupancy.
+func attacksSquare(piece *Piece, target uint64, occupancy Bitboard) bool {
+	index := piece.Location.FirstSet()
+	switch piece.Kind {
+	case Pawn:
+		file, rank := indexToFileRank(index)
+		targetFile, targetRank := indexToFileRank(target)
+		forward := 1
+		if piece.Color == Black {
+			forward = -1
+		}
+		return targetRank == rank+forward && (targetFile == file-1 || targetFile == file+1)
+	case Knight:
+		return GetKnightMoves(index).IsSet(target)
+	case King:
+		return GetKingMoves(index).IsSet(target)
+	case Bishop:
+		return GetRayAttacks(index, occupancy).Diagonal().IsSet(target)
+	case Rook:
+		return GetRayAttacks(index, occupancy).Orthogonal().IsSet(target)
+	case Queen:
+		return GetRayAttacks(index, occupancy).All().IsSet(target)
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStaticExchange(t *testing.T) {
+	cases := []struct {
+		fen, move string
+		want      int
+	}{
+		// Undefended knight
+		{"4k3/8/8/3n4/8/8/8/3RK3 w - - 0 1", "d1d5", 320},
+		// Pawn takes a knight defended by a pawn
+		{"4k3/8/4p3/3n4/2P5/8/8/4K3 w - - 0 1", "c4d5", 320 - 100},
+		// Queen takes a pawn defended by a pawn
+		{"4k3/8/4p3/3p4/8/8/8/3QK3 w - - 0 1", "d1d5", 100 - 900},
+		// Rook takes a defended rook, backed up by a second rook behind it
+		{"3rk3/8/8/3r4/8/8/3R4/3RK3 w - - 0 1", "d2d5", 500 - 500 + 500},
+		// En passant
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+		// Knight takes a pawn twice defended, with one attacker of our own left
+		{"4k3/2p1p3/3p4/8/4N3/8/8/3RK3 w - - 0 1", "e4d6", 100 - 320},
+	}
+	for _, tc := range cases {
+		pos, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ap, ok := findUCIMove(pos, tc.move)
+		if !ok {
+			t.Fatalf("%s: %s is not legal", tc.fen, tc.move)
+		}
+		if got := staticExchange(pos, ap.Move); got != tc.want {
+			t.Errorf("%s %s: got %d, want %d", tc.fen, tc.move, got, tc.want)
+		}
+	}
+}
+
+func TestMovePicker_Stages(t *testing.T) {
+	// White can take an undefended knight with the rook or queen, take a pawn defended by a
+	// pawn with the queen, and promote on b8
+	pos, _ := ParseFEN("4k3/1P6/4p3/3p4/6n1/8/8/3Q2RK w - - 0 1")
+	legal := generateLegalMoves(pos)
+	packed := func(uci string) uint16 {
+		ap, ok := findUCIMove(pos, uci)
+		if !ok {
+			t.Fatalf("%s is not legal", uci)
+		}
+		return packMove(ap.Move)
+	}
+	prev := packMove(GeneratedMove{From: "e7", To: "e8"})
+	s := &searcher{}
+	s.killers[2] = [2]uint16{packed("g1g3"), packed("d1d4")}
+	s.countermoves[White][prev&(1<<12-1)] = packed("g1g2")
+	s.history[White][packed("g1f1")&(1<<12-1)] = 100
+
+	picker := newMovePicker(s, pos, legal, packed("d1a4"), 2, prev)
+	var order []string
+	var stages []pickStage
+	for {
+		ap, ok := picker.next()
+		if !ok {
+			break
+		}
+		order = append(order, ap.Move.UCINotation())
+		stages = append(stages, picker.stage)
+	}
+	if len(order) != len(legal) {
+		t.Fatalf("picker returned %d moves, want %d: %v", len(order), len(legal), order)
+	}
+	seen := map[string]bool{}
+	for _, m := range order {
+		if seen[m] {
+			t.Fatalf("%s returned twice: %v", m, order)
+		}
+		seen[m] = true
+	}
+	if !slices.IsSorted(stages) {
+		t.Errorf("stages out of order: %v", stages)
+	}
+	want := []string{"d1a4", "g1g4", "d1g4", "b7b8q", "b7b8r", "b7b8b", "b7b8n", "g1g3", "d1d4", "g1g2", "g1f1"}
+	if !slices.Equal(order[:len(want)], want) {
+		t.Errorf("got order %v, want it to start with %v", order, want)
+	}
+	if order[len(order)-1] != "d1d5" || stages[len(stages)-1] != stageBadCaptures {
+		t.Errorf("expected the losing capture d1d5 last, got %v", order)
+	}
+}
+
+// TestMovePicker_CutoffRates searches a few positions and checks that most beta cutoffs come
+// from the first move searched. Run with -v to see the rates by stage.
+func TestMovePicker_CutoffRates(t *testing.T) {
+	fens := []string{
+		standardStartFEN,
+		smpTestFEN,
+		"r3k2r/pp1n1ppp/2pbpn2/q7/2PP4/2N1PN2/PP1B1PPP/R2QKB1R w KQkq - 2 9",
+		"2r3k1/pp3ppp/2n1b3/3p4/3P4/2PB1N2/P4PPP/R5K1 b - - 0 20",
+	}
+	var total searchStats
+	for _, fen := range fens {
+		pos, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &searcher{tt: NewTranspositionTable(1)}
+		if _, _, ok := s.iterate(pos, 4, 0); !ok {
+			t.Fatalf("no move for %s", fen)
+		}
+		total.cutoffs += s.stats.cutoffs
+		total.firstMove += s.stats.firstMove
+		for st, n := range s.stats.stageCutoffs {
+			total.stageCutoffs[st] += n
+		}
+	}
+	rate := float64(total.firstMove) / float64(total.cutoffs)
+	t.Logf("%d cutoffs, %.1f%% by the first move", total.cutoffs, 100*rate)
+	for st, n := range total.stageCutoffs {
+		t.Logf("  %-13s %5.1f%%", pickStage(st), 100*float64(n)/float64(total.cutoffs))
+	}
+	if rate < 0.85 {
+		t.Errorf("expected at least 85%% of cutoffs on the first move, got %.1f%%", 100*rate)
+	}
+	for _, st := range []pickStage{stageTT, stageGoodCaptures, stageKillers, stageQuiets} {
+		if total.stageCutoffs[st] == 0 {
+			t.Errorf("expected cutoffs from the %s stage", st)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// A Network is a small efficiently updatable neural network (NNUE) evaluating positions in
+// centipawns from the side to move's point of view.
+//
+// Inputs are HalfKP-like features, seen from each side in turn: for every piece other than
+// the kings, the (own king square, piece square, piece type) triple, with squares mirrored
+// vertically for Black so both sides see the board from their own first rank. Piece types
+// are the five non-king kinds, own first, then the opponent's, giving 64*64*10 = 40960
+// features per side.
+//
+// The feature transformer maps the active features of each side to an int16 accumulator of
+// FTSize values. The side to move's accumulator is followed by the other one, clipped to
+// [0, 127], and fed through two hidden layers of int8 weights with int32 biases (each output
+// shifted right by nnueHiddenShift and clipped to [0, 127]) and a final int8 output neuron
+// whose sum is divided by nnueOutputScale.
+//
+// Weights file format, all little-endian:
+//
+//	magic   [4]byte "CXNN"
+//	version uint32  1
+//	sizes   uint32 FTSize, Hidden1, Hidden2
+//	ft      int16 biases [FTSize], int16 weights [40960][FTSize]
+//	l1      int32 biases [Hidden1], int8 weights [Hidden1][2*FTSize]
+//	l2      int32 biases [Hidden2], int8 weights [Hidden2][Hidden1]
+//	out     int32 bias, int8 weights [Hidden2]
+type Network struct {
+	FTSize, Hidden1, Hidden2 int
+
+	ftBias    []int16
+	ftWeights []int16 // feature-major: the FTSize weights of feature f start at f*FTSize
+	l1Bias    []int32
+	l1Weights []int8 // row-major: the 2*FTSize weights of neuron j start at j*2*FTSize
+	l2Bias    []int32
+	l2Weights []int8
+	outBias   int32
+	outWeight []int8
+}
+
+const (
+	nnueMagic       = "CXNN"
+	nnueVersion     = 1
+	nnueKingSquares = 64
+	nnuePieceTypes  = 10
+	nnueFeatures    = nnueKingSquares * nnuePieceTypes * 64
+	nnueHiddenShift = 6
+	nnueOutputScale = 16
+	nnueMaxLayer    = 1 << 12 // sanity bound on layer sizes read from a file
+)
+
+// ErrNetworkFormat is returned for weights files that are not in the documented format.
+var ErrNetworkFormat = errors.New("nnue: bad weights file")
+
+// NewNetwork allocates a network of the given sizes with all weights zero.
+func NewNetwork(ftSize, hidden1, hidden2 int) *Network {
+	return &Network{
+		FTSize: ftSize, Hidden1: hidden1, Hidden2: hidden2,
+		ftBias:    make([]int16, ftSize),
+		ftWeights: make([]int16, nnueFeatures*ftSize),
+		l1Bias:    make([]int32, hidden1),
+		l1Weights: make([]int8, hidden1*2*ftSize),
+		l2Bias:    make([]int32, hidden2),
+		l2Weights: make([]int8, hidden2*hidden1),
+		outWeight: make([]int8, hidden2),
+	}
+}
+
+// LoadNetwork reads a weights file from path.
+func LoadNetwork(path string) (*Network, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadNetwork(f)
+}
+
+// ReadNetwork reads a network in the weights file format.
+func ReadNetwork(r io.Reader) (*Network, error) {
+	reader := bufio.NewReader(r)
+	var header struct {
+		Magic                    [4]byte
+		Version                  uint32
+		FTSize, Hidden1, Hidden2 uint32
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNetworkFormat, err)
+	}
+	if string(header.Magic[:]) != nnueMagic || header.Version != nnueVersion {
+		return nil, fmt.Errorf("%w: not a version %d network", ErrNetworkFormat, nnueVersion)
+	}
+	for _, size := range []uint32{header.FTSize, header.Hidden1, header.Hidden2} {
+		if size == 0 || size > nnueMaxLayer {
+			return nil, fmt.Errorf("%w: layer size %d", ErrNetworkFormat, size)
+		}
+	}
+	n := NewNetwork(int(header.FTSize), int(header.Hidden1), int(header.Hidden2))
+	for _, data := range n.parameters() {
+		if err := binary.Read(reader, binary.LittleEndian, data); err != nil {
+			return nil, fmt.Errorf("%w: truncated: %v", ErrNetworkFormat, err)
+		}
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%w: trailing data", ErrNetworkFormat)
+	}
+	return n, nil
+}
+
+// WriteTo writes the network in the weights file format.
+func (n *Network) WriteTo(w io.Writer) (int64, error) {
+	writer := bufio.NewWriter(w)
+	header := []any{[]byte(nnueMagic), uint32(nnueVersion), uint32(n.FTSize), uint32(n.Hidden1), uint32(n.Hidden2)}
+	var written int64
+	for _, data := range append(header, n.parameters()...) {
+		if err := binary.Write(writer, binary.LittleEndian, data); err != nil {
+			return written, err
+		}
+		written += int64(binary.Size(data))
+	}
+	return written, writer.Flush()
+}
+
+// parameters lists the weight arrays in file order.
+func (n *Network) parameters() []any {
+	return []any{n.ftBias, n.ftWeights, n.l1Bias, n.l1Weights, n.l2Bias, n.l2Weights, &n.outBias, n.outWeight}
+}
+
+// Accumulator holds the feature transformer output for both perspectives, indexed by Color.
+type Accumulator struct {
+	values [2][]int16
+}
+
+// NewAccumulator allocates an accumulator sized for n.
+func (n *Network) NewAccumulator() *Accumulator {
+	return &Accumulator{values: [2][]int16{make([]int16, n.FTSize), make([]int16, n.FTSize)}}
+}
+
+// nnueFeature returns the input index of a non-king piece on sq seen by perspective, whose
+// king is on kingSq.
+func nnueFeature(perspective Color, kingSq, sq uint64, kind PieceKind, color Color) int {
+	if perspective == Black {
+		kingSq ^= 56
+		sq ^= 56
+	}
+	pieceType := nnueKindIndex(kind)
+	if color != perspective {
+		pieceType += 5
+	}
+	return (int(kingSq)*nnuePieceTypes+pieceType)*64 + int(sq)
+}
+
+func nnueKindIndex(kind PieceKind) int {
+	switch kind {
+	case Pawn:
+		return 0
+	case Knight:
+		return 1
+	case Bishop:
+		return 2
+	case Rook:
+		return 3
+	}
+	return 4 // Queen
+}
+
+// kingSquare returns the square of color's king, or false without one.
+func kingSquare(pos *Position, color Color) (uint64, bool) {
+	for i := range pos.pieces {
+		piece := &pos.pieces[i]
+		if piece.Kind == King && piece.Color == color && !piece.Location.IsEmpty() {
+			return piece.Location.FirstSet(), true
+		}
+	}
+	return 0, false
+}
+
+// Supports reports whether the network can evaluate pos: it needs both kings on the board,
+// and knows nothing about pieces in hand.
+func (n *Network) Supports(pos *Position) bool {
+	if n == nil || pos.variant == Crazyhouse {
+		return false
+	}
+	_, white := kingSquare(pos, White)
+	_, black := kingSquare(pos, Black)
+	return white && black
+}
+
+// Refresh recomputes the accumulator of perspective for pos from scratch.
+func (n *Network) Refresh(acc *Accumulator, pos *Position, perspective Color) {
+	values := acc.values[perspective]
+	copy(values, n.ftBias)
+	kingSq, _ := kingSquare(pos, perspective)
+	for i := range pos.pieces {
+		piece := &pos.pieces[i]
+		if piece.Kind == King || piece.Location.IsEmpty() {
+			continue
+		}
+		n.addFeature(values, nnueFeature(perspective, kingSq, piece.Location.FirstSet(), piece.Kind, piece.Color))
+	}
+}
+
+// Update sets acc to the accumulator of child, given parentAcc for parent, the position
+// before move, or before a null move when move is nil. Only the features of the squares
+// move changes are updated, unless a king moved, which changes every feature of its side.
+func (n *Network) Update(acc, parentAcc *Accumulator, parent, child *Position, move *GeneratedMove) {
+	var buf [4]uint64
+	changed := nnueChangedSquares(parent, move, buf[:0])
+	for _, perspective := range []Color{White, Black} {
+		parentKing, _ := kingSquare(parent, perspective)
+		childKing, _ := kingSquare(child, perspective)
+		if parentKing != childKing {
+			n.Refresh(acc, child, perspective)
+			continue
+		}
+		values := acc.values[perspective]
+		copy(values, parentAcc.values[perspective])
+		for _, sq := range changed {
+			before, beforeColor, hadPiece := nnuePieceAt(parent, sq)
+			after, afterColor, hasPiece := nnuePieceAt(child, sq)
+			if hadPiece == hasPiece && before == after && beforeColor == afterColor {
+				continue
+			}
+			if hadPiece {
+				n.subFeature(values, nnueFeature(perspective, childKing, sq, before, beforeColor))
+			}
+			if hasPiece {
+				n.addFeature(values, nnueFeature(perspective, childKing, sq, after, afterColor))
+			}
+		}
+	}
+}
+
+// nnueChangedSquares appends to squares those whose contents move changes: its from and to
+// squares, the rook's squares when castling and the captured pawn's square en passant. A
+// null move changes none.
+func nnueChangedSquares(parent *Position, move *GeneratedMove, squares []uint64) []uint64 {
+	if move == nil {
+		return squares
+	}
+	to, _ := squareToIndex(move.To)
+	squares = append(squares, to)
+	if move.IsDrop {
+		return squares
+	}
+	from, _ := squareToIndex(move.From)
+	squares = append(squares, from)
+	backRank := from &^ 7
+	switch {
+	case move.IsCastle && (move.CastleSide == WhiteKingside || move.CastleSide == BlackKingside):
+		squares = append(squares, backRank+7, backRank+5)
+	case move.IsCastle:
+		squares = append(squares, backRank, backRank+3)
+	case move.Kind == Pawn && move.IsCapture && parent.board[to] < 0:
+		squares = append(squares, from&^7|to&7)
+	}
+	return squares
+}
+
+// nnuePieceAt returns the non-king piece on sq, if any.
+func nnuePieceAt(pos *Position, sq uint64) (PieceKind, Color, bool) {
+	i := pos.board[sq]
+	if i < 0 || pos.pieces[i].Kind == King {
+		return Empty, White, false
+	}
+	return pos.pieces[i].Kind, pos.pieces[i].Color, true
+}
+
+func (n *Network) addFeature(values []int16, feature int) {
+	weights := n.ftWeights[feature*n.FTSize : (feature+1)*n.FTSize]
+	for i, w := range weights {
+		values[i] += w
+	}
+}
+
+func (n *Network) subFeature(values []int16, feature int) {
+	weights := n.ftWeights[feature*n.FTSize : (feature+1)*n.FTSize]
+	for i, w := range weights {
+		values[i] -= w
+	}
+}
+
+// LayerBuffers holds the inputs and hidden layer values of one evaluation, so that a
+// searcher can reuse them rather than allocate them for every position.
+type LayerBuffers struct {
+	input, hidden1, hidden2 []int32
+}
+
+// NewLayerBuffers allocates layer buffers sized for n.
+func (n *Network) NewLayerBuffers() *LayerBuffers {
+	return &LayerBuffers{input: make([]int32, 2*n.FTSize), hidden1: make([]int32, n.Hidden1), hidden2: make([]int32, n.Hidden2)}
+}
+
+// Output runs the layers after the feature transformer for side to move, using buf for the
+// intermediate values.
+func (n *Network) Output(acc *Accumulator, toMove Color, buf *LayerBuffers) int {
+	for i, v := range acc.values[toMove] {
+		buf.input[i] = clippedReLU(int32(v))
+	}
+	for i, v := range acc.values[toMove.Opponent()] {
+		buf.input[n.FTSize+i] = clippedReLU(int32(v))
+	}
+	denseLayer(buf.hidden1, buf.input, n.l1Weights, n.l1Bias)
+	denseLayer(buf.hidden2, buf.hidden1, n.l2Weights, n.l2Bias)
+	sum := n.outBias
+	for i, w := range n.outWeight {
+		sum += int32(w) * buf.hidden2[i]
+	}
+	return int(sum / nnueOutputScale)
+}
+
+// Evaluate returns the network's score for pos, computing both accumulators from scratch.
+func (n *Network) Evaluate(pos *Position) int {
+	acc := n.NewAccumulator()
+	n.Refresh(acc, pos, White)
+	n.Refresh(acc, pos, Black)
+	return n.Output(acc, pos.toMove, n.NewLayerBuffers())
+}
+
+// denseLayer sets out to input multiplied by the row-major int8 weights, plus biases, with
+// the hidden activation applied.
+func denseLayer(out, input []int32, weights []int8, biases []int32) {
+	for j := range out {
+		sum := biases[j]
+		row := weights[j*len(input) : (j+1)*len(input)]
+		for i, x := range input {
+			sum += int32(row[i]) * x
+		}
+		out[j] = clippedReLU(sum >> nnueHiddenShift)
+	}
+}
+
+func clippedReLU(x int32) int32 {
+	return min(max(x, 0), 127)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// randomNetwork returns a small network with random weights, scaled so that accumulators
+// land around the clipping range.
+func randomNetwork(seed int64) *Network {
+	rng := rand.New(rand.NewSource(seed))
+	n := NewNetwork(32, 16, 8)
+	for i := range n.ftBias {
+		n.ftBias[i] = int16(rng.Intn(128))
+	}
+	for i := range n.ftWeights {
+		n.ftWeights[i] = int16(rng.Intn(65) - 32)
+	}
+	for _, layer := range [][]int8{n.l1Weights, n.l2Weights, n.outWeight} {
+		for i := range layer {
+			layer[i] = int8(rng.Intn(255) - 127)
+		}
+	}
+	for _, biases := range [][]int32{n.l1Bias, n.l2Bias} {
+		for i := range biases {
+			biases[i] = int32(rng.Intn(2001) - 1000)
+		}
+	}
+	n.outBias = int32(rng.Intn(201) - 100)
+	return n
+}
+
+// TestNetwork_IncrementalMatchesRefresh plays random games, including null moves, and checks
+// after every move that the incrementally updated accumulators and output equal a full
+// recomputation.
+func TestNetwork_IncrementalMatchesRefresh(t *testing.T) {
+	net := randomNetwork(1)
+	rng := rand.New(rand.NewSource(2))
+	starts := []string{
+		standardStartFEN,
+		"r3k2r/1P4p1/8/3pP3/8/8/6p1/R3K2R w KQkq d6 0 1", // castling, en passant, promotions
+	}
+	outputs := map[int]bool{}
+	for game := range 20 {
+		pos, err := ParseFEN(starts[game%len(starts)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		acc := net.NewAccumulator()
+		net.Refresh(acc, pos, White)
+		net.Refresh(acc, pos, Black)
+		for ply := 0; ply < 80; ply++ {
+			var next *Position
+			var move *GeneratedMove
+			if legal := generateLegalMoves(pos); len(legal) == 0 {
+				break
+			} else if rng.Intn(10) == 0 && !pos.IsKingInCheck(pos.toMove) {
+				next = nullMovePosition(pos)
+			} else {
+				ap := legal[rng.Intn(len(legal))]
+				next, move = ap.Position, &ap.Move
+			}
+			updated := net.NewAccumulator()
+			net.Update(updated, acc, pos, next, move)
+
+			fresh := net.NewAccumulator()
+			net.Refresh(fresh, next, White)
+			net.Refresh(fresh, next, Black)
+			for _, color := range []Color{White, Black} {
+				if !slices.Equal(updated.values[color], fresh.values[color]) {
+					t.Fatalf("game %d ply %d: %s accumulator differs after reaching %s",
+						game, ply, colorToString(color), next.String())
+				}
+			}
+			got, want := net.Output(updated, next.toMove, net.NewLayerBuffers()), net.Evaluate(next)
+			if got != want {
+				t.Fatalf("game %d ply %d: incremental output %d, full %d", game, ply, got, want)
+			}
+			outputs[got] = true
+			pos, acc = next, updated
+		}
+	}
+	if len(outputs) < 10 {
+		t.Errorf("expected the random network to produce varied outputs, got %d distinct", len(outputs))
+	}
+}
+
+// TestNetwork_SearchHooks walks a line through the searcher's make hook and checks that the
+// evaluation at every ply matches a full recomputation.
+func TestNetwork_SearchHooks(t *testing.T) {
+	net := randomNetwork(3)
+	s := &searcher{net: net}
+	pos := NewVariantPosition(Standard)
+	s.setRoot(pos)
+	for ply, uci := range []string{"e2e4", "d7d5", "e4d5", "g8f6", "f1b5", "c7c6", "d5c6", "d8d2", "e1d2", "e7e5", "c6b7", "b8d7", "b7a8q"} {
+		ap, ok := findUCIMove(pos, uci)
+		if !ok {
+			t.Fatalf("%s is not legal", uci)
+		}
+		s.makeMove(pos, ap.Position, &ap.Move, ply)
+		pos = ap.Position
+		if got, want := s.evaluate(pos, ply+1), net.Evaluate(pos); got != want {
+			t.Fatalf("after %s: search evaluation %d, full %d", uci, got, want)
+		}
+	}
+
+	// Searching with the network is as reproducible as without
+	var results []string
+	for range 2 {
+		best, ok := Dumbfish{Network: net}.SelectMove(NewVariantPosition(Standard))
+		if !ok {
+			t.Fatal("no move")
+		}
+		results = append(results, best.Move.UCINotation())
+	}
+	if results[0] != results[1] {
+		t.Errorf("searches with the same network differ: %v", results)
+	}
+}
+
+func TestNetwork_WeightsFile(t *testing.T) {
+	net := randomNetwork(4)
+	var buf bytes.Buffer
+	written, err := net.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSize := 4 + 4*4 + 32*2 + nnueFeatures*32*2 + 16*4 + 16*64 + 8*4 + 8*16 + 4 + 8
+	if written != int64(buf.Len()) || buf.Len() != wantSize {
+		t.Fatalf("wrote %d bytes (reported %d), want %d", buf.Len(), written, wantSize)
+	}
+	data := buf.Bytes()
+
+	loaded, err := ReadNetwork(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, _ := ParseFEN("r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4")
+	if got, want := loaded.Evaluate(pos), net.Evaluate(pos); got != want {
+		t.Errorf("loaded network evaluates %d, original %d", got, want)
+	}
+
+	bad := map[string][]byte{
+		"magic":     append([]byte("NNUE"), data[4:]...),
+		"truncated": data[:len(data)-1],
+		"trailing":  append(slices.Clone(data), 0),
+		"empty":     nil,
+	}
+	for name, b := range bad {
+		if _, err := ReadNetwork(bytes.NewReader(b)); !errors.Is(err, ErrNetworkFormat) {
+			t.Errorf("%s: expected ErrNetworkFormat, got %v", name, err)
+		}
+	}
+}
+
+func TestUCI_EvalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.nnue")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := randomNetwork(5).WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	in := strings.NewReader("setoption name EvalFile value " + path + "\nposition startpos\ngo depth 2\n")
+	var out strings.Builder
+	if err := RunUCI(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"info string loaded network", "(32-16-8)", "bestmove "} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestNetwork_UpdateSpecialMoves checks the squares Update takes from castling, en passant,
+// promotion and capture moves, on both sides, against a full recomputation.
+func TestNetwork_UpdateSpecialMoves(t *testing.T) {
+	net := randomNetwork(4)
+	for _, c := range []struct{ fen, uci string }{
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1c1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8g8"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6"},
+		{"4k3/8/8/8/3pP3/8/8/4K3 b - e3 0 1", "d4e3"},
+		{"1n2k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8n"},
+		{"4k3/8/8/8/8/8/6p1/4K2R b - - 0 1", "g2h1q"},
+		{"4k3/8/8/3p4/4N3/8/8/4K3 w - - 0 1", "e4d6"},
+	} {
+		pos, err := ParseFEN(c.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ap, ok := findUCIMove(pos, c.uci)
+		if !ok {
+			t.Fatalf("%s: %s is not legal", c.fen, c.uci)
+		}
+		acc, updated, fresh := net.NewAccumulator(), net.NewAccumulator(), net.NewAccumulator()
+		net.Refresh(acc, pos, White)
+		net.Refresh(acc, pos, Black)
+		net.Update(updated, acc, pos, ap.Position, &ap.Move)
+		net.Refresh(fresh, ap.Position, White)
+		net.Refresh(fresh, ap.Position, Black)
+		for _, color := range []Color{White, Black} {
+			if !slices.Equal(updated.values[color], fresh.values[color]) {
+				t.Errorf("%s %s: %s accumulator differs", c.fen, c.uci, colorToString(color))
+			}
+		}
+	}
+}
+
+func TestNetwork_EvaluationDoesNotAllocate(t *testing.T) {
+	net := randomNetwork(5)
+	pos := NewVariantPosition(Standard)
+	ap, _ := findUCIMove(pos, "g1f3")
+	acc, child := net.NewAccumulator(), net.NewAccumulator()
+	net.Refresh(acc, pos, White)
+	net.Refresh(acc, pos, Black)
+	buf := net.NewLayerBuffers()
+	allocs := testing.AllocsPerRun(100, func() {
+		net.Update(child, acc, pos, ap.Position, &ap.Move)
+		net.Output(child, ap.Position.toMove, buf)
+	})
+	if allocs != 0 {
+		t.Errorf("Update and Output made %v allocations", allocs)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+// GameResult is the result of a game, as written in PGN.
+type GameResult int
+
+const (
+	Ongoing GameResult = iota
+	WhiteWins
+	BlackWins
+	Draw
+)
+
+func (r GameResult) String() string {
+	switch r {
+	case WhiteWins:
+		return "1-0"
+	case BlackWins:
+		return "0-1"
+	case Draw:
+		return "1/2-1/2"
+	default:
+		return "*"
+	}
+}
+
+// parseGameResult reads a result as written in PGN; anything else is Ongoing.
+func parseGameResult(s string) GameResult {
+	switch s {
+	case "1-0":
+		return WhiteWins
+	case "0-1":
+		return BlackWins
+	case "1/2-1/2":
+		return Draw
+	default:
+		return Ongoing
+	}
+}
+
+// Outcome describes whether the game is over in a position and why.
+type Outcome struct {
+	Result GameResult
+	Reason string
+}
+
+// IsOver reports whether the outcome ends the game.
+func (o Outcome) IsOver() bool {
+	return o.Result != Ongoing
+}
+
+// rank8 covers the eighth rank, the Racing Kings goal.
+var rank8 = Bitboard(0xFF00000000000000)
+
+// kingBitboard returns the location of the color's king, or an empty bitboard if it has none.
+func (p *Position) kingBitboard(color Color) Bitboard {
+	for i := range p.pieces {
+		piece := &p.pieces[i]
+		if piece.Color == color && piece.Kind == King {
+			return piece.Location
+		}
+	}
+	return EmptyBitboard()
+}
+
+// isVariantEnd reports whether a variant-specific rule has ended the game, independent of
+// checkmate and stalemate.
+func (p *Position) isVariantEnd() bool {
+	switch p.variant {
+	case Horde:
+		return p.whiteOccupancy.IsEmpty()
+	case RacingKings:
+		whiteHome := !p.kingBitboard(White).And(rank8).IsEmpty()
+		blackHome := !p.kingBitboard(Black).And(rank8).IsEmpty()
+		if !whiteHome && !blackHome {
+			return false
+		}
+		if blackHome || p.toMove == White {
+			return true
+		}
+		// White has arrived; black gets one move to draw by reaching the eighth rank too
+		for _, ap := range filterLegalMoves(p) {
+			if ap.Move.Kind == King && ap.Move.To[1] == '8' {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Outcome reports whether the game has ended in this position: variant wins first, then
+// checkmate, stalemate, the fifty-move rule and (in standard chess) insufficient material.
+// Repetition requires the game history and is not detected here.
+func (p *Position) Outcome() Outcome {
+	switch p.variant {
+	case Horde:
+		if p.whiteOccupancy.IsEmpty() {
+			return Outcome{Result: BlackWins, Reason: "horde destroyed"}
+		}
+	case RacingKings:
+		if p.isVariantEnd() {
+			whiteHome := !p.kingBitboard(White).And(rank8).IsEmpty()
+			blackHome := !p.kingBitboard(Black).And(rank8).IsEmpty()
+			switch {
+			case whiteHome && blackHome:
+				return Outcome{Result: Draw, Reason: "both kings reached the eighth rank"}
+			case whiteHome:
+				return Outcome{Result: WhiteWins, Reason: "king reached the eighth rank"}
+			default:
+				return Outcome{Result: BlackWins, Reason: "king reached the eighth rank"}
+			}
+		}
+	}
+
+	if len(generateLegalMoves(p)) == 0 {
+		if p.IsKingInCheck(p.toMove) {
+			if p.toMove == White {
+				return Outcome{Result: BlackWins, Reason: "checkmate"}
+			}
+			return Outcome{Result: WhiteWins, Reason: "checkmate"}
+		}
+		return Outcome{Result: Draw, Reason: "stalemate"}
+	}
+	if p.halfmoves >= 100 {
+		return Outcome{Result: Draw, Reason: "fifty-move rule"}
+	}
+	if p.variant == Standard && p.hasInsufficientMaterial() {
+		return Outcome{Result: Draw, Reason: "insufficient material"}
+	}
+	return Outcome{Result: Ongoing}
+}
+
+// hasInsufficientMaterial reports dead positions with bare kings, a single minor piece,
+// or only bishops all standing on squares of one color.
+func (p *Position) hasInsufficientMaterial() bool {
+	var minors, bishops int
+	var bishopSquares Bitboard
+	for i := range p.pieces {
+		switch p.pieces[i].Kind {
+		case King:
+		case Knight:
+			minors++
+		case Bishop:
+			minors++
+			bishops++
+			bishopSquares = bishopSquares.Or(p.pieces[i].Location)
+		default:
+			return false
+		}
+	}
+	if minors <= 1 {
+		return true
+	}
+	const darkSquares = Bitboard(0xAA55AA55AA55AA55)
+	if bishops == minors {
+		onDark := bishopSquares.And(darkSquares).Count()
+		return onDark == 0 || onDark == bishops
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestOutcome(t *testing.T) {
+	cases := []struct {
+		name   string
+		fen    string
+		result GameResult
+		reason string
+	}{
+		{"start position", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", Ongoing, ""},
+		{"fool's mate", "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", BlackWins, "checkmate"},
+		{"back rank mate", "R5k1/5ppp/8/8/8/8/8/6K1 b - - 0 1", WhiteWins, "checkmate"},
+		{"stalemate", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", Draw, "stalemate"},
+		{"fifty moves", "4k3/8/8/8/8/8/4P3/4K3 w - - 100 80", Draw, "fifty-move rule"},
+		{"bare kings", "4k3/8/8/8/8/8/8/4K3 w - - 0 1", Draw, "insufficient material"},
+		{"king and knight", "4k3/8/8/8/8/8/8/4KN2 w - - 0 1", Draw, "insufficient material"},
+		{"same colored bishops", "4kb2/8/8/8/8/8/8/2B1K3 w - - 0 1", Draw, "insufficient material"},
+		{"opposite colored bishops", "4k1b1/8/8/8/8/8/8/2B1K3 w - - 0 1", Ongoing, ""},
+	}
+	for _, tc := range cases {
+		pos, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatalf("%s: failed to parse fen: %v", tc.name, err)
+		}
+		out := pos.Outcome()
+		if out.Result != tc.result || out.Reason != tc.reason {
+			t.Errorf("%s: got %s (%s), want %s (%s)", tc.name, out.Result, out.Reason, tc.result, tc.reason)
+		}
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 // GetPossiblePawnMoves returns pseudo-legal pawn moves for the given pawn piece.
 // Includes single/double pushes (if empty), captures, and en passant (if available in position).
-// Assumes standard chess with white pawns moving towards increasing ranks (north).
+// White pawns move towards increasing ranks (north); double pushes start from the variant's start ranks.
 func GetPossiblePawnMoves(pos *Position, piece *Piece) Bitboard {
 	if piece == nil || piece.Location.IsEmpty() || piece.Kind != Pawn {
 		return EmptyBitboard()
@@ -16,18 +16,16 @@ func GetPossiblePawnMoves(pos *Position, piece *Piece) Bitboard {
 
 	var selfOccupancy, enemyOccupancy Bitboard
 	var forwardDirection int
-	var startRank int
 	if piece.Color == White {
 		selfOccupancy = pos.GetWhiteOccupancy()
 		enemyOccupancy = pos.GetBlackOccupancy()
 		forwardDirection = 1
-		startRank = 1
 	} else {
 		selfOccupancy = pos.GetBlackOccupancy()
 		enemyOccupancy = pos.GetWhiteOccupancy()
 		forwardDirection = -1
-		startRank = 6
 	}
+	firstStartRank, lastStartRank := pos.variant.pawnStartRanks(piece.Color)
 
 	moves := EmptyBitboard()
 
@@ -39,7 +37,7 @@ func GetPossiblePawnMoves(pos *Position, piece *Piece) Bitboard {
 			moves = moves.Set(nextIndex)
 
 			// Double push from start rank
-			if rank == startRank {
+			if rank == firstStartRank || rank == lastStartRank {
 				doubleStepRank := rank + 2*forwardDirection
 				if doubleStepRank >= 0 && doubleStepRank < 8 {
 					doubleStepIndex := fileRankToIndex(file, doubleStepRank)
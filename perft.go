@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Perft counts the leaf nodes of the legal move tree depth plies below pos, the standard
+// check of a move generator against published counts. It gives up with ctx's error once
+// ctx is done.
+func Perft(ctx context.Context, pos *Position, depth int) (int, error) {
+	if depth <= 0 {
+		return 1, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	legal := generateLegalMoves(pos)
+	if depth == 1 {
+		return len(legal), nil
+	}
+	nodes := 0
+	for _, ap := range legal {
+		n, err := Perft(ctx, ap.Position, depth-1)
+		if err != nil {
+			return 0, err
+		}
+		nodes += n
+	}
+	return nodes, nil
+}
+
+// Divide runs Perft below each legal move of pos and returns the counts by move in UCI
+// notation, the usual way to find where two move generators disagree.
+func Divide(ctx context.Context, pos *Position, depth int) (map[string]int, error) {
+	counts := map[string]int{}
+	for _, ap := range generateLegalMoves(pos) {
+		n, err := Perft(ctx, ap.Position, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		counts[ap.Move.UCINotation()] = n
+	}
+	return counts, nil
+}
+
+// runPerft implements "perft [-depth N] [FEN]", printing the number of move paths and the
+// speed of the move generator.
+func runPerft(args []string, out io.Writer) error {
+	flags := commandFlags("perft", out)
+	depth := flags.Int("depth", 5, "length of the move paths in plies")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	pos, err := positionArgs(flags.Args())
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	nodes, err := Perft(context.Background(), pos, *depth)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	fmt.Fprintf(out, "Depth %d: %d nodes in %v (%d nps)\n", *depth, nodes, elapsed.Round(time.Millisecond),
+		int(float64(nodes)/max(elapsed.Seconds(), 1e-9)))
+	return nil
+}
+
+// runDivide implements "divide [-depth N] [FEN]", printing the perft count below each legal
+// move in UCI notation, sorted, and their total.
+func runDivide(args []string, out io.Writer) error {
+	flags := commandFlags("divide", out)
+	depth := flags.Int("depth", 4, "length of the move paths in plies, the move itself included")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	pos, err := positionArgs(flags.Args())
+	if err != nil {
+		return err
+	}
+	counts, err := Divide(context.Background(), pos, max(*depth, 1))
+	if err != nil {
+		return err
+	}
+	moves := make([]string, 0, len(counts))
+	total := 0
+	for move, n := range counts {
+		moves = append(moves, move)
+		total += n
+	}
+	sort.Strings(moves)
+	for _, move := range moves {
+		fmt.Fprintf(out, "%s: %d\n", move, counts[move])
+	}
+	fmt.Fprintf(out, "\nMoves: %d\nNodes: %d\n", len(moves), total)
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPerft_KnownCounts(t *testing.T) {
+	cases := []struct {
+		fen   string
+		nodes []int // by depth from 1
+	}{
+		{standardStartFEN, []int{20, 400, 8902}},
+		// "Kiwipete", full of castling, en passant and promotion corner cases
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039}},
+		{"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812}},
+	}
+	for _, c := range cases {
+		pos, err := ParseFEN(c.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range c.nodes {
+			if got, err := Perft(context.Background(), pos, i+1); err != nil || got != want {
+				t.Errorf("perft(%d) of %s = %d, %v; want %d", i+1, c.fen, got, err, want)
+			}
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	pos := NewVariantPosition(Standard)
+	counts, err := Divide(context.Background(), pos, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if len(counts) != 20 || counts["e2e4"] != 20 || counts["g1f3"] != 20 || total != 400 {
+		t.Errorf("divide(2) = %v", counts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Divide(ctx, pos, 3); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled divide: %v", err)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// PGNGame is a game read from Portable Game Notation: its tag pairs and mainline SAN moves.
+// Comments, variations and NAGs are skipped.
+type PGNGame struct {
+	Tags   map[string]string
+	Moves  []string
+	Result string
+}
+
+// StartPosition returns the game's initial position, honouring the FEN and Variant tags.
+func (g PGNGame) StartPosition() (*Position, error) {
+	variant, err := ParseVariant(g.Tags["Variant"])
+	if err != nil {
+		return nil, err
+	}
+	fen := variant.StartFEN()
+	if tagFEN, ok := g.Tags["FEN"]; ok {
+		fen = tagFEN
+	}
+	pos, err := ParseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	pos.SetVariant(variant)
+	return pos, nil
+}
+
+// Replay plays the mainline from the start position and returns the applied moves in order.
+func (g PGNGame) Replay() ([]AppliedMove, error) {
+	pos, err := g.StartPosition()
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]AppliedMove, 0, len(g.Moves))
+	for i, san := range g.Moves {
+		ap, err := parseSAN(pos, san)
+		if err != nil {
+			return applied, fmt.Errorf("ply %d: %w", i+1, err)
+		}
+		applied = append(applied, ap)
+		pos = ap.Position
+	}
+	return applied, nil
+}
+
+// ReadPGN reads every game from a PGN stream.
+func ReadPGN(r io.Reader) ([]PGNGame, error) {
+	var games []PGNGame
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	current := PGNGame{Tags: map[string]string{}}
+	inMoves := false
+	var movetext strings.Builder
+	flush := func() {
+		if !inMoves && len(current.Tags) == 0 {
+			return
+		}
+		current.Moves, current.Result = parseMovetext(movetext.String())
+		if current.Result == "" {
+			current.Result = current.Tags["Result"]
+		}
+		games = append(games, current)
+		current = PGNGame{Tags: map[string]string{}}
+		movetext.Reset()
+		inMoves = false
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "%") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && !strings.HasPrefix(line, "[%") {
+			if inMoves {
+				flush()
+			}
+			name, value, ok := parsePGNTag(line)
+			if ok {
+				current.Tags[name] = value
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		inMoves = true
+		movetext.WriteString(line)
+		movetext.WriteString("\n")
+		if endsWithResult(line) {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return games, err
+	}
+	flush()
+	return games, nil
+}
+
+// parsePGNTag parses a tag pair line such as [Event "Casual game"].
+func parsePGNTag(line string) (string, string, bool) {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+	space := strings.IndexByte(line, ' ')
+	if space == -1 {
+		return "", "", false
+	}
+	name := line[:space]
+	value := strings.TrimSpace(line[space+1:])
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "\""), "\"")
+	value = strings.ReplaceAll(value, "\\\"", "\"")
+	value = strings.ReplaceAll(value, "\\\\", "\\")
+	return name, value, true
+}
+
+func isPGNResult(token string) bool {
+	return token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*"
+}
+
+func endsWithResult(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 0 && isPGNResult(fields[len(fields)-1]) && !strings.ContainsAny(line, "{(")
+}
+
+// parseMovetext extracts mainline SAN tokens and the result from PGN movetext.
+func parseMovetext(text string) ([]string, string) {
+	var moves []string
+	result := ""
+	depth := 0
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '{':
+			end := strings.IndexByte(text[i:], '}')
+			if end == -1 {
+				return moves, result
+			}
+			i += end + 1
+			continue
+		case c == ';':
+			end := strings.IndexByte(text[i:], '\n')
+			if end == -1 {
+				return moves, result
+			}
+			i += end + 1
+			continue
+		case c == '(':
+			depth++
+			i++
+			continue
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+			i++
+			continue
+		case c == ' ' || c == '\n' || c == '\t' || c == '\r':
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(text) && !strings.ContainsRune(" \n\t\r{}();", rune(text[i])) {
+			i++
+		}
+		token := text[start:i]
+		if depth > 0 || strings.HasPrefix(token, "$") {
+			continue
+		}
+		if isPGNResult(token) {
+			result = token
+			continue
+		}
+		// Strip move numbers such as "12." or "12..." which may be glued to the move
+		if dot := strings.LastIndexByte(token, '.'); dot != -1 {
+			token = token[dot+1:]
+		}
+		if token == "" || (token[0] >= '0' && token[0] <= '9' && token[0] != '0') {
+			continue
+		}
+		moves = append(moves, token)
+	}
+	return moves, result
+}
+
+// sevenTagRoster lists the tags every PGN game carries, in their required order.
+var sevenTagRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// WriteTo writes the game in PGN export format: the seven tag roster (with "?" for missing
+// values) followed by the remaining tags in alphabetical order, then the movetext wrapped at
+// 80 columns and ending with the result.
+func (g PGNGame) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	result := g.Result
+	if result == "" {
+		result = "*"
+	}
+	for _, name := range sevenTagRoster {
+		value, ok := g.Tags[name]
+		switch {
+		case name == "Result":
+			value = result
+		case !ok || value == "":
+			value = "?"
+		}
+		writePGNTag(&sb, name, value)
+	}
+	var names []string
+	for name := range g.Tags {
+		if !slices.Contains(sevenTagRoster, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		writePGNTag(&sb, name, g.Tags[name])
+	}
+	sb.WriteString("\n")
+
+	moveNumber, toMove := 1, White
+	if pos, err := g.StartPosition(); err == nil {
+		moveNumber, toMove = max(pos.moveNumber, 1), pos.toMove
+	}
+	var tokens []string
+	for i, san := range g.Moves {
+		switch {
+		case toMove == White:
+			tokens = append(tokens, fmt.Sprintf("%d.", moveNumber))
+		case i == 0:
+			tokens = append(tokens, fmt.Sprintf("%d...", moveNumber))
+		}
+		tokens = append(tokens, san)
+		if toMove == Black {
+			moveNumber++
+		}
+		toMove = toMove.Opponent()
+	}
+	tokens = append(tokens, result)
+	line := 0
+	for i, token := range tokens {
+		if i > 0 {
+			if line+1+len(token) > 80 {
+				sb.WriteString("\n")
+				line = 0
+			} else {
+				sb.WriteString(" ")
+				line++
+			}
+		}
+		sb.WriteString(token)
+		line += len(token)
+	}
+	sb.WriteString("\n\n")
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// writePGNTag writes a tag pair line, escaping quotes and backslashes in value.
+func writePGNTag(sb *strings.Builder, name, value string) {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "\"", "\\\"")
+	fmt.Fprintf(sb, "[%s \"%s\"]\n", name, value)
+}
+
+// runPGN implements "pgn [-out FILE] [-fen] FILE...", replaying every game to check its
+// moves, and writing the games that replay cleanly to -out in export format.
+func runPGN(args []string, out io.Writer) error {
+	flags := commandFlags("pgn", out)
+	output := flags.String("out", "", "file to write the legal games to (default none)")
+	showFEN := flags.Bool("fen", false, "print the final position of each game")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("usage: pgn [-out FILE] [-fen] FILE...")
+	}
+
+	var good []PGNGame
+	bad := 0
+	for _, path := range flags.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		games, err := ReadPGN(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for i, game := range games {
+			name := fmt.Sprintf("%s: game %d (%s - %s)", path, i+1, game.Tags["White"], game.Tags["Black"])
+			moves, err := game.Replay()
+			if err != nil {
+				fmt.Fprintf(out, "%s: %v\n", name, err)
+				bad++
+				continue
+			}
+			fmt.Fprintf(out, "%s: %d plies, %s\n", name, len(moves), game.Result)
+			if *showFEN {
+				pos, _ := game.StartPosition()
+				if len(moves) > 0 {
+					pos = moves[len(moves)-1].Position
+				}
+				fmt.Fprintf(out, "  %s\n", pos.FEN())
+			}
+			good = append(good, game)
+		}
+	}
+
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		for _, game := range good {
+			if _, err := game.WriteTo(f); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d of %d games have illegal moves", bad, bad+len(good))
+	}
+	return nil
+}
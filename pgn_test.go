@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadPGN_TagsCommentsAndVariations(t *testing.T) {
+	input := `[Event "Test"]
+[White "Alice"]
+[Black "Bob \"The Rook\""]
+[Result "1-0"]
+
+1. e4 {best by test} e5 2. Nf3 (2. f4 exf4) Nc6 $1 3. Bb5 a6 ; Morphy
+4. Ba4 Nf6 5. O-O 1-0
+
+[Event "Second"]
+[Result "*"]
+
+1.d4 d5 *
+`
+	games, err := ReadPGN(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("read pgn: %v", err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("expected 2 games, got %d", len(games))
+	}
+	g := games[0]
+	if g.Tags["Black"] != `Bob "The Rook"` {
+		t.Errorf("unexpected Black tag %q", g.Tags["Black"])
+	}
+	want := []string{"e4", "e5", "Nf3", "Nc6", "Bb5", "a6", "Ba4", "Nf6", "O-O"}
+	if strings.Join(g.Moves, " ") != strings.Join(want, " ") {
+		t.Fatalf("moves = %v, want %v", g.Moves, want)
+	}
+	if g.Result != "1-0" {
+		t.Errorf("expected result 1-0, got %s", g.Result)
+	}
+	applied, err := g.Replay()
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	last := applied[len(applied)-1].Position
+	if k := last.GetPieceAtSquare("g1"); k == nil || k.Kind != King {
+		t.Fatalf("expected white king on g1 after O-O")
+	}
+	if games[1].Moves[0] != "d4" || games[1].Result != "*" {
+		t.Errorf("unexpected second game %+v", games[1])
+	}
+}
+
+func TestParseSAN_Disambiguation(t *testing.T) {
+	pos, err := ParseFEN("4k3/8/8/8/8/8/4K3/R6R w - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	if _, err := parseSAN(pos, "Rd1"); err == nil {
+		t.Fatalf("expected Rd1 to be ambiguous")
+	}
+	ap, err := parseSAN(pos, "Rad1")
+	if err != nil || ap.Move.From != "a1" {
+		t.Fatalf("expected Rad1 from a1, got %+v, %v", ap.Move, err)
+	}
+
+	promo, err := ParseFEN("1n2k3/P7/8/8/8/8/8/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	for san, want := range map[string]string{"a8=Q": "a7a8q", "axb8=N+": "a7b8n", "a8R": "a7a8r"} {
+		ap, err := parseSAN(promo, san)
+		if err != nil || ap.Move.UCINotation() != want {
+			t.Errorf("parseSAN(%s) = %s, %v; want %s", san, ap.Move.UCINotation(), err, want)
+		}
+	}
+	if _, err := parseSAN(promo, "Qa8"); err == nil {
+		t.Errorf("expected error for move by missing piece")
+	}
+}
+
+func TestPGNGame_WriteToRoundTrip(t *testing.T) {
+	game := PGNGame{
+		Tags: map[string]string{
+			"Event":     "Test",
+			"White":     `Bob "The Rook"`,
+			"Black":     "Alice",
+			"FEN":       "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2",
+			"SetUp":     "1",
+			"Annotator": "",
+		},
+		Moves:  []string{"Nc6", "Nf3", "Nf6", "Bb5"},
+		Result: "*",
+	}
+	var sb strings.Builder
+	if _, err := game.WriteTo(&sb); err != nil {
+		t.Fatalf("write pgn: %v", err)
+	}
+	text := sb.String()
+	if !strings.HasPrefix(text, "[Event \"Test\"]\n[Site \"?\"]\n[Date \"?\"]\n[Round \"?\"]\n") {
+		t.Errorf("seven tag roster out of order:\n%s", text)
+	}
+	if !strings.Contains(text, "\n2... Nc6 3. Nf3 Nf6 4. Bb5 *\n") {
+		t.Errorf("unexpected movetext:\n%s", text)
+	}
+
+	games, err := ReadPGN(strings.NewReader(text + text))
+	if err != nil {
+		t.Fatalf("read pgn: %v", err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("expected 2 games, got %d", len(games))
+	}
+	got := games[0]
+	if got.Tags["White"] != game.Tags["White"] || got.Tags["SetUp"] != "1" || got.Result != "*" {
+		t.Errorf("tags did not round trip: %v", got.Tags)
+	}
+	if strings.Join(got.Moves, " ") != strings.Join(game.Moves, " ") {
+		t.Errorf("moves = %v, want %v", got.Moves, game.Moves)
+	}
+	if _, err := got.Replay(); err != nil {
+		t.Errorf("replay: %v", err)
+	}
+}
+
+func TestPGNGame_WriteToWrapsLines(t *testing.T) {
+	game := PGNGame{Tags: map[string]string{}, Result: "1/2-1/2"}
+	for range 20 {
+		game.Moves = append(game.Moves, "Nf3", "Nf6", "Ng1", "Ng8")
+	}
+	var sb strings.Builder
+	if _, err := game.WriteTo(&sb); err != nil {
+		t.Fatalf("write pgn: %v", err)
+	}
+	for _, line := range strings.Split(sb.String(), "\n") {
+		if len(line) > 80 {
+			t.Errorf("line longer than 80 columns: %q", line)
+		}
+	}
+	if !strings.Contains(sb.String(), "40. Ng1 Ng8 1/2-1/2\n") {
+		t.Errorf("unexpected movetext end:\n%s", sb.String())
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+// PolyglotKey returns the Polyglot Zobrist hash of a position, used to index opening books.
+func PolyglotKey(pos *Position) uint64 {
+	var key uint64
+	for i := range pos.pieces {
+		piece := &pos.pieces[i]
+		if piece.Location.IsEmpty() {
+			continue
+		}
+		key ^= polyglotRandom64[64*polyglotPieceIndex(piece.Kind, piece.Color)+int(piece.Location.FirstSet())]
+	}
+
+	castlingKeys := []CastlingSide{WhiteKingside, WhiteQueenside, BlackKingside, BlackQueenside}
+	for i, right := range castlingKeys {
+		if pos.CanCastle(right) {
+			key ^= polyglotRandom64[768+i]
+		}
+	}
+
+	// The en passant file is only hashed when a pawn of the side to move can actually capture
+	if !pos.enpassant.IsEmpty() {
+		epFile, epRank := indexToFileRank(pos.enpassant.FirstSet())
+		pawnRank := epRank - 1
+		if pos.toMove == Black {
+			pawnRank = epRank + 1
+		}
+		for _, df := range []int{-1, 1} {
+			if p := pos.GetPiece(epFile+df, pawnRank); p != nil && p.Kind == Pawn && p.Color == pos.toMove {
+				key ^= polyglotRandom64[772+epFile]
+				break
+			}
+		}
+	}
+
+	if pos.toMove == White {
+		key ^= polyglotRandom64[780]
+	}
+	return key
+}
+
+// polyglotPieceIndex maps a piece to the Polyglot "kind of piece" ordering:
+// black pawn 0, white pawn 1, black knight 2, ... white king 11.
+func polyglotPieceIndex(kind PieceKind, color Color) int {
+	var base int
+	switch kind {
+	case Pawn:
+		base = 0
+	case Knight:
+		base = 2
+	case Bishop:
+		base = 4
+	case Rook:
+		base = 6
+	case Queen:
+		base = 8
+	case King:
+		base = 10
+	}
+	if color == White {
+		return base + 1
+	}
+	return base
+}
+
+// BookEntry is one 16-byte record of a Polyglot book.
+type BookEntry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+// PolyglotBook is an in-memory Polyglot opening book with entries sorted by key.
+type PolyglotBook struct {
+	Entries []BookEntry
+}
+
+// LoadPolyglotBook opens and reads a Polyglot .bin file.
+func LoadPolyglotBook(path string) (*PolyglotBook, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPolyglotBook(f)
+}
+
+// ReadPolyglotBook reads big-endian 16-byte Polyglot entries until EOF.
+func ReadPolyglotBook(r io.Reader) (*PolyglotBook, error) {
+	book := &PolyglotBook{}
+	reader := bufio.NewReader(r)
+	var buf [16]byte
+	for {
+		_, err := io.ReadFull(reader, buf[:])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("polyglot book: truncated entry: %w", err)
+		}
+		book.Entries = append(book.Entries, BookEntry{
+			Key:    binary.BigEndian.Uint64(buf[0:8]),
+			Move:   binary.BigEndian.Uint16(buf[8:10]),
+			Weight: binary.BigEndian.Uint16(buf[10:12]),
+			Learn:  binary.BigEndian.Uint32(buf[12:16]),
+		})
+	}
+	// Books are sorted by key on disk, but be tolerant of hand-made files
+	if !sort.SliceIsSorted(book.Entries, func(i, j int) bool { return book.Entries[i].Key < book.Entries[j].Key }) {
+		sort.SliceStable(book.Entries, func(i, j int) bool { return book.Entries[i].Key < book.Entries[j].Key })
+	}
+	return book, nil
+}
+
+// WriteTo writes the book in Polyglot binary format.
+func (b *PolyglotBook) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	var buf [16]byte
+	for _, e := range b.Entries {
+		binary.BigEndian.PutUint64(buf[0:8], e.Key)
+		binary.BigEndian.PutUint16(buf[8:10], e.Move)
+		binary.BigEndian.PutUint16(buf[10:12], e.Weight)
+		binary.BigEndian.PutUint32(buf[12:16], e.Learn)
+		n, err := w.Write(buf[:])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// BookMove is a legal move found in the book together with its weight.
+type BookMove struct {
+	AppliedMove
+	Weight uint16
+}
+
+// Lookup returns the book moves for the position that are legal, in book order.
+// Only standard chess positions are looked up.
+func (b *PolyglotBook) Lookup(pos *Position) []BookMove {
+	if b == nil || pos.variant != Standard {
+		return nil
+	}
+	key := PolyglotKey(pos)
+	start := sort.Search(len(b.Entries), func(i int) bool { return b.Entries[i].Key >= key })
+	var moves []BookMove
+	var legal []AppliedMove
+	for i := start; i < len(b.Entries) && b.Entries[i].Key == key; i++ {
+		if legal == nil {
+			legal = generateLegalMoves(pos)
+		}
+		uci := polyglotMoveToUCI(pos, b.Entries[i].Move)
+		for _, ap := range legal {
+			if ap.Move.UCINotation() == uci {
+				moves = append(moves, BookMove{AppliedMove: ap, Weight: b.Entries[i].Weight})
+				break
+			}
+		}
+	}
+	return moves
+}
+
+// PickMove selects a book move at random with probability proportional to its weight.
+func (b *PolyglotBook) PickMove(pos *Position, rng *rand.Rand) (AppliedMove, bool) {
+	moves := b.Lookup(pos)
+	total := 0
+	for _, m := range moves {
+		total += int(m.Weight)
+	}
+	if total == 0 {
+		return AppliedMove{}, false
+	}
+	pick := rng.Intn(total)
+	for _, m := range moves {
+		pick -= int(m.Weight)
+		if pick < 0 {
+			return m.AppliedMove, true
+		}
+	}
+	return AppliedMove{}, false
+}
+
+// polyglotMoveToUCI decodes a Polyglot move. Castling is stored as the king capturing
+// its own rook (e1h1) and is translated to the usual king move (e1g1).
+func polyglotMoveToUCI(pos *Position, move uint16) string {
+	toFile := int(move & 7)
+	toRank := int((move >> 3) & 7)
+	fromFile := int((move >> 6) & 7)
+	fromRank := int((move >> 9) & 7)
+	promotion := (move >> 12) & 7
+
+	from := squareFromIndex(fileRankToIndex(fromFile, fromRank))
+	to := squareFromIndex(fileRankToIndex(toFile, toRank))
+	if king := pos.GetPiece(fromFile, fromRank); king != nil && king.Kind == King && fromFile == 4 && fromRank == toRank {
+		if rook := pos.GetPiece(toFile, toRank); rook != nil && rook.Kind == Rook && rook.Color == king.Color {
+			if toFile == 7 {
+				to = squareFromIndex(fileRankToIndex(6, toRank))
+			} else if toFile == 0 {
+				to = squareFromIndex(fileRankToIndex(2, toRank))
+			}
+		}
+	}
+	return from + to + []string{"", "n", "b", "r", "q"}[promotion%5]
+}
+
+// polyglotMoveFromGenerated encodes a move in Polyglot format.
+func polyglotMoveFromGenerated(move GeneratedMove) uint16 {
+	fromFile, fromRank, _ := squareToFileRank(move.From)
+	toFile, toRank, _ := squareToFileRank(move.To)
+	if move.IsCastle {
+		if move.CastleSide == WhiteKingside || move.CastleSide == BlackKingside {
+			toFile = 7
+		} else {
+			toFile = 0
+		}
+	}
+	var promotion uint16
+	switch move.Promotion {
+	case Knight:
+		promotion = 1
+	case Bishop:
+		promotion = 2
+	case Rook:
+		promotion = 3
+	case Queen:
+		promotion = 4
+	}
+	return uint16(toFile) | uint16(toRank)<<3 | uint16(fromFile)<<6 | uint16(fromRank)<<9 | promotion<<12
+}
+
+// BookBuildOptions limits which positions and moves make it into a built book.
+type BookBuildOptions struct {
+	MaxPly   int // only record moves played within the first MaxPly plies (0 = 20)
+	MinCount int // drop moves seen fewer than MinCount times (0 = 1)
+}
+
+// BuildPolyglotBook builds a book from PGN games. Each move is weighted like polyglot's
+// make-book: two points when the side that played it went on to win, one for a draw.
+// Games that cannot be replayed are skipped from the first unreadable move onwards.
+func BuildPolyglotBook(games []PGNGame, opts BookBuildOptions) *PolyglotBook {
+	maxPly := opts.MaxPly
+	if maxPly <= 0 {
+		maxPly = 20
+	}
+	minCount := opts.MinCount
+	if minCount <= 0 {
+		minCount = 1
+	}
+
+	type bookKey struct {
+		key  uint64
+		move uint16
+	}
+	counts := map[bookKey]int{}
+	scores := map[bookKey]int{}
+	for _, game := range games {
+		pos, err := game.StartPosition()
+		if err != nil || pos.variant != Standard {
+			continue
+		}
+		for ply, san := range game.Moves {
+			if ply >= maxPly {
+				break
+			}
+			ap, err := parseSAN(pos, san)
+			if err != nil {
+				break
+			}
+			k := bookKey{key: PolyglotKey(pos), move: polyglotMoveFromGenerated(ap.Move)}
+			counts[k]++
+			switch {
+			case game.Result == "1/2-1/2":
+				scores[k]++
+			case (game.Result == "1-0" && pos.toMove == White) || (game.Result == "0-1" && pos.toMove == Black):
+				scores[k] += 2
+			}
+			pos = ap.Position
+		}
+	}
+
+	book := &PolyglotBook{}
+	for k, n := range counts {
+		if n < minCount || scores[k] == 0 {
+			continue
+		}
+		book.Entries = append(book.Entries, BookEntry{Key: k.key, Move: k.move, Weight: uint16(min(scores[k], 0xFFFF))})
+	}
+	sort.Slice(book.Entries, func(i, j int) bool {
+		a, b := book.Entries[i], book.Entries[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		if a.Weight != b.Weight {
+			return a.Weight > b.Weight
+		}
+		return a.Move < b.Move
+	})
+	return book
+}
+
+// BookEngine plays from an opening book while it can and otherwise delegates to Engine.
+type BookEngine struct {
+	Book   *PolyglotBook
+	Engine Engine
+	Rand   *rand.Rand
+}
+
+func (b BookEngine) Name() string { return b.Engine.Name() }
+
+// SelectMove returns a weighted random book move, falling back to the wrapped engine.
+func (b BookEngine) SelectMove(pos *Position) (AppliedMove, bool) {
+	if ap, ok := b.Book.PickMove(pos, b.rng()); ok {
+		return ap, true
+	}
+	return b.Engine.SelectMove(pos)
+}
+
+// Search plays from the book like SelectMove and passes the limits to the wrapped engine.
+func (b BookEngine) Search(ctx context.Context, pos *Position, limits SearchLimits, info func(SearchInfo)) (AppliedMove, bool) {
+	if ap, ok := b.Book.PickMove(pos, b.rng()); ok {
+		return ap, true
+	}
+	return b.Engine.Search(ctx, pos, limits, info)
+}
+
+func (b BookEngine) rng() *rand.Rand {
+	if b.Rand == nil {
+		return rand.New(rand.NewSource(rand.Int63()))
+	}
+	return b.Rand
+}
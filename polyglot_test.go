@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestPolyglotKey_ReferenceVectors(t *testing.T) {
+	// Reference keys from the Polyglot book format specification
+	cases := []struct {
+		moves []string
+		key   uint64
+	}{
+		{nil, 0x463b96181691fc9c},
+		{[]string{"e2e4"}, 0x823c9b50fd114196},
+		{[]string{"e2e4", "d7d5"}, 0x0756b94461c50fb0},
+		{[]string{"e2e4", "d7d5", "e4e5"}, 0x662fafb965db29d4},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5"}, 0x22a48b5a8e47ff78},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2"}, 0x652a607ca3f242c1},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2", "e8f7"}, 0x00fdd303c946bdd9},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4"}, 0x3c8123ea7b067637},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4", "b4c3", "a1a3"}, 0x5c3f9b829b279560},
+	}
+	for _, tc := range cases {
+		pos := NewVariantPosition(Standard)
+		for _, uci := range tc.moves {
+			next, ok := findUCIMove(pos, uci)
+			if !ok {
+				t.Fatalf("move %s not legal after %v", uci, tc.moves)
+			}
+			pos = next.Position
+		}
+		if got := PolyglotKey(pos); got != tc.key {
+			t.Errorf("key after %v = %016x, want %016x", tc.moves, got, tc.key)
+		}
+	}
+}
+
+func TestPolyglotMoveEncoding(t *testing.T) {
+	pos, err := ParseFEN("r3k2r/1P6/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	for _, ap := range generateLegalMoves(pos) {
+		encoded := polyglotMoveFromGenerated(ap.Move)
+		if got := polyglotMoveToUCI(pos, encoded); got != ap.Move.UCINotation() {
+			t.Errorf("round trip of %s gave %s", ap.Move.UCINotation(), got)
+		}
+	}
+	// Castling is stored as king takes rook
+	castle := GeneratedMove{From: "e1", To: "g1", Kind: King, Color: White, IsCastle: true, CastleSide: WhiteKingside}
+	if got := polyglotMoveFromGenerated(castle); got != 0x0107 {
+		t.Errorf("expected e1h1 encoding 0x0107 for O-O, got %#04x", got)
+	}
+}
+
+const bookTestPGN = `[Event "One"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 1-0
+
+[Event "Two"]
+[Result "1/2-1/2"]
+
+1. e4 c5 2. Nf3 d6 1/2-1/2
+
+[Event "Three"]
+[Result "1-0"]
+
+1. d4 d5 2. c4 e6 1-0
+
+[Event "Four"]
+[Result "0-1"]
+
+1. e4 e5 2. Nf3 Nf6 0-1
+`
+
+func TestBuildPolyglotBook_RoundTrip(t *testing.T) {
+	games, err := ReadPGN(strings.NewReader(bookTestPGN))
+	if err != nil {
+		t.Fatalf("read pgn: %v", err)
+	}
+	book := BuildPolyglotBook(games, BookBuildOptions{MaxPly: 2})
+
+	var buf bytes.Buffer
+	if _, err := book.WriteTo(&buf); err != nil {
+		t.Fatalf("write book: %v", err)
+	}
+	if buf.Len() != 16*len(book.Entries) {
+		t.Fatalf("expected %d bytes, got %d", 16*len(book.Entries), buf.Len())
+	}
+	loaded, err := ReadPolyglotBook(&buf)
+	if err != nil {
+		t.Fatalf("read book: %v", err)
+	}
+
+	start := NewVariantPosition(Standard)
+	moves := loaded.Lookup(start)
+	weights := map[string]uint16{}
+	for _, m := range moves {
+		weights[m.Move.UCINotation()] = m.Weight
+	}
+	// e4: win(2) + draw(1) + loss(0) = 3; d4: win(2)
+	if weights["e2e4"] != 3 || weights["d2d4"] != 2 || len(weights) != 2 {
+		t.Fatalf("unexpected start position weights: %v", weights)
+	}
+	if moves[0].Move.UCINotation() != "e2e4" {
+		t.Fatalf("expected heaviest move first, got %s", moves[0].Move.UCINotation())
+	}
+
+	// MaxPly limits recorded depth: nothing after 1. e4 e5
+	afterE4E5, _ := findUCIMove(start, "e2e4")
+	afterE4E5, _ = findUCIMove(afterE4E5.Position, "e7e5")
+	if got := loaded.Lookup(afterE4E5.Position); len(got) != 0 {
+		t.Fatalf("expected no entries beyond max ply, got %d", len(got))
+	}
+
+	// MinCount keeps only moves seen at least twice
+	frequent := BuildPolyglotBook(games, BookBuildOptions{MaxPly: 2, MinCount: 2})
+	for _, m := range frequent.Lookup(start) {
+		if m.Move.UCINotation() != "e2e4" {
+			t.Fatalf("unexpected infrequent move %s", m.Move.UCINotation())
+		}
+	}
+}
+
+func TestReadPolyglotBook_Truncated(t *testing.T) {
+	if _, err := ReadPolyglotBook(bytes.NewReader(make([]byte, 20))); err == nil {
+		t.Fatalf("expected error for truncated book")
+	}
+}
+
+func TestBookEngine_FallsBackOutOfBook(t *testing.T) {
+	games, err := ReadPGN(strings.NewReader(bookTestPGN))
+	if err != nil {
+		t.Fatalf("read pgn: %v", err)
+	}
+	engine := BookEngine{
+		Book:   BuildPolyglotBook(games, BookBuildOptions{MaxPly: 1}),
+		Engine: Dumbfish{},
+		Rand:   rand.New(rand.NewSource(1)),
+	}
+	start := NewVariantPosition(Standard)
+	for i := 0; i < 20; i++ {
+		ap, ok := engine.SelectMove(start)
+		if !ok {
+			t.Fatalf("expected a move")
+		}
+		if uci := ap.Move.UCINotation(); uci != "e2e4" && uci != "d2d4" {
+			t.Fatalf("expected a book move from the start position, got %s", uci)
+		}
+	}
+
+	outOfBook, err := ParseFEN("4k3/8/8/8/8/8/4P3/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	want, _ := Dumbfish{}.SelectMove(outOfBook)
+	got, ok := engine.SelectMove(outOfBook)
+	if !ok || got.Move.UCINotation() != want.Move.UCINotation() {
+		t.Fatalf("expected fallback move %s, got %s", want.Move.UCINotation(), got.Move.UCINotation())
+	}
+}
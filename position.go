@@ -12,6 +12,14 @@ const (
 	Black
 )
 
+// Opponent returns the other color.
+func (c Color) Opponent() Color {
+	if c == White {
+		return Black
+	}
+	return White
+}
+
 // CastlingSide represents a specific castling right bit value stored in Position.castling
 type CastlingSide byte
 
@@ -44,6 +52,9 @@ type Position struct {
 	halfmoves      int
 	whiteOccupancy Bitboard
 	blackOccupancy Bitboard
+	variant        Variant
+	pockets        [2][7]int // Crazyhouse pieces in hand, indexed by Color and PieceKind
+	promoted       Bitboard  // Crazyhouse squares holding promoted pieces
 }
 
 func NewPosition() *Position {
@@ -83,6 +94,9 @@ func (p *Position) Clone() *Position {
 		halfmoves:      p.halfmoves,
 		whiteOccupancy: p.whiteOccupancy,
 		blackOccupancy: p.blackOccupancy,
+		variant:        p.variant,
+		pockets:        p.pockets,
+		promoted:       p.promoted,
 	}
 	copy(newPosition.pieces, p.pieces)
 	return newPosition
@@ -90,10 +104,14 @@ func (p *Position) Clone() *Position {
 
 // ApplyMove returns a new position with the given move applied.
 // Supports captures, en passant, promotions, en passant availability, halfmove clock, move number, and castling rights updates.
+// In Crazyhouse it also handles drops, pockets, and promoted-piece tracking.
 func (p *Position) ApplyMove(move GeneratedMove) *Position {
 	if p == nil {
 		return nil
 	}
+	if move.IsDrop {
+		return p.applyDrop(move)
+	}
 	newPosition := p.Clone()
 
 	fromFile, fromRank, okFrom := squareToFileRank(move.From)
@@ -128,8 +146,14 @@ func (p *Position) ApplyMove(move GeneratedMove) *Position {
 			capRank = toRank + 1
 		}
 		newPosition.SetPiece(toFile, capRank, Empty, White)
-	} else if newPosition.GetPiece(toFile, toRank) != nil {
+		if p.variant == Crazyhouse {
+			newPosition.pocketCapture(move.Color, Pawn, fileRankToIndex(toFile, capRank))
+		}
+	} else if capPiece := newPosition.GetPiece(toFile, toRank); capPiece != nil {
 		captured = true
+		if p.variant == Crazyhouse {
+			newPosition.pocketCapture(move.Color, capPiece.Kind, fileRankToIndex(toFile, toRank))
+		}
 	}
 
 	// Update castling rights for king/rook moves and rook captures
@@ -234,8 +258,18 @@ func (p *Position) ApplyMove(move GeneratedMove) *Position {
 	}
 	newPosition.SetPiece(toFile, toRank, movedKind, move.Color)
 
-	// En passant availability after a double pawn push
-	if move.Kind == Pawn {
+	// Promoted pieces keep their mark as they move so a later capture pockets a pawn
+	if p.variant == Crazyhouse {
+		fromIndex := fileRankToIndex(fromFile, fromRank)
+		toIndex := fileRankToIndex(toFile, toRank)
+		wasPromoted := p.promoted.IsSet(fromIndex)
+		newPosition.SetPromoted(fromIndex, false)
+		newPosition.SetPromoted(toIndex, wasPromoted || movedKind != move.Kind)
+	}
+
+	// En passant availability after a double pawn push from the second rank
+	// (Horde first-rank double pushes do not create an en passant square)
+	if move.Kind == Pawn && (fromRank == 1 || fromRank == 6) {
 		if dr := toRank - fromRank; dr == 2 || dr == -2 {
 			midRank := (toRank + fromRank) / 2
 			newPosition.SetEnpassant(fileRankToIndex(toFile, midRank))
@@ -279,7 +313,8 @@ func (p *Position) IsKingInCheck(color Color) bool {
 		}
 	}
 	if kingIndex == ^uint64(0) {
-		return true
+		// A missing king counts as in check, except where the variant plays without one
+		return p.variant.mustHaveKing(color)
 	}
 	enemy := White
 	if color == White {
@@ -484,19 +519,8 @@ func (p *Position) SetPieceAtSquare(square string, kind PieceKind, color Color)
 func (p *Position) String() string {
 	var sb strings.Builder
 
-	// Print the board
-	for rank := 7; rank >= 0; rank-- {
-		for file := 0; file < 8; file++ {
-			piece := p.GetPiece(file, rank)
-			if piece == nil {
-				sb.WriteString(". ")
-			} else {
-				sb.WriteString(pieceKindToFEN(piece.Kind, piece.Color))
-				sb.WriteString(" ")
-			}
-		}
-		sb.WriteString("\n")
-	}
+	// Print the board, with coordinates
+	sb.WriteString(BoardView{Style: ASCIIBoard}.Render(p))
 
 	// Print additional info
 	sb.WriteString(fmt.Sprintf("To move: %s\n", colorToString(p.toMove)))
@@ -510,6 +534,9 @@ func (p *Position) String() string {
 		sb.WriteString(fmt.Sprintf("Enpassant: %s\n", squares[0]))
 	}
 	sb.WriteString(fmt.Sprintf("Halfmoves: %d\n", p.halfmoves))
+	if p.variant == Crazyhouse {
+		sb.WriteString(fmt.Sprintf("Pockets: [%s]\n", p.pocketFEN()))
+	}
 
 	return sb.String()
 }
@@ -539,6 +566,30 @@ func pieceKindToFEN(kind PieceKind, color Color) string {
 	return pieceChar
 }
 
+// fenCharToPiece converts a FEN piece letter (e.g. 'N', 'p') to its kind and color.
+func fenCharToPiece(char rune) (PieceKind, Color, bool) {
+	color := White
+	if char >= 'a' && char <= 'z' {
+		color = Black
+		char -= 'a' - 'A'
+	}
+	switch char {
+	case 'P':
+		return Pawn, color, true
+	case 'R':
+		return Rook, color, true
+	case 'N':
+		return Knight, color, true
+	case 'B':
+		return Bishop, color, true
+	case 'Q':
+		return Queen, color, true
+	case 'K':
+		return King, color, true
+	}
+	return Empty, White, false
+}
+
 func colorToString(color Color) string {
 	if color == White {
 		return "White"
@@ -555,6 +606,26 @@ func ParseFEN(fen string) (*Position, error) {
 	pos := NewPosition()
 
 	boardPart := parts[0]
+
+	// Crazyhouse pockets: "board[QRp]" or a ninth "rank" holding the pocket ("board/QRp")
+	if openIdx := strings.IndexByte(boardPart, '['); openIdx != -1 {
+		closeIdx := strings.IndexByte(boardPart, ']')
+		if closeIdx < openIdx {
+			return nil, fmt.Errorf("invalid FEN: unterminated pocket")
+		}
+		if err := pos.parsePocketFEN(boardPart[openIdx+1 : closeIdx]); err != nil {
+			return nil, err
+		}
+		pos.SetVariant(Crazyhouse)
+		boardPart = boardPart[:openIdx]
+	} else if ranks := strings.Split(boardPart, "/"); len(ranks) == 9 {
+		if err := pos.parsePocketFEN(ranks[8]); err != nil {
+			return nil, err
+		}
+		pos.SetVariant(Crazyhouse)
+		boardPart = strings.Join(ranks[:8], "/")
+	}
+
 	rank := 7
 	file := 0
 
@@ -565,42 +636,16 @@ func ParseFEN(fen string) (*Position, error) {
 			file = 0
 		case char >= '1' && char <= '8':
 			file += int(char - '0')
-		case char == 'r':
-			pos.SetPiece(file, rank, Rook, Black)
-			file++
-		case char == 'n':
-			pos.SetPiece(file, rank, Knight, Black)
-			file++
-		case char == 'b':
-			pos.SetPiece(file, rank, Bishop, Black)
-			file++
-		case char == 'q':
-			pos.SetPiece(file, rank, Queen, Black)
-			file++
-		case char == 'k':
-			pos.SetPiece(file, rank, King, Black)
-			file++
-		case char == 'p':
-			pos.SetPiece(file, rank, Pawn, Black)
-			file++
-		case char == 'R':
-			pos.SetPiece(file, rank, Rook, White)
-			file++
-		case char == 'N':
-			pos.SetPiece(file, rank, Knight, White)
-			file++
-		case char == 'B':
-			pos.SetPiece(file, rank, Bishop, White)
-			file++
-		case char == 'Q':
-			pos.SetPiece(file, rank, Queen, White)
-			file++
-		case char == 'K':
-			pos.SetPiece(file, rank, King, White)
-			file++
-		case char == 'P':
-			pos.SetPiece(file, rank, Pawn, White)
-			file++
+		case char == '~':
+			// Crazyhouse promoted-piece marker follows the piece it applies to
+			if file > 0 {
+				pos.SetPromoted(fileRankToIndex(file-1, rank), true)
+			}
+		default:
+			if kind, color, ok := fenCharToPiece(char); ok {
+				pos.SetPiece(file, rank, kind, color)
+				file++
+			}
 		}
 	}
 
@@ -643,3 +688,171 @@ func ParseFEN(fen string) (*Position, error) {
 
 	return pos, nil
 }
+
+// ParseStrictFEN parses fen like ParseFEN, but also rejects what ParseFEN lets through: a
+// board that is not 8 ranks of 8 files, a side to move other than "w" or "b", and
+// positions that Validate finds impossible.
+func ParseStrictFEN(fen string) (*Position, error) {
+	pos, err := ParseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Fields(fen)
+	if err := checkFENBoard(parts[0], pos.variant == Crazyhouse); err != nil {
+		return nil, err
+	}
+	if parts[1] != "w" && parts[1] != "b" {
+		return nil, fmt.Errorf("invalid FEN: side to move %q", parts[1])
+	}
+	if err := pos.Validate(); err != nil {
+		return nil, err
+	}
+	return pos, nil
+}
+
+// checkFENBoard checks that the board field of a FEN, without any Crazyhouse pocket, has 8
+// ranks of 8 files.
+func checkFENBoard(board string, crazyhouse bool) error {
+	if i := strings.IndexByte(board, '['); i != -1 {
+		board = board[:i]
+	}
+	ranks := strings.Split(board, "/")
+	if crazyhouse && len(ranks) == 9 {
+		ranks = ranks[:8]
+	}
+	if len(ranks) != 8 {
+		return fmt.Errorf("invalid FEN: %d ranks", len(ranks))
+	}
+	for i, rank := range ranks {
+		files := 0
+		for j, char := range rank {
+			switch _, _, isPiece := fenCharToPiece(char); {
+			case char >= '1' && char <= '8':
+				files += int(char - '0')
+			case isPiece:
+				files++
+			case char == '~' && crazyhouse && j > 0:
+			default:
+				return fmt.Errorf("invalid FEN: unexpected %q in rank %d", char, 8-i)
+			}
+		}
+		if files != 8 {
+			return fmt.Errorf("invalid FEN: rank %d has %d files", 8-i, files)
+		}
+	}
+	return nil
+}
+
+// Validate reports why the position cannot arise in a game of its variant: other than one
+// king a side (none for White in Horde), pawns on the first or last rank, the side not to
+// move in check (in Racing Kings, either side), or an en passant square that no double
+// pawn step explains.
+func (p *Position) Validate() error {
+	var kings [2]int
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			piece := p.GetPiece(file, rank)
+			switch {
+			case piece == nil:
+			case piece.Kind == King:
+				kings[piece.Color]++
+			case piece.Kind == Pawn && (rank == 7 || rank == 0 && !(p.variant == Horde && piece.Color == White)):
+				return fmt.Errorf("invalid position: pawn on %c%d", 'a'+file, rank+1)
+			}
+		}
+	}
+	for _, color := range []Color{White, Black} {
+		want := 1
+		if p.variant == Horde && color == White {
+			want = 0
+		}
+		if kings[color] != want {
+			return fmt.Errorf("invalid position: %s has %d kings", colorToString(color), kings[color])
+		}
+	}
+	if p.IsKingInCheck(p.toMove.Opponent()) {
+		return fmt.Errorf("invalid position: %s is in check with %s to move", colorToString(p.toMove.Opponent()), colorToString(p.toMove))
+	}
+	if p.variant == RacingKings && p.IsKingInCheck(p.toMove) {
+		return fmt.Errorf("invalid position: kings cannot be in check in Racing Kings")
+	}
+	if !p.enpassant.IsEmpty() {
+		square := p.enpassant.ToFileRanks()[0]
+		file, rank := square[0], square[1]
+		wantRank, pawnRank, fromRank := 5, 4, 6
+		if p.toMove == Black {
+			wantRank, pawnRank, fromRank = 2, 3, 1
+		}
+		pawn := p.GetPiece(file, pawnRank)
+		if rank != wantRank || p.GetPiece(file, rank) != nil || p.GetPiece(file, fromRank) != nil ||
+			pawn == nil || pawn.Kind != Pawn || pawn.Color == p.toMove {
+			return fmt.Errorf("invalid position: no double pawn step to en passant square %c%d", 'a'+file, rank+1)
+		}
+	}
+	return nil
+}
+
+// FEN returns the position in Forsyth-Edwards Notation. Crazyhouse positions include the
+// pocket in brackets after the board and mark promoted pieces with '~'.
+func (p *Position) FEN() string {
+	var sb strings.Builder
+	for rank := 7; rank >= 0; rank-- {
+		emptyCount := 0
+		for file := 0; file < 8; file++ {
+			piece := p.GetPiece(file, rank)
+			if piece == nil {
+				emptyCount++
+				continue
+			}
+			if emptyCount > 0 {
+				sb.WriteString(fmt.Sprintf("%d", emptyCount))
+				emptyCount = 0
+			}
+			sb.WriteString(pieceKindToFEN(piece.Kind, piece.Color))
+			if p.variant == Crazyhouse && p.promoted.IsSet(fileRankToIndex(file, rank)) {
+				sb.WriteString("~")
+			}
+		}
+		if emptyCount > 0 {
+			sb.WriteString(fmt.Sprintf("%d", emptyCount))
+		}
+		if rank > 0 {
+			sb.WriteString("/")
+		}
+	}
+	if p.variant == Crazyhouse {
+		sb.WriteString("[" + p.pocketFEN() + "]")
+	}
+
+	if p.toMove == White {
+		sb.WriteString(" w ")
+	} else {
+		sb.WriteString(" b ")
+	}
+
+	castling := ""
+	if p.CanCastle(WhiteKingside) {
+		castling += "K"
+	}
+	if p.CanCastle(WhiteQueenside) {
+		castling += "Q"
+	}
+	if p.CanCastle(BlackKingside) {
+		castling += "k"
+	}
+	if p.CanCastle(BlackQueenside) {
+		castling += "q"
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	sb.WriteString(castling)
+
+	if squares := p.enpassant.ToSquares(); len(squares) > 0 {
+		sb.WriteString(" " + squares[0])
+	} else {
+		sb.WriteString(" -")
+	}
+	sb.WriteString(fmt.Sprintf(" %d %d", p.halfmoves, p.moveNumber))
+	return sb.String()
+}
@@ -213,6 +213,18 @@ func TestParseFEN(t *testing.T) {
 	}
 }
 
+func TestValidate_VariantStartPositions(t *testing.T) {
+	for _, v := range []Variant{Standard, Crazyhouse, Horde, RacingKings} {
+		if err := NewVariantPosition(v).Validate(); err != nil {
+			t.Errorf("%s: %v", v, err)
+		}
+	}
+	pos, err := ParseStrictFEN("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R/Pp w KQkq - 2 3")
+	if err != nil || pos.variant != Crazyhouse {
+		t.Errorf("crazyhouse FEN with a pocket rank: %v", err)
+	}
+}
+
 func TestSpecificFEN(t *testing.T) {
 	fen := "3r3k/pb2q1pp/3b1p2/2n5/2QRpP2/6B1/PP4PP/2R3K1 b - - 7 28"
 
@@ -0,0 +1,99 @@
+package main
+
+import "math"
+
+// SearchOptions switches the selective parts of the search on and off, mostly to measure
+// what each of them is worth. DefaultSearchOptions enables all of them.
+type SearchOptions struct {
+	NullMove          bool // skip nodes where passing still fails high (not when only pawns are left)
+	LateMoveReduction bool // search late quiet moves shallower unless they turn out good
+	Futility          bool // skip quiet moves near the leaves that cannot raise alpha
+	ReverseFutility   bool // fail high near the leaves when far above beta
+	CheckExtension    bool // search one ply deeper when in check
+	AspirationWindows bool // search the root with a narrow window around the last score
+}
+
+// DefaultSearchOptions returns the options Dumbfish plays with.
+func DefaultSearchOptions() SearchOptions {
+	return SearchOptions{
+		NullMove:          true,
+		LateMoveReduction: true,
+		Futility:          true,
+		ReverseFutility:   true,
+		CheckExtension:    true,
+		AspirationWindows: true,
+	}
+}
+
+const (
+	// nullMoveMinDepth is the shallowest depth at which a null move is tried.
+	nullMoveMinDepth = 3
+	// nullMoveVerifyDepth is the depth from which a null-move cutoff is verified by a reduced
+	// normal search, which catches zugzwang positions the material guard lets through.
+	nullMoveVerifyDepth = 6
+	// futilityDepth and reverseFutilityDepth bound the depths at which those prunings apply.
+	futilityDepth        = 2
+	reverseFutilityDepth = 3
+	// aspirationDelta is the initial half-width of an aspiration window in centipawns.
+	aspirationDelta = 50
+)
+
+// futilityMargin is how much a quiet move is assumed to gain at most, depth plies from the leaves.
+func futilityMargin(depth int) int {
+	return 100 + 150*depth
+}
+
+// reverseFutilityMargin is how far above beta the static score must be to fail high at depth.
+func reverseFutilityMargin(depth int) int {
+	return 120 * depth
+}
+
+// lmrReductions[depth][n] is the reduction of the n-th move searched at depth.
+var lmrReductions [maxSearchPly + 1][64]int
+
+func init() {
+	for depth := 1; depth <= maxSearchPly; depth++ {
+		for n := 1; n < 64; n++ {
+			lmrReductions[depth][n] = int(0.75 + math.Log(float64(depth))*math.Log(float64(n))/2.25)
+		}
+	}
+}
+
+// lateMoveReduction returns how many plies to reduce the n-th move (from 0) at depth.
+func lateMoveReduction(depth, n int) int {
+	if depth < 3 || n < 3 {
+		return 0
+	}
+	return min(lmrReductions[min(depth, maxSearchPly)][min(n, 63)], depth-2)
+}
+
+// nullMovePosition returns pos with the side to move passing.
+func nullMovePosition(pos *Position) *Position {
+	next := pos.Clone()
+	next.toMove = pos.toMove.Opponent()
+	next.enpassant = EmptyBitboard()
+	next.halfmoves++
+	return next
+}
+
+// hasNonPawnMaterial reports whether color has a piece other than pawns and the king, on the
+// board or in hand. Without one, zugzwang is common and passing is no lower bound.
+func hasNonPawnMaterial(pos *Position, color Color) bool {
+	for i := range pos.pieces {
+		piece := &pos.pieces[i]
+		if piece.Color == color && piece.Kind != Pawn && piece.Kind != King && !piece.Location.IsEmpty() {
+			return true
+		}
+	}
+	for _, kind := range pocketKinds {
+		if kind != Pawn && pos.pockets[color][kind] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isMateScore reports whether score is a mate or tablebase result rather than an evaluation.
+func isMateScore(score int) bool {
+	return abs(score) >= tbWinScore-maxSearchPly
+}
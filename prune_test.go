@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// benchNodes searches fens to depth with opts and returns the total nodes.
+func benchNodes(t testing.TB, fens []string, opts SearchOptions, depth int) int {
+	total := 0
+	for _, fen := range fens {
+		infos := searchReports(t, Dumbfish{Options: &opts, Hash: NewTranspositionTable(4)}, fen, depth)
+		total += infos[len(infos)-1].Nodes
+	}
+	return total
+}
+
+func TestSearchOptions_PruneNodes(t *testing.T) {
+	fens := benchFENs[:4]
+	all := benchNodes(t, fens, DefaultSearchOptions(), 5)
+	none := benchNodes(t, fens, SearchOptions{}, 5)
+	t.Logf("depth 5: %d nodes with selective search, %d without", all, none)
+	if all*2 > none {
+		t.Errorf("expected selective search to at least halve the nodes: %d vs %d", all, none)
+	}
+}
+
+func TestSearchOptions_TacticsStillFound(t *testing.T) {
+	cases := []struct {
+		fen, best string
+		depth     int
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", 3},
+		{"4k3/8/8/3q4/8/2N5/8/4K2R w - - 0 1", "c3d5", 4},
+	}
+	for _, tc := range cases {
+		pos, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		best, ok := Dumbfish{}.Search(context.Background(), pos, SearchLimits{Depth: tc.depth}, nil)
+		if !ok || best.Move.UCINotation() != tc.best {
+			t.Errorf("%s: expected %s, got %s", tc.fen, tc.best, best.Move.UCINotation())
+		}
+	}
+
+	// The mate in two starts with a quiet king move, which reductions must not hide
+	infos := searchReports(t, Dumbfish{}, "k7/8/2K5/8/8/8/8/7R w - - 0 1", 5)
+	if last := infos[len(infos)-1]; last.Score.Mate != 2 {
+		t.Errorf("expected mate in 2, got %s", last.UCI())
+	}
+}
+
+func TestNullMove_ZugzwangGuards(t *testing.T) {
+	s := &searcher{opts: DefaultSearchOptions()}
+	s.moves[0] = packMove(GeneratedMove{From: "e2", To: "e4"})
+
+	// King and pawns only: passing is never tried
+	pawns, _ := ParseFEN("8/8/4k3/3p4/3P4/4K3/8/8 w - - 0 1")
+	if hasNonPawnMaterial(pawns, White) {
+		t.Fatalf("expected no non-pawn material")
+	}
+	if _, ok := s.nullMove(pawns, 500, 4, 1, 0); ok {
+		t.Errorf("null move tried with only pawns left")
+	}
+
+	// A rook up, passing still fails high
+	rook, _ := ParseFEN("8/8/4k3/3p4/3P4/4K3/8/7R w - - 0 1")
+	if _, ok := s.nullMove(rook, Evaluate(rook), 4, 1, 0); !ok {
+		t.Errorf("expected a null-move cutoff a rook up")
+	}
+	// Not right after another null move, and not when switched off
+	s.moves[0] = 0
+	if _, ok := s.nullMove(rook, Evaluate(rook), 4, 1, 0); ok {
+		t.Errorf("null move tried twice in a row")
+	}
+	s.moves[0] = packMove(GeneratedMove{From: "e2", To: "e4"})
+	s.opts.NullMove = false
+	if _, ok := s.nullMove(rook, Evaluate(rook), 4, 1, 0); ok {
+		t.Errorf("null move tried while disabled")
+	}
+}
+
+func TestUCI_SearchOptions(t *testing.T) {
+	in := strings.NewReader("uci\nsetoption name NullMove value false\nsetoption name Futility value maybe\n" +
+		"position startpos\ngo depth 2\n")
+	var out strings.Builder
+	if err := RunUCI(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"option name NullMove type check default true",
+		"option name AspirationWindows type check default true",
+		"info string Futility:",
+		"bestmove ",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	run := func() string {
+		var out strings.Builder
+		if err := runBench([]string{"-depth", "3"}, &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	first := run()
+	lines := strings.Split(strings.TrimSpace(first), "\n")
+	if len(lines) != len(benchFENs)+1 || !strings.HasPrefix(lines[len(lines)-1], "Total: ") {
+		t.Fatalf("unexpected bench output:\n%s", first)
+	}
+	// Everything but the timing is reproducible
+	nodesOnly := func(out string) string {
+		out = out[:strings.LastIndex(out, " in ")]
+		return out
+	}
+	if again := run(); nodesOnly(again) != nodesOnly(first) {
+		t.Errorf("bench node counts differ between runs:\n%s\nvs\n%s", first, again)
+	}
+}
+
+// BenchmarkFixedDepth searches the bench positions to a fixed depth with each selective
+// search feature switched off in turn, reporting nodes/op so regressions stand out:
+// go test -run - -bench FixedDepth
+func BenchmarkFixedDepth(b *testing.B) {
+	configs := []struct {
+		name string
+		off  func(*SearchOptions)
+	}{
+		{"all", func(*SearchOptions) {}},
+		{"-nullmove", func(o *SearchOptions) { o.NullMove = false }},
+		{"-lmr", func(o *SearchOptions) { o.LateMoveReduction = false }},
+		{"-futility", func(o *SearchOptions) { o.Futility = false }},
+		{"-reversefutility", func(o *SearchOptions) { o.ReverseFutility = false }},
+		{"-checkextension", func(o *SearchOptions) { o.CheckExtension = false }},
+		{"-aspiration", func(o *SearchOptions) { o.AspirationWindows = false }},
+	}
+	for _, cfg := range configs {
+		b.Run(fmt.Sprintf("depth=5/%s", cfg.name), func(b *testing.B) {
+			opts := DefaultSearchOptions()
+			cfg.off(&opts)
+			nodes := 0
+			for range b.N {
+				nodes += benchNodes(b, benchFENs, opts, 5)
+			}
+			b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+		})
+	}
+}
@@ -239,3 +239,33 @@ func GetPossibleRayMoves(pos *Position, piece *Piece) RayMoves {
 		SW: computeDirection(Rays.SW, false),
 	}
 }
+
+// GetRayAttacks returns the squares attacked by a slider on index given the board occupancy.
+// Each direction stops at (and includes) the first occupied square, regardless of its color.
+func GetRayAttacks(index uint64, occupancy Bitboard) RayMoves {
+	if index >= 64 {
+		return RayMoves{}
+	}
+	computeDirection := func(directionTable *[64]Bitboard, increasing bool) Bitboard {
+		ray := directionTable[index]
+		blockers := ray.And(occupancy)
+		if blockers.IsEmpty() {
+			return ray
+		}
+		nearestIndex := blockers.FirstSet()
+		if !increasing {
+			nearestIndex = blockers.LastSet()
+		}
+		return ray.Xor(directionTable[nearestIndex])
+	}
+	return RayMoves{
+		N:  computeDirection(&Rays.N, true),
+		E:  computeDirection(&Rays.E, true),
+		S:  computeDirection(&Rays.S, false),
+		W:  computeDirection(&Rays.W, false),
+		NE: computeDirection(&Rays.NE, true),
+		NW: computeDirection(&Rays.NW, true),
+		SE: computeDirection(&Rays.SE, false),
+		SW: computeDirection(&Rays.SW, false),
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseSAN resolves a Standard Algebraic Notation move (e.g. "Nbd7", "exd5", "e8=Q+", "O-O", "N@f3")
+// against the legal moves of the position. Check/mate marks and annotation suffixes are ignored.
+func parseSAN(pos *Position, san string) (AppliedMove, error) {
+	text := strings.TrimRight(san, "+#!?")
+	if text == "" {
+		return AppliedMove{}, fmt.Errorf("empty SAN move")
+	}
+	legal := generateLegalMoves(pos)
+
+	// Castling, accepting both letter O and digit 0
+	switch strings.ReplaceAll(text, "0", "O") {
+	case "O-O", "O-O-O":
+		queenside := len(text) == 5
+		for _, ap := range legal {
+			if !ap.Move.IsCastle {
+				continue
+			}
+			isQueenside := ap.Move.CastleSide == WhiteQueenside || ap.Move.CastleSide == BlackQueenside
+			if isQueenside == queenside {
+				return ap, nil
+			}
+		}
+		return AppliedMove{}, fmt.Errorf("illegal castling move %q", san)
+	}
+
+	// Drops, e.g. N@f3 or @e4 (pawn)
+	if at := strings.IndexByte(text, '@'); at != -1 {
+		letter := text[:at]
+		if letter == "" {
+			letter = "P"
+		}
+		for _, ap := range legal {
+			if ap.Move.IsDrop && dropLetter(ap.Move.Kind) == letter && ap.Move.To == text[at+1:] {
+				return ap, nil
+			}
+		}
+		return AppliedMove{}, fmt.Errorf("illegal drop %q", san)
+	}
+
+	kind := Pawn
+	switch text[0] {
+	case 'N':
+		kind = Knight
+	case 'B':
+		kind = Bishop
+	case 'R':
+		kind = Rook
+	case 'Q':
+		kind = Queen
+	case 'K':
+		kind = King
+	}
+	if kind != Pawn {
+		text = text[1:]
+	}
+
+	promotion := Empty
+	if eq := strings.IndexByte(text, '='); eq != -1 && eq+1 < len(text) {
+		promotion = sanLetterToKind(text[eq+1])
+		text = text[:eq]
+	} else if kind == Pawn && len(text) >= 3 && strings.ContainsRune("NBRQ", rune(text[len(text)-1])) {
+		// Tolerate promotions written without '=' (e8Q)
+		promotion = sanLetterToKind(text[len(text)-1])
+		text = text[:len(text)-1]
+	}
+
+	text = strings.ReplaceAll(text, "x", "")
+	text = strings.ReplaceAll(text, "-", "")
+	if len(text) < 2 {
+		return AppliedMove{}, fmt.Errorf("malformed SAN move %q", san)
+	}
+	to := text[len(text)-2:]
+	disambiguation := text[:len(text)-2]
+
+	var match AppliedMove
+	matches := 0
+	for _, ap := range legal {
+		mv := ap.Move
+		if mv.IsDrop || mv.IsCastle || mv.Kind != kind || mv.To != to || mv.Promotion != promotion {
+			continue
+		}
+		if !sanDisambiguationMatches(mv.From, disambiguation) {
+			continue
+		}
+		match = ap
+		matches++
+	}
+	switch matches {
+	case 0:
+		return AppliedMove{}, fmt.Errorf("illegal move %q", san)
+	case 1:
+		return match, nil
+	default:
+		return AppliedMove{}, fmt.Errorf("ambiguous move %q", san)
+	}
+}
+
+// sanDisambiguationMatches reports whether the origin square agrees with the SAN
+// disambiguation prefix (a file, a rank, or a full square).
+func sanDisambiguationMatches(from, disambiguation string) bool {
+	for i := 0; i < len(disambiguation); i++ {
+		c := disambiguation[i]
+		switch {
+		case c >= 'a' && c <= 'h':
+			if from[0] != c {
+				return false
+			}
+		case c >= '1' && c <= '8':
+			if from[1] != c {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func sanLetterToKind(letter byte) PieceKind {
+	switch letter {
+	case 'N', 'n':
+		return Knight
+	case 'B', 'b':
+		return Bishop
+	case 'R', 'r':
+		return Rook
+	case 'Q', 'q':
+		return Queen
+	case 'K', 'k':
+		return King
+	}
+	return Empty
+}
+
+// formatSAN writes a legal move of the position in Standard Algebraic Notation, with the
+// minimal disambiguation and a "+" or "#" suffix for check and mate.
+func formatSAN(pos *Position, ap AppliedMove) string {
+	mv := ap.Move
+	var sb strings.Builder
+	switch {
+	case mv.IsCastle:
+		if mv.CastleSide == WhiteQueenside || mv.CastleSide == BlackQueenside {
+			sb.WriteString("O-O-O")
+		} else {
+			sb.WriteString("O-O")
+		}
+	case mv.IsDrop:
+		sb.WriteString(mv.UCINotation())
+	case mv.Kind == Pawn:
+		if mv.IsCapture {
+			sb.WriteString(mv.From[:1] + "x")
+		}
+		sb.WriteString(mv.To)
+		if mv.Promotion != Empty {
+			sb.WriteString("=" + pieceSANLetter(mv.Promotion))
+		}
+	default:
+		sb.WriteString(pieceSANLetter(mv.Kind))
+		sameFile, sameRank, ambiguous := false, false, false
+		for _, other := range generateLegalMoves(pos) {
+			om := other.Move
+			if om.IsDrop || om.Kind != mv.Kind || om.To != mv.To || om.From == mv.From {
+				continue
+			}
+			ambiguous = true
+			sameFile = sameFile || om.From[0] == mv.From[0]
+			sameRank = sameRank || om.From[1] == mv.From[1]
+		}
+		switch {
+		case ambiguous && !sameFile:
+			sb.WriteByte(mv.From[0])
+		case ambiguous && !sameRank:
+			sb.WriteByte(mv.From[1])
+		case ambiguous:
+			sb.WriteString(mv.From)
+		}
+		if mv.IsCapture {
+			sb.WriteString("x")
+		}
+		sb.WriteString(mv.To)
+	}
+
+	next := ap.Position
+	if next.IsKingInCheck(next.toMove) {
+		if len(generateLegalMoves(next)) == 0 {
+			sb.WriteString("#")
+		} else {
+			sb.WriteString("+")
+		}
+	}
+	return sb.String()
+}
+
+// formatSANLine writes a sequence of moves from pos as numbered SAN, e.g. "12... Nf6 13. e5".
+// It stops at the first move that is not legal.
+func formatSANLine(pos *Position, moves []GeneratedMove) string {
+	var parts []string
+	for i, mv := range moves {
+		ap, ok := findUCIMove(pos, mv.UCINotation())
+		if !ok {
+			break
+		}
+		switch {
+		case pos.toMove == White:
+			parts = append(parts, fmt.Sprintf("%d.", pos.moveNumber))
+		case i == 0:
+			parts = append(parts, fmt.Sprintf("%d...", pos.moveNumber))
+		}
+		parts = append(parts, formatSAN(pos, ap))
+		pos = ap.Position
+	}
+	return strings.Join(parts, " ")
+}
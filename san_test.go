@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFormatSAN(t *testing.T) {
+	cases := []struct {
+		fen, uci, want string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "g1f3", "Nf3"},
+		{"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1g1", "O-O"},
+		{"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1c1", "O-O-O"},
+		{"4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "a1d1", "Rad1"},
+		{"4k3/8/8/8/R7/8/4K3/R7 w - - 0 1", "a1a2", "R1a2"},
+		{"7k/2N5/8/8/8/2N1N3/4K3/8 w - - 0 1", "c3d5", "Nc3d5"},
+		{"4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "e4d5", "exd5"},
+		{"8/4P2k/8/8/8/8/8/4K3 w - - 0 1", "e7e8q", "e8=Q"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra8#"},
+		{"6k1/5pp1/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra8+"},
+	}
+	for _, tc := range cases {
+		pos, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatalf("parse fen: %v", err)
+		}
+		ap, ok := findUCIMove(pos, tc.uci)
+		if !ok {
+			t.Fatalf("%s: %s is not legal", tc.fen, tc.uci)
+		}
+		got := formatSAN(pos, ap)
+		if got != tc.want {
+			t.Errorf("%s %s: got %q, want %q", tc.fen, tc.uci, got, tc.want)
+		}
+		// Whatever we write must read back as the same move
+		if back, err := parseSAN(pos, got); err != nil || back.Move.UCINotation() != tc.uci {
+			t.Errorf("%q does not parse back to %s: %v", got, tc.uci, err)
+		}
+	}
+}
+
+func TestFormatSANLine(t *testing.T) {
+	pos, _ := ParseFEN("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 3 3")
+	var moves []GeneratedMove
+	for _, uci := range []string{"g8f6", "f1c4", "f8c5"} {
+		ap, _ := findUCIMove(pos, uci)
+		moves = append(moves, ap.Move)
+		pos = ap.Position
+	}
+	start, _ := ParseFEN("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 3 3")
+	if got := formatSANLine(start, moves); got != "3... Nf6 4. Bc4 Bc5" {
+		t.Fatalf("unexpected line %q", got)
+	}
+}
+
+func TestMultiPV(t *testing.T) {
+	pos, _ := ParseFEN("4k3/8/8/3q4/8/2N5/8/4K2R w - - 0 1")
+	var lines []SearchInfo
+	best, ok := Dumbfish{}.Search(context.Background(), pos, SearchLimits{Depth: 2, MultiPV: 3}, func(info SearchInfo) {
+		if info.Depth == 2 {
+			lines = append(lines, info)
+		}
+	})
+	if !ok || len(lines) != 3 {
+		t.Fatalf("expected 3 lines at depth 2, got %d", len(lines))
+	}
+	seen := map[string]bool{}
+	for i, line := range lines {
+		if line.MultiPV != i+1 {
+			t.Errorf("line %d reported as multipv %d", i+1, line.MultiPV)
+		}
+		root := line.PV[0].UCINotation()
+		if seen[root] {
+			t.Errorf("root move %s appears in two lines", root)
+		}
+		seen[root] = true
+		if i > 0 && line.Score.Centipawns > lines[i-1].Score.Centipawns {
+			t.Errorf("line %d scores above line %d", i+1, i)
+		}
+	}
+	if lines[0].PV[0].UCINotation() != "c3d5" || best.Move.UCINotation() != "c3d5" {
+		t.Errorf("expected the queen capture first, got %s", lines[0].PV[0].UCINotation())
+	}
+
+	var out strings.Builder
+	if err := runAnalyze([]string{"--multipv", "2", "-depth", "2", "4k3/8/8/3q4/8/2N5/8/4K2R", "w", "-", "-", "0", "1"}, &out); err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	if !strings.Contains(out.String(), "  1. Nxd5") || !strings.Contains(out.String(), " 2. ") {
+		t.Fatalf("unexpected analyze output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Scores beyond tbWinScore are tablebase wins; beyond mateScore-maxSearchPly are mates.
+const (
+	mateScore    = 100000
+	tbWinScore   = 90000
+	maxSearchPly = 128
+)
+
+// searcher runs a negamax alpha-beta search, iteratively deepened under a TimeManager.
+// Each search thread has its own searcher; threads share only the transposition table and
+// the searchShared state.
+type searcher struct {
+	ctx      context.Context
+	tb       *SyzygyTablebase
+	tm       *TimeManager
+	tt       *TranspositionTable
+	shared   *searchShared
+	info     func(SearchInfo)
+	id       int // thread index; 0 is the main thread, which alone reports and keeps time
+	maxNodes int
+	multiPV  int
+	nodes    int
+	selDepth int
+	aborted  bool
+	pv       [maxSearchPly + 1][]GeneratedMove // pv[ply] is the best line found below ply
+	opts     SearchOptions
+	net      *Network                 // evaluates in place of Evaluate when set
+	accs     []*Accumulator           // accs[ply] holds the network accumulators of the position at ply
+	layers   *LayerBuffers            // the network's layer values, reused by every evaluation
+	noNull   bool                     // set while verifying a null-move cutoff
+	moves    [maxSearchPly + 1]uint16 // moves[ply] is the move being searched at ply (0 for a null move)
+	stats    searchStats
+
+	// Move ordering heuristics, indexed by the low 12 bits (from and to) of packed moves
+	killers      [maxSearchPly + 1][2]uint16 // quiet moves that caused a cutoff at each ply
+	countermoves [2][1 << 12]uint16          // quiet refutation of the opponent's previous move
+	history      [2][1 << 12]int             // butterfly history of quiet moves by color
+}
+
+// searchStats counts beta cutoffs, to measure how well moves are ordered.
+type searchStats struct {
+	cutoffs      int
+	firstMove    int            // cutoffs by the first move searched
+	stageCutoffs [stageDone]int // cutoffs by the stage of the move picker that produced the move
+}
+
+// searchShared is the state all threads of one search see.
+type searchShared struct {
+	stop  atomic.Bool  // set by the main thread once it has decided
+	nodes atomic.Int64 // nodes searched by all threads
+}
+
+// totalNodes returns the nodes searched by every thread of the search.
+func (s *searcher) totalNodes() int {
+	if s.shared == nil {
+		return s.nodes
+	}
+	return int(s.shared.nodes.Load())
+}
+
+// shouldAbort is polled in the search; clock and context checks are spaced out to keep them cheap.
+func (s *searcher) shouldAbort() bool {
+	if s.aborted {
+		return true
+	}
+	if s.shared != nil && s.shared.stop.Load() {
+		s.aborted = true
+	} else if s.maxNodes > 0 && s.totalNodes() >= s.maxNodes {
+		s.aborted = true
+	} else if s.nodes%256 == 0 {
+		if s.tm != nil && s.tm.Expired() {
+			s.aborted = true
+		} else if s.ctx != nil && s.ctx.Err() != nil {
+			s.aborted = true
+		}
+	}
+	return s.aborted
+}
+
+// report sends a SearchInfo for one line of a completed iteration.
+func (s *searcher) report(depth, multiPV, score int, pv []GeneratedMove) {
+	if s.info == nil {
+		return
+	}
+	info := SearchInfo{
+		Depth:    depth,
+		MultiPV:  multiPV,
+		SelDepth: max(s.selDepth, depth),
+		Score:    scoreFromSearch(score),
+		Nodes:    s.totalNodes(),
+		PV:       append([]GeneratedMove(nil), pv...),
+		HashFull: s.tt.HashFull(),
+	}
+	if s.tm != nil {
+		info.Time = s.tm.Elapsed()
+		if info.Time > 0 {
+			info.NPS = int(float64(info.Nodes) / info.Time.Seconds())
+		}
+	}
+	s.info(info)
+}
+
+// rootLine is one MultiPV line: a root move with its score and principal variation.
+type rootLine struct {
+	move  AppliedMove
+	score int
+	pv    []GeneratedMove
+}
+
+// iterate deepens one ply at a time up to maxDepth until the limits say stop, returning the
+// best move of the last completed iteration. Each iteration searches multiPV lines, every
+// line excluding the root moves of the lines above it. Odd-numbered helper threads start one
+// ply deeper so that threads spread over two depths.
+func (s *searcher) iterate(pos *Position, maxDepth, mate int) (AppliedMove, int, bool) {
+	// Inside the tablebases the DTZ ranking picks the move directly
+	if s.tb.supports(pos) {
+		if ranked, err := s.tb.RootMoves(pos); err == nil && len(ranked) > 0 {
+			for i, rm := range ranked[:min(len(ranked), max(s.multiPV, 1))] {
+				s.report(1, i+1, tablebaseScore(rm.WDL, 0), []GeneratedMove{rm.Move})
+			}
+			return ranked[0].AppliedMove, tablebaseScore(ranked[0].WDL, 0), true
+		}
+	}
+
+	losing := bitbaseRootExclusions(pos)
+	var lines []rootLine
+	for depth := 1 + s.id%2; depth <= maxDepth; depth++ {
+		var current []rootLine
+		excluded := map[string]bool{}
+		for move := range losing {
+			excluded[move] = true
+		}
+		for k := 0; k < max(s.multiPV, 1); k++ {
+			first := ""
+			if k < len(lines) {
+				first = lines[k].move.Move.UCINotation()
+			}
+			prev := mateScore + 1 // no score to aspire to
+			if k < len(lines) {
+				prev = lines[k].score
+			}
+			line, ok := s.aspirate(pos, depth, first, excluded, prev)
+			if !ok {
+				break
+			}
+			if s.aborted {
+				// A partial first line searched the previous best first, so only trust an improvement
+				if k == 0 && (len(lines) == 0 || line.score > lines[0].score) {
+					current = append(current, line)
+				}
+				break
+			}
+			current = append(current, line)
+			excluded[line.move.Move.UCINotation()] = true
+		}
+		if len(current) == 0 {
+			break
+		}
+		lines = current
+		if s.aborted {
+			break
+		}
+		for k, line := range lines {
+			s.report(depth, k+1, line.score, line.pv)
+		}
+		if s.tm != nil {
+			s.tm.OnIteration(lines[0].move.Move.UCINotation())
+		}
+		if mate > 0 && lines[0].score >= mateScore-2*mate {
+			break
+		}
+		if s.tm != nil && !s.tm.StartIteration() {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		return AppliedMove{}, 0, false
+	}
+	return lines[0].move, lines[0].score, true
+}
+
+// bitbaseRootExclusions returns the root moves that the bitbases show to give away part of
+// the result of pos, so that the search only chooses among the moves keeping the best one.
+// Moves to positions no bitbase covers are kept.
+func bitbaseRootExclusions(pos *Position) map[string]bool {
+	if _, ok := EndgameProbe(pos); !ok {
+		return nil
+	}
+	legal := generateLegalMoves(pos)
+	results := map[string]WDL{}
+	best := WDLLoss
+	for _, ap := range legal {
+		child := ap.Position
+		wdl, ok := EndgameProbe(child)
+		if !ok && child.whiteOccupancy.Count() == 1 && child.blackOccupancy.Count() == 1 {
+			wdl, ok = WDLDraw, true // bare kings
+		}
+		if !ok {
+			continue
+		}
+		results[ap.Move.UCINotation()] = -wdl
+		best = max(best, -wdl)
+	}
+	excluded := map[string]bool{}
+	for move, wdl := range results {
+		if wdl < best {
+			excluded[move] = true
+		}
+	}
+	return excluded
+}
+
+// aspirate searches the root like searchRoot, first with a narrow window around prev, the
+// score of the line in the previous iteration. The window widens each time the score falls
+// outside it.
+func (s *searcher) aspirate(pos *Position, depth int, first string, excluded map[string]bool, prev int) (rootLine, bool) {
+	alpha, beta := -mateScore-1, mateScore+1
+	delta := aspirationDelta
+	if s.opts.AspirationWindows && depth >= 4 && prev <= mateScore && !isMateScore(prev) {
+		alpha, beta = prev-delta, prev+delta
+	}
+	for {
+		line, ok := s.searchRoot(pos, depth, first, excluded, alpha, beta)
+		if !ok || s.aborted {
+			return line, ok
+		}
+		switch {
+		case line.score <= alpha && alpha > -mateScore-1:
+			alpha = max(line.score-delta, -mateScore-1)
+		case line.score >= beta && beta < mateScore+1:
+			beta = min(line.score+delta, mateScore+1)
+		default:
+			return line, true
+		}
+		delta *= 2
+	}
+}
+
+// searchRoot searches the legal moves not in excluded to depth plies within (alpha, beta) and
+// returns the best line, or false when no moves are left. The move named first, if any, is
+// searched first.
+func (s *searcher) searchRoot(pos *Position, depth int, first string, excluded map[string]bool, alpha, beta int) (rootLine, bool) {
+	var legal []AppliedMove
+	for _, ap := range generateLegalMoves(pos) {
+		if !excluded[ap.Move.UCINotation()] {
+			legal = append(legal, ap)
+		}
+	}
+	if len(legal) == 0 {
+		return rootLine{}, false
+	}
+	for i := range legal {
+		if legal[i].Move.UCINotation() == first {
+			legal[0], legal[i] = legal[i], legal[0]
+			break
+		}
+	}
+
+	s.setRoot(pos)
+	best := rootLine{move: legal[0], score: -mateScore - 1, pv: []GeneratedMove{legal[0].Move}}
+	for i, ap := range legal {
+		s.moves[0] = packMove(ap.Move)
+		s.makeMove(pos, ap.Position, &ap.Move, 0)
+		score := s.searchMove(ap.Position, i == 0, depth-1, 0, 1, alpha, beta)
+		if s.aborted {
+			break
+		}
+		if score > best.score {
+			best = rootLine{move: ap, score: score, pv: append([]GeneratedMove{ap.Move}, s.pv[1]...)}
+		}
+		alpha = max(alpha, score)
+		if alpha >= beta {
+			break
+		}
+	}
+	return best, true
+}
+
+// searchMove searches the position after a move with principal variation search: only the
+// first move gets the full window, the rest are proven worse with a null window and searched
+// again only when that fails. A late move may first be searched reduction plies shallower.
+// It returns the score from the mover's point of view.
+func (s *searcher) searchMove(pos *Position, first bool, depth, reduction, ply, alpha, beta int) int {
+	if first {
+		return -s.alphaBeta(pos, depth, ply, -beta, -alpha)
+	}
+	score := alpha + 1
+	if reduction > 0 {
+		score = -s.alphaBeta(pos, depth-reduction, ply, -alpha-1, -alpha)
+	}
+	if score > alpha && !s.aborted {
+		score = -s.alphaBeta(pos, depth, ply, -alpha-1, -alpha)
+	}
+	if score > alpha && score < beta && !s.aborted {
+		score = -s.alphaBeta(pos, depth, ply, -beta, -alpha)
+	}
+	return score
+}
+
+// alphaBeta returns the fail-soft negamax score of pos, searched depth plies deep.
+func (s *searcher) alphaBeta(pos *Position, depth, ply, alpha, beta int) int {
+	s.nodes++
+	if s.shared != nil {
+		s.shared.nodes.Add(1)
+	}
+	s.pv[ply] = s.pv[ply][:0]
+	s.selDepth = max(s.selDepth, ply)
+	if s.shouldAbort() {
+		return 0
+	}
+	if pos.halfmoves >= 100 {
+		return 0
+	}
+
+	// Interior tablebase cutoff, only right after a zeroing move where DTZ cannot spoil the result
+	if pos.halfmoves == 0 && s.tb.supports(pos) {
+		if wdl, err := s.tb.ProbeWDL(pos); err == nil {
+			return tablebaseScore(wdl, ply)
+		}
+	}
+
+	// Bitbase cutoff: draws at once, wins and losses only right after a zeroing move, so that
+	// won endings still have to be pressed home move by move
+	if wdl, ok := EndgameProbe(pos); ok && (wdl == WDLDraw || pos.halfmoves == 0) {
+		return tablebaseScore(wdl, ply)
+	}
+
+	inCheck := pos.IsKingInCheck(pos.toMove)
+	if inCheck && s.opts.CheckExtension {
+		depth++
+	}
+	if depth <= 0 || ply >= maxSearchPly {
+		return s.evaluate(pos, ply)
+	}
+
+	// Table cutoffs are only taken in null-window searches so that principal variations stay whole
+	pvNode := beta-alpha > 1
+	key := searchKey(pos)
+	entry, hit := s.tt.probe(key)
+	if hit && entry.depth >= depth && !pvNode {
+		score := scoreFromTT(entry.score, ply)
+		if entry.bound == boundExact ||
+			entry.bound == boundLower && score >= beta ||
+			entry.bound == boundUpper && score <= alpha {
+			return score
+		}
+	}
+
+	eval := 0
+	if !inCheck {
+		eval = s.evaluate(pos, ply)
+	}
+	if !pvNode && !inCheck && !isMateScore(beta) {
+		if s.opts.ReverseFutility && depth <= reverseFutilityDepth && eval-reverseFutilityMargin(depth) >= beta {
+			return eval
+		}
+		if score, ok := s.nullMove(pos, eval, depth, ply, beta); ok {
+			return score
+		}
+	}
+
+	legal := generateLegalMoves(pos)
+	if len(legal) == 0 {
+		if pos.variant == Standard || pos.variant == Crazyhouse {
+			if inCheck {
+				return -mateScore + ply
+			}
+			return 0
+		}
+		return variantTerminalScore(pos, ply)
+	}
+	prev := uint16(0)
+	if ply > 0 {
+		prev = s.moves[ply-1]
+	}
+	picker := newMovePicker(s, pos, legal, entry.move, ply, prev)
+	// Near the leaves, quiet moves cannot lift a hopeless static score above alpha
+	futile := s.opts.Futility && !pvNode && !inCheck && depth <= futilityDepth &&
+		!isMateScore(alpha) && eval+futilityMargin(depth) <= alpha
+
+	origAlpha := alpha
+	best, bestMove := -mateScore-1, uint16(0)
+	var quietsTried []uint16
+	for i := 0; ; i++ {
+		ap, ok := picker.next()
+		if !ok {
+			break
+		}
+		packed := packMove(ap.Move)
+		quiet := !ap.Move.IsCapture && ap.Move.Promotion == Empty
+		reduction := 0
+		if quiet && i > 0 && (futile || s.opts.LateMoveReduction) && !inCheck &&
+			picker.stage == stageQuiets && !ap.Position.IsKingInCheck(ap.Position.toMove) {
+			if futile {
+				best = max(best, eval+futilityMargin(depth))
+				continue
+			}
+			reduction = lateMoveReduction(depth, i)
+		}
+		s.moves[ply] = packed
+		s.makeMove(pos, ap.Position, &ap.Move, ply)
+		score := s.searchMove(ap.Position, i == 0, depth-1, reduction, ply+1, alpha, beta)
+		if s.aborted {
+			return 0
+		}
+		if score > best {
+			best, bestMove = score, packed
+		}
+		if score > alpha {
+			alpha = score
+			s.pv[ply] = append(append(s.pv[ply][:0], ap.Move), s.pv[ply+1]...)
+		}
+		if alpha >= beta {
+			s.stats.cutoffs++
+			s.stats.stageCutoffs[picker.stage]++
+			if i == 0 {
+				s.stats.firstMove++
+			}
+			if quiet {
+				s.rememberCutoff(pos, packed, quietsTried, depth, ply)
+			}
+			break
+		}
+		if quiet {
+			quietsTried = append(quietsTried, packed)
+		}
+	}
+
+	bound := boundExact
+	if best <= origAlpha {
+		// No move proved best, so keep whatever move the table already had
+		bound, bestMove = boundUpper, 0
+	} else if best >= beta {
+		bound = boundLower
+	}
+	s.tt.store(key, ttData{score: scoreToTT(best, ply), move: bestMove, depth: depth, bound: bound})
+	return best
+}
+
+// nullMove lets the side to move pass and searches the reply at reduced depth. If even that
+// fails high, the node is cut with the returned score. Passing is no lower bound in zugzwang,
+// so it is not tried with pawns alone, twice in a row, or in variants with unusual check
+// rules, and deep cutoffs are verified by a reduced search without null moves.
+func (s *searcher) nullMove(pos *Position, eval, depth, ply, beta int) (int, bool) {
+	if !s.opts.NullMove || s.noNull || depth < nullMoveMinDepth || eval < beta ||
+		ply == 0 || s.moves[ply-1] == 0 ||
+		(pos.variant != Standard && pos.variant != Crazyhouse) ||
+		!hasNonPawnMaterial(pos, pos.toMove) {
+		return 0, false
+	}
+	r := 2 + depth/4
+	s.moves[ply] = 0
+	next := nullMovePosition(pos)
+	s.makeMove(pos, next, nil, ply)
+	score := -s.alphaBeta(next, depth-1-r, ply+1, -beta, -beta+1)
+	if s.aborted || score < beta {
+		return 0, false
+	}
+	// A mate found after passing proves nothing about the position itself
+	if isMateScore(score) {
+		score = beta
+	}
+	if depth >= nullMoveVerifyDepth {
+		s.noNull = true
+		verified := s.alphaBeta(pos, depth-r, ply, beta-1, beta)
+		s.noNull = false
+		if s.aborted || verified < beta {
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// evaluate scores pos, reached at ply, with the network if there is one.
+func (s *searcher) evaluate(pos *Position, ply int) int {
+	if s.net.Supports(pos) {
+		score := s.net.Output(s.accs[ply], pos.toMove, s.layers)
+		// Keep evaluations clear of the mate and tablebase range
+		return min(max(score, -tbWinScore+maxSearchPly+1), tbWinScore-maxSearchPly-1)
+	}
+	return Evaluate(pos)
+}
+
+// setRoot computes the network accumulators of the root position from scratch.
+func (s *searcher) setRoot(pos *Position) {
+	if s.net == nil {
+		return
+	}
+	if s.accs == nil {
+		s.accs = make([]*Accumulator, maxSearchPly+2)
+		for i := range s.accs {
+			s.accs[i] = s.net.NewAccumulator()
+		}
+		s.layers = s.net.NewLayerBuffers()
+	}
+	if s.net.Supports(pos) {
+		s.net.Refresh(s.accs[0], pos, White)
+		s.net.Refresh(s.accs[0], pos, Black)
+	}
+}
+
+// makeMove prepares the evaluation of child, reached from parent by move (nil for a null
+// move) at ply, by updating the accumulators of ply+1 from those of ply. Positions are copied rather than unmade, so
+// going back to ply needs no work: its accumulators are left as they were.
+func (s *searcher) makeMove(parent, child *Position, move *GeneratedMove, ply int) {
+	if !s.net.Supports(child) {
+		return
+	}
+	if s.net.Supports(parent) {
+		s.net.Update(s.accs[ply+1], s.accs[ply], parent, child, move)
+		return
+	}
+	s.net.Refresh(s.accs[ply+1], child, White)
+	s.net.Refresh(s.accs[ply+1], child, Black)
+}
+
+// variantTerminalScore scores a position without legal moves using the variant's outcome rules.
+func variantTerminalScore(pos *Position, ply int) int {
+	outcome := pos.Outcome()
+	switch {
+	case outcome.Result == Draw || outcome.Result == Ongoing:
+		return 0
+	case (outcome.Result == WhiteWins) == (pos.toMove == White):
+		return mateScore - ply
+	}
+	return -mateScore + ply
+}
+
+// tablebaseScore converts a WDL result into a search score, preferring nearer wins.
+// Cursed wins and blessed losses are draws under the fifty-move rule.
+func tablebaseScore(wdl WDL, ply int) int {
+	switch {
+	case wdl == WDLWin:
+		return tbWinScore - ply
+	case wdl == WDLLoss:
+		return -tbWinScore + ply
+	}
+	return 0
+}
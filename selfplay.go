@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SelfPlayOptions configures a run of engine-versus-engine games.
+//
+// Games come in pairs sharing an opening, with the engines swapping colours, so neither
+// side profits from a lopsided opening. Openings are drawn from Book for up to BookPlies
+// plies and continued with RandomPlies uniformly random legal moves; the seed of each pair is
+// Seed plus the pair number, so a run is reproducible whatever the number of Workers.
+type SelfPlayOptions struct {
+	Games   int
+	Limits  SearchLimits // per move, typically Depth or Nodes
+	Workers int          // games played at the same time (0 = 1)
+	Seed    int64
+	Event   string // PGN Event tag (empty = "chessx selfplay")
+
+	Book        *PolyglotBook
+	BookPlies   int
+	RandomPlies int
+
+	Adjudication
+
+	Progress func(SelfPlayGame) // called for each game, in order, if not nil
+}
+
+// TrainingSample is a position an engine searched, with its score in centipawns from
+// White's point of view.
+type TrainingSample struct {
+	FEN   string
+	Score int
+}
+
+// SelfPlayGame is a finished self-play game.
+type SelfPlayGame struct {
+	Round   int // from 1
+	White   int // index of the engine playing White
+	PGN     PGNGame
+	Outcome Outcome
+	Samples []TrainingSample // positions searched by the engines, not in check and not mates
+}
+
+// SelfPlayStats sums up a run. Wins are indexed like the engines.
+type SelfPlayStats struct {
+	Wins      [2]int
+	Draws     int
+	Positions int
+}
+
+// SelfPlay plays opts.Games games between engines and writes them to pgn, and their
+// training samples to data, in the order the games were started. Either writer may be nil.
+// Each line of data holds a FEN, the game result from White's point of view in brackets and
+// the search score, such as "<fen> [0.5] 23", which ReadTuningSet accepts.
+//
+// With several workers the engines search from several goroutines at once, so their Search
+// must be safe for concurrent use, as Dumbfish's is unless its Hash is shared.
+func SelfPlay(ctx context.Context, engines [2]Engine, opts SelfPlayOptions, pgn, data io.Writer) (SelfPlayStats, error) {
+	var stats SelfPlayStats
+	workers := min(max(opts.Workers, 1), max(opts.Games, 1))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type finished struct {
+		game SelfPlayGame
+		err  error
+	}
+	rounds := make(chan int)
+	results := make(chan finished)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := range rounds {
+				game, err := playSelfPlayGame(ctx, engines, opts, round)
+				results <- finished{game, err}
+			}
+		}()
+	}
+	go func() {
+		defer close(rounds)
+		for round := 1; round <= opts.Games; round++ {
+			select {
+			case rounds <- round:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Games finish out of order; hold them back until the earlier ones are written
+	pending := map[int]SelfPlayGame{}
+	next := 1
+	var firstErr error
+	for r := range results {
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+				cancel()
+			}
+			continue
+		}
+		pending[r.game.Round] = r.game
+		for firstErr == nil {
+			game, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if err := writeSelfPlayGame(game, pgn, data); err != nil {
+				firstErr = err
+				cancel()
+				break
+			}
+			stats.add(game)
+			if opts.Progress != nil {
+				opts.Progress(game)
+			}
+		}
+	}
+	return stats, firstErr
+}
+
+// add counts game in the stats.
+func (st *SelfPlayStats) add(game SelfPlayGame) {
+	switch game.Outcome.Result {
+	case WhiteWins:
+		st.Wins[game.White]++
+	case BlackWins:
+		st.Wins[1-game.White]++
+	default:
+		st.Draws++
+	}
+	st.Positions += len(game.Samples)
+}
+
+// writeSelfPlayGame writes the game and its samples.
+func writeSelfPlayGame(game SelfPlayGame, pgn, data io.Writer) error {
+	if pgn != nil {
+		if _, err := game.PGN.WriteTo(pgn); err != nil {
+			return err
+		}
+	}
+	if data == nil {
+		return nil
+	}
+	result := map[GameResult]string{WhiteWins: "1.0", BlackWins: "0.0", Draw: "0.5"}[game.Outcome.Result]
+	for _, sample := range game.Samples {
+		if _, err := fmt.Fprintf(data, "%s [%s] %d\n", sample.FEN, result, sample.Score); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// playSelfPlayGame plays one game of the run. Engine round%2 has White, so both engines
+// play each opening once with each colour.
+func playSelfPlayGame(ctx context.Context, engines [2]Engine, opts SelfPlayOptions, round int) (SelfPlayGame, error) {
+	white := (round - 1) % 2
+	event := opts.Event
+	if event == "" {
+		event = "chessx selfplay"
+	}
+	pos, err := ParseFEN(standardStartFEN)
+	if err != nil {
+		return SelfPlayGame{}, err
+	}
+	g := newEngineGame(engines[white], engines[1-white], pos, map[string]string{
+		"Event": event,
+		"Site":  "?",
+		"Date":  time.Now().Format("2006.01.02"),
+		"Round": strconv.Itoa(round),
+	})
+
+	rng := rand.New(rand.NewSource(opts.Seed + int64(round-1)/2))
+	for ply := 0; ply < opts.BookPlies && opts.Book != nil && !g.pos.Outcome().IsOver(); ply++ {
+		ap, ok := opts.Book.PickMove(g.pos, rng)
+		if !ok {
+			break
+		}
+		g.play(ap)
+	}
+	for ply := 0; ply < opts.RandomPlies && !g.pos.Outcome().IsOver(); ply++ {
+		legal := generateLegalMoves(g.pos)
+		g.play(legal[rng.Intn(len(legal))])
+	}
+
+	if err := g.run(ctx, opts.Limits, nil, opts.Adjudication); err != nil {
+		return SelfPlayGame{}, fmt.Errorf("round %d: %w", round, err)
+	}
+	return SelfPlayGame{Round: round, White: white, PGN: g.pgn, Outcome: g.outcome, Samples: g.samples}, nil
+}
+
+// runSelfPlay implements "selfplay [-games N] [-depth D | -nodes N] [-workers W] [-pgn FILE]
+// [-data FILE]", playing Dumbfish against itself and writing the games and training data.
+func runSelfPlay(args []string, out io.Writer) error {
+	flags := commandFlags("selfplay", out)
+	games := flags.Int("games", 10, "number of games")
+	depth := flags.Int("depth", 4, "search depth in plies per move")
+	nodes := flags.Int("nodes", 0, "nodes per move instead of a depth")
+	workers := flags.Int("workers", 1, "games played in parallel")
+	seed := flags.Int64("seed", 1, "seed of the random openings")
+	bookPath := flags.String("book", "", "Polyglot opening book")
+	bookPlies := flags.Int("book-plies", 16, "maximum plies played from the book")
+	randomPlies := flags.Int("random", 8, "random plies played after the book")
+	adjudication := adjudicationFlags(flags)
+	pgnPath := flags.String("pgn", "selfplay.pgn", "PGN file to write the games to")
+	dataPath := flags.String("data", "", "file to write FEN, result and score lines to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	opts := SelfPlayOptions{
+		Games:        *games,
+		Limits:       SearchLimits{Depth: max(*depth, 1)},
+		Workers:      *workers,
+		Seed:         *seed,
+		BookPlies:    *bookPlies,
+		RandomPlies:  *randomPlies,
+		Adjudication: *adjudication,
+		Progress: func(game SelfPlayGame) {
+			fmt.Fprintf(out, "Game %d: %s (%s), %d moves\n", game.Round, game.Outcome.Result,
+				game.Outcome.Reason, (len(game.PGN.Moves)+1)/2)
+		},
+	}
+	if *nodes > 0 {
+		opts.Limits = SearchLimits{Nodes: *nodes}
+	}
+	if *bookPath != "" {
+		book, err := LoadPolyglotBook(*bookPath)
+		if err != nil {
+			return err
+		}
+		opts.Book = book
+	}
+
+	pgn, err := os.Create(*pgnPath)
+	if err != nil {
+		return err
+	}
+	defer pgn.Close()
+	var data io.Writer
+	if *dataPath != "" {
+		f, err := os.Create(*dataPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data = f
+	}
+
+	stats, err := SelfPlay(context.Background(), [2]Engine{Dumbfish{}, Dumbfish{}}, opts, pgn, data)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Score: %d - %d - %d, %d positions\n", stats.Wins[0], stats.Wins[1], stats.Draws, stats.Positions)
+	return pgn.Close()
+}
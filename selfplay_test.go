@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// quickSelfPlay returns options for short games that are cheap to play.
+func quickSelfPlay(games, workers int) SelfPlayOptions {
+	return SelfPlayOptions{
+		Games:        games,
+		Limits:       SearchLimits{Depth: 1},
+		Workers:      workers,
+		Seed:         7,
+		RandomPlies:  4,
+		Adjudication: Adjudication{MaxMoves: 30},
+	}
+}
+
+func TestSelfPlay_GamesAndTrainingData(t *testing.T) {
+	var pgn, data strings.Builder
+	var rounds []int
+	opts := quickSelfPlay(2, 2)
+	opts.Progress = func(game SelfPlayGame) { rounds = append(rounds, game.Round) }
+	stats, err := SelfPlay(context.Background(), [2]Engine{Dumbfish{}, Dumbfish{}}, opts, &pgn, &data)
+	if err != nil {
+		t.Fatalf("selfplay: %v", err)
+	}
+	if len(rounds) != 2 || rounds[0] != 1 || rounds[1] != 2 {
+		t.Errorf("progress rounds = %v, want [1 2]", rounds)
+	}
+	if stats.Wins[0]+stats.Wins[1]+stats.Draws != 2 {
+		t.Errorf("stats %+v do not add up to 2 games", stats)
+	}
+
+	games, err := ReadPGN(strings.NewReader(pgn.String()))
+	if err != nil {
+		t.Fatalf("read pgn: %v", err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("expected 2 games, got %d", len(games))
+	}
+	for i, game := range games {
+		applied, err := game.Replay()
+		if err != nil {
+			t.Fatalf("game %d: replay: %v", i+1, err)
+		}
+		if game.Result == "*" || game.Tags["Result"] != game.Result {
+			t.Errorf("game %d: result %q, tag %q", i+1, game.Result, game.Tags["Result"])
+		}
+		if len(applied) > 2*opts.MaxMoves {
+			t.Errorf("game %d: %d plies beyond the move limit", i+1, len(applied))
+		}
+		if outcome := applied[len(applied)-1].Position.Outcome(); outcome.IsOver() && outcome.Result.String() != game.Result {
+			t.Errorf("game %d: final position is %s but the result is %s", i+1, outcome.Result, game.Result)
+		}
+	}
+	// The pair shares its opening
+	if strings.Join(games[0].Moves[:4], " ") != strings.Join(games[1].Moves[:4], " ") {
+		t.Errorf("openings differ: %v and %v", games[0].Moves[:4], games[1].Moves[:4])
+	}
+
+	set, err := ReadTuningSet(strings.NewReader(data.String()))
+	if err != nil {
+		t.Fatalf("training data: %v", err)
+	}
+	if len(set) != stats.Positions || len(set) == 0 {
+		t.Errorf("read %d training positions, stats say %d", len(set), stats.Positions)
+	}
+}
+
+func TestSelfPlay_WorkersDoNotChangeGames(t *testing.T) {
+	date := regexp.MustCompile(`\[Date "[^"]*"\]`)
+	play := func(workers int) string {
+		var pgn strings.Builder
+		if _, err := SelfPlay(context.Background(), [2]Engine{Dumbfish{}, Dumbfish{}}, quickSelfPlay(4, workers), &pgn, nil); err != nil {
+			t.Fatalf("selfplay with %d workers: %v", workers, err)
+		}
+		return date.ReplaceAllString(pgn.String(), "")
+	}
+	if one, three := play(1), play(3); one != three {
+		t.Errorf("games differ between 1 and 3 workers:\n%s\n---\n%s", one, three)
+	}
+}
+
+// silentEngine never finds a move.
+type silentEngine struct{}
+
+func (silentEngine) Name() string                             { return "Silent" }
+func (silentEngine) SelectMove(*Position) (AppliedMove, bool) { return AppliedMove{}, false }
+func (silentEngine) Search(context.Context, *Position, SearchLimits, func(SearchInfo)) (AppliedMove, bool) {
+	return AppliedMove{}, false
+}
+
+func TestSelfPlay_EngineWithoutMoveFails(t *testing.T) {
+	_, err := SelfPlay(context.Background(), [2]Engine{silentEngine{}, Dumbfish{}}, quickSelfPlay(2, 1), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "Silent returned no move") {
+		t.Fatalf("expected an error naming the engine, got %v", err)
+	}
+}
+
+func TestRunSelfPlay(t *testing.T) {
+	dir := t.TempDir()
+	pgn := filepath.Join(dir, "games.pgn")
+	data := filepath.Join(dir, "train.txt")
+	var out strings.Builder
+	args := []string{"-games", "2", "-depth", "1", "-max-moves", "20", "-pgn", pgn, "-data", data}
+	if err := runSelfPlay(args, &out); err != nil {
+		t.Fatalf("selfplay: %v", err)
+	}
+	if !strings.Contains(out.String(), "Game 2: ") || !strings.Contains(out.String(), "Score: ") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+	f, err := os.Open(pgn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if games, err := ReadPGN(f); err != nil || len(games) != 2 {
+		t.Errorf("read %d games from the PGN file: %v", len(games), err)
+	}
+	if text, err := os.ReadFile(data); err != nil || len(text) == 0 {
+		t.Errorf("training data not written: %v", err)
+	}
+}
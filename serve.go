@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ServerOptions configures the HTTP API. Zero values take the defaults given.
+type ServerOptions struct {
+	Engine         Engine        // answers /api/bestmove; shared by concurrent requests (Dumbfish)
+	Timeout        time.Duration // longest a request may run; requests may ask for less (10s)
+	MaxBodyBytes   int64         // largest request body accepted (64 KiB)
+	MaxSearchDepth int           // deepest search a request may ask for (20)
+	MaxPerftDepth  int           // deepest perft a request may ask for (6)
+}
+
+// apiServer serves the JSON endpoints. Every endpoint takes a POST of a JSON object with
+// the position's "fen" (the standard start position when empty) and an optional
+// "timeoutMs", and answers with a JSON object, or {"error": "..."} and an error status.
+type apiServer struct {
+	opts ServerOptions
+}
+
+// NewServer returns a handler for the API:
+//
+//	POST /api/moves     legal moves in UCI and SAN
+//	POST /api/move      play "move" (UCI or SAN) and return the new position
+//	POST /api/status    side to move, check, and the result once the game is over
+//	POST /api/bestmove  search with "depth", "nodes" and "movetimeMs" limits
+//	POST /api/eval      the static evaluation, term by term
+//	POST /api/perft     leaf node count at "depth", by move with "divide"
+func NewServer(opts ServerOptions) http.Handler {
+	if opts.Engine == nil {
+		opts.Engine = Dumbfish{}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = 64 << 10
+	}
+	if opts.MaxSearchDepth <= 0 {
+		opts.MaxSearchDepth = 20
+	}
+	if opts.MaxPerftDepth <= 0 {
+		opts.MaxPerftDepth = 6
+	}
+	s := &apiServer{opts: opts}
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/moves", apiHandler(s, s.moves))
+	mux.Handle("POST /api/move", apiHandler(s, s.move))
+	mux.Handle("POST /api/status", apiHandler(s, s.status))
+	mux.Handle("POST /api/bestmove", apiHandler(s, s.bestMove))
+	mux.Handle("POST /api/eval", apiHandler(s, s.eval))
+	mux.Handle("POST /api/perft", apiHandler(s, s.perft))
+	return mux
+}
+
+// apiRequest holds the fields common to all requests.
+type apiRequest struct {
+	FEN       string `json:"fen"`
+	TimeoutMs int    `json:"timeoutMs"`
+}
+
+func (r *apiRequest) common() *apiRequest { return r }
+
+// position parses the request's FEN, refusing positions that cannot arise in a game.
+func (r *apiRequest) position() (*Position, error) {
+	if r.FEN == "" {
+		return NewVariantPosition(Standard), nil
+	}
+	pos, err := ParseStrictFEN(r.FEN)
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, "fen: %v", err)
+	}
+	return pos, nil
+}
+
+// apiError is an error with the HTTP status to answer it with.
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e *apiError) Error() string { return e.err.Error() }
+
+func apiErrorf(status int, format string, args ...any) error {
+	return &apiError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+// apiHandler decodes a request of type T, runs fn on it under the request's deadline and
+// encodes what it returns.
+func apiHandler[T any, R interface {
+	*T
+	common() *apiRequest
+}](s *apiServer, fn func(context.Context, *T) (any, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req T
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.opts.MaxBodyBytes))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeAPIError(w, apiErrorf(http.StatusRequestEntityTooLarge, "request body over %d bytes", tooLarge.Limit))
+				return
+			}
+			writeAPIError(w, apiErrorf(http.StatusBadRequest, "request: %v", err))
+			return
+		}
+		timeout := s.opts.Timeout
+		if ms := R(&req).common().TimeoutMs; ms > 0 {
+			timeout = min(timeout, time.Duration(ms)*time.Millisecond)
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		response, err := fn(ctx, &req)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = apiErrorf(http.StatusGatewayTimeout, "timed out after %v", timeout)
+		}
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, response)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		status = apiErr.status
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// apiMove is a move in both notations.
+type apiMove struct {
+	UCI string `json:"uci"`
+	SAN string `json:"san"`
+}
+
+type movesResponse struct {
+	FEN   string    `json:"fen"`
+	Moves []apiMove `json:"moves"`
+}
+
+func (s *apiServer) moves(ctx context.Context, req *apiRequest) (any, error) {
+	pos, err := req.position()
+	if err != nil {
+		return nil, err
+	}
+	response := movesResponse{FEN: pos.FEN(), Moves: []apiMove{}}
+	for _, ap := range generateLegalMoves(pos) {
+		response.Moves = append(response.Moves, apiMove{UCI: ap.Move.UCINotation(), SAN: formatSAN(pos, ap)})
+	}
+	return response, nil
+}
+
+type moveRequest struct {
+	apiRequest
+	Move string `json:"move"`
+}
+
+type moveResponse struct {
+	apiMove
+	FEN    string         `json:"fen"`
+	Status statusResponse `json:"status"`
+}
+
+func (s *apiServer) move(ctx context.Context, req *moveRequest) (any, error) {
+	pos, err := req.position()
+	if err != nil {
+		return nil, err
+	}
+	ap, ok := findUCIMove(pos, req.Move)
+	if !ok {
+		if ap, err = parseSAN(pos, req.Move); err != nil {
+			return nil, apiErrorf(http.StatusUnprocessableEntity, "move %q: %v", req.Move, err)
+		}
+	}
+	return moveResponse{
+		apiMove: apiMove{UCI: ap.Move.UCINotation(), SAN: formatSAN(pos, ap)},
+		FEN:     ap.Position.FEN(),
+		Status:  positionStatus(ap.Position),
+	}, nil
+}
+
+type statusResponse struct {
+	ToMove string `json:"toMove"`
+	Check  bool   `json:"check"`
+	Over   bool   `json:"over"`
+	Result string `json:"result"` // "*" while the game goes on
+	Reason string `json:"reason,omitempty"`
+}
+
+// positionStatus describes pos. Repetitions need the game's history and are not detected.
+func positionStatus(pos *Position) statusResponse {
+	outcome := pos.Outcome()
+	return statusResponse{
+		ToMove: colorToString(pos.toMove),
+		Check:  pos.IsKingInCheck(pos.toMove),
+		Over:   outcome.IsOver(),
+		Result: outcome.Result.String(),
+		Reason: outcome.Reason,
+	}
+}
+
+func (s *apiServer) status(ctx context.Context, req *apiRequest) (any, error) {
+	pos, err := req.position()
+	if err != nil {
+		return nil, err
+	}
+	return positionStatus(pos), nil
+}
+
+type bestMoveRequest struct {
+	apiRequest
+	Depth      int `json:"depth"`
+	Nodes      int `json:"nodes"`
+	MoveTimeMs int `json:"movetimeMs"`
+}
+
+type bestMoveResponse struct {
+	apiMove
+	FEN   string `json:"fen"` // after the move
+	Score Score  `json:"score"`
+	Depth int    `json:"depth"`
+	Nodes int    `json:"nodes"`
+	PV    string `json:"pv"` // in SAN, with move numbers
+}
+
+// bestMove searches within the request's limits, or to the default depth without any. A
+// search cut short by the deadline still answers with the best move found.
+func (s *apiServer) bestMove(ctx context.Context, req *bestMoveRequest) (any, error) {
+	pos, err := req.position()
+	if err != nil {
+		return nil, err
+	}
+	if req.Depth < 0 || req.Nodes < 0 || req.MoveTimeMs < 0 {
+		return nil, apiErrorf(http.StatusBadRequest, "limits must not be negative")
+	}
+	if req.Depth > s.opts.MaxSearchDepth {
+		return nil, apiErrorf(http.StatusBadRequest, "depth %d over the limit of %d", req.Depth, s.opts.MaxSearchDepth)
+	}
+	limits := SearchLimits{Depth: req.Depth, Nodes: req.Nodes, MoveTime: time.Duration(req.MoveTimeMs) * time.Millisecond}
+	if limits.IsZero() {
+		limits.Depth = defaultSearchDepth
+	}
+	var last SearchInfo
+	best, ok := s.opts.Engine.Search(ctx, pos, limits, func(info SearchInfo) {
+		if info.MultiPV <= 1 {
+			last = info
+		}
+	})
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, apiErrorf(http.StatusUnprocessableEntity, "no legal moves")
+	}
+	return bestMoveResponse{
+		apiMove: apiMove{UCI: best.Move.UCINotation(), SAN: formatSAN(pos, best)},
+		FEN:     best.Position.FEN(),
+		Score:   last.Score,
+		Depth:   last.Depth,
+		Nodes:   last.Nodes,
+		PV:      formatSANLine(pos, last.PV),
+	}, nil
+}
+
+func (s *apiServer) eval(ctx context.Context, req *apiRequest) (any, error) {
+	pos, err := req.position()
+	if err != nil {
+		return nil, err
+	}
+	return defaultEvalParams.Breakdown(pos), nil
+}
+
+type perftRequest struct {
+	apiRequest
+	Depth  int  `json:"depth"`
+	Divide bool `json:"divide"`
+}
+
+type perftResponse struct {
+	Nodes  int            `json:"nodes"`
+	Divide map[string]int `json:"divide,omitempty"`
+}
+
+func (s *apiServer) perft(ctx context.Context, req *perftRequest) (any, error) {
+	pos, err := req.position()
+	if err != nil {
+		return nil, err
+	}
+	if req.Depth < 1 || req.Depth > s.opts.MaxPerftDepth {
+		return nil, apiErrorf(http.StatusBadRequest, "depth must be from 1 to %d", s.opts.MaxPerftDepth)
+	}
+	if !req.Divide {
+		nodes, err := Perft(ctx, pos, req.Depth)
+		return perftResponse{Nodes: nodes}, err
+	}
+	counts, err := Divide(ctx, pos, req.Depth)
+	if err != nil {
+		return nil, err
+	}
+	response := perftResponse{Divide: counts}
+	for _, n := range counts {
+		response.Nodes += n
+	}
+	return response, nil
+}
+
+// runServe implements "serve [-addr HOST:PORT] ...", serving the JSON API of NewServer until
+// the process is stopped.
+func runServe(args []string, out io.Writer) error {
+	flags := commandFlags("serve", out)
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	timeout := flags.Duration("timeout", 10*time.Second, "longest time a request may take")
+	maxBody := flags.Int64("max-body", 64<<10, "largest request body in bytes")
+	maxDepth := flags.Int("max-depth", 20, "deepest search a request may ask for")
+	maxPerft := flags.Int("max-perft", 6, "deepest perft a request may ask for")
+	spec := flags.String("engine", "dumbfish", engineFlagHelp)
+	options := flags.String("options", "", "UCI options as Name=Value,...")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	engine, closer, err := openEngine(*spec, *options)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer()
+	}
+	server := &http.Server{
+		Addr: *addr,
+		Handler: NewServer(ServerOptions{Engine: engine, Timeout: *timeout, MaxBodyBytes: *maxBody,
+			MaxSearchDepth: *maxDepth, MaxPerftDepth: *maxPerft}),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       *timeout,
+		WriteTimeout:      *timeout + 5*time.Second,
+	}
+	fmt.Fprintf(out, "Serving the chessx API on http://%s/api/\n", *addr)
+	return server.ListenAndServe()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postAPI posts body to path and decodes the JSON response into a map.
+func postAPI(t *testing.T, server *httptest.Server, path, body string) (int, map[string]any) {
+	t.Helper()
+	resp, err := server.Client().Post(server.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("POST %s: content type %q", path, ct)
+	}
+	var decoded map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("POST %s: decode: %v", path, err)
+	}
+	return resp.StatusCode, decoded
+}
+
+func newTestAPI(t *testing.T, opts ServerOptions) *httptest.Server {
+	server := httptest.NewServer(NewServer(opts))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAPI_MovesAndStatus(t *testing.T) {
+	server := newTestAPI(t, ServerOptions{})
+	status, body := postAPI(t, server, "/api/moves", `{}`)
+	moves, _ := body["moves"].([]any)
+	if status != http.StatusOK || len(moves) != 20 || body["fen"] != standardStartFEN {
+		t.Fatalf("moves from the start: %d %v", status, body)
+	}
+	found := false
+	for _, m := range moves {
+		move := m.(map[string]any)
+		found = found || move["uci"] == "g1f3" && move["san"] == "Nf3"
+	}
+	if !found {
+		t.Errorf("Nf3 missing from %v", moves)
+	}
+
+	// Fool's mate
+	status, body = postAPI(t, server, "/api/status", `{"fen": "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3"}`)
+	if status != http.StatusOK || body["over"] != true || body["result"] != "0-1" || body["reason"] != "checkmate" ||
+		body["check"] != true || body["toMove"] != "White" {
+		t.Errorf("status: %d %v", status, body)
+	}
+	status, body = postAPI(t, server, "/api/status", `{"fen": ""}`)
+	if status != http.StatusOK || body["over"] != false || body["result"] != "*" {
+		t.Errorf("start status: %d %v", status, body)
+	}
+
+	for _, bad := range []string{`{"fen": "not a fen"}`, `{"fen": 3}`, `{"position": "x"}`, `{`} {
+		if status, body := postAPI(t, server, "/api/moves", bad); status != http.StatusBadRequest || body["error"] == "" {
+			t.Errorf("%s: %d %v", bad, status, body)
+		}
+	}
+}
+
+func TestAPI_RejectsImpossiblePositions(t *testing.T) {
+	server := newTestAPI(t, ServerOptions{})
+	for _, c := range []struct {
+		name, fen, want string
+	}{
+		{"opponent in check", "7k/8/8/8/8/8/8/K6Q w - - 0 1", "Black is in check"},
+		{"two kings", "kk6/8/8/8/8/8/8/KK6 w - - 0 1", "White has 2 kings"},
+		{"no black king", "8/8/8/8/8/8/8/KQ6 w - - 0 1", "Black has 0 kings"},
+		{"seven ranks", "7k/8/8/8/8/8/K7 w - - 0 1", "7 ranks"},
+		{"short rank", "7k/8/8/8/8/8/8/K6 w - - 0 1", "rank 1 has 7 files"},
+		{"long rank", "7k/8/8/8/8/8/8/K8 w - - 0 1", "rank 1 has 9 files"},
+		{"bad piece", "7k/8/8/8/8/8/8/K6X w - - 0 1", "unexpected 'X'"},
+		{"bad side to move", "7k/8/8/8/8/8/8/K7 x - - 0 1", "side to move"},
+		{"pawn on the last rank", "P6k/8/8/8/8/8/8/K7 w - - 0 1", "pawn on a8"},
+		{"en passant without a pawn", "7k/8/8/8/8/8/8/K7 w - e6 0 1", "en passant square e6"},
+		{"en passant on the wrong rank", "7k/8/8/4p3/8/8/8/K7 w - e5 0 1", "en passant square e5"},
+		{"en passant for the mover's pawn", "7k/8/8/4P3/8/8/8/K7 w - e6 0 1", "en passant square e6"},
+	} {
+		for _, path := range []string{"/api/moves", "/api/status", "/api/bestmove"} {
+			status, body := postAPI(t, server, path, fmt.Sprintf(`{"fen": %q}`, c.fen))
+			if message, _ := body["error"].(string); status != http.StatusBadRequest || !strings.Contains(message, c.want) {
+				t.Errorf("%s %s: %d %v, want 400 with %q", c.name, path, status, body, c.want)
+			}
+		}
+	}
+	// A double step really played leaves a valid en passant square
+	if status, body := postAPI(t, server, "/api/moves", `{"fen": "rnbqkbnr/pppp1ppp/8/4p3/8/8/PPPPPPPP/RNBQKBNR w KQkq e6 0 2"}`); status != http.StatusOK {
+		t.Errorf("en passant after e5: %d %v", status, body)
+	}
+}
+
+func TestAPI_Move(t *testing.T) {
+	server := newTestAPI(t, ServerOptions{})
+	status, body := postAPI(t, server, "/api/move", `{"move": "Nf3"}`)
+	if status != http.StatusOK || body["uci"] != "g1f3" || body["san"] != "Nf3" ||
+		body["fen"] != "rnbqkbnr/pppppppp/8/8/8/5N2/PPPPPPPP/RNBQKB1R b KQkq - 1 1" {
+		t.Errorf("Nf3: %d %v", status, body)
+	}
+	status, body = postAPI(t, server, "/api/move", `{"fen": "7k/8/6K1/8/8/8/8/R7 w - - 0 1", "move": "a1a8"}`)
+	if status != http.StatusOK || body["san"] != "Ra8#" || body["status"].(map[string]any)["result"] != "1-0" {
+		t.Errorf("mate: %d %v", status, body)
+	}
+	for _, move := range []string{"e2e5", "Ke2", ""} {
+		if status, body := postAPI(t, server, "/api/move", `{"move": "`+move+`"}`); status != http.StatusUnprocessableEntity {
+			t.Errorf("move %q: %d %v", move, status, body)
+		}
+	}
+}
+
+func TestAPI_BestMoveAndEval(t *testing.T) {
+	server := newTestAPI(t, ServerOptions{MaxSearchDepth: 5})
+	status, body := postAPI(t, server, "/api/bestmove", `{"fen": "7k/8/6K1/8/8/8/8/R7 w - - 0 1", "depth": 2}`)
+	if status != http.StatusOK || body["uci"] != "a1a8" || body["san"] != "Ra8#" ||
+		body["score"].(map[string]any)["mate"] != 1.0 || body["depth"] != 2.0 || body["pv"] != "1. Ra8#" {
+		t.Errorf("mate in one: %d %v", status, body)
+	}
+	if status, body := postAPI(t, server, "/api/bestmove", `{"depth": 6}`); status != http.StatusBadRequest {
+		t.Errorf("depth over the limit: %d %v", status, body)
+	}
+	if status, body := postAPI(t, server, "/api/bestmove", `{"fen": "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1"}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("stalemate: %d %v", status, body)
+	}
+	// A deadline cuts the search short but still gets a move
+	start := time.Now()
+	status, body = postAPI(t, server, "/api/bestmove", `{"movetimeMs": 60000, "timeoutMs": 200}`)
+	if status != http.StatusOK || body["uci"] == "" || time.Since(start) > 5*time.Second {
+		t.Errorf("timed search: %d %v after %v", status, body, time.Since(start))
+	}
+
+	status, body = postAPI(t, server, "/api/eval", `{}`)
+	if status != http.StatusOK || body["phase"] != float64(totalPhase) || body["score"] != 0.0 ||
+		body["material"].(map[string]any)["mg"] != 0.0 {
+		t.Errorf("eval: %d %v", status, body)
+	}
+}
+
+func TestAPI_Perft(t *testing.T) {
+	server := newTestAPI(t, ServerOptions{MaxPerftDepth: 5})
+	status, body := postAPI(t, server, "/api/perft", `{"depth": 3}`)
+	if status != http.StatusOK || body["nodes"] != 8902.0 || body["divide"] != nil {
+		t.Errorf("perft: %d %v", status, body)
+	}
+	status, body = postAPI(t, server, "/api/perft", `{"depth": 2, "divide": true}`)
+	if divide, _ := body["divide"].(map[string]any); status != http.StatusOK || body["nodes"] != 400.0 || len(divide) != 20 {
+		t.Errorf("divide: %d %v", status, body)
+	}
+	for _, depth := range []string{"0", "6"} {
+		if status, _ := postAPI(t, server, "/api/perft", `{"depth": `+depth+`}`); status != http.StatusBadRequest {
+			t.Errorf("depth %s: %d", depth, status)
+		}
+	}
+	status, body = postAPI(t, server, "/api/perft", `{"depth": 5, "timeoutMs": 20}`)
+	if status != http.StatusGatewayTimeout || !strings.Contains(body["error"].(string), "timed out") {
+		t.Errorf("timeout: %d %v", status, body)
+	}
+}
+
+func TestAPI_Limits(t *testing.T) {
+	server := newTestAPI(t, ServerOptions{MaxBodyBytes: 100})
+	status, body := postAPI(t, server, "/api/moves", `{"fen": "`+strings.Repeat(" ", 200)+`"}`)
+	if status != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: %d %v", status, body)
+	}
+	resp, err := server.Client().Get(server.URL + "/api/moves")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: %d", resp.StatusCode)
+	}
+}
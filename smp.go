@@ -0,0 +1,38 @@
+package main
+
+import "sync"
+
+// maxThreads bounds the Threads option.
+const maxThreads = 256
+
+// searchLazySMP runs main on the calling goroutine and threads-1 helper searches alongside it
+// (Lazy SMP). The helpers search the same position without reporting or keeping time; they
+// only help by filling the shared transposition table. The main thread alone decides the move,
+// and the helpers stop as soon as it does.
+func searchLazySMP(main *searcher, threads int, pos *Position, maxDepth, mate int) (AppliedMove, bool) {
+	if main.shared == nil {
+		main.shared = &searchShared{}
+	}
+	var wg sync.WaitGroup
+	for id := 1; id < threads; id++ {
+		helper := &searcher{
+			ctx:      main.ctx,
+			tb:       main.tb,
+			tt:       main.tt,
+			opts:     main.opts,
+			net:      main.net,
+			shared:   main.shared,
+			id:       id,
+			maxNodes: main.maxNodes,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			helper.iterate(pos, maxDepth, 0)
+		}()
+	}
+	best, _, ok := main.iterate(pos, maxDepth, mate)
+	main.shared.stop.Store(true)
+	wg.Wait()
+	return best, ok
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const smpTestFEN = "r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4"
+
+// searchReports searches fen to depth with a fresh table and returns every report.
+func searchReports(t testing.TB, engine Dumbfish, fen string, depth int) []SearchInfo {
+	pos, err := ParseFEN(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []SearchInfo
+	if _, ok := engine.Search(context.Background(), pos, SearchLimits{Depth: depth}, func(info SearchInfo) {
+		infos = append(infos, info)
+	}); !ok {
+		t.Fatalf("no move for %s", fen)
+	}
+	return infos
+}
+
+func TestLazySMP_SingleThreadIsDeterministic(t *testing.T) {
+	run := func() string {
+		var sb strings.Builder
+		engine := Dumbfish{Threads: 1, Hash: NewTranspositionTable(4)}
+		for _, info := range searchReports(t, engine, smpTestFEN, 4) {
+			fmt.Fprintf(&sb, "%d %d %s |", info.Nodes, info.HashFull, info.Score.UCI())
+			for _, m := range info.PV {
+				sb.WriteString(" " + m.UCINotation())
+			}
+			sb.WriteString("\n")
+		}
+		return sb.String()
+	}
+	first := run()
+	for range 3 {
+		if again := run(); again != first {
+			t.Fatalf("single-threaded searches differ:\n%s\nvs\n%s", first, again)
+		}
+	}
+}
+
+func TestLazySMP_HelpersShareTheWork(t *testing.T) {
+	for _, threads := range []int{2, 4} {
+		engine := Dumbfish{Threads: threads}
+		infos := searchReports(t, engine, "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 4)
+		last := infos[len(infos)-1]
+		if last.Score.Mate != 1 || last.PV[0].UCINotation() != "a1a8" {
+			t.Errorf("threads %d: expected mate in 1 with a1a8, got %s", threads, last.UCI())
+		}
+
+		pos, _ := ParseFEN("4k3/8/8/3q4/8/2N5/8/4K2R w - - 0 1")
+		best, ok := engine.Search(context.Background(), pos, SearchLimits{Depth: 4, MultiPV: 2}, nil)
+		if !ok || best.Move.UCINotation() != "c3d5" {
+			t.Errorf("threads %d: expected c3d5, got %s", threads, best.Move.UCINotation())
+		}
+	}
+
+	// Helpers count towards the node limit and stop with the main thread
+	pos := NewVariantPosition(Standard)
+	var last SearchInfo
+	if _, ok := (Dumbfish{Threads: 4}).Search(context.Background(), pos, SearchLimits{Nodes: 5000}, func(info SearchInfo) {
+		last = info
+	}); !ok {
+		t.Fatalf("expected a move under a node limit")
+	}
+	if last.Nodes > 5000 {
+		t.Errorf("expected at most 5000 nodes across threads, reported %d", last.Nodes)
+	}
+}
+
+func TestUCI_ThreadsAndHash(t *testing.T) {
+	in := strings.NewReader("uci\nsetoption name Threads value 3\nsetoption name Hash value 2\n" +
+		"position fen 6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1\ngo depth 3\n")
+	var out strings.Builder
+	if err := RunUCI(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"option name Threads type spin", "option name Hash type spin", "bestmove a1a8"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+}
+
+// BenchmarkTimeToDepth measures how long searches take to reach a fixed depth as threads are
+// added. Compare the ns/op of the sub-benchmarks: go test -run - -bench TimeToDepth
+func BenchmarkTimeToDepth(b *testing.B) {
+	fens := []string{
+		standardStartFEN,
+		smpTestFEN,
+		"r3k2r/pp1n1ppp/2pbpn2/q7/2PP4/2N1PN2/PP1B1PPP/R2QKB1R w KQkq - 2 9",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}
+	for _, threads := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("threads=%d", threads), func(b *testing.B) {
+			hash := NewTranspositionTable(defaultHashMB)
+			nodes := 0
+			for range b.N {
+				for _, fen := range fens {
+					hash.Clear()
+					infos := searchReports(b, Dumbfish{Threads: threads, Hash: hash}, fen, 5)
+					nodes += infos[len(infos)-1].Nodes
+				}
+			}
+			b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+		})
+	}
+}
@@ -0,0 +1,1332 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Syzygy tablebases: a pure-Go reader for .rtbw (win/draw/loss) and .rtbz (distance to zeroing)
+// files following the layout of Ronald de Man's probing code. Tables are opened lazily on first
+// use and read with ReadAt, so large sets are never loaded into memory wholesale.
+
+const (
+	syzygyWDLSuffix = ".rtbw"
+	syzygyDTZSuffix = ".rtbz"
+	syzygyMaxPieces = 7
+)
+
+var (
+	syzygyWDLMagic = [4]byte{0x71, 0xE8, 0x23, 0x5D}
+	syzygyDTZMagic = [4]byte{0xD7, 0x66, 0x0C, 0xA5}
+)
+
+var (
+	// ErrSyzygyMissing is returned when no table covers the position's material.
+	ErrSyzygyMissing = errors.New("syzygy: table not found")
+	// ErrSyzygyUnsupported is returned for positions tablebases cannot answer
+	// (castling rights, variants, too many pieces).
+	ErrSyzygyUnsupported = errors.New("syzygy: position not supported")
+)
+
+// Additional WDL values distinguishing results spoiled by the fifty-move rule.
+const (
+	WDLBlessedLoss WDL = -1 // lost, but drawn under the fifty-move rule
+	WDLCursedWin   WDL = 1  // won, but drawn under the fifty-move rule
+)
+
+// Index tables, see encodePiece/encodePawn.
+var (
+	syzygyTriangle = [64]int{
+		6, 0, 1, 2, 2, 1, 0, 6,
+		0, 7, 3, 4, 4, 3, 7, 0,
+		1, 3, 8, 5, 5, 8, 3, 1,
+		2, 4, 5, 9, 9, 5, 4, 2,
+		2, 4, 5, 9, 9, 5, 4, 2,
+		1, 3, 8, 5, 5, 8, 3, 1,
+		0, 7, 3, 4, 4, 3, 7, 0,
+		6, 0, 1, 2, 2, 1, 0, 6,
+	}
+	syzygyLower = [64]int{
+		28, 0, 1, 2, 3, 4, 5, 6,
+		0, 29, 7, 8, 9, 10, 11, 12,
+		1, 7, 30, 13, 14, 15, 16, 17,
+		2, 8, 13, 31, 18, 19, 20, 21,
+		3, 9, 14, 18, 32, 22, 23, 24,
+		4, 10, 15, 19, 22, 33, 25, 26,
+		5, 11, 16, 20, 23, 25, 34, 27,
+		6, 12, 17, 21, 24, 26, 27, 35,
+	}
+	syzygyDiag = [64]int{
+		0, 0, 0, 0, 0, 0, 0, 8,
+		0, 1, 0, 0, 0, 0, 9, 0,
+		0, 0, 2, 0, 0, 10, 0, 0,
+		0, 0, 0, 3, 11, 0, 0, 0,
+		0, 0, 0, 12, 4, 0, 0, 0,
+		0, 0, 13, 0, 0, 5, 0, 0,
+		0, 14, 0, 0, 0, 0, 6, 0,
+		15, 0, 0, 0, 0, 0, 0, 7,
+	}
+	syzygyFlap = [64]int{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 6, 12, 18, 18, 12, 6, 0,
+		1, 7, 13, 19, 19, 13, 7, 1,
+		2, 8, 14, 20, 20, 14, 8, 2,
+		3, 9, 15, 21, 21, 15, 9, 3,
+		4, 10, 16, 22, 22, 16, 10, 4,
+		5, 11, 17, 23, 23, 17, 11, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	}
+	syzygyPtwist = [64]int{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		47, 35, 23, 11, 10, 22, 34, 46,
+		45, 33, 21, 9, 8, 20, 32, 44,
+		43, 31, 19, 7, 6, 18, 30, 42,
+		41, 29, 17, 5, 4, 16, 28, 40,
+		39, 27, 15, 3, 2, 14, 26, 38,
+		37, 25, 13, 1, 0, 12, 24, 36,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	}
+	syzygyInvFlap = [24]int{
+		8, 16, 24, 32, 40, 48,
+		9, 17, 25, 33, 41, 49,
+		10, 18, 26, 34, 42, 50,
+		11, 19, 27, 35, 43, 51,
+	}
+	syzygyFileToFile = [8]int{0, 1, 2, 3, 3, 2, 1, 0}
+
+	syzygyKKIndex  [10][64]int
+	syzygyBinomial [5][64]uint64
+	syzygyPawnIdx  [5][24]uint64
+	syzygyPFactor  [5][4]uint64
+)
+
+func init() {
+	// binomial[i][j] = C(j, i+1)
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 64; j++ {
+			f, l := uint64(j), uint64(1)
+			for k := 1; k <= i; k++ {
+				f *= uint64(j - k)
+				l *= uint64(k + 1)
+			}
+			syzygyBinomial[i][j] = f / l
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		var s uint64
+		for j := 0; j < 24; j++ {
+			if j%6 == 0 {
+				s = 0
+			}
+			syzygyPawnIdx[i][j] = s
+			if i == 0 {
+				s++
+			} else {
+				s += syzygyBinomial[i-1][syzygyPtwist[syzygyInvFlap[j]]]
+			}
+			if j%6 == 5 {
+				syzygyPFactor[i][j/6] = s
+			}
+		}
+	}
+
+	// KK index: the 462 legal placements of two kings with the first in the a1-d1-d4
+	// triangle; placements with both kings on the a1-h8 diagonal are numbered last.
+	offDiag := func(sq int) int { return sq>>3 - sq&7 }
+	type kk struct{ idx, sq int }
+	var bothOnDiagonal []kk
+	code := 0
+	for idx := 0; idx < 10; idx++ {
+		for sq := 0; sq < 64; sq++ {
+			syzygyKKIndex[idx][sq] = -1
+		}
+	}
+	for idx := 0; idx < 10; idx++ {
+		for s1 := 0; s1 < 28; s1++ {
+			if syzygyTriangle[s1] != idx || s1&7 > 3 || offDiag(s1) > 0 {
+				continue
+			}
+			for s2 := 0; s2 < 64; s2++ {
+				switch {
+				case s1 == s2 || KingMoves[s1].IsSet(uint64(s2)):
+				case offDiag(s1) == 0 && offDiag(s2) > 0:
+				case offDiag(s1) == 0 && offDiag(s2) == 0:
+					bothOnDiagonal = append(bothOnDiagonal, kk{idx, s2})
+				default:
+					syzygyKKIndex[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, p := range bothOnDiagonal {
+		syzygyKKIndex[p.idx][p.sq] = code
+		code++
+	}
+}
+
+// syzygyPiece converts a piece to the table encoding: 1..6 for white P N B R Q K, +8 for black.
+func syzygyPiece(kind PieceKind, color Color) int {
+	var code int
+	switch kind {
+	case Pawn:
+		code = 1
+	case Knight:
+		code = 2
+	case Bishop:
+		code = 3
+	case Rook:
+		code = 4
+	case Queen:
+		code = 5
+	case King:
+		code = 6
+	}
+	if color == Black {
+		code += 8
+	}
+	return code
+}
+
+// syzygyMaterial returns a table name such as "KQvK" for the given side (white first unless mirrored).
+func syzygyMaterial(pos *Position, mirrored bool) string {
+	order := []PieceKind{King, Queen, Rook, Bishop, Knight, Pawn}
+	side := func(color Color) string {
+		var sb strings.Builder
+		for _, kind := range order {
+			for i := range pos.pieces {
+				if pos.pieces[i].Kind == kind && pos.pieces[i].Color == color {
+					sb.WriteString(pieceKindToFEN(kind, White))
+				}
+			}
+		}
+		return sb.String()
+	}
+	if mirrored {
+		return side(Black) + "v" + side(White)
+	}
+	return side(White) + "v" + side(Black)
+}
+
+// syzygyFile provides little-endian random access to a table file.
+type syzygyFile struct {
+	r    io.ReaderAt
+	size int64
+}
+
+func (f *syzygyFile) bytes(off int64, n int) []byte {
+	buf := make([]byte, n)
+	if off < f.size {
+		_, _ = f.r.ReadAt(buf, off)
+	}
+	return buf
+}
+
+func (f *syzygyFile) u8(off int64) int { return int(f.bytes(off, 1)[0]) }
+func (f *syzygyFile) u16(off int64) int {
+	return int(binary.LittleEndian.Uint16(f.bytes(off, 2)))
+}
+func (f *syzygyFile) u32(off int64) uint32 { return binary.LittleEndian.Uint32(f.bytes(off, 4)) }
+
+// syzygyPairs describes one compressed sub-table (Huffman-coded symbols expanding to pairs).
+type syzygyPairs struct {
+	constValue int // value of single-valued tables (idxbits == 0)
+	blockSize  uint
+	idxBits    uint
+	minLen     int
+	offsets    []int    // first symbol per code length, indexed from minLen
+	base       []uint64 // smallest left-aligned code per length, indexed from minLen
+	symLen     []int
+	symPat     []byte
+
+	indexTable int64
+	sizeTable  int64
+	data       int64
+
+	// sizes of the index table, size table and data sections
+	sizes [3]int64
+	flags int
+}
+
+// setupPairs parses a pairs header at off and returns it with the offset just past it.
+func setupPairs(f *syzygyFile, off int64, tbSize uint64, wdl bool) (*syzygyPairs, int64) {
+	d := &syzygyPairs{flags: f.u8(off)}
+	if d.flags&0x80 != 0 {
+		if wdl {
+			d.constValue = f.u8(off + 1)
+		}
+		return d, off + 2
+	}
+	d.blockSize = uint(f.u8(off + 1))
+	d.idxBits = uint(f.u8(off + 2))
+	realNumBlocks := int64(f.u32(off + 4))
+	numBlocks := realNumBlocks + int64(f.u8(off+3))
+	maxLen := f.u8(off + 8)
+	d.minLen = f.u8(off + 9)
+	h := maxLen - d.minLen + 1
+	numSyms := f.u16(off + 10 + 2*int64(h))
+
+	d.offsets = make([]int, h)
+	for i := 0; i < h; i++ {
+		d.offsets[i] = f.u16(off + 10 + 2*int64(i))
+	}
+	d.symPat = f.bytes(off+12+2*int64(h), 3*numSyms)
+	next := off + 12 + 2*int64(h) + 3*int64(numSyms) + int64(numSyms&1)
+
+	numIndices := (tbSize + (1 << d.idxBits) - 1) >> d.idxBits
+	d.sizes[0] = 6 * int64(numIndices)
+	d.sizes[1] = 2 * numBlocks
+	d.sizes[2] = (int64(1) << d.blockSize) * realNumBlocks
+
+	d.symLen = make([]int, numSyms)
+	done := make([]bool, numSyms)
+	var calc func(s int)
+	calc = func(s int) {
+		w := d.symPat[3*s:]
+		s2 := int(w[2])<<4 | int(w[1])>>4
+		if s2 == 0x0fff {
+			d.symLen[s] = 0
+		} else {
+			s1 := int(w[1]&0x0f)<<8 | int(w[0])
+			if !done[s1] {
+				calc(s1)
+			}
+			if !done[s2] {
+				calc(s2)
+			}
+			d.symLen[s] = d.symLen[s1] + d.symLen[s2] + 1
+		}
+		done[s] = true
+	}
+	for s := 0; s < numSyms; s++ {
+		if !done[s] {
+			calc(s)
+		}
+	}
+
+	d.base = make([]uint64, h)
+	for i := h - 2; i >= 0; i-- {
+		d.base[i] = (d.base[i+1] + uint64(d.offsets[i]) - uint64(d.offsets[i+1])) / 2
+	}
+	for i := 0; i < h; i++ {
+		d.base[i] <<= uint(64 - (d.minLen + i))
+	}
+	return d, next
+}
+
+// decompress returns the stored value at idx.
+func (d *syzygyPairs) decompress(f *syzygyFile, idx uint64) int {
+	if d.idxBits == 0 {
+		return d.constValue
+	}
+	mainIdx := idx >> d.idxBits
+	litIdx := int64(idx&((1<<d.idxBits)-1)) - int64(1)<<(d.idxBits-1)
+	entry := f.bytes(d.indexTable+6*int64(mainIdx), 6)
+	block := int64(binary.LittleEndian.Uint32(entry[0:4]))
+	litIdx += int64(binary.LittleEndian.Uint16(entry[4:6]))
+	if litIdx < 0 {
+		for litIdx < 0 {
+			block--
+			litIdx += int64(f.u16(d.sizeTable+2*block)) + 1
+		}
+	} else {
+		for litIdx > int64(f.u16(d.sizeTable+2*block)) {
+			litIdx -= int64(f.u16(d.sizeTable+2*block)) + 1
+			block++
+		}
+	}
+
+	blockData := f.bytes(d.data+block<<d.blockSize, 1<<d.blockSize+8)
+	code := binary.BigEndian.Uint64(blockData)
+	ptr := 8
+	bitCount := 0 // number of consumed bits not yet refilled
+	var sym int
+	for {
+		l := d.minLen
+		for code < d.base[l-d.minLen] {
+			l++
+		}
+		sym = d.offsets[l-d.minLen] + int((code-d.base[l-d.minLen])>>uint(64-l))
+		if litIdx < int64(d.symLen[sym])+1 {
+			break
+		}
+		litIdx -= int64(d.symLen[sym]) + 1
+		code <<= uint(l)
+		bitCount += l
+		if bitCount >= 32 {
+			bitCount -= 32
+			var word uint32
+			if ptr+4 <= len(blockData) {
+				word = binary.BigEndian.Uint32(blockData[ptr:])
+			}
+			ptr += 4
+			code |= uint64(word) << uint(bitCount)
+		}
+	}
+
+	for d.symLen[sym] != 0 {
+		w := d.symPat[3*sym:]
+		s1 := int(w[1]&0x0f)<<8 | int(w[0])
+		if litIdx < int64(d.symLen[s1])+1 {
+			sym = s1
+		} else {
+			litIdx -= int64(d.symLen[s1]) + 1
+			sym = int(w[2])<<4 | int(w[1])>>4
+		}
+	}
+	return int(d.symPat[3*sym])
+}
+
+// syzygyEncoding holds the piece order and index factors of one side (or file) of a table.
+type syzygyEncoding struct {
+	pieces []int
+	norm   []int
+	factor [syzygyMaxPieces]uint64
+	pairs  *syzygyPairs
+	// DTZ value maps
+	flags  int
+	mapIdx [4]int64
+}
+
+// syzygyTable is one opened .rtbw or .rtbz file.
+type syzygyTable struct {
+	file      *syzygyFile
+	closer    io.Closer
+	name      string
+	wdl       bool
+	num       int
+	symmetric bool
+	hasPawns  bool
+	pawns     [2]int
+	encType   int
+
+	// sides[side] for pawnless WDL, sides[0] for pawnless DTZ
+	sides [2]*syzygyEncoding
+	// files[file][side] for pawn tables (side 0 only for DTZ)
+	files [4][2]*syzygyEncoding
+	// DTZ tables store only one side to move
+	dtzMap int64
+}
+
+func subfactor(k, n uint64) uint64 {
+	f, l := n, uint64(1)
+	for i := uint64(1); i < k; i++ {
+		f *= n - i
+		l *= i + 1
+	}
+	return f / l
+}
+
+func (t *syzygyTable) setNormPiece(pieces []int) []int {
+	norm := make([]int, t.num)
+	switch t.encType {
+	case 0:
+		norm[0] = 3
+	case 2:
+		norm[0] = 2
+	default:
+		norm[0] = t.encType - 1
+	}
+	for i := norm[0]; i < t.num; i += norm[i] {
+		for j := i; j < t.num && pieces[j] == pieces[i]; j++ {
+			norm[i]++
+		}
+	}
+	return norm
+}
+
+func (t *syzygyTable) setNormPawn(pieces []int) []int {
+	norm := make([]int, t.num)
+	norm[0] = t.pawns[0]
+	if t.pawns[1] > 0 {
+		norm[t.pawns[0]] = t.pawns[1]
+	}
+	for i := t.pawns[0] + t.pawns[1]; i < t.num; i += norm[i] {
+		for j := i; j < t.num && pieces[j] == pieces[i]; j++ {
+			norm[i]++
+		}
+	}
+	return norm
+}
+
+func (t *syzygyTable) calcFactorsPiece(enc *syzygyEncoding, order int) uint64 {
+	pivfac := []uint64{31332, 28056, 462}
+	n := uint64(64 - enc.norm[0])
+	f := uint64(1)
+	for i, k := enc.norm[0], 0; i < t.num || k == order; k++ {
+		if k == order {
+			enc.factor[0] = f
+			f *= pivfac[t.encType]
+		} else {
+			enc.factor[i] = f
+			f *= subfactor(uint64(enc.norm[i]), n)
+			n -= uint64(enc.norm[i])
+			i += enc.norm[i]
+		}
+	}
+	return f
+}
+
+func (t *syzygyTable) calcFactorsPawn(enc *syzygyEncoding, order, order2, file int) uint64 {
+	i := enc.norm[0]
+	if order2 < 0x0f {
+		i += enc.norm[i]
+	}
+	n := uint64(64 - i)
+	f := uint64(1)
+	for k := 0; i < t.num || k == order || k == order2; k++ {
+		switch {
+		case k == order:
+			enc.factor[0] = f
+			f *= syzygyPFactor[enc.norm[0]-1][file]
+		case k == order2:
+			enc.factor[enc.norm[0]] = f
+			f *= subfactor(uint64(enc.norm[enc.norm[0]]), uint64(48-enc.norm[0]))
+		default:
+			enc.factor[i] = f
+			f *= subfactor(uint64(enc.norm[i]), n)
+			n -= uint64(enc.norm[i])
+			i += enc.norm[i]
+		}
+	}
+	return f
+}
+
+// openSyzygyTable parses the header of a table file named like "KRPvKR".
+func openSyzygyTable(path, name string, wdl bool) (*syzygyTable, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+	t, err := newSyzygyTable(&syzygyFile{r: fh, size: info.Size()}, name, wdl)
+	if err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t.closer = fh
+	return t, nil
+}
+
+func newSyzygyTable(f *syzygyFile, name string, wdl bool) (*syzygyTable, error) {
+	t := &syzygyTable{file: f, name: name, wdl: wdl}
+	parts := strings.Split(name, "v")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "K") || !strings.HasPrefix(parts[1], "K") {
+		return nil, fmt.Errorf("syzygy: bad table name %q", name)
+	}
+	t.num = len(parts[0]) + len(parts[1])
+	t.symmetric = parts[0] == parts[1]
+	whitePawns, blackPawns := strings.Count(parts[0], "P"), strings.Count(parts[1], "P")
+	t.hasPawns = whitePawns+blackPawns > 0
+	if t.hasPawns {
+		t.pawns = [2]int{whitePawns, blackPawns}
+		if blackPawns > 0 && (whitePawns == 0 || blackPawns < whitePawns) {
+			t.pawns = [2]int{blackPawns, whitePawns}
+		}
+	} else {
+		unique := 0
+		for _, side := range parts {
+			for _, c := range "KQRBN" {
+				if strings.Count(side, string(c)) == 1 {
+					unique++
+				}
+			}
+		}
+		if unique >= 3 {
+			t.encType = 0
+		} else {
+			t.encType = 2
+		}
+	}
+
+	magic := syzygyDTZMagic
+	if wdl {
+		magic = syzygyWDLMagic
+	}
+	if !equalBytes(f.bytes(0, 4), magic[:]) {
+		return nil, fmt.Errorf("syzygy: bad magic")
+	}
+	if t.hasPawns != (f.u8(4)&0x02 != 0) {
+		return nil, fmt.Errorf("syzygy: pawn flag does not match table name")
+	}
+	split := f.u8(4)&0x01 != 0
+	off := int64(5)
+
+	if wdl {
+		return t, t.setupWDL(split, off)
+	}
+	return t, t.setupDTZ(off)
+}
+
+func equalBytes(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *syzygyTable) readPieces(off int64, shift uint) []int {
+	pieces := make([]int, t.num)
+	for i := range pieces {
+		pieces[i] = (t.file.u8(off+int64(i)) >> shift) & 0x0f
+	}
+	return pieces
+}
+
+// layoutSections assigns index, size and data offsets to the sub-tables in file order.
+func layoutSections(off int64, pairs []*syzygyPairs) {
+	for _, d := range pairs {
+		d.indexTable = off
+		off += d.sizes[0]
+	}
+	for _, d := range pairs {
+		d.sizeTable = off
+		off += d.sizes[1]
+	}
+	for _, d := range pairs {
+		off = (off + 0x3f) &^ 0x3f
+		d.data = off
+		off += d.sizes[2]
+	}
+}
+
+func (t *syzygyTable) setupWDL(split bool, off int64) error {
+	f := t.file
+	sides := 1
+	if split {
+		sides = 2
+	}
+	var all []*syzygyPairs
+	if !t.hasPawns {
+		var tbSize [2]uint64
+		for side := 0; side < 2; side++ {
+			enc := &syzygyEncoding{pieces: t.readPieces(off+1, uint(4*side))}
+			enc.norm = t.setNormPiece(enc.pieces)
+			tbSize[side] = t.calcFactorsPiece(enc, (f.u8(off)>>(4*side))&0x0f)
+			t.sides[side] = enc
+		}
+		off += int64(t.num) + 1
+		off += off & 1
+		for side := 0; side < sides; side++ {
+			t.sides[side].pairs, off = setupPairs(f, off, tbSize[side], true)
+			all = append(all, t.sides[side].pairs)
+		}
+		if !split {
+			t.sides[1] = nil
+		}
+		layoutSections(off, all)
+		return nil
+	}
+
+	s := int64(1)
+	if t.pawns[1] > 0 {
+		s = 2
+	}
+	var tbSize [4][2]uint64
+	for file := 0; file < 4; file++ {
+		for side := 0; side < 2; side++ {
+			enc := &syzygyEncoding{pieces: t.readPieces(off+s, uint(4*side))}
+			enc.norm = t.setNormPawn(enc.pieces)
+			order := (f.u8(off) >> (4 * side)) & 0x0f
+			order2 := 0x0f
+			if t.pawns[1] > 0 {
+				order2 = (f.u8(off+1) >> (4 * side)) & 0x0f
+			}
+			tbSize[file][side] = t.calcFactorsPawn(enc, order, order2, file)
+			t.files[file][side] = enc
+		}
+		off += int64(t.num) + s
+	}
+	off += off & 1
+	for file := 0; file < 4; file++ {
+		for side := 0; side < sides; side++ {
+			t.files[file][side].pairs, off = setupPairs(f, off, tbSize[file][side], true)
+			all = append(all, t.files[file][side].pairs)
+		}
+		if !split {
+			t.files[file][1] = nil
+		}
+	}
+	// Sections are laid out per file, with both sides of a file adjacent
+	layoutSections(off, all)
+	return nil
+}
+
+func (t *syzygyTable) setupDTZ(off int64) error {
+	f := t.file
+	if !t.hasPawns {
+		enc := &syzygyEncoding{pieces: t.readPieces(off+1, 0)}
+		enc.norm = t.setNormPiece(enc.pieces)
+		tbSize := t.calcFactorsPiece(enc, f.u8(off)&0x0f)
+		off += int64(t.num) + 1
+		off += off & 1
+		enc.pairs, off = setupPairs(f, off, tbSize, false)
+		enc.flags = enc.pairs.flags
+		t.dtzMap = off
+		if enc.flags&2 != 0 {
+			for i := 0; i < 4; i++ {
+				enc.mapIdx[i] = off + 1 - t.dtzMap
+				off += 1 + int64(f.u8(off))
+			}
+			off += off & 1
+		}
+		t.sides[0] = enc
+		layoutSections(off, []*syzygyPairs{enc.pairs})
+		return nil
+	}
+
+	s := int64(1)
+	if t.pawns[1] > 0 {
+		s = 2
+	}
+	var tbSize [4]uint64
+	for file := 0; file < 4; file++ {
+		enc := &syzygyEncoding{pieces: t.readPieces(off+s, 0)}
+		enc.norm = t.setNormPawn(enc.pieces)
+		order := f.u8(off) & 0x0f
+		order2 := 0x0f
+		if t.pawns[1] > 0 {
+			order2 = f.u8(off+1) & 0x0f
+		}
+		tbSize[file] = t.calcFactorsPawn(enc, order, order2, file)
+		t.files[file][0] = enc
+		off += int64(t.num) + s
+	}
+	off += off & 1
+	var all []*syzygyPairs
+	for file := 0; file < 4; file++ {
+		enc := t.files[file][0]
+		enc.pairs, off = setupPairs(f, off, tbSize[file], false)
+		enc.flags = enc.pairs.flags
+		all = append(all, enc.pairs)
+	}
+	t.dtzMap = off
+	for file := 0; file < 4; file++ {
+		enc := t.files[file][0]
+		if enc.flags&2 != 0 {
+			for i := 0; i < 4; i++ {
+				enc.mapIdx[i] = off + 1 - t.dtzMap
+				off += 1 + int64(f.u8(off))
+			}
+		}
+	}
+	off += off & 1
+	layoutSections(off, all)
+	return nil
+}
+
+// encodePiece computes the index of a pawnless placement; pos is modified in place.
+func (t *syzygyTable) encodePiece(enc *syzygyEncoding, pos []int) uint64 {
+	n := t.num
+	if pos[0]&0x04 != 0 {
+		for i := 0; i < n; i++ {
+			pos[i] ^= 0x07
+		}
+	}
+	if pos[0]&0x20 != 0 {
+		for i := 0; i < n; i++ {
+			pos[i] ^= 0x38
+		}
+	}
+	offDiag := func(sq int) int { return sq>>3 - sq&7 }
+	i := 0
+	for i = 0; i < n; i++ {
+		if offDiag(pos[i]) != 0 {
+			break
+		}
+	}
+	limit := 2
+	if t.encType == 0 {
+		limit = 3
+	}
+	if i < limit && offDiag(pos[i]) > 0 {
+		for k := 0; k < n; k++ {
+			pos[k] = (pos[k]>>3 | pos[k]<<3) & 63
+		}
+	}
+
+	var idx uint64
+	if t.encType == 0 {
+		a := boolToInt(pos[1] > pos[0])
+		b := boolToInt(pos[2] > pos[0]) + boolToInt(pos[2] > pos[1])
+		switch {
+		case offDiag(pos[0]) != 0:
+			idx = uint64(syzygyTriangle[pos[0]]*63*62 + (pos[1]-a)*62 + (pos[2] - b))
+		case offDiag(pos[1]) != 0:
+			idx = uint64(6*63*62 + syzygyDiag[pos[0]]*28*62 + syzygyLower[pos[1]]*62 + pos[2] - b)
+		case offDiag(pos[2]) != 0:
+			idx = uint64(6*63*62 + 4*28*62 + syzygyDiag[pos[0]]*7*28 + (syzygyDiag[pos[1]]-a)*28 + syzygyLower[pos[2]])
+		default:
+			idx = uint64(6*63*62 + 4*28*62 + 4*7*28 + syzygyDiag[pos[0]]*7*6 + (syzygyDiag[pos[1]]-a)*6 + (syzygyDiag[pos[2]] - b))
+		}
+		i = 3
+	} else {
+		idx = uint64(syzygyKKIndex[syzygyTriangle[pos[0]]][pos[1]])
+		i = 2
+	}
+	idx *= enc.factor[0]
+	return idx + encodeRemaining(enc, pos, i, n, 0)
+}
+
+// encodeRemaining adds the combinatorial index of each group of like pieces from i onwards.
+func encodeRemaining(enc *syzygyEncoding, pos []int, i, n, squareOffset int) uint64 {
+	var idx uint64
+	for i < n {
+		t := enc.norm[i]
+		sort.Ints(pos[i : i+t])
+		var s uint64
+		for m := i; m < i+t; m++ {
+			p := pos[m]
+			j := 0
+			for l := 0; l < i; l++ {
+				j += boolToInt(p > pos[l])
+			}
+			s += syzygyBinomial[m-i][p-j-squareOffset]
+		}
+		idx += s * enc.factor[i]
+		i += t
+	}
+	return idx
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// pawnFile moves the leading pawn with the lowest flap index to pos[0] and returns its file bucket.
+func (t *syzygyTable) pawnFile(pos []int) int {
+	for i := 1; i < t.pawns[0]; i++ {
+		if syzygyFlap[pos[0]] > syzygyFlap[pos[i]] {
+			pos[0], pos[i] = pos[i], pos[0]
+		}
+	}
+	return syzygyFileToFile[pos[0]&0x07]
+}
+
+// encodePawn computes the index of a placement with pawns; pos is modified in place.
+func (t *syzygyTable) encodePawn(enc *syzygyEncoding, pos []int) uint64 {
+	n := t.num
+	if pos[0]&0x04 != 0 {
+		for i := 0; i < n; i++ {
+			pos[i] ^= 0x07
+		}
+	}
+	for i := 1; i < t.pawns[0]; i++ {
+		for j := i + 1; j < t.pawns[0]; j++ {
+			if syzygyPtwist[pos[i]] < syzygyPtwist[pos[j]] {
+				pos[i], pos[j] = pos[j], pos[i]
+			}
+		}
+	}
+	k := t.pawns[0] - 1
+	idx := syzygyPawnIdx[k][syzygyFlap[pos[0]]]
+	for i := k; i > 0; i-- {
+		idx += syzygyBinomial[k-i][syzygyPtwist[pos[i]]]
+	}
+	idx *= enc.factor[0]
+
+	i := t.pawns[0]
+	if end := i + t.pawns[1]; end > i {
+		sort.Ints(pos[i:end])
+		var s uint64
+		for m := i; m < end; m++ {
+			p := pos[m]
+			j := 0
+			for l := 0; l < i; l++ {
+				j += boolToInt(p > pos[l])
+			}
+			s += syzygyBinomial[m-i][p-j-8]
+		}
+		idx += s * enc.factor[i]
+		i = end
+	}
+	return idx + encodeRemaining(enc, pos, i, n, 0)
+}
+
+// probe reads the raw stored value for the position. For DTZ tables ok is false when the
+// table stores the other side to move.
+func (t *syzygyTable) probe(pos *Position) (value int, enc *syzygyEncoding, ok bool) {
+	mirrored := !t.symmetric && syzygyMaterial(pos, false) != t.name
+	var colorFlip, squareFlip, side int
+	switch {
+	case t.symmetric:
+		if pos.toMove == Black {
+			colorFlip, squareFlip = 8, 0x38
+		}
+	case mirrored:
+		colorFlip, squareFlip = 8, 0x38
+		side = boolToInt(pos.toMove == White)
+	default:
+		side = boolToInt(pos.toMove == Black)
+	}
+
+	squaresOf := func(code int) []int {
+		code ^= colorFlip
+		color := White
+		if code&8 != 0 {
+			color = Black
+		}
+		var squares []int
+		for i := range pos.pieces {
+			piece := &pos.pieces[i]
+			if piece.Color == color && syzygyPiece(piece.Kind, White) == code&7 {
+				squares = append(squares, int(piece.Location.FirstSet()))
+			}
+		}
+		sort.Ints(squares)
+		return squares
+	}
+
+	p := make([]int, 0, t.num)
+	if !t.hasPawns {
+		enc = t.sides[side]
+		if !t.wdl {
+			enc = t.sides[0]
+			if enc.flags&1 != side && !t.symmetric {
+				return 0, enc, false
+			}
+		}
+		if enc == nil {
+			return 0, nil, false
+		}
+		for i := 0; i < t.num; {
+			squares := squaresOf(enc.pieces[i])
+			p = append(p, squares...)
+			i += max(len(squares), 1)
+		}
+		if len(p) != t.num {
+			return 0, nil, false
+		}
+		return enc.pairs.decompress(t.file, t.encodePiece(enc, p)), enc, true
+	}
+
+	for _, sq := range squaresOf(t.files[0][0].pieces[0]) {
+		p = append(p, sq^squareFlip)
+	}
+	file := t.pawnFile(p)
+	enc = t.files[file][side]
+	if !t.wdl {
+		enc = t.files[file][0]
+		if enc.flags&1 != side {
+			return 0, enc, false
+		}
+	}
+	if enc == nil {
+		return 0, nil, false
+	}
+	for i := len(p); i < t.num; {
+		squares := squaresOf(enc.pieces[i])
+		for _, sq := range squares {
+			p = append(p, sq^squareFlip)
+		}
+		i += max(len(squares), 1)
+	}
+	if len(p) != t.num {
+		return 0, nil, false
+	}
+	return enc.pairs.decompress(t.file, t.encodePawn(enc, p)), enc, true
+}
+
+// SyzygyTablebase probes Syzygy tables found in one or more directories.
+type SyzygyTablebase struct {
+	mu        sync.Mutex
+	paths     map[string]string // table file name -> path
+	tables    map[string]*syzygyTable
+	MaxPieces int // largest piece count with a WDL table available
+}
+
+// OpenSyzygy indexes the table files in the given directories (separated by the OS path list
+// separator, as in the SyzygyPath UCI option). Unreadable directories are reported; tables
+// themselves are only opened when first probed.
+func OpenSyzygy(path string) (*SyzygyTablebase, error) {
+	tb := &SyzygyTablebase{paths: map[string]string{}, tables: map[string]*syzygyTable{}}
+	var errs []error
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			ext := filepath.Ext(name)
+			if ext != syzygyWDLSuffix && ext != syzygyDTZSuffix {
+				continue
+			}
+			if _, seen := tb.paths[name]; !seen {
+				tb.paths[name] = filepath.Join(dir, name)
+			}
+			if ext == syzygyWDLSuffix {
+				tb.MaxPieces = max(tb.MaxPieces, len(strings.TrimSuffix(name, ext))-1)
+			}
+		}
+	}
+	return tb, errors.Join(errs...)
+}
+
+// Close releases all opened table files.
+func (tb *SyzygyTablebase) Close() error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	var errs []error
+	for name, t := range tb.tables {
+		if t != nil && t.closer != nil {
+			errs = append(errs, t.closer.Close())
+		}
+		delete(tb.tables, name)
+	}
+	return errors.Join(errs...)
+}
+
+// table returns the opened table for the position's material, or nil with an error.
+func (tb *SyzygyTablebase) table(pos *Position, wdl bool) (*syzygyTable, error) {
+	suffix := syzygyDTZSuffix
+	if wdl {
+		suffix = syzygyWDLSuffix
+	}
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	for _, name := range []string{syzygyMaterial(pos, false), syzygyMaterial(pos, true)} {
+		file := name + suffix
+		if t, ok := tb.tables[file]; ok {
+			if t == nil {
+				return nil, ErrSyzygyMissing
+			}
+			return t, nil
+		}
+		path, ok := tb.paths[file]
+		if !ok {
+			continue
+		}
+		t, err := openSyzygyTable(path, name, wdl)
+		if err != nil {
+			// Remember broken files so they are not reopened on every probe
+			tb.tables[file] = nil
+			return nil, err
+		}
+		tb.tables[file] = t
+		return t, nil
+	}
+	return nil, ErrSyzygyMissing
+}
+
+// supports reports whether the position can be probed at all.
+func (tb *SyzygyTablebase) supports(pos *Position) bool {
+	if tb == nil || pos.variant != Standard || pos.castling != 0 {
+		return false
+	}
+	n := len(pos.pieces)
+	return n <= tb.MaxPieces && n <= syzygyMaxPieces
+}
+
+// Pieces returns the number of pieces on the board, the quantity tablebases are limited by.
+func (p *Position) Pieces() int {
+	return len(p.pieces)
+}
+
+func (tb *SyzygyTablebase) probeWDLTable(pos *Position) (WDL, error) {
+	if pos.Pieces() == 2 {
+		return WDLDraw, nil
+	}
+	t, err := tb.table(pos, true)
+	if err != nil {
+		return WDLDraw, err
+	}
+	v, _, ok := t.probe(pos)
+	if !ok {
+		return WDLDraw, fmt.Errorf("syzygy: %s does not cover this side to move", t.name)
+	}
+	return WDL(v - 2), nil
+}
+
+func isZeroingMove(move GeneratedMove) bool {
+	return move.IsCapture || move.Kind == Pawn
+}
+
+// probeAB resolves captures with a small alpha-beta search before trusting the table, whose
+// values are only defined when the best move is not a capture. It reports whether the result
+// comes from a capture that is the best move.
+func (tb *SyzygyTablebase) probeAB(pos *Position, alpha, beta WDL) (WDL, bool, error) {
+	for _, ap := range generateLegalMoves(pos) {
+		if !ap.Move.IsCapture || isEnPassantMove(pos, ap.Move) {
+			continue
+		}
+		v, _, err := tb.probeAB(ap.Position, -beta, -alpha)
+		if err != nil {
+			return WDLDraw, false, err
+		}
+		v = -v
+		if v > alpha {
+			if v >= beta {
+				return v, true, nil
+			}
+			alpha = v
+		}
+	}
+	v, err := tb.probeWDLTable(pos)
+	if err != nil {
+		return WDLDraw, false, err
+	}
+	if alpha >= v {
+		return alpha, alpha > 0, nil
+	}
+	return v, false, nil
+}
+
+func isEnPassantMove(pos *Position, move GeneratedMove) bool {
+	if move.Kind != Pawn || pos.enpassant.IsEmpty() {
+		return false
+	}
+	return squareFromIndex(pos.enpassant.FirstSet()) == move.To
+}
+
+// ProbeWDL returns the win/draw/loss value of the position for the side to move, taking
+// en passant and the fifty-move rule distinction (cursed wins, blessed losses) into account.
+func (tb *SyzygyTablebase) ProbeWDL(pos *Position) (WDL, error) {
+	v, _, err := tb.probeWDL(pos)
+	return v, err
+}
+
+func (tb *SyzygyTablebase) probeWDL(pos *Position) (WDL, bool, error) {
+	if !tb.supports(pos) {
+		return WDLDraw, false, ErrSyzygyUnsupported
+	}
+	v, captureBest, err := tb.probeAB(pos, WDLLoss, WDLWin)
+	if err != nil || pos.enpassant.IsEmpty() {
+		return v, captureBest, err
+	}
+
+	// En passant captures are not covered by the tables
+	best := WDL(-3)
+	hasOther := false
+	for _, ap := range generateLegalMoves(pos) {
+		if !isEnPassantMove(pos, ap.Move) {
+			hasOther = true
+			continue
+		}
+		v0, _, err := tb.probeAB(ap.Position, WDLLoss, WDLWin)
+		if err != nil {
+			return WDLDraw, false, err
+		}
+		if -v0 > best {
+			best = -v0
+		}
+	}
+	if best > -3 {
+		if best >= v {
+			return best, true, nil
+		}
+		if v == WDLDraw && !hasOther {
+			return best, true, nil
+		}
+	}
+	return v, captureBest, nil
+}
+
+var (
+	wdlToDTZ  = map[WDL]int{WDLLoss: -1, WDLBlessedLoss: -101, WDLDraw: 0, WDLCursedWin: 101, WDLWin: 1}
+	wdlToMap  = map[WDL]int{WDLLoss: 1, WDLBlessedLoss: 3, WDLDraw: 0, WDLCursedWin: 2, WDLWin: 0}
+	wdlPAFlag = map[WDL]int{WDLLoss: 8, WDLBlessedLoss: 0, WDLDraw: 0, WDLCursedWin: 0, WDLWin: 4}
+)
+
+// probeDTZTable reads the DTZ table; ok is false when the table stores the other side to move.
+func (tb *SyzygyTablebase) probeDTZTable(pos *Position, wdl WDL) (int, bool, error) {
+	t, err := tb.table(pos, false)
+	if err != nil {
+		return 0, false, err
+	}
+	res, enc, ok := t.probe(pos)
+	if !ok {
+		return 0, false, nil
+	}
+	if enc.flags&2 != 0 {
+		res = t.file.u8(t.dtzMap + enc.mapIdx[wdlToMap[wdl]] + int64(res))
+	}
+	if enc.flags&wdlPAFlag[wdl] == 0 || wdl&1 != 0 {
+		res *= 2
+	}
+	return res, true, nil
+}
+
+// ProbeDTZ returns the distance to zeroing (plies until a capture or pawn move under optimal play,
+// positive when winning, negative when losing, 0 for draws). Values beyond ±100 are cursed wins
+// or blessed losses.
+func (tb *SyzygyTablebase) ProbeDTZ(pos *Position) (int, error) {
+	wdl, captureBest, err := tb.probeWDL(pos)
+	if err != nil {
+		return 0, err
+	}
+	if wdl == WDLDraw {
+		return 0, nil
+	}
+	if captureBest {
+		return wdlToDTZ[wdl], nil
+	}
+
+	legal := generateLegalMoves(pos)
+	if wdl > 0 {
+		// A winning pawn move zeroes the counter immediately
+		for _, ap := range legal {
+			if ap.Move.Kind != Pawn || ap.Move.IsCapture {
+				continue
+			}
+			v, err := tb.ProbeWDL(ap.Position)
+			if err != nil {
+				return 0, err
+			}
+			if -v == wdl {
+				return wdlToDTZ[wdl], nil
+			}
+		}
+	}
+
+	dtz, ok, err := tb.probeDTZTable(pos, wdl)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		if wdl > 0 {
+			return wdlToDTZ[wdl] + dtz, nil
+		}
+		return wdlToDTZ[wdl] - dtz, nil
+	}
+
+	// The table stores the other side to move: search one ply
+	best := wdlToDTZ[wdl]
+	if wdl > 0 {
+		best = int(^uint(0) >> 1)
+	}
+	for _, ap := range legal {
+		if isZeroingMove(ap.Move) {
+			continue
+		}
+		v, err := tb.ProbeDTZ(ap.Position)
+		if err != nil {
+			return 0, err
+		}
+		v = -v
+		if wdl > 0 {
+			if v > 0 && v+1 < best {
+				best = v + 1
+			}
+		} else if v-1 < best {
+			best = v - 1
+		}
+	}
+	return best, nil
+}
+
+// SyzygyRootMove is a legal root move ranked by tablebase results.
+type SyzygyRootMove struct {
+	AppliedMove
+	WDL WDL // result for the side making the move
+	DTZ int // distance to zeroing after the move, from the mover's point of view
+}
+
+// RootMoves ranks the legal moves by WDL and then DTZ: the fastest conversion when winning,
+// the slowest when losing. It fails if any child position cannot be probed.
+func (tb *SyzygyTablebase) RootMoves(pos *Position) ([]SyzygyRootMove, error) {
+	if !tb.supports(pos) {
+		return nil, ErrSyzygyUnsupported
+	}
+	var moves []SyzygyRootMove
+	for _, ap := range generateLegalMoves(pos) {
+		rm := SyzygyRootMove{AppliedMove: ap}
+		if next := generateLegalMoves(ap.Position); len(next) == 0 && ap.Position.IsKingInCheck(ap.Position.toMove) {
+			// Checkmate is the fastest possible win
+			rm.WDL, rm.DTZ = WDLWin, 1
+			moves = append(moves, rm)
+			continue
+		}
+		wdl, err := tb.ProbeWDL(ap.Position)
+		if err != nil {
+			return nil, err
+		}
+		rm.WDL = -wdl
+		if rm.WDL != WDLDraw {
+			dtz, err := tb.ProbeDTZ(ap.Position)
+			if err != nil {
+				return nil, err
+			}
+			if isZeroingMove(ap.Move) {
+				dtz = 0
+			}
+			rm.DTZ = -dtz
+		}
+		moves = append(moves, rm)
+	}
+	rank := func(rm SyzygyRootMove) int {
+		abs := rm.DTZ
+		if abs < 0 {
+			abs = -abs
+		}
+		switch {
+		case rm.WDL > 0:
+			return int(rm.WDL)*1000 - abs
+		case rm.WDL < 0:
+			return int(rm.WDL)*1000 + abs
+		}
+		return 0
+	}
+	sort.SliceStable(moves, func(i, j int) bool { return rank(moves[i]) > rank(moves[j]) })
+	return moves, nil
+}
+
+// runProbe implements "probe [-syzygy DIR] <fen>", printing tablebase results for a position.
+func runProbe(args []string, out io.Writer) error {
+	flags := commandFlags("probe", out)
+	path := flags.String("syzygy", os.Getenv("SYZYGY_PATH"), "directories holding Syzygy tables")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("usage: probe [-syzygy DIR] <fen>")
+	}
+	pos, err := ParseFEN(strings.Join(flags.Args(), " "))
+	if err != nil {
+		return err
+	}
+	tb, err := OpenSyzygy(*path)
+	if err != nil {
+		fmt.Fprintf(out, "warning: %v\n", err)
+	}
+	defer tb.Close()
+
+	wdl, err := tb.ProbeWDL(pos)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "WDL: %s\n", wdl)
+	dtz, err := tb.ProbeDTZ(pos)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "DTZ: %d\n", dtz)
+	if moves, err := tb.RootMoves(pos); err == nil && len(moves) > 0 {
+		fmt.Fprintf(out, "Best move: %s\n", moves[0].Move.UCINotation())
+	}
+	return nil
+}
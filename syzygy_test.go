@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// No real Syzygy files are vendored, so these tests write small tables in the Syzygy layout:
+// KRvK with WDL values taken from the KRK bitbase, compressed with a canonical Huffman code
+// of mixed lengths, split into blocks and addressed through the index and size tables.
+
+// syzygyTestPieces is the piece order used for both sides of the generated KRvK tables.
+var syzygyTestPieces = []int{6, 4, 14} // white king, white rook, black king
+
+func syzygyTestEncoding(t *testing.T) (*syzygyTable, *syzygyEncoding, uint64) {
+	t.Helper()
+	table := &syzygyTable{num: 3, encType: 0}
+	enc := &syzygyEncoding{pieces: syzygyTestPieces}
+	enc.norm = table.setNormPiece(enc.pieces)
+	return table, enc, table.calcFactorsPiece(enc, 0)
+}
+
+// writeTestPairs appends a pairs header for values to header and returns the index, size and
+// data sections to be laid out after all headers.
+func writeTestPairs(header *bytes.Buffer, values []int, blockSize, idxBits uint, flags byte) (index, sizes, data []byte) {
+	// Symbols are the distinct values; longer codes take the lower symbol numbers
+	var symbols []int
+	seen := map[int]int{}
+	for _, v := range values {
+		if _, ok := seen[v]; !ok {
+			seen[v] = len(symbols)
+			symbols = append(symbols, v)
+		}
+	}
+	for len(symbols) < 3 {
+		symbols = append(symbols, 0xff)
+	}
+	n := len(symbols)
+	longLen := bits.Len(uint(n - 1))
+	short := (1 << longLen) - n // codes of length longLen-1
+	minLen := longLen
+	if short > 0 {
+		minLen = longLen - 1
+	}
+	codeLen := func(sym int) int {
+		if sym < n-short {
+			return longLen
+		}
+		return longLen - 1
+	}
+	code := func(sym int) uint64 {
+		if sym < n-short {
+			return uint64(sym)
+		}
+		return uint64((n-short)/2 + sym - (n - short))
+	}
+
+	// Bit-pack the values into blocks, starting a new block when the next code would not fit
+	blockBits := 8 << blockSize
+	var blocks [][]byte
+	var counts []int
+	var cur []byte
+	used, count := 0, 0
+	var blockStart []int
+	flush := func() {
+		buf := make([]byte, 1<<blockSize)
+		copy(buf, cur)
+		blocks = append(blocks, buf)
+		counts = append(counts, count)
+		cur, used, count = nil, 0, 0
+	}
+	for i, v := range values {
+		sym := seen[v]
+		l := codeLen(sym)
+		if used+l > blockBits {
+			flush()
+		}
+		if count == 0 {
+			blockStart = append(blockStart, i)
+		}
+		c := code(sym)
+		for b := l - 1; b >= 0; b-- {
+			if used%8 == 0 {
+				cur = append(cur, 0)
+			}
+			if c>>uint(b)&1 == 1 {
+				cur[used/8] |= 0x80 >> uint(used%8)
+			}
+			used++
+		}
+		count++
+	}
+	flush()
+
+	h := longLen - minLen + 1
+	header.WriteByte(flags)
+	header.WriteByte(byte(blockSize))
+	header.WriteByte(byte(idxBits))
+	header.WriteByte(0)
+	binary.Write(header, binary.LittleEndian, uint32(len(blocks)))
+	header.WriteByte(byte(longLen))
+	header.WriteByte(byte(minLen))
+	offsets := []uint16{uint16(n - short), 0}
+	if h == 1 {
+		offsets = []uint16{0}
+	}
+	binary.Write(header, binary.LittleEndian, offsets)
+	binary.Write(header, binary.LittleEndian, uint16(n))
+	for _, v := range symbols {
+		header.Write([]byte{byte(v), 0xf0, 0xff})
+	}
+	if n&1 == 1 {
+		header.WriteByte(0)
+	}
+
+	blockOf := func(i int) int {
+		b := 0
+		for b+1 < len(blockStart) && blockStart[b+1] <= i {
+			b++
+		}
+		return b
+	}
+	numIndices := (len(values) + (1 << idxBits) - 1) >> idxBits
+	for m := 0; m < numIndices; m++ {
+		mid := m<<idxBits + 1<<(idxBits-1)
+		b := blockOf(min(mid, len(values)-1))
+		index = binary.LittleEndian.AppendUint32(index, uint32(b))
+		index = binary.LittleEndian.AppendUint16(index, uint16(mid-blockStart[b]))
+	}
+	for _, c := range counts {
+		sizes = binary.LittleEndian.AppendUint16(sizes, uint16(c-1))
+	}
+	for _, block := range blocks {
+		data = append(data, block...)
+	}
+	return index, sizes, data
+}
+
+// assembleTestTable lays out headers and sections the way setupWDL/setupDTZ read them.
+func assembleTestTable(magic [4]byte, pieceHeader []byte, pairs func(header *bytes.Buffer) [][3][]byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(magic[:])
+	buf.WriteByte(0x01) // split, no pawns
+	buf.Write(pieceHeader)
+	if buf.Len()&1 == 1 {
+		buf.WriteByte(0)
+	}
+	sections := pairs(&buf)
+	for part := 0; part < 3; part++ {
+		for _, s := range sections {
+			if part == 2 {
+				for buf.Len()&0x3f != 0 {
+					buf.WriteByte(0)
+				}
+			}
+			buf.Write(s[part])
+		}
+	}
+	return buf.Bytes()
+}
+
+func syzygyTestPieceHeader() []byte {
+	header := []byte{0x00}
+	for _, p := range syzygyTestPieces {
+		header = append(header, byte(p|p<<4))
+	}
+	return header
+}
+
+// krkTestValues fills the table index space of one side to move with raw WDL values (v+2).
+func krkTestValues(t *testing.T, whiteToMove bool) []int {
+	table, enc, size := syzygyTestEncoding(t)
+	values := make([]int, size)
+	for i := range values {
+		values[i] = 2
+	}
+	for wk := 0; wk < 64; wk++ {
+		for wr := 0; wr < 64; wr++ {
+			for bk := 0; bk < 64; bk++ {
+				if wk == wr || wk == bk || wr == bk || KingMoves[wk].IsSet(uint64(bk)) {
+					continue
+				}
+				pos := NewPosition()
+				pos.SetPiece(wk%8, wk/8, King, White)
+				pos.SetPiece(wr%8, wr/8, Rook, White)
+				pos.SetPiece(bk%8, bk/8, King, Black)
+				if !whiteToMove {
+					pos.SetToMove(Black)
+				}
+				if pos.IsKingInCheck(pos.toMove.Opponent()) {
+					continue
+				}
+				wdl, ok := EndgameProbe(pos)
+				if !ok {
+					t.Fatalf("bitbase probe failed for %s", pos.FEN())
+				}
+				values[table.encodePiece(enc, []int{wk, wr, bk})] = int(wdl) + 2
+			}
+		}
+	}
+	return values
+}
+
+func writeKRvKTables(t *testing.T, dir string) {
+	t.Helper()
+	registerTestBitbases(t, "KRK")
+	white, black := krkTestValues(t, true), krkTestValues(t, false)
+
+	wdl := assembleTestTable(syzygyWDLMagic, syzygyTestPieceHeader(), func(header *bytes.Buffer) [][3][]byte {
+		var sections [][3][]byte
+		for _, values := range [][]int{white, black} {
+			index, sizes, data := writeTestPairs(header, values, 6, 9, 0)
+			sections = append(sections, [3][]byte{index, sizes, data})
+		}
+		return sections
+	})
+
+	// DTZ stores white to move only, with synthetic distances for the won positions
+	dtzValues := make([]int, len(white))
+	for i, v := range white {
+		if v == 4 {
+			dtzValues[i] = 1 + i%30
+		}
+	}
+	dtz := assembleTestTable(syzygyDTZMagic, syzygyTestPieceHeader()[:len(syzygyTestPieces)+1], func(header *bytes.Buffer) [][3][]byte {
+		// flags: white to move stored (bit 0 clear), distances stored in plies for wins (4)
+		index, sizes, data := writeTestPairs(header, dtzValues, 5, 8, 0x04)
+		return [][3][]byte{{index, sizes, data}}
+	})
+	// The DTZ header has no split flag
+	dtz[4] = 0
+
+	for name, content := range map[string][]byte{"KRvK.rtbw": wdl, "KRvK.rtbz": dtz} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func TestSyzygyIndexTables(t *testing.T) {
+	maxIdx := -1
+	for idx := 0; idx < 10; idx++ {
+		for sq := 0; sq < 64; sq++ {
+			maxIdx = max(maxIdx, syzygyKKIndex[idx][sq])
+		}
+	}
+	if maxIdx != 461 {
+		t.Fatalf("expected 462 king-king placements, got %d", maxIdx+1)
+	}
+	// b1 king: the first row starts after the six squares next to it
+	if syzygyKKIndex[0][3] != 0 || syzygyKKIndex[0][2] != -1 {
+		t.Fatalf("unexpected KK index for b1: %v", syzygyKKIndex[0][:8])
+	}
+	if syzygyPFactor[0][0] != 6 || syzygyBinomial[1][5] != 10 {
+		t.Fatalf("unexpected pawn factors %v / binomials %v", syzygyPFactor[0], syzygyBinomial[1][5])
+	}
+}
+
+func TestSyzygyProbeWDL_MatchesBitbase(t *testing.T) {
+	dir := t.TempDir()
+	writeKRvKTables(t, dir)
+	tb, err := OpenSyzygy(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer tb.Close()
+	if tb.MaxPieces != 3 {
+		t.Fatalf("expected 3-piece tables, got %d", tb.MaxPieces)
+	}
+
+	rng := rand.New(rand.NewSource(30))
+	checked := 0
+	for checked < 400 {
+		squares := rng.Perm(64)[:3]
+		strong, weak := White, Black
+		if checked%2 == 1 {
+			// Mirrored material: black has the rook
+			strong, weak = Black, White
+		}
+		pos := NewPosition()
+		pos.SetPiece(squares[0]%8, squares[0]/8, King, strong)
+		pos.SetPiece(squares[1]%8, squares[1]/8, Rook, strong)
+		pos.SetPiece(squares[2]%8, squares[2]/8, King, weak)
+		if rng.Intn(2) == 0 {
+			pos.SetToMove(Black)
+		}
+		if KingMoves[uint64(squares[0])].IsSet(uint64(squares[2])) || pos.IsKingInCheck(pos.toMove.Opponent()) {
+			continue
+		}
+		want, _ := EndgameProbe(pos)
+		got, err := tb.ProbeWDL(pos)
+		if err != nil {
+			t.Fatalf("%s: probe: %v", pos.FEN(), err)
+		}
+		if got != want {
+			t.Fatalf("%s: got %s, want %s", pos.FEN(), got, want)
+		}
+		checked++
+	}
+}
+
+func TestSyzygyProbeDTZ(t *testing.T) {
+	dir := t.TempDir()
+	writeKRvKTables(t, dir)
+	tb, err := OpenSyzygy(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer tb.Close()
+
+	// White to move is stored: the table value plus one
+	won, _ := ParseFEN("8/8/8/3k4/8/8/8/KR6 w - - 0 1")
+	dtz, err := tb.ProbeDTZ(won)
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	table, enc, _ := syzygyTestEncoding(t)
+	idx := table.encodePiece(enc, []int{0, 1, 35})
+	if want := 2 + int(idx%30); dtz != want {
+		t.Fatalf("expected dtz %d, got %d", want, dtz)
+	}
+
+	// Black to move is not stored and is resolved by a one-ply search
+	lost, _ := ParseFEN("8/8/8/3k4/8/8/8/KR6 b - - 0 1")
+	dtz, err = tb.ProbeDTZ(lost)
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	worst := 0
+	for _, ap := range generateLegalMoves(lost) {
+		child, err := tb.ProbeDTZ(ap.Position)
+		if err != nil {
+			t.Fatalf("probe child: %v", err)
+		}
+		worst = max(worst, child)
+	}
+	if dtz != -worst-1 {
+		t.Fatalf("expected dtz %d, got %d", -worst-1, dtz)
+	}
+
+	drawn, _ := ParseFEN("7K/8/8/8/8/8/1k6/1R6 b - - 0 1")
+	if dtz, err := tb.ProbeDTZ(drawn); err != nil || dtz != 0 {
+		t.Fatalf("expected hanging rook to be a draw, got %d, %v", dtz, err)
+	}
+}
+
+func TestSyzygyMissingTables(t *testing.T) {
+	dir := t.TempDir()
+	writeKRvKTables(t, dir)
+	tb, err := OpenSyzygy(dir + string(os.PathListSeparator) + filepath.Join(dir, "does-not-exist"))
+	if err == nil {
+		t.Fatalf("expected an error for the missing directory")
+	}
+	defer tb.Close()
+
+	queen, _ := ParseFEN("8/8/8/3k4/8/8/8/KQ6 w - - 0 1")
+	if _, err := tb.ProbeWDL(queen); !errors.Is(err, ErrSyzygyMissing) {
+		t.Fatalf("expected missing table error, got %v", err)
+	}
+	many, _ := ParseFEN("8/8/8/3k4/8/8/8/KQR5 w - - 0 1")
+	if _, err := tb.ProbeWDL(many); !errors.Is(err, ErrSyzygyUnsupported) {
+		t.Fatalf("expected unsupported error for 4 pieces, got %v", err)
+	}
+	castling, _ := ParseFEN("4k3/8/8/8/8/8/8/4K2R w K - 0 1")
+	if _, err := tb.ProbeWDL(castling); !errors.Is(err, ErrSyzygyUnsupported) {
+		t.Fatalf("expected unsupported error with castling rights, got %v", err)
+	}
+
+	// A corrupt file is reported, not trusted
+	if err := os.WriteFile(filepath.Join(dir, "KQvK.rtbw"), []byte("not a table"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	tb2, _ := OpenSyzygy(dir)
+	defer tb2.Close()
+	if _, err := tb2.ProbeWDL(queen); err == nil || !strings.Contains(err.Error(), "magic") {
+		t.Fatalf("expected bad magic error, got %v", err)
+	}
+}
+
+func TestSyzygySearchAndUCI(t *testing.T) {
+	dir := t.TempDir()
+	writeKRvKTables(t, dir)
+	tb, err := OpenSyzygy(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer tb.Close()
+
+	// At the root the tablebase picks a move that keeps the win
+	pos, _ := ParseFEN("8/8/8/8/8/2k5/8/KR6 w - - 0 1")
+	best, ok := Dumbfish{Tablebase: tb}.SelectMove(pos)
+	if !ok {
+		t.Fatalf("expected a move")
+	}
+	if wdl, err := tb.ProbeWDL(best.Position); err != nil || wdl != WDLLoss {
+		t.Fatalf("expected %s to keep the win, got %s, %v", best.Move.UCINotation(), wdl, err)
+	}
+
+	var out bytes.Buffer
+	in := strings.NewReader(strings.Join([]string{
+		"uci",
+		"setoption name SyzygyPath value " + dir,
+		"position fen 8/8/8/8/8/2k5/8/KR6 w - - 0 1",
+		"go depth 1",
+		"quit",
+	}, "\n"))
+	if err := RunUCI(in, &out); err != nil {
+		t.Fatalf("uci: %v", err)
+	}
+	if !strings.Contains(out.String(), "option name SyzygyPath") || !strings.Contains(out.String(), "bestmove "+best.Move.UCINotation()) {
+		t.Fatalf("unexpected uci output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runProbe([]string{"-syzygy", dir, "8/8/8/8/8/2k5/8/KR6", "w", "-", "-", "0", "1"}, &out); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if !strings.Contains(out.String(), "WDL: win") {
+		t.Fatalf("unexpected probe output:\n%s", out.String())
+	}
+}
+
+// syzygyRealTables is where TestSyzygyRealTables looks for the published KRvK and KQvK
+// tables, which the other tests cannot stand in for: their tables come from the test's own
+// encoder, which shares the reader's idea of the format.
+const syzygyRealTables = "testdata/syzygy"
+
+// TestSyzygyRealTables probes the published 3-piece tables on positions with known values,
+// and checks a sample of KRvK and KQvK positions against the bitbases.
+func TestSyzygyRealTables(t *testing.T) {
+	for _, name := range []string{"KRvK.rtbw", "KRvK.rtbz", "KQvK.rtbw", "KQvK.rtbz"} {
+		if _, err := os.Stat(filepath.Join(syzygyRealTables, name)); err != nil {
+			t.Skipf("%s/%s not found; copy the 3-piece Syzygy tables there to run this test", syzygyRealTables, name)
+		}
+	}
+	tb, err := OpenSyzygy(syzygyRealTables)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer tb.Close()
+
+	for _, c := range []struct {
+		fen string
+		wdl WDL
+		dtz int
+	}{
+		{"8/8/8/3k4/8/8/8/KR6 w - - 0 1", WDLWin, 0},
+		{"8/8/8/8/8/8/8/KQ5k w - - 0 1", WDLWin, 0},
+		{"k7/8/1K6/8/8/8/8/7R w - - 0 1", WDLWin, 1},   // Rh8#
+		{"k7/8/1K6/8/8/8/8/7Q w - - 0 1", WDLWin, 1},   // Qh8#
+		{"8/8/8/3k4/8/8/8/KR6 b - - 0 1", WDLLoss, 0},  // Black cannot reach the rook
+		{"8/8/8/8/8/8/2kR4/K7 b - - 0 1", WDLDraw, 0},  // Kxd2
+		{"k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", WDLDraw, 0}, // stalemate
+		{"K7/8/8/8/8/8/8/5rk1 w - - 0 1", WDLLoss, 0},  // colours reversed
+	} {
+		pos, err := ParseFEN(c.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wdl, err := tb.ProbeWDL(pos); err != nil || wdl != c.wdl {
+			t.Errorf("%s: WDL %s, %v; want %s", c.fen, wdl, err, c.wdl)
+		}
+		dtz, err := tb.ProbeDTZ(pos)
+		switch {
+		case err != nil:
+			t.Errorf("%s: DTZ: %v", c.fen, err)
+		case c.dtz != 0 && dtz != c.dtz, c.wdl == WDLDraw && dtz != 0, c.wdl == WDLWin && dtz <= 0, c.wdl == WDLLoss && dtz >= 0:
+			t.Errorf("%s: DTZ %d for a %s", c.fen, dtz, c.wdl)
+		}
+	}
+
+	checked := 0
+	for _, strong := range []PieceKind{Rook, Queen} {
+		for squares := 0; squares < 64*64*64; squares += 7 {
+			strongKing, piece, weakKing := squares/4096, squares/64%64, squares%64
+			if strongKing == piece || strongKing == weakKing || piece == weakKing || KingMoves[uint64(strongKing)].IsSet(uint64(weakKing)) {
+				continue
+			}
+			for _, toMove := range []Color{White, Black} {
+				pos := NewPosition()
+				pos.SetPiece(strongKing%8, strongKing/8, King, White)
+				pos.SetPiece(piece%8, piece/8, strong, White)
+				pos.SetPiece(weakKing%8, weakKing/8, King, Black)
+				pos.SetToMove(toMove)
+				if pos.IsKingInCheck(toMove.Opponent()) {
+					continue
+				}
+				want, _ := EndgameProbe(pos)
+				if got, err := tb.ProbeWDL(pos); err != nil || got != want {
+					t.Fatalf("%s: WDL %s, %v; bitbase %s", pos.FEN(), got, err, want)
+				}
+				checked++
+			}
+		}
+	}
+	t.Logf("checked %d positions against the bitbases", checked)
+}
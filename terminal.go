@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+// BoardStyle is how a board is drawn in a terminal.
+type BoardStyle int
+
+const (
+	ASCIIBoard   BoardStyle = iota // FEN letters; last-move squares in [brackets], a checked king in (parentheses)
+	UnicodeBoard                   // chess glyphs, marked like ASCIIBoard, for terminals without colour
+	ColorBoard                     // chess glyphs on ANSI-coloured squares, with highlighted squares
+)
+
+// ParseBoardStyle reads a style name: "ascii", "unicode", "color", or "auto" to pick the
+// richest style that out shows correctly.
+func ParseBoardStyle(s string, out io.Writer) (BoardStyle, error) {
+	switch strings.ToLower(s) {
+	case "auto", "":
+		return detectBoardStyle(out), nil
+	case "ascii":
+		return ASCIIBoard, nil
+	case "unicode":
+		return UnicodeBoard, nil
+	case "color", "colour":
+		return ColorBoard, nil
+	}
+	return ASCIIBoard, fmt.Errorf("unknown board style %q (want auto, color, unicode or ascii)", s)
+}
+
+// detectBoardStyle chooses ColorBoard for a terminal, UnicodeBoard for one where NO_COLOR
+// is set, and ASCIIBoard when out is not a terminal or TERM is unset or "dumb".
+func detectBoardStyle(out io.Writer) BoardStyle {
+	if !isTerminal(out) {
+		return ASCIIBoard
+	}
+	if term := os.Getenv("TERM"); term == "" || term == "dumb" {
+		return ASCIIBoard
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return UnicodeBoard
+	}
+	return ColorBoard
+}
+
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// clearScreen clears out when it is a terminal.
+func clearScreen(out io.Writer) {
+	if isTerminal(out) {
+		fmt.Fprint(out, "\033[2J\033[H")
+	}
+}
+
+// ANSI escapes of ColorBoard: 256-colour square backgrounds and piece foregrounds.
+const (
+	ansiReset      = "\033[0m"
+	ansiLight      = "\033[48;5;223m"
+	ansiDark       = "\033[48;5;137m"
+	ansiLastLight  = "\033[48;5;186m"
+	ansiLastDark   = "\033[48;5;143m"
+	ansiCheck      = "\033[48;5;160m"
+	ansiWhitePiece = "\033[1;38;5;231m"
+	ansiBlackPiece = "\033[1;38;5;16m"
+)
+
+// pieceGlyphs are the chess symbols of each PieceKind, White's outlined and Black's solid.
+var pieceGlyphs = [2]map[PieceKind]string{
+	White: {King: "♔", Queen: "♕", Rook: "♖", Bishop: "♗", Knight: "♘", Pawn: "♙"},
+	Black: {King: "♚", Queen: "♛", Rook: "♜", Bishop: "♝", Knight: "♞", Pawn: "♟"},
+}
+
+// pieceSymbol returns how style draws a piece. On coloured squares both sides use the solid
+// glyphs, told apart by their colour, since outlines are hard to see on a dark background.
+func pieceSymbol(kind PieceKind, color Color, style BoardStyle) string {
+	switch style {
+	case ColorBoard:
+		return pieceGlyphs[Black][kind]
+	case UnicodeBoard:
+		return pieceGlyphs[color][kind]
+	}
+	return pieceKindToFEN(kind, color)
+}
+
+// BoardView is a position as a player sees it: from their side of the board, with the last
+// move marked and a panel of game information beside it.
+type BoardView struct {
+	Style    BoardStyle
+	Flip     bool           // Black at the bottom
+	LastMove *GeneratedMove // marked on the board, if not nil
+	Panel    []string       // lines shown to the right of the board, from its top
+}
+
+// Render draws pos with rank and file labels. The king of the side to move is marked when
+// in check.
+func (v BoardView) Render(pos *Position) string {
+	marked := map[string]bool{}
+	if v.LastMove != nil {
+		marked[v.LastMove.To] = true
+		if !v.LastMove.IsDrop {
+			marked[v.LastMove.From] = true
+		}
+	}
+	checked := ""
+	if pos.IsKingInCheck(pos.toMove) {
+		if squares := pos.kingBitboard(pos.toMove).ToSquares(); len(squares) > 0 {
+			checked = squares[0]
+		}
+	}
+
+	var lines []string
+	for row := 0; row < 8; row++ {
+		rank := 7 - row
+		if v.Flip {
+			rank = row
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%d ", rank+1)
+		for col := 0; col < 8; col++ {
+			file := col
+			if v.Flip {
+				file = 7 - col
+			}
+			square := string(rune('a'+file)) + string(rune('1'+rank))
+			sb.WriteString(v.cell(pos.GetPiece(file, rank), (file+rank)%2 == 1, marked[square], square == checked))
+		}
+		if v.Style == ColorBoard {
+			sb.WriteString(ansiReset)
+		}
+		lines = append(lines, sb.String())
+	}
+	files := "abcdefgh"
+	if v.Flip {
+		files = "hgfedcba"
+	}
+	var labels strings.Builder
+	labels.WriteString("  ")
+	for _, file := range files {
+		fmt.Fprintf(&labels, " %c ", file)
+	}
+	lines = append(lines, labels.String())
+
+	var sb strings.Builder
+	for i, line := range lines {
+		sb.WriteString(line)
+		if i < len(v.Panel) && v.Panel[i] != "" {
+			sb.WriteString("   " + v.Panel[i])
+		}
+		sb.WriteString("\n")
+	}
+	for _, line := range v.Panel[min(len(lines), len(v.Panel)):] {
+		sb.WriteString(strings.Repeat(" ", 29) + line + "\n")
+	}
+	return sb.String()
+}
+
+// cell draws one square, three characters wide.
+func (v BoardView) cell(piece *Piece, light, lastMove, check bool) string {
+	symbol := "."
+	if v.Style == ColorBoard {
+		symbol = " "
+	}
+	if piece != nil {
+		symbol = pieceSymbol(piece.Kind, piece.Color, v.Style)
+	}
+	if v.Style != ColorBoard {
+		switch {
+		case check:
+			return "(" + symbol + ")"
+		case lastMove:
+			return "[" + symbol + "]"
+		}
+		return " " + symbol + " "
+	}
+
+	background := ansiDark
+	switch {
+	case check:
+		background = ansiCheck
+	case lastMove && light:
+		background = ansiLastLight
+	case lastMove:
+		background = ansiLastDark
+	case light:
+		background = ansiLight
+	}
+	foreground := ansiWhitePiece
+	if piece != nil && piece.Color == Black {
+		foreground = ansiBlackPiece
+	}
+	return background + foreground + " " + symbol + " "
+}
+
+// gamePanel returns the lines shown beside a game's board: each player's name and clock
+// level with their back rank, the material they have captured (in Crazyhouse, their
+// pocket) below or above it, and the last moves in between.
+func gamePanel(g *Game, flip bool, style BoardStyle) []string {
+	top, bottom := Black, White
+	if flip {
+		top, bottom = White, Black
+	}
+	moves := moveListLines(g.Start(), g.SAN())
+	if len(moves) > 4 {
+		moves = moves[len(moves)-4:]
+	}
+	panel := make([]string, 8)
+	panel[0], panel[1] = playerLine(g, top), materialLine(g.Position(), top, style)
+	copy(panel[2:6], moves)
+	panel[6], panel[7] = materialLine(g.Position(), bottom, style), playerLine(g, bottom)
+	if outcome := g.Outcome(); outcome.IsOver() {
+		panel = append(panel, "", fmt.Sprintf("%s (%s)", outcome.Result, outcome.Reason))
+	}
+	return panel
+}
+
+// RenderGame draws the current position of g with its last move marked and the game panel
+// beside it, from Black's side when flip is set.
+func RenderGame(g *Game, flip bool, style BoardStyle) string {
+	view := BoardView{Style: style, Flip: flip, Panel: gamePanel(g, flip, style)}
+	if moves := g.Moves(); len(moves) > 0 {
+		view.LastMove = &moves[len(moves)-1].Move
+	}
+	return view.Render(g.Position())
+}
+
+// playerLine names color, with an arrow when it is to move, and shows its clock.
+func playerLine(g *Game, color Color) string {
+	line := colorToString(color)
+	if g.TimeControl() != nil {
+		line += "  " + formatClock(g.Remaining(color))
+	}
+	if g.Position().toMove == color && !g.Outcome().IsOver() {
+		line += "  <"
+	}
+	return line
+}
+
+// formatClock shows the time on a clock as h:mm:ss or m:ss, with tenths under 20 seconds.
+func formatClock(d time.Duration) string {
+	d = max(d, 0)
+	if d < 20*time.Second {
+		return fmt.Sprintf("0:%04.1f", d.Truncate(time.Second/10).Seconds())
+	}
+	s := int(d / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// startingCounts are the pieces each side starts with, by PieceKind.
+var startingCounts = map[PieceKind]int{Queen: 1, Rook: 2, Bishop: 2, Knight: 2, Pawn: 8}
+
+// materialLine shows the opponent's pieces color has captured, most valuable first, and
+// color's lead in material in pawns when it is ahead. In Crazyhouse, where captures go to
+// the pocket, it shows the pocket instead.
+func materialLine(pos *Position, color Color, style BoardStyle) string {
+	var sb strings.Builder
+	if pos.variant == Crazyhouse {
+		for _, kind := range pocketKinds {
+			sb.WriteString(strings.Repeat(pieceSymbol(kind, color, style), pos.pockets[color][kind]))
+		}
+		return sb.String()
+	}
+	var counts [2][7]int
+	for _, piece := range pos.pieces {
+		counts[piece.Color][piece.Kind] += piece.Location.Count()
+	}
+	balance := 0
+	for _, kind := range pocketKinds {
+		mine, theirs := counts[color][kind], counts[color.Opponent()][kind]
+		balance += (mine - theirs) * pieceValues[kind]
+		sb.WriteString(strings.Repeat(pieceSymbol(kind, color.Opponent(), style), max(startingCounts[kind]-theirs, 0)))
+	}
+	if balance >= 50 {
+		fmt.Fprintf(&sb, " +%d", (balance+50)/100)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// moveListLines numbers moves played from start in SAN, a move pair to a line.
+func moveListLines(start *Position, sans []string) []string {
+	var lines []string
+	number := start.moveNumber
+	i := 0
+	if start.toMove == Black && len(sans) > 0 {
+		lines = append(lines, fmt.Sprintf("%d... %s", number, sans[0]))
+		number, i = number+1, 1
+	}
+	for ; i < len(sans); i, number = i+2, number+1 {
+		line := fmt.Sprintf("%d. %s", number, sans[i])
+		if i+1 < len(sans) {
+			line += " " + sans[i+1]
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// runPlay implements "play [-fen FEN] [-color white|black|random] [-engine NAME] [-tc 300+3]",
+// playing a person at the terminal against Dumbfish or another engine, with clocks when
+// given a time control.
+func runPlay(args []string, in io.Reader, out io.Writer) error {
+	flags := commandFlags("play", out)
+	fen := flags.String("fen", "", "starting position (default the standard one)")
+	color := flags.String("color", "white", "the side you play: white, black or random")
+	spec := flags.String("engine", "dumbfish", "opponent's "+engineFlagHelp)
+	options := flags.String("options", "", "opponent's UCI options as Name=Value,...")
+	tc := flags.String("tc", "", `time control in seconds, such as "300+3" for 5 minutes plus 3 seconds a move (default untimed)`)
+	depth := flags.Int("depth", defaultSearchDepth, "the engine's search depth in untimed games")
+	board := flags.String("board", "auto", "board drawing: color, unicode, ascii, or auto to suit the terminal")
+	bitbaseDir := flags.String("bitbases", "", `directory of endgame bitbases written by "chessx bitbase"`)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *bitbaseDir != "" {
+		if err := loadBitbaseDir(*bitbaseDir); err != nil {
+			return err
+		}
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	style, err := ParseBoardStyle(*board, out)
+	if err != nil {
+		return err
+	}
+
+	var human Color
+	switch strings.ToLower(*color) {
+	case "white":
+		human = White
+	case "black":
+		human = Black
+	case "random":
+		human = Color(rand.Intn(2))
+	default:
+		return fmt.Errorf("-color must be white, black or random, not %q", *color)
+	}
+	var control *TimeControl
+	if *tc != "" {
+		parsed, err := ParseTimeControl(*tc)
+		if err != nil {
+			return err
+		}
+		control = &parsed
+	}
+	pos := NewVariantPosition(Standard)
+	if *fen != "" {
+		var err error
+		if pos, err = ParseFEN(*fen); err != nil {
+			return fmt.Errorf("parse FEN: %w", err)
+		}
+	}
+	engine, closer, err := openEngine(*spec, *options)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer()
+	}
+
+	input := bufio.NewScanner(in)
+	game := NewGame(pos, control)
+	for {
+		pos := game.Position()
+		clearScreen(out)
+		fmt.Fprintf(out, "You play %s against %s.\n\n", colorToString(human), engine.Name())
+		fmt.Fprintln(out, RenderGame(game, human == Black, style))
+		if outcome := game.Outcome(); outcome.IsOver() {
+			fmt.Fprintf(out, "Game over: %s (%s)\n", outcome.Result, outcome.Reason)
+			return nil
+		}
+
+		if pos.toMove != human {
+			// Engine move, showing its analysis as it deepens
+			fmt.Fprintf(out, "%s is thinking...\n", engine.Name())
+			limits := game.Limits()
+			if control == nil {
+				limits.Depth = *depth
+			}
+			reply, ok := engine.Search(context.Background(), pos, limits, func(info SearchInfo) {
+				fmt.Fprintf(out, "  %s\n", info.UCI())
+			})
+			if !ok {
+				return fmt.Errorf("%s returned no move", engine.Name())
+			}
+			game.Play(reply) // a move after the flag fell ends the game instead
+			continue
+		}
+
+		fmt.Fprint(out, "Enter move (UCI or SAN such as e2e4, Nf3, exd5, e8=Q), 'resign' or 'q' to quit: ")
+		if !input.Scan() {
+			if err := input.Err(); err != nil {
+				return fmt.Errorf("input error: %w", err)
+			}
+			fmt.Fprintln(out)
+			return nil
+		}
+		switch move := strings.TrimSpace(input.Text()); move {
+		case "q", "quit", "exit":
+			fmt.Fprintln(out, "Goodbye!")
+			return nil
+		case "resign":
+			game.Resign(human)
+		default:
+			if _, err := game.PlayInput(move); err != nil && !errors.Is(err, ErrGameOver) {
+				fmt.Fprintf(out, "%v. Press Enter to continue...\n", err)
+				input.Scan()
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// playedGame plays moves in SAN from fen, failing the test on an illegal one.
+func playedGame(t *testing.T, fen string, tc *TimeControl, moves ...string) *Game {
+	t.Helper()
+	pos, err := ParseFEN(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := NewGame(pos, tc)
+	game.clock = &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	game.turnStart = game.clock.Now()
+	for _, san := range moves {
+		if _, err := game.PlayInput(san); err != nil {
+			t.Fatalf("%s: %v", san, err)
+		}
+	}
+	return game
+}
+
+func TestRenderGame_ASCII(t *testing.T) {
+	game := playedGame(t, standardStartFEN, nil, "e4", "e5", "Qh5", "Nc6", "Bc4", "Nf6", "Qxf7#")
+	want := `8  r  .  b  q (k) b  .  r    Black
+7  p  p  p  p  . [Q] p  p 
+6  .  .  n  .  .  n  .  .    1. e4 e5
+5  .  .  .  .  p  .  . [.]   2. Qh5 Nc6
+4  .  .  B  .  P  .  .  .    3. Bc4 Nf6
+3  .  .  .  .  .  .  .  .    4. Qxf7#
+2  P  P  P  P  .  P  P  P    p +1
+1  R  N  B  .  K  .  N  R    White
+   a  b  c  d  e  f  g  h 
+                             1-0 (checkmate)
+`
+	if got := RenderGame(game, false, ASCIIBoard); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// From Black's side, with clocks and glyphs, after Black's first move from a FEN
+	game = playedGame(t, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1",
+		&TimeControl{Base: 5 * time.Minute, Increment: 3 * time.Second}, "d5", "exd5")
+	got := RenderGame(game, true, UnicodeBoard)
+	lines := strings.Split(got, "\n")
+	if lines[0] != "1  ♖  ♘  ♗  ♔  ♕  ♗  ♘  ♖    White  5:03" || lines[1] != "2  ♙  ♙  ♙  .  ♙  ♙  ♙  ♙    ♟ +1" ||
+		lines[3] != "4  .  .  . [.] .  .  .  .    2. exd5" || lines[4] != "5  .  .  .  . [♙] .  .  . " ||
+		lines[7] != "8  ♜  ♞  ♝  ♚  ♛  ♝  ♞  ♜    Black  5:03  <" || lines[8] != "   h  g  f  e  d  c  b  a " {
+		t.Errorf("flipped board:\n%s", got)
+	}
+}
+
+func TestRenderGame_Color(t *testing.T) {
+	game := playedGame(t, standardStartFEN, nil, "f3", "e5", "g4", "Qh4#")
+	got := RenderGame(game, false, ColorBoard)
+	// The queen came from d8 to h4, both dark squares, and checks the king on e1
+	if !strings.Contains(got, ansiLastDark+ansiBlackPiece+" ♛ ") || !strings.Contains(got, ansiLastDark+ansiWhitePiece+"   ") ||
+		!strings.Contains(got, ansiCheck+ansiWhitePiece+" ♚ ") || strings.Count(got, ansiReset) != 8 {
+		t.Errorf("coloured board:\n%q", got)
+	}
+	if strings.Contains(RenderGame(game, false, ASCIIBoard), "\033") {
+		t.Error("ASCII board has escapes")
+	}
+}
+
+func TestBoardStyle(t *testing.T) {
+	var sb strings.Builder
+	if style, err := ParseBoardStyle("auto", &sb); err != nil || style != ASCIIBoard {
+		t.Errorf("auto for a buffer: %v, %v", style, err)
+	}
+	if style, err := ParseBoardStyle("Colour", &sb); err != nil || style != ColorBoard {
+		t.Errorf("colour: %v, %v", style, err)
+	}
+	if _, err := ParseBoardStyle("fancy", &sb); err == nil {
+		t.Error("unknown style accepted")
+	}
+	for d, want := range map[time.Duration]string{
+		-time.Second: "0:00.0", 9*time.Second + 870*time.Millisecond: "0:09.8", 20 * time.Second: "0:20",
+		5*time.Minute + 3*time.Second: "5:03", 90 * time.Minute: "1:30:00",
+	} {
+		if got := formatClock(d); got != want {
+			t.Errorf("formatClock(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Command fakeuci is a scripted UCI engine for the client tests. It declares a fixed set of
+// options, answers every search with the same move after a few info lines, and can be told to
+// misbehave: wait for "stop", exit in the middle of a search or never finish the handshake.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	name := flag.String("name", "Fake 1.0", "engine name")
+	best := flag.String("bestmove", "e2e4", "move played in every position")
+	infos := flag.Int("infos", 3, "info lines sent before the move")
+	delay := flag.Duration("delay", 0, "pause before each info line")
+	waitStop := flag.Bool("wait-stop", false, "keep thinking until \"stop\", as with \"go infinite\"")
+	crash := flag.Bool("crash", false, "exit when told to search")
+	mute := flag.Bool("mute", false, "never answer \"uci\"")
+	logPath := flag.String("log", "", "file to append the commands received to")
+	flag.Parse()
+
+	var log *os.File
+	if *logPath != "" {
+		var err error
+		if log, err = os.OpenFile(*logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer log.Close()
+	}
+	commands := make(chan string)
+	go func() {
+		defer close(commands)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if log != nil {
+				fmt.Fprintln(log, scanner.Text())
+			}
+			commands <- scanner.Text()
+		}
+	}()
+
+	for command := range commands {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			if *mute {
+				continue
+			}
+			fmt.Println("id name " + *name)
+			fmt.Println("id author The chessx authors")
+			fmt.Println("option name Hash type spin default 16 min 1 max 1024")
+			fmt.Println("option name Ponder type check default false")
+			fmt.Println("option name Style type combo default Normal var Solid var Normal var Risky")
+			fmt.Println("option name Book File type string default <empty>")
+			fmt.Println("option name Clear Hash type button")
+			fmt.Println("uciok")
+		case "isready":
+			fmt.Println("readyok")
+		case "go":
+			if *crash {
+				os.Exit(3)
+			}
+			if len(fields) == 3 && fields[1] == "perft" {
+				fmt.Println("e2e4: 20\ng1f3: 20\n\nNodes searched: 40")
+				continue
+			}
+			for depth := 1; depth <= *infos; depth++ {
+				time.Sleep(*delay)
+				fmt.Printf("info depth %d score cp %d nodes %d time %d pv %s\n", depth, 10*depth, 100*depth, depth, *best)
+			}
+			fmt.Println("info string searching done")
+			if *waitStop || strings.Contains(command, "infinite") {
+				for command := range commands {
+					if command == "stop" {
+						break
+					}
+				}
+			}
+			fmt.Println("bestmove " + *best)
+		case "quit":
+			return
+		}
+	}
+}
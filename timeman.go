@@ -0,0 +1,122 @@
+package main
+
+import "time"
+
+// SearchLimits mirrors the arguments of the UCI "go" command. Zero values mean "no limit".
+type SearchLimits struct {
+	WTime, BTime time.Duration // time left on each clock
+	WInc, BInc   time.Duration // increment per move
+	MovesToGo    int           // moves until the next time control (0 = sudden death)
+	MoveTime     time.Duration // exact time to spend on this move
+	Depth        int           // maximum depth in plies
+	Nodes        int           // maximum nodes searched
+	Mate         int           // stop once a mate in this many moves is found
+	Infinite     bool          // search until stopped
+	MultiPV      int           // number of best lines to search and report (0 = 1)
+}
+
+// clockFor returns the remaining time and increment for color.
+func (l SearchLimits) clockFor(color Color) (remaining, increment time.Duration) {
+	if color == White {
+		return l.WTime, l.WInc
+	}
+	return l.BTime, l.BInc
+}
+
+// IsZero reports whether no limit at all was given. MultiPV does not bound the search.
+func (l SearchLimits) IsZero() bool {
+	l.MultiPV = 0
+	return l == SearchLimits{}
+}
+
+// Clock abstracts wall time so searches can be tested against a simulated clock.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+const (
+	// defaultMoveOverhead is reserved per move for communication and scheduling latency.
+	defaultMoveOverhead = 30 * time.Millisecond
+	// defaultMovesToGo is the assumed game length left in sudden-death time controls.
+	defaultMovesToGo = 30
+)
+
+// TimeManager splits the clock into a soft budget, checked between iterations, and a hard
+// budget that aborts the search. Best-move changes between iterations extend the soft budget.
+type TimeManager struct {
+	clock       Clock
+	start       time.Time
+	soft, hard  time.Duration
+	limited     bool
+	lastBest    string
+	instability int // percent added to the soft budget, decays every iteration
+}
+
+// NewTimeManager allocates budgets for side to move under limits, starting now.
+func NewTimeManager(limits SearchLimits, side Color, clock Clock) *TimeManager {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	tm := &TimeManager{clock: clock, start: clock.Now()}
+	remaining, increment := limits.clockFor(side)
+	switch {
+	case limits.Infinite:
+	case limits.MoveTime > 0:
+		tm.limited = true
+		tm.hard = max(limits.MoveTime-defaultMoveOverhead, limits.MoveTime/2)
+		tm.soft = tm.hard
+	case limits.WTime > 0 || limits.BTime > 0:
+		// An empty clock for the side to move still gets a (tiny) budget rather than none
+		tm.limited = true
+		available := max(remaining-defaultMoveOverhead, 0)
+		movesToGo := defaultMovesToGo
+		if limits.MovesToGo > 0 {
+			movesToGo = min(limits.MovesToGo, defaultMovesToGo)
+		}
+		tm.soft = available/time.Duration(movesToGo) + increment*3/4
+		// Never plan to use more than most of what is left, so the clock cannot run out
+		tm.hard = min(tm.soft*4, available*8/10)
+		tm.soft = min(tm.soft, tm.hard)
+	}
+	return tm
+}
+
+// Elapsed returns the time spent since the search started.
+func (tm *TimeManager) Elapsed() time.Duration {
+	return tm.clock.Now().Sub(tm.start)
+}
+
+// SoftLimit returns the soft budget including any instability extension.
+func (tm *TimeManager) SoftLimit() time.Duration {
+	return min(tm.soft+tm.soft*time.Duration(tm.instability)/100, tm.hard)
+}
+
+// HardLimit returns the budget at which the search is aborted.
+func (tm *TimeManager) HardLimit() time.Duration {
+	return tm.hard
+}
+
+// OnIteration records the best move of a completed iteration. A change of mind extends the
+// soft budget; a stable best move lets the extension decay.
+func (tm *TimeManager) OnIteration(best string) {
+	tm.instability /= 2
+	if tm.lastBest != "" && best != tm.lastBest {
+		tm.instability = min(tm.instability+100, 300)
+	}
+	tm.lastBest = best
+}
+
+// StartIteration reports whether another iteration is likely to finish within the soft budget.
+// The next iteration usually takes longer than everything before it, so stop at half the budget.
+func (tm *TimeManager) StartIteration() bool {
+	return !tm.limited || tm.Elapsed() < tm.SoftLimit()/2
+}
+
+// Expired reports whether the hard budget is exhausted and the search must stop now.
+func (tm *TimeManager) Expired() bool {
+	return tm.limited && tm.Elapsed() >= tm.hard
+}
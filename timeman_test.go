@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock advances by step on every reading, so searches consume simulated time
+// proportional to the work done rather than to the speed of the machine.
+type fakeClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func TestTimeManager_Budgets(t *testing.T) {
+	clock := &fakeClock{}
+	cases := []struct {
+		name       string
+		limits     SearchLimits
+		side       Color
+		soft, hard time.Duration
+	}{
+		{"sudden death", SearchLimits{WTime: 60 * time.Second, BTime: time.Second}, White, 1999 * time.Millisecond, 7996 * time.Millisecond},
+		{"uses the side to move's clock", SearchLimits{WTime: 60 * time.Second, BTime: 3030 * time.Millisecond}, Black, 100 * time.Millisecond, 400 * time.Millisecond},
+		{"increment", SearchLimits{BTime: 3030 * time.Millisecond, BInc: 400 * time.Millisecond}, Black, 400 * time.Millisecond, 1600 * time.Millisecond},
+		{"last move before the control", SearchLimits{WTime: 1030 * time.Millisecond, MovesToGo: 1}, White, 800 * time.Millisecond, 800 * time.Millisecond},
+		{"movetime", SearchLimits{MoveTime: time.Second}, White, 970 * time.Millisecond, 970 * time.Millisecond},
+		{"nearly flagging", SearchLimits{WTime: 20 * time.Millisecond}, White, 0, 0},
+	}
+	for _, tc := range cases {
+		tm := NewTimeManager(tc.limits, tc.side, clock)
+		if tm.SoftLimit() != tc.soft || tm.HardLimit() != tc.hard {
+			t.Errorf("%s: got soft %v hard %v, want soft %v hard %v", tc.name, tm.SoftLimit(), tm.HardLimit(), tc.soft, tc.hard)
+		}
+		if !tm.limited {
+			t.Errorf("%s: expected a limited search", tc.name)
+		}
+	}
+
+	for _, limits := range []SearchLimits{{Infinite: true, WTime: time.Second}, {Depth: 5}, {Nodes: 1000}} {
+		tm := NewTimeManager(limits, White, clock)
+		clock.now = clock.now.Add(time.Hour)
+		if tm.Expired() || !tm.StartIteration() {
+			t.Errorf("%+v: expected no time limit", limits)
+		}
+	}
+}
+
+func TestTimeManager_ExtendsOnUnstableBestMove(t *testing.T) {
+	tm := NewTimeManager(SearchLimits{WTime: 60 * time.Second}, White, &fakeClock{})
+	base := tm.SoftLimit()
+	tm.OnIteration("e2e4")
+	tm.OnIteration("e2e4")
+	if tm.SoftLimit() != base {
+		t.Fatalf("stable best move should not extend: %v vs %v", tm.SoftLimit(), base)
+	}
+	tm.OnIteration("d2d4")
+	if tm.SoftLimit() != 2*base {
+		t.Fatalf("expected a doubled soft limit after a change, got %v (base %v)", tm.SoftLimit(), base)
+	}
+	for i := 0; i < 6; i++ {
+		tm.OnIteration([]string{"e2e4", "d2d4"}[i%2])
+	}
+	if tm.SoftLimit() < 5*base/2 || tm.SoftLimit() > tm.HardLimit() {
+		t.Fatalf("expected a flip-flopping best move to extend up to the hard limit, got %v (base %v)", tm.SoftLimit(), base)
+	}
+	for i := 0; i < 10; i++ {
+		tm.OnIteration("d2d4")
+	}
+	if tm.SoftLimit() != base {
+		t.Fatalf("extension should decay once the move is stable, got %v", tm.SoftLimit())
+	}
+}
+
+func TestTimeManager_StopsWithinBudget(t *testing.T) {
+	clock := &fakeClock{}
+	tm := NewTimeManager(SearchLimits{MoveTime: 130 * time.Millisecond}, White, clock)
+	clock.step = 10 * time.Millisecond
+	if !tm.StartIteration() {
+		t.Fatalf("expected time for an iteration at the start")
+	}
+	for i := 0; i < 8; i++ {
+		clock.Now()
+	}
+	if tm.StartIteration() {
+		t.Fatalf("should not start an iteration past half the soft budget (elapsed %v)", tm.Elapsed())
+	}
+	if !tm.Expired() {
+		t.Fatalf("expected the hard budget to be exhausted after %v", tm.Elapsed())
+	}
+}
+
+// TestSearch_NeverFlags plays a blitz game against itself on a simulated clock where every
+// clock reading (one per 256 nodes) costs 4ms.
+func TestSearch_NeverFlags(t *testing.T) {
+	clock := &fakeClock{step: 4 * time.Millisecond}
+	engine := Dumbfish{Clock: clock}
+	pos := NewVariantPosition(Standard)
+	remaining := map[Color]time.Duration{White: 2 * time.Second, Black: 2 * time.Second}
+	inc := 20 * time.Millisecond
+	for ply := 0; ply < 40; ply++ {
+		limits := SearchLimits{WTime: remaining[White], BTime: remaining[Black], WInc: inc, BInc: inc}
+		start := clock.now
+		ap, ok := engine.Search(context.Background(), pos, limits, nil)
+		if !ok {
+			break
+		}
+		spent := clock.now.Sub(start)
+		remaining[pos.toMove] -= spent
+		if remaining[pos.toMove] <= 0 {
+			t.Fatalf("ply %d: %s flagged after spending %v", ply, colorToString(pos.toMove), spent)
+		}
+		remaining[pos.toMove] += inc
+		pos = ap.Position
+	}
+}
+
+func TestSearch_NodeDepthAndMateLimits(t *testing.T) {
+	engine := Dumbfish{Clock: &fakeClock{}}
+	pos := NewVariantPosition(Standard)
+
+	s := searcher{maxNodes: 500}
+	if _, _, ok := s.iterate(pos, maxSearchPly, 0); !ok || s.nodes > 501 {
+		t.Fatalf("expected the node limit to stop the search, searched %d", s.nodes)
+	}
+	if _, ok := engine.Search(context.Background(), pos, SearchLimits{Nodes: 500}, nil); !ok {
+		t.Fatalf("expected a move under a node limit")
+	}
+
+	// Back rank mate in one: the mate limit stops at depth 1 despite an unbounded depth
+	mate, _ := ParseFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	ap, ok := engine.Search(context.Background(), mate, SearchLimits{Mate: 1}, nil)
+	if !ok || ap.Move.UCINotation() != "a1a8" {
+		t.Fatalf("expected a1a8, got %s", ap.Move.UCINotation())
+	}
+
+	s = searcher{}
+	_, score, _ := s.iterate(mate, 2, 0)
+	if score != mateScore-1 {
+		t.Fatalf("expected mate in one score, got %d", score)
+	}
+}
@@ -0,0 +1,667 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TournamentFormat is how a tournament pairs its players.
+type TournamentFormat int
+
+const (
+	// RoundRobin pairs everyone with everyone once per cycle, swapping colours every other
+	// cycle. With an odd number of players one sits out each round, scoring nothing.
+	RoundRobin TournamentFormat = iota
+	// Swiss pairs players with equal or close scores who have not met, for a fixed number of
+	// rounds. With an odd number of players the lowest ranked without a bye gets one point.
+	Swiss
+)
+
+func (f TournamentFormat) String() string {
+	return [...]string{"roundrobin", "swiss"}[f]
+}
+
+// ParseTournamentFormat reads "roundrobin" or "swiss".
+func ParseTournamentFormat(s string) (TournamentFormat, error) {
+	switch strings.ToLower(strings.ReplaceAll(s, "-", "")) {
+	case "roundrobin", "rr":
+		return RoundRobin, nil
+	case "swiss":
+		return Swiss, nil
+	}
+	return 0, fmt.Errorf("unknown tournament format %q", s)
+}
+
+// TournamentPlayer is an engine configuration taking part in a tournament under Name.
+type TournamentPlayer struct {
+	Name   string
+	Engine Engine
+}
+
+// TournamentOptions configures a tournament. Rounds is the number of Swiss rounds, or of
+// round-robin cycles (0 = 1). Games of round r start from opening (r-1) modulo the number
+// of openings. With StatePath the tournament is saved there after every game, and picks up
+// from the saved games when created again.
+type TournamentOptions struct {
+	Format      TournamentFormat
+	Rounds      int
+	Openings    []PGNGame
+	Limits      SearchLimits
+	TimeControl *TimeControl
+	Event       string // PGN Event tag (empty = "chessx tournament")
+	StatePath   string
+	Adjudication
+
+	Progress func(TournamentGame) // called after each game, if not nil
+}
+
+// TournamentGame is a scheduled or played game. Black is -1 for a bye.
+type TournamentGame struct {
+	Round  int    `json:"round"`
+	White  int    `json:"white"`
+	Black  int    `json:"black"`
+	Result string `json:"result,omitempty"` // PGN result; empty until played
+	Reason string `json:"reason,omitempty"`
+	PGN    string `json:"pgn,omitempty"`
+}
+
+// IsBye reports whether the game is a bye rather than a game.
+func (g TournamentGame) IsBye() bool { return g.Black < 0 }
+
+// points returns what the player at index scored in the game.
+func (g TournamentGame) points(index int) float64 {
+	switch {
+	case g.Result == "1/2-1/2":
+		return 0.5
+	case g.Result == "1-0" && index == g.White, g.Result == "0-1" && index == g.Black:
+		return 1
+	}
+	return 0
+}
+
+// tournamentState is what is saved between runs.
+type tournamentState struct {
+	Format  string           `json:"format"`
+	Rounds  int              `json:"rounds"`
+	Players []string         `json:"players"`
+	Games   []TournamentGame `json:"games"`
+}
+
+// Tournament runs games between several players and keeps their standings.
+type Tournament struct {
+	Players []TournamentPlayer
+	opts    TournamentOptions
+	games   []TournamentGame // in round order; played or scheduled
+}
+
+// NewTournament sets up a tournament, resuming the one saved at opts.StatePath if there is
+// one. A saved tournament must have the same players, format and rounds.
+func NewTournament(players []TournamentPlayer, opts TournamentOptions) (*Tournament, error) {
+	if len(players) < 2 {
+		return nil, errors.New("tournament: need at least two players")
+	}
+	names := map[string]bool{}
+	for _, p := range players {
+		if names[p.Name] {
+			return nil, fmt.Errorf("tournament: duplicate player name %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	opts.Rounds = max(opts.Rounds, 1)
+	t := &Tournament{Players: players, opts: opts}
+	if opts.StatePath == "" {
+		return t, nil
+	}
+	data, err := os.ReadFile(opts.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state tournamentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %w", opts.StatePath, err)
+	}
+	if state.Format != opts.Format.String() || state.Rounds != opts.Rounds || !slices.Equal(state.Players, t.names()) {
+		return nil, fmt.Errorf("%s: saved tournament has different players, format or rounds", opts.StatePath)
+	}
+	t.games = state.Games
+	return t, nil
+}
+
+func (t *Tournament) names() []string {
+	names := make([]string, len(t.Players))
+	for i, p := range t.Players {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// TotalRounds returns the number of rounds the tournament lasts.
+func (t *Tournament) TotalRounds() int {
+	if t.opts.Format == Swiss {
+		return t.opts.Rounds
+	}
+	n := len(t.Players)
+	if n%2 == 1 {
+		n++
+	}
+	return (n - 1) * t.opts.Rounds
+}
+
+// Games returns the games played or scheduled so far, in round order.
+func (t *Tournament) Games() []TournamentGame {
+	return slices.Clone(t.games)
+}
+
+// Run plays every remaining game, saving the state after each one. Once ctx is done it
+// stops before the next game and returns ctx.Err(); the game in progress is abandoned.
+func (t *Tournament) Run(ctx context.Context) error {
+	for round := 1; round <= t.TotalRounds(); round++ {
+		if !slices.ContainsFunc(t.games, func(g TournamentGame) bool { return g.Round == round }) {
+			t.games = append(t.games, t.pair(round)...)
+			if err := t.save(); err != nil {
+				return err
+			}
+		}
+		for i := range t.games {
+			if t.games[i].Round != round || t.games[i].Result != "" {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := t.play(ctx, &t.games[i]); err != nil {
+				return err
+			}
+			if err := t.save(); err != nil {
+				return err
+			}
+			if t.opts.Progress != nil {
+				t.opts.Progress(t.games[i])
+			}
+		}
+	}
+	return nil
+}
+
+// play plays a scheduled game, or scores a bye.
+func (t *Tournament) play(ctx context.Context, game *TournamentGame) error {
+	if game.IsBye() {
+		game.Result, game.Reason = "1-0", "bye"
+		return nil
+	}
+	opening := PGNGame{Tags: map[string]string{}}
+	if len(t.opts.Openings) > 0 {
+		opening = t.opts.Openings[(game.Round-1)%len(t.opts.Openings)]
+	}
+	start, err := opening.StartPosition()
+	if err != nil {
+		return fmt.Errorf("round %d: opening: %w", game.Round, err)
+	}
+	white, black := t.Players[game.White], t.Players[game.Black]
+	for _, p := range []TournamentPlayer{white, black} {
+		if g, ok := p.Engine.(newGamer); ok {
+			if err := g.NewGame(); err != nil {
+				return fmt.Errorf("round %d: %s: %w", game.Round, p.Name, err)
+			}
+		}
+	}
+	event := t.opts.Event
+	if event == "" {
+		event = "chessx tournament"
+	}
+	g := newEngineGame(white.Engine, black.Engine, start, map[string]string{
+		"Event": event,
+		"Site":  "?",
+		"Date":  time.Now().Format("2006.01.02"),
+		"Round": strconv.Itoa(game.Round),
+	})
+	g.pgn.Tags["White"], g.pgn.Tags["Black"] = white.Name, black.Name
+	if err := g.playOpening(opening); err != nil {
+		return fmt.Errorf("round %d: opening: %w", game.Round, err)
+	}
+	if err := g.run(ctx, t.opts.Limits, t.opts.TimeControl, t.opts.Adjudication); err != nil {
+		return fmt.Errorf("round %d: %s - %s: %w", game.Round, white.Name, black.Name, err)
+	}
+	var pgn strings.Builder
+	if _, err := g.pgn.WriteTo(&pgn); err != nil {
+		return err
+	}
+	game.Result, game.Reason, game.PGN = g.pgn.Result, g.outcome.Reason, pgn.String()
+	return nil
+}
+
+// save writes the state to opts.StatePath, if set, replacing the file atomically.
+func (t *Tournament) save() error {
+	if t.opts.StatePath == "" {
+		return nil
+	}
+	state := tournamentState{Format: t.opts.Format.String(), Rounds: t.opts.Rounds, Players: t.names(), Games: t.games}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := t.opts.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.opts.StatePath)
+}
+
+// pair returns the games of round.
+func (t *Tournament) pair(round int) []TournamentGame {
+	if t.opts.Format == Swiss {
+		return t.pairSwiss(round)
+	}
+	return t.pairRoundRobin(round)
+}
+
+// pairRoundRobin pairs round with the circle method: the last seat stays put while the
+// others rotate, so every pair meets once in n-1 rounds. The first half of the seats has
+// White, except against the fixed seat, whose colour alternates; with an odd number of
+// players the fixed seat is the bye, which balances colours exactly. Colours are swapped
+// in every other cycle.
+func (t *Tournament) pairRoundRobin(round int) []TournamentGame {
+	n := len(t.Players)
+	if n%2 == 1 {
+		n++ // the extra seat is a bye
+	}
+	cycle, r := (round-1)/(n-1), (round-1)%(n-1)
+	seats := make([]int, n)
+	seats[0] = n - 1
+	for i := 1; i < n; i++ {
+		seats[i] = (i - 1 + r) % (n - 1)
+	}
+	var games []TournamentGame
+	for i := 0; i < n/2; i++ {
+		white, black := seats[i], seats[n-1-i]
+		if i == 0 && r%2 == 1 {
+			white, black = black, white
+		}
+		if cycle%2 == 1 {
+			white, black = black, white
+		}
+		if white >= len(t.Players) || black >= len(t.Players) {
+			continue
+		}
+		games = append(games, TournamentGame{Round: round, White: white, Black: black})
+	}
+	return games
+}
+
+// pairSwiss pairs round by score: players are ranked by points, then by their order of
+// entry, and each in turn meets the highest ranked player left whom they have not met yet,
+// backtracking when that leaves the others unpairable. Rematches are only allowed when no
+// pairing without them exists. The player with more games as White gets Black.
+func (t *Tournament) pairSwiss(round int) []TournamentGame {
+	standings := t.Standings()
+	ranked := make([]int, len(standings))
+	for i, s := range standings {
+		ranked[i] = s.index
+	}
+	var games []TournamentGame
+	if len(ranked)%2 == 1 {
+		// The bye goes to the lowest ranked player who has not had one
+		for i := len(ranked) - 1; i >= 0; i-- {
+			if !slices.ContainsFunc(t.games, func(g TournamentGame) bool { return g.IsBye() && g.White == ranked[i] }) {
+				games = append(games, TournamentGame{Round: round, White: ranked[i], Black: -1})
+				ranked = slices.Delete(ranked, i, i+1)
+				break
+			}
+		}
+		if len(games) == 0 {
+			games = append(games, TournamentGame{Round: round, White: ranked[len(ranked)-1], Black: -1})
+			ranked = ranked[:len(ranked)-1]
+		}
+	}
+	met := map[[2]int]bool{}
+	for _, g := range t.games {
+		if !g.IsBye() {
+			met[[2]int{g.White, g.Black}], met[[2]int{g.Black, g.White}] = true, true
+		}
+	}
+	pairs, ok := pairUnmet(ranked, met)
+	if !ok {
+		pairs, _ = pairUnmet(ranked, nil)
+	}
+	for _, p := range pairs {
+		white, black := t.colours(p[0], p[1])
+		games = append(games, TournamentGame{Round: round, White: white, Black: black})
+	}
+	return games
+}
+
+// pairUnmet pairs the players of ranked, in rank order, so that no pair has met.
+func pairUnmet(ranked []int, met map[[2]int]bool) ([][2]int, bool) {
+	if len(ranked) == 0 {
+		return nil, true
+	}
+	first := ranked[0]
+	for i := 1; i < len(ranked); i++ {
+		if met[[2]int{first, ranked[i]}] {
+			continue
+		}
+		rest := slices.Concat(ranked[1:i], ranked[i+1:])
+		if pairs, ok := pairUnmet(rest, met); ok {
+			return append([][2]int{{first, ranked[i]}}, pairs...), true
+		}
+	}
+	return nil, false
+}
+
+// colours orders a pair as white and black, giving White to the player who has had it less
+// often, or else to whoever had Black last; a is the higher ranked player.
+func (t *Tournament) colours(a, b int) (int, int) {
+	balance := func(player int) (diff int, last int) {
+		for _, g := range t.games {
+			switch {
+			case g.IsBye():
+			case g.White == player:
+				diff, last = diff+1, 1
+			case g.Black == player:
+				diff, last = diff-1, -1
+			}
+		}
+		return diff, last
+	}
+	diffA, lastA := balance(a)
+	diffB, lastB := balance(b)
+	switch {
+	case diffA != diffB:
+		if diffA < diffB {
+			return a, b
+		}
+		return b, a
+	case lastA != lastB:
+		if lastA < lastB {
+			return a, b
+		}
+		return b, a
+	}
+	return a, b
+}
+
+// Standing is a player's place in the tournament. Buchholz sums the points of the player's
+// opponents; Sonneborn-Berger sums the points of the opponents the player beat and half the
+// points of those drawn with. Byes count as points but add nothing to either tiebreak.
+type Standing struct {
+	Rank            int     `json:"rank"`
+	Name            string  `json:"name"`
+	Points          float64 `json:"points"`
+	Games           int     `json:"games"`
+	Wins            int     `json:"wins"`
+	Draws           int     `json:"draws"`
+	Losses          int     `json:"losses"`
+	SonnebornBerger float64 `json:"sonnebornBerger"`
+	Buchholz        float64 `json:"buchholz"`
+
+	index int
+}
+
+// Standings ranks the players by points, then by Sonneborn-Berger and Buchholz in a round
+// robin, or by Buchholz and Sonneborn-Berger in a Swiss, then by order of entry. Players
+// with equal points and tiebreaks share a rank.
+func (t *Tournament) Standings() []Standing {
+	standings := make([]Standing, len(t.Players))
+	for i, p := range t.Players {
+		standings[i] = Standing{Name: p.Name, index: i}
+	}
+	played := slices.DeleteFunc(slices.Clone(t.games), func(g TournamentGame) bool { return g.Result == "" })
+	for _, g := range played {
+		for _, player := range []int{g.White, g.Black} {
+			if player < 0 {
+				continue
+			}
+			s := &standings[player]
+			s.Points += g.points(player)
+			if g.IsBye() {
+				continue
+			}
+			s.Games++
+			switch g.points(player) {
+			case 1:
+				s.Wins++
+			case 0.5:
+				s.Draws++
+			default:
+				s.Losses++
+			}
+		}
+	}
+	for _, g := range played {
+		if g.IsBye() {
+			continue
+		}
+		for _, pair := range [][2]int{{g.White, g.Black}, {g.Black, g.White}} {
+			player, opponent := pair[0], pair[1]
+			standings[player].Buchholz += standings[opponent].Points
+			standings[player].SonnebornBerger += g.points(player) * standings[opponent].Points
+		}
+	}
+
+	keys := func(s Standing) [3]float64 {
+		if t.opts.Format == Swiss {
+			return [3]float64{s.Points, s.Buchholz, s.SonnebornBerger}
+		}
+		return [3]float64{s.Points, s.SonnebornBerger, s.Buchholz}
+	}
+	slices.SortStableFunc(standings, func(a, b Standing) int {
+		ka, kb := keys(a), keys(b)
+		for i := range ka {
+			if ka[i] != kb[i] {
+				if ka[i] > kb[i] {
+					return -1
+				}
+				return 1
+			}
+		}
+		return 0
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+		if i > 0 && keys(standings[i]) == keys(standings[i-1]) {
+			standings[i].Rank = standings[i-1].Rank
+		}
+	}
+	return standings
+}
+
+// WriteCrosstable writes the standings as a table with one column per opponent, in the
+// order of the standings. Each cell lists the row player's results against that opponent:
+// 1, = or 0 per game, with "." where they have not played.
+func (t *Tournament) WriteCrosstable(w io.Writer) error {
+	standings := t.Standings()
+	width := len("Name")
+	for _, s := range standings {
+		width = max(width, len(s.Name))
+	}
+	cells := make([][]string, len(standings))
+	cellWidth := 1
+	for i, row := range standings {
+		cells[i] = make([]string, len(standings))
+		for j, col := range standings {
+			if i == j {
+				cells[i][j] = "*"
+				continue
+			}
+			var sb strings.Builder
+			for _, g := range t.games {
+				if g.Result == "" || g.IsBye() ||
+					!(g.White == row.index && g.Black == col.index || g.White == col.index && g.Black == row.index) {
+					continue
+				}
+				sb.WriteString(map[float64]string{1: "1", 0.5: "=", 0: "0"}[g.points(row.index)])
+			}
+			if sb.Len() == 0 {
+				sb.WriteString(".")
+			}
+			cells[i][j] = sb.String()
+			cellWidth = max(cellWidth, sb.Len())
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%3s  %-*s %6s %7s %7s", "#", width, "Name", "Points", "SB", "Buchholz")
+	for j := range standings {
+		fmt.Fprintf(&sb, " %*d", cellWidth, j+1)
+	}
+	sb.WriteString("\n")
+	for i, s := range standings {
+		fmt.Fprintf(&sb, "%3d  %-*s %6.1f %7.2f %8.1f", s.Rank, width, s.Name, s.Points, s.SonnebornBerger, s.Buchholz)
+		for _, cell := range cells[i] {
+			fmt.Fprintf(&sb, " %*s", cellWidth, cell)
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WritePGN writes the games played so far, in round order.
+func (t *Tournament) WritePGN(w io.Writer) error {
+	for _, g := range t.games {
+		if g.PGN == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, g.PGN); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteStandingsJSON writes the standings as a JSON document.
+func (t *Tournament) WriteStandingsJSON(w io.Writer) error {
+	played := 0
+	for round := 1; round <= t.TotalRounds(); round++ {
+		if !slices.ContainsFunc(t.games, func(g TournamentGame) bool { return g.Round == round }) ||
+			slices.ContainsFunc(t.games, func(g TournamentGame) bool { return g.Round == round && g.Result == "" }) {
+			break
+		}
+		played = round
+	}
+	doc := struct {
+		Event     string     `json:"event"`
+		Format    string     `json:"format"`
+		Rounds    int        `json:"rounds"`
+		Played    int        `json:"roundsPlayed"`
+		Standings []Standing `json:"standings"`
+	}{t.opts.Event, t.opts.Format.String(), t.TotalRounds(), played, t.Standings()}
+	if doc.Event == "" {
+		doc.Event = "chessx tournament"
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// runTournament implements "tournament -player NAME=SPEC[@OPTIONS] ... [-format roundrobin|swiss]",
+// playing several engine configurations against each other and printing the crosstable.
+func runTournament(args []string, out io.Writer) error {
+	flags := commandFlags("tournament", out)
+	var specs stringList
+	flags.Var(&specs, "player", `a player as NAME=SPEC[@OPTIONS], with SPEC and OPTIONS as for "match" (repeat for each player)`)
+	format := flags.String("format", "roundrobin", "roundrobin or swiss")
+	rounds := flags.Int("rounds", 1, "Swiss rounds, or round-robin cycles")
+	event := flags.String("event", "", "event name for the PGN")
+	openingsPath := flags.String("openings", "", "opening suite: a PGN file, or FEN or EPD lines")
+	tc := flags.String("tc", "", `time control in seconds, such as "10+0.1" or "40/60"`)
+	depth := flags.Int("depth", 4, "search depth in plies per move, without -tc or -nodes")
+	nodes := flags.Int("nodes", 0, "nodes per move, without -tc")
+	statePath := flags.String("state", "tournament.json", "file saving the tournament, to resume it (empty = none)")
+	pgnPath := flags.String("pgn", "tournament.pgn", "PGN file to write the games to")
+	standingsPath := flags.String("standings", "standings.json", "JSON file to write the standings to")
+	adjudication := adjudicationFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(specs) < 2 {
+		return errors.New("usage: tournament -player NAME=SPEC[@OPTIONS] -player NAME=SPEC[@OPTIONS] ...")
+	}
+
+	opts := TournamentOptions{Rounds: *rounds, Event: *event, StatePath: *statePath,
+		Limits: SearchLimits{Depth: max(*depth, 1)}, Adjudication: *adjudication}
+	var err error
+	if opts.Format, err = ParseTournamentFormat(*format); err != nil {
+		return err
+	}
+	if *nodes > 0 {
+		opts.Limits = SearchLimits{Nodes: *nodes}
+	}
+	if *tc != "" {
+		control, err := ParseTimeControl(*tc)
+		if err != nil {
+			return err
+		}
+		opts.TimeControl = &control
+	}
+	if *openingsPath != "" {
+		if opts.Openings, err = LoadOpenings(*openingsPath); err != nil {
+			return err
+		}
+	}
+
+	var players []TournamentPlayer
+	for _, spec := range specs {
+		name, engineSpec, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("player %q: expected NAME=SPEC[@OPTIONS]", spec)
+		}
+		engineSpec, options, _ := strings.Cut(engineSpec, "@")
+		engine, closer, err := openEngine(engineSpec, options)
+		if err != nil {
+			return fmt.Errorf("player %s: %w", name, err)
+		}
+		if closer != nil {
+			defer closer()
+		}
+		players = append(players, TournamentPlayer{Name: name, Engine: engine})
+	}
+	opts.Progress = func(game TournamentGame) {
+		if game.IsBye() {
+			fmt.Fprintf(out, "Round %d: %s has a bye\n", game.Round, players[game.White].Name)
+			return
+		}
+		fmt.Fprintf(out, "Round %d: %s - %s %s (%s)\n", game.Round, players[game.White].Name, players[game.Black].Name,
+			game.Result, game.Reason)
+	}
+	tournament, err := NewTournament(players, opts)
+	if err != nil {
+		return err
+	}
+	runErr := tournament.Run(context.Background())
+
+	if err := tournament.WriteCrosstable(out); err != nil {
+		return err
+	}
+	for _, export := range []struct {
+		path  string
+		write func(io.Writer) error
+	}{{*pgnPath, tournament.WritePGN}, {*standingsPath, tournament.WriteStandingsJSON}} {
+		if export.path == "" {
+			continue
+		}
+		f, err := os.Create(export.path)
+		if err != nil {
+			return err
+		}
+		if err := export.write(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return runErr
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testPlayers returns n players that play instantly.
+func testPlayers(n int) []TournamentPlayer {
+	players := make([]TournamentPlayer, n)
+	for i := range players {
+		players[i] = TournamentPlayer{Name: string(rune('A' + i)), Engine: firstMoveEngine{}}
+	}
+	return players
+}
+
+func TestRoundRobinPairings(t *testing.T) {
+	for n := 2; n <= 9; n++ {
+		tournament, err := NewTournament(testPlayers(n), TournamentOptions{Rounds: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		met := map[[2]int]int{}
+		whites := make([]int, n)
+		for round := 1; round <= tournament.TotalRounds(); round++ {
+			seen := map[int]bool{}
+			for _, g := range tournament.pair(round) {
+				if seen[g.White] || seen[g.Black] {
+					t.Fatalf("%d players, round %d: a player is paired twice", n, round)
+				}
+				seen[g.White], seen[g.Black] = true, true
+				met[[2]int{g.White, g.Black}]++
+				whites[g.White]++
+			}
+		}
+		for a := range n {
+			for b := range n {
+				if a != b && met[[2]int{a, b}] != 1 {
+					t.Errorf("%d players: %c had White against %c %d times over two cycles", n, 'A'+a, 'A'+b, met[[2]int{a, b}])
+				}
+			}
+			if whites[a] != n-1 {
+				t.Errorf("%d players: %c had White %d times, want %d", n, 'A'+a, whites[a], n-1)
+			}
+		}
+		// Within one cycle colours are as balanced as the number of games allows
+		single, _ := NewTournament(testPlayers(n), TournamentOptions{})
+		whites = make([]int, n)
+		for round := 1; round <= single.TotalRounds(); round++ {
+			for _, g := range single.pair(round) {
+				whites[g.White]++
+			}
+		}
+		for a, w := range whites {
+			if w < (n-1)/2 || w > n/2 {
+				t.Errorf("%d players: %c has White %d times in a cycle", n, 'A'+a, w)
+			}
+		}
+	}
+}
+
+func TestSwissPairings(t *testing.T) {
+	tournament, err := NewTournament(testPlayers(5), TournamentOptions{Format: Swiss, Rounds: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Round 1 goes by order of entry, with the bye for the last player
+	round1 := tournament.pair(1)
+	byes := slices.DeleteFunc(slices.Clone(round1), func(g TournamentGame) bool { return !g.IsBye() })
+	if len(round1) != 3 || len(byes) != 1 || byes[0].White != 4 {
+		t.Fatalf("unexpected first round %+v", round1)
+	}
+	// White wins every game, and the bye scores a point
+	for i := range round1 {
+		round1[i].Result = "1-0"
+	}
+	tournament.games = round1
+
+	round2 := tournament.pair(2)
+	for _, g := range round2 {
+		if g.IsBye() {
+			if g.White == 4 {
+				t.Errorf("player E got a second bye")
+			}
+			continue
+		}
+		for _, previous := range round1 {
+			if previous.White == g.White && previous.Black == g.Black || previous.White == g.Black && previous.Black == g.White {
+				t.Errorf("rematch of %c and %c in round 2", 'A'+g.White, 'A'+g.Black)
+			}
+		}
+	}
+	// The three players on one point meet each other where they can
+	leaders := map[int]bool{}
+	for _, s := range tournament.Standings() {
+		if s.Points == 1 {
+			leaders[s.index] = true
+		}
+	}
+	pairedLeaders := 0
+	for _, g := range round2 {
+		if !g.IsBye() && leaders[g.White] && leaders[g.Black] {
+			pairedLeaders++
+		}
+	}
+	if pairedLeaders != 1 {
+		t.Errorf("expected one game between leaders in round 2, got %d: %+v", pairedLeaders, round2)
+	}
+}
+
+func TestStandings_Tiebreaks(t *testing.T) {
+	tournament, err := NewTournament(testPlayers(4), TournamentOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A beats B and draws C, B beats C, C beats D, D beats A, B draws D
+	tournament.games = []TournamentGame{
+		{Round: 1, White: 0, Black: 1, Result: "1-0"},
+		{Round: 1, White: 2, Black: 0, Result: "1/2-1/2"},
+		{Round: 2, White: 1, Black: 2, Result: "1-0"},
+		{Round: 2, White: 2, Black: 3, Result: "1-0"},
+		{Round: 3, White: 3, Black: 0, Result: "1-0"},
+		{Round: 3, White: 1, Black: 3, Result: "1/2-1/2"},
+	}
+	want := map[string]Standing{
+		"A": {Points: 1.5, Wins: 1, Draws: 1, Losses: 1, SonnebornBerger: 1.5 + 0.75, Buchholz: 1.5 + 1.5 + 1.5},
+		"B": {Points: 1.5, Wins: 1, Draws: 1, Losses: 1, SonnebornBerger: 1.5 + 0.75, Buchholz: 1.5 + 1.5 + 1.5},
+		"C": {Points: 1.5, Wins: 1, Draws: 1, Losses: 1, SonnebornBerger: 1.5 + 0.75, Buchholz: 1.5 + 1.5 + 1.5},
+		"D": {Points: 1.5, Wins: 1, Draws: 1, Losses: 1, SonnebornBerger: 1.5 + 0.75, Buchholz: 1.5 + 1.5 + 1.5},
+	}
+	for _, s := range tournament.Standings() {
+		w := want[s.Name]
+		if s.Points != w.Points || s.Wins != w.Wins || s.Draws != w.Draws || s.Losses != w.Losses ||
+			s.SonnebornBerger != w.SonnebornBerger || s.Buchholz != w.Buchholz || s.Rank != 1 {
+			t.Errorf("%s: got %+v, want %+v", s.Name, s, w)
+		}
+	}
+
+	// Now A beats D instead of losing: A leads, and B's win over C is worth as much as C's
+	// draw with A plus its win over D, so B and C share second place
+	tournament.games[4].Result = "0-1"
+	standings := tournament.Standings()
+	if standings[0].Name != "A" || standings[0].Points != 2.5 || standings[0].Rank != 1 {
+		t.Fatalf("expected A to lead, got %+v", standings[0])
+	}
+	byName := map[string]Standing{}
+	for _, s := range standings {
+		byName[s.Name] = s
+	}
+	if b := byName["B"]; b.SonnebornBerger != 1.5*0+1*1.5+0.5*0.5 {
+		t.Errorf("B's Sonneborn-Berger %.2f", b.SonnebornBerger)
+	}
+	if c := byName["C"]; c.Buchholz != 2.5+1.5+0.5 || c.SonnebornBerger != 0.5*2.5+1*0.5 {
+		t.Errorf("C's tiebreaks: %+v", c)
+	}
+	if standings[1].Name != "B" || standings[2].Name != "C" || standings[1].Rank != 2 || standings[2].Rank != 2 ||
+		standings[3].Name != "D" || standings[3].Rank != 4 {
+		t.Errorf("unexpected standings %+v", standings)
+	}
+}
+
+func TestTournament_RunAndResume(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "state.json")
+	players := []TournamentPlayer{
+		{Name: "search", Engine: Dumbfish{}},
+		{Name: "first", Engine: firstMoveEngine{}},
+		{Name: "other", Engine: firstMoveEngine{}},
+	}
+	opts := TournamentOptions{Format: Swiss, Rounds: 3, Limits: SearchLimits{Depth: 1}, StatePath: state,
+		Adjudication: Adjudication{ResignScore: 500, ResignMoves: 1, MaxMoves: 60}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	played := 0
+	opts.Progress = func(TournamentGame) {
+		if played++; played == 2 {
+			cancel()
+		}
+	}
+	first, err := NewTournament(players, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the run to be cancelled, got %v", err)
+	}
+
+	opts.Progress = nil
+	resumed, err := NewTournament(players, opts)
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if done := slices.DeleteFunc(resumed.Games(), func(g TournamentGame) bool { return g.Result == "" }); len(done) != 2 {
+		t.Fatalf("resumed with %d games played, want 2", len(done))
+	}
+	if err := resumed.Run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	games := resumed.Games()
+	if len(games) != 6 {
+		t.Fatalf("expected 3 rounds of 2 games (one a bye), got %d", len(games))
+	}
+	byes := map[int]int{}
+	for _, g := range games {
+		if g.IsBye() {
+			byes[g.White]++
+		}
+	}
+	if len(byes) != 3 {
+		t.Errorf("each player should get one bye: %v", byes)
+	}
+	if standings := resumed.Standings(); standings[0].Name != "search" || standings[0].Points < 2 {
+		t.Errorf("the searching engine should win: %+v", standings)
+	}
+
+	var pgn strings.Builder
+	if err := resumed.WritePGN(&pgn); err != nil {
+		t.Fatal(err)
+	}
+	if written, err := ReadPGN(strings.NewReader(pgn.String())); err != nil || len(written) != 3 {
+		t.Errorf("PGN export holds %d games: %v", len(written), err)
+	}
+	var doc struct {
+		Format    string     `json:"format"`
+		Played    int        `json:"roundsPlayed"`
+		Standings []Standing `json:"standings"`
+	}
+	var standings strings.Builder
+	if err := resumed.WriteStandingsJSON(&standings); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(standings.String()), &doc); err != nil {
+		t.Fatalf("standings JSON: %v", err)
+	}
+	if doc.Format != "swiss" || doc.Played != 3 || len(doc.Standings) != 3 || doc.Standings[0].Name != "search" {
+		t.Errorf("unexpected standings document %+v", doc)
+	}
+	var table strings.Builder
+	if err := resumed.WriteCrosstable(&table); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(table.String()), "\n"); len(lines) != 4 || !strings.Contains(lines[1], "search") {
+		t.Errorf("unexpected crosstable:\n%s", table.String())
+	}
+
+	// The saved tournament does not fit other players
+	if _, err := NewTournament(players[:2], opts); err == nil {
+		t.Error("expected an error resuming with different players")
+	}
+}
+
+func TestNewTournament_Validation(t *testing.T) {
+	if _, err := NewTournament(testPlayers(1), TournamentOptions{}); err == nil {
+		t.Error("expected an error for one player")
+	}
+	players := testPlayers(2)
+	players[1].Name = players[0].Name
+	if _, err := NewTournament(players, TournamentOptions{}); err == nil {
+		t.Error("expected an error for duplicate names")
+	}
+	for _, s := range []string{"roundrobin", "round-robin", "RR", "Swiss"} {
+		if _, err := ParseTournamentFormat(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	if _, err := ParseTournamentFormat("knockout"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestRunTournamentCommand(t *testing.T) {
+	dir := t.TempDir()
+	var out strings.Builder
+	args := []string{"-player", "base=dumbfish", "-player", "nonull=dumbfish@NullMove=false", "-depth", "1",
+		"-max-moves", "10", "-state", filepath.Join(dir, "state.json"), "-pgn", filepath.Join(dir, "games.pgn"),
+		"-standings", filepath.Join(dir, "standings.json")}
+	if err := runTournament(args, &out); err != nil {
+		t.Fatalf("tournament: %v", err)
+	}
+	if !strings.Contains(out.String(), "Round 1: ") || !strings.Contains(out.String(), "Buchholz") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+	if err := runTournament([]string{"-player", "solo=dumbfish"}, &out); err == nil {
+		t.Error("expected an error for one player")
+	}
+	if err := runTournament([]string{"-player", "dumbfish", "-player", "b=dumbfish", "-state", ""}, &out); err == nil {
+		t.Error("expected an error for a player without a name")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import "sync/atomic"
+
+// Bound says how a stored score relates to the true score of a position.
+type ttBound uint8
+
+const (
+	boundNone  ttBound = iota
+	boundUpper         // the search failed low: the true score is at most the stored one
+	boundLower         // the search failed high: the true score is at least the stored one
+	boundExact
+)
+
+// defaultHashMB sizes the table of a UCI session until the GUI sets "Hash".
+const defaultHashMB = 16
+
+// ttEntry is one slot of the transposition table. Entries are read and written without locks:
+// the key is stored XORed with the data, so a slot torn by two racing writers no longer
+// matches either position and is treated as a miss.
+type ttEntry struct {
+	key  atomic.Uint64
+	data atomic.Uint64
+}
+
+// ttData is an unpacked entry. Packed, the score takes bits 0-31, the move 32-47, the depth
+// 48-55, the bound 56-57 and the generation 58-63.
+type ttData struct {
+	score      int
+	move       uint16
+	depth      int
+	bound      ttBound
+	generation uint8
+}
+
+func (d ttData) pack() uint64 {
+	return uint64(uint32(int32(d.score))) |
+		uint64(d.move)<<32 |
+		uint64(uint8(d.depth))<<48 |
+		uint64(d.bound&3)<<56 |
+		uint64(d.generation&63)<<58
+}
+
+func unpackTTData(v uint64) ttData {
+	return ttData{
+		score:      int(int32(uint32(v))),
+		move:       uint16(v >> 32),
+		depth:      int(uint8(v >> 48)),
+		bound:      ttBound(v>>56) & 3,
+		generation: uint8(v>>58) & 63,
+	}
+}
+
+// TranspositionTable caches search results by position. One table is shared by all search
+// threads, and by consecutive searches of a game.
+type TranspositionTable struct {
+	entries    []ttEntry
+	mask       uint64
+	generation uint8 // bumped by NewSearch; only changed while no search runs
+}
+
+// NewTranspositionTable allocates a table of at most megabytes MB, rounded down to a power
+// of two number of entries.
+func NewTranspositionTable(megabytes int) *TranspositionTable {
+	n := uint64(1)
+	for n*2*16 <= uint64(max(megabytes, 1))<<20 {
+		n *= 2
+	}
+	return &TranspositionTable{entries: make([]ttEntry, n), mask: n - 1}
+}
+
+// Clear forgets every stored position, e.g. before a new game.
+func (t *TranspositionTable) Clear() {
+	for i := range t.entries {
+		t.entries[i].key.Store(0)
+		t.entries[i].data.Store(0)
+	}
+	t.generation = 0
+}
+
+// NewSearch ages the stored entries so the next search prefers to overwrite them.
+func (t *TranspositionTable) NewSearch() {
+	t.generation = (t.generation + 1) & 63
+}
+
+// HashFull returns the permille of sampled entries written during the current search.
+func (t *TranspositionTable) HashFull() int {
+	if t == nil {
+		return 0
+	}
+	n := min(len(t.entries), 1000)
+	used := 0
+	for i := range n {
+		data := t.entries[i].data.Load()
+		if data != 0 && unpackTTData(data).generation == t.generation {
+			used++
+		}
+	}
+	return used * 1000 / n
+}
+
+func (t *TranspositionTable) probe(key uint64) (ttData, bool) {
+	if t == nil {
+		return ttData{}, false
+	}
+	e := &t.entries[key&t.mask]
+	data := e.data.Load()
+	if data == 0 || e.key.Load()^data != key {
+		return ttData{}, false
+	}
+	return unpackTTData(data), true
+}
+
+// store saves a search result. A slot is kept for a deeper result of the same position
+// from this search, unless the new result is exact.
+func (t *TranspositionTable) store(key uint64, d ttData) {
+	if t == nil {
+		return
+	}
+	e := &t.entries[key&t.mask]
+	old := e.data.Load()
+	if old != 0 && e.key.Load()^old == key {
+		prev := unpackTTData(old)
+		if prev.generation == t.generation && prev.depth > d.depth && d.bound != boundExact {
+			return
+		}
+		if d.move == 0 {
+			d.move = prev.move
+		}
+	}
+	d.generation = t.generation
+	data := d.pack()
+	e.key.Store(key ^ data)
+	e.data.Store(data)
+}
+
+// scoreToTT makes mate and tablebase scores relative to the stored position rather than the
+// root, so they stay correct when the position is reached at a different ply.
+func scoreToTT(score, ply int) int {
+	switch {
+	case score >= tbWinScore-maxSearchPly:
+		return score + ply
+	case score <= -tbWinScore+maxSearchPly:
+		return score - ply
+	}
+	return score
+}
+
+// scoreFromTT undoes scoreToTT for a position reached at ply.
+func scoreFromTT(score, ply int) int {
+	switch {
+	case score >= tbWinScore-maxSearchPly:
+		return score - ply
+	case score <= -tbWinScore+maxSearchPly:
+		return score + ply
+	}
+	return score
+}
+
+// packMove encodes a move in 16 bits: from (or the dropped kind) in bits 0-5, to in 6-11,
+// the promotion kind in 12-14 and the drop flag in bit 15. Zero means no move.
+func packMove(m GeneratedMove) uint16 {
+	to, _ := squareToIndex(m.To)
+	if m.IsDrop {
+		return uint16(m.Kind) | uint16(to)<<6 | 1<<15
+	}
+	from, _ := squareToIndex(m.From)
+	return uint16(from) | uint16(to)<<6 | uint16(m.Promotion)<<12
+}
+
+// searchKey hashes a position for the transposition table: the Polyglot key, plus the
+// variant and Crazyhouse state that Polyglot does not cover.
+func searchKey(pos *Position) uint64 {
+	key := PolyglotKey(pos)
+	if pos.variant == Standard {
+		return key
+	}
+	key ^= mix64(uint64(pos.variant))
+	if pos.variant == Crazyhouse {
+		for color := range pos.pockets {
+			for _, kind := range pocketKinds {
+				if n := pos.pockets[color][kind]; n > 0 {
+					key ^= mix64(uint64(color)<<16 | uint64(kind)<<8 | uint64(n))
+				}
+			}
+		}
+		key ^= mix64(uint64(pos.promoted) ^ 0x9e3779b97f4a7c15)
+	}
+	return key
+}
+
+// mix64 is the SplitMix64 finalizer, used to derive hash keys for state without Polyglot keys.
+func mix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
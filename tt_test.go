@@ -0,0 +1,151 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestTranspositionTable_StoreProbe(t *testing.T) {
+	tt := NewTranspositionTable(1)
+	if len(tt.entries) != 1<<16 {
+		t.Fatalf("expected 65536 entries in 1MB, got %d", len(tt.entries))
+	}
+	tt.NewSearch()
+	key := uint64(0x1234_5678_9abc_def0)
+	want := ttData{score: -mateScore + 7, move: 0x8123, depth: 9, bound: boundUpper}
+	tt.store(key, want)
+	got, ok := tt.probe(key)
+	want.generation = tt.generation
+	if !ok || got != want {
+		t.Fatalf("probe: got %+v %v, want %+v", got, ok, want)
+	}
+	// Same slot, different position
+	if _, ok := tt.probe(key ^ 1<<40); ok {
+		t.Errorf("expected a miss for another key in the same slot")
+	}
+
+	// A shallower bound does not replace a deeper result of this search, an exact one does
+	tt.store(key, ttData{score: 5, depth: 3, bound: boundLower})
+	if got, _ := tt.probe(key); got.depth != 9 {
+		t.Errorf("shallow bound replaced a deeper entry: %+v", got)
+	}
+	tt.store(key, ttData{score: 5, depth: 3, bound: boundExact})
+	if got, _ := tt.probe(key); got.depth != 3 || got.move != want.move {
+		t.Errorf("expected the exact result to replace the entry and keep its move: %+v", got)
+	}
+	tt.NewSearch()
+	tt.store(key, ttData{score: 1, depth: 1, bound: boundLower})
+	if got, _ := tt.probe(key); got.depth != 1 {
+		t.Errorf("expected an entry from an older search to be replaced: %+v", got)
+	}
+
+	tt.Clear()
+	if _, ok := tt.probe(key); ok {
+		t.Errorf("expected Clear to empty the table")
+	}
+}
+
+func TestTranspositionTable_HashFull(t *testing.T) {
+	tt := NewTranspositionTable(1)
+	tt.NewSearch()
+	for i := range 500 {
+		tt.store(uint64(i), ttData{depth: 1, bound: boundExact})
+	}
+	if got := tt.HashFull(); got != 500 {
+		t.Errorf("expected 500 permille, got %d", got)
+	}
+	tt.NewSearch()
+	if got := tt.HashFull(); got != 0 {
+		t.Errorf("expected entries of the last search not to count, got %d", got)
+	}
+	if got := (*TranspositionTable)(nil).HashFull(); got != 0 {
+		t.Errorf("expected 0 without a table, got %d", got)
+	}
+}
+
+// TestTranspositionTable_ConcurrentWriters hammers a tiny table from several goroutines. Every
+// writer stores data derived from its key, so a torn entry shows up as a hit with the wrong data.
+func TestTranspositionTable_ConcurrentWriters(t *testing.T) {
+	tt := &TranspositionTable{entries: make([]ttEntry, 4), mask: 3}
+	var wg sync.WaitGroup
+	errs := make(chan ttData, 1)
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 20000 {
+				key := mix64(uint64(w*20000 + i))
+				want := ttData{score: int(int16(key)), move: uint16(key >> 16), depth: int(uint8(key >> 32)), bound: boundExact}
+				tt.store(key, want)
+				if got, ok := tt.probe(key); ok && (got.score != want.score || got.move != want.move || got.depth != want.depth) {
+					select {
+					case errs <- got:
+					default:
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	if got, bad := <-errs; bad {
+		t.Fatalf("probe returned data of another position: %+v", got)
+	}
+}
+
+func TestScoreToTT(t *testing.T) {
+	for _, score := range []int{0, 250, -900, mateScore - 5, -mateScore + 8, tbWinScore - 3, -tbWinScore + 4} {
+		stored := scoreToTT(score, 3)
+		if got := scoreFromTT(stored, 3); got != score {
+			t.Errorf("%d: round trip gave %d", score, got)
+		}
+	}
+	// A mate in 2 plies from a node at ply 3 is a mate in 5 from the root, and in 3 from ply 1
+	if got := scoreFromTT(scoreToTT(mateScore-5, 3), 1); got != mateScore-3 {
+		t.Errorf("expected mate distance to follow the ply, got %d", got)
+	}
+}
+
+func TestPackMove_Distinct(t *testing.T) {
+	fens := []string{
+		"r3k2r/1P6/8/3pP3/8/8/6p1/R3K2R w KQkq d6 0 1",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR[QNp] b KQkq - 0 1",
+	}
+	for _, fen := range fens {
+		pos, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := map[uint16]string{}
+		for _, ap := range generateLegalMoves(pos) {
+			packed := packMove(ap.Move)
+			if packed == 0 {
+				t.Errorf("%s: %s packs to the empty move", fen, ap.Move.UCINotation())
+			}
+			if other, dup := seen[packed]; dup {
+				t.Errorf("%s: %s and %s pack to %#x", fen, other, ap.Move.UCINotation(), packed)
+			}
+			seen[packed] = ap.Move.UCINotation()
+		}
+	}
+}
+
+func TestSearchKey(t *testing.T) {
+	start := NewVariantPosition(Standard)
+	pos := start
+	for _, uci := range []string{"g1f3", "g8f6", "f3g1", "f6g8"} {
+		ap, _ := findUCIMove(pos, uci)
+		pos = ap.Position
+	}
+	if searchKey(pos) != searchKey(start) {
+		t.Errorf("expected a transposition to the start position to hash the same")
+	}
+
+	a, _ := ParseFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1")
+	b, _ := ParseFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[N] w KQkq - 0 1")
+	c, _ := ParseFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[n] w KQkq - 0 1")
+	keys := map[uint64]bool{searchKey(start): true, searchKey(a): true, searchKey(b): true, searchKey(c): true}
+	if len(keys) != 4 {
+		t.Errorf("expected the variant and pockets to change the key")
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// slots returns pointers to every weight of p in a fixed order, so the tuner can treat the
+// parameters as one vector.
+func (p *EvalParams) slots() []*int {
+	var slots []*int
+	for _, table := range []*[7]int{&p.MaterialMG, &p.MaterialEG} {
+		for k := range table {
+			slots = append(slots, &table[k])
+		}
+	}
+	for _, tables := range []*[7][64]int{&p.PSTMG, &p.PSTEG} {
+		for k := range tables {
+			for sq := range tables[k] {
+				slots = append(slots, &tables[k][sq])
+			}
+		}
+	}
+	return slots
+}
+
+// Flat index offsets of the groups in slots.
+const (
+	slotMaterialMG = 0
+	slotMaterialEG = 7
+	slotPSTMG      = 14
+	slotPSTEG      = slotPSTMG + 7*64
+	slotCount      = slotPSTEG + 7*64
+)
+
+// evalTerm is one weight's coefficient in a position's evaluation.
+type evalTerm struct {
+	slot int
+	coef float64
+}
+
+// evalTerms expresses the evaluation of pos from White's point of view as a linear function
+// of the parameters: the sum of coef times slot value over the terms, before rounding.
+func evalTerms(pos *Position) []evalTerm {
+	phase := float64(gamePhase(pos)) / totalPhase
+	coefs := map[int]float64{}
+	add := func(kind PieceKind, sq int, sign float64) {
+		coefs[slotMaterialMG+int(kind)] += sign * phase
+		coefs[slotMaterialEG+int(kind)] += sign * (1 - phase)
+		if sq >= 0 {
+			coefs[slotPSTMG+int(kind)*64+sq] += sign * phase
+			coefs[slotPSTEG+int(kind)*64+sq] += sign * (1 - phase)
+		}
+	}
+	for i := range pos.pieces {
+		piece := &pos.pieces[i]
+		if piece.Location.IsEmpty() {
+			continue
+		}
+		sign := 1.0
+		if piece.Color == Black {
+			sign = -1
+		}
+		add(piece.Kind, pstSquare(piece.Location.FirstSet(), piece.Color), sign)
+	}
+	if pos.variant == Crazyhouse {
+		for _, kind := range pocketKinds {
+			if n := pos.pockets[White][kind] - pos.pockets[Black][kind]; n != 0 {
+				add(kind, -1, float64(n))
+			}
+		}
+	}
+	terms := make([]evalTerm, 0, len(coefs))
+	for slot := range slotCount {
+		if c := coefs[slot]; c != 0 {
+			terms = append(terms, evalTerm{slot, c})
+		}
+	}
+	return terms
+}
+
+// TuningPosition is a position of the training set, reduced to its evaluation terms.
+type TuningPosition struct {
+	terms  []evalTerm
+	result float64 // game result from White's point of view: 1, 0.5 or 0
+}
+
+// ReadTuningSet reads one labelled position per line: a FEN or EPD followed by the game
+// result as "[1.0]", "[0.5]", "[0.0]", or a "1-0", "0-1" or "1/2-1/2" token, possibly
+// quoted as in the EPD opcode c9 "1-0";. Blank lines and lines starting with '#' are skipped.
+func ReadTuningSet(r io.Reader) ([]TuningPosition, error) {
+	var set []TuningPosition
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fen, result, err := parseLabelledFEN(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		pos, err := ParseFEN(fen)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		set = append(set, TuningPosition{terms: evalTerms(pos), result: result})
+	}
+	return set, scanner.Err()
+}
+
+// parseLabelledFEN splits a labelled line into its position and result.
+func parseLabelledFEN(line string) (string, float64, error) {
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		var result float64
+		if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+			// Bare numbers are FEN clocks; results as numbers come in brackets
+			r, err := strconv.ParseFloat(field[1:len(field)-1], 64)
+			if err != nil || r < 0 || r > 1 {
+				return "", 0, fmt.Errorf("bad result %q", field)
+			}
+			result = r
+		} else {
+			switch strings.Trim(field, `";`) {
+			case "1-0":
+				result = 1
+			case "0-1":
+				result = 0
+			case "1/2-1/2":
+				result = 0.5
+			default:
+				continue
+			}
+		}
+		fenFields := fields[:i]
+		if n := len(fenFields); n > 0 && fenFields[n-1] == "c9" {
+			fenFields = fenFields[:n-1]
+		}
+		// EPD has no move counters, but needs board, side, castling and en passant
+		if len(fenFields) < 4 {
+			return "", 0, fmt.Errorf("missing position before result %q", field)
+		}
+		return strings.Join(fenFields, " "), result, nil
+	}
+	return "", 0, fmt.Errorf("no game result in %q", line)
+}
+
+// Tuner fits EvalParams to labelled positions with the Texel method: it minimises the mean
+// squared difference between game results and the evaluation mapped through a sigmoid.
+type Tuner struct {
+	Params    EvalParams
+	K         float64 // sigmoid scale; fitted by FitK
+	positions []TuningPosition
+}
+
+// NewTuner starts tuning from params.
+func NewTuner(params EvalParams, positions []TuningPosition) *Tuner {
+	return &Tuner{Params: params, K: 1, positions: positions}
+}
+
+// sigmoid maps a centipawn score to an expected result.
+func sigmoid(k, score float64) float64 {
+	return 1 / (1 + math.Pow(10, -k*score/400))
+}
+
+func (t *Tuner) vector() []float64 {
+	slots := t.Params.slots()
+	v := make([]float64, len(slots))
+	for i, s := range slots {
+		v[i] = float64(*s)
+	}
+	return v
+}
+
+func (t *Tuner) setVector(v []float64) {
+	for i, s := range t.Params.slots() {
+		*s = int(math.Round(v[i]))
+	}
+}
+
+func linearEval(terms []evalTerm, v []float64) float64 {
+	score := 0.0
+	for _, term := range terms {
+		score += term.coef * v[term.slot]
+	}
+	return score
+}
+
+// Error returns the mean squared error of the current parameters.
+func (t *Tuner) Error() float64 {
+	return t.errorOf(t.vector(), t.K)
+}
+
+func (t *Tuner) errorOf(v []float64, k float64) float64 {
+	if len(t.positions) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, p := range t.positions {
+		d := p.result - sigmoid(k, linearEval(p.terms, v))
+		sum += d * d
+	}
+	return sum / float64(len(t.positions))
+}
+
+// FitK chooses the sigmoid scale that best fits the current parameters, by golden-section
+// search, so that tuning changes the weights rather than the overall scale.
+func (t *Tuner) FitK() float64 {
+	v := t.vector()
+	lo, hi := 0.01, 5.0
+	ratio := (math.Sqrt(5) - 1) / 2
+	for hi-lo > 1e-4 {
+		a := hi - ratio*(hi-lo)
+		b := lo + ratio*(hi-lo)
+		if t.errorOf(v, a) < t.errorOf(v, b) {
+			hi = b
+		} else {
+			lo = a
+		}
+	}
+	t.K = (lo + hi) / 2
+	return t.K
+}
+
+// activeSlots returns the parameters that some position depends on.
+func (t *Tuner) activeSlots() []int {
+	used := make([]bool, slotCount)
+	for _, p := range t.positions {
+		for _, term := range p.terms {
+			used[term.slot] = true
+		}
+	}
+	var active []int
+	for slot, u := range used {
+		if u {
+			active = append(active, slot)
+		}
+	}
+	return active
+}
+
+// LocalSearch is the classic Texel tuner: each pass tries moving every parameter by step in
+// both directions, keeping changes that lower the error, until a pass improves nothing or
+// passes runs out. progress, if not nil, is called with the error after every pass.
+func (t *Tuner) LocalSearch(passes, step int, progress func(pass int, err float64)) {
+	v := t.vector()
+	best := t.errorOf(v, t.K)
+	for pass := 1; pass <= passes; pass++ {
+		improved := false
+		for _, slot := range t.activeSlots() {
+			for _, delta := range []float64{float64(step), -float64(step)} {
+				v[slot] += delta
+				if e := t.errorOf(v, t.K); e < best {
+					best, improved = e, true
+					break
+				}
+				v[slot] -= delta
+			}
+		}
+		if progress != nil {
+			progress(pass, best)
+		}
+		if !improved {
+			break
+		}
+	}
+	t.setVector(v)
+}
+
+// GradientDescent minimises the error with Adam over full-batch gradients, for the given
+// number of epochs and learning rate in centipawns. progress, if not nil, is called with the
+// error after every epoch.
+func (t *Tuner) GradientDescent(epochs int, rate float64, progress func(epoch int, err float64)) {
+	const beta1, beta2, epsilon = 0.9, 0.999, 1e-8
+	v := t.vector()
+	m := make([]float64, len(v))
+	s := make([]float64, len(v))
+	grad := make([]float64, len(v))
+	scale := math.Ln10 * t.K / 400
+	for epoch := 1; epoch <= epochs; epoch++ {
+		clear(grad)
+		for _, p := range t.positions {
+			predicted := sigmoid(t.K, linearEval(p.terms, v))
+			g := -2 * (p.result - predicted) * predicted * (1 - predicted) * scale
+			for _, term := range p.terms {
+				grad[term.slot] += g * term.coef
+			}
+		}
+		n := float64(len(t.positions))
+		for i := range v {
+			g := grad[i] / n
+			m[i] = beta1*m[i] + (1-beta1)*g
+			s[i] = beta2*s[i] + (1-beta2)*g*g
+			mHat := m[i] / (1 - math.Pow(beta1, float64(epoch)))
+			sHat := s[i] / (1 - math.Pow(beta2, float64(epoch)))
+			v[i] -= rate * mHat / (math.Sqrt(sHat) + epsilon)
+		}
+		if progress != nil {
+			progress(epoch, t.errorOf(v, t.K))
+		}
+	}
+	t.setVector(v)
+}
+
+// WriteEvalParams writes p as a gofmt-ed Go source file declaring defaultEvalParams, to be
+// compiled into the evaluator in place of eval_params.go.
+func WriteEvalParams(w io.Writer, p EvalParams) error {
+	var src bytes.Buffer
+	src.WriteString("// Code generated by \"chessx tune\"; DO NOT EDIT.\n\npackage main\n\n")
+	src.WriteString("var defaultEvalParams = EvalParams{\n")
+	for _, group := range []struct {
+		name   string
+		values *[7]int
+	}{{"MaterialMG", &p.MaterialMG}, {"MaterialEG", &p.MaterialEG}} {
+		fmt.Fprintf(&src, "%s: [7]int{%s},\n", group.name, joinInts(group.values[:]))
+	}
+	for _, group := range []struct {
+		name   string
+		tables *[7][64]int
+	}{{"PSTMG", &p.PSTMG}, {"PSTEG", &p.PSTEG}} {
+		fmt.Fprintf(&src, "%s: [7][64]int{\n", group.name)
+		for kind, table := range group.tables {
+			if kind == int(Empty) {
+				fmt.Fprintf(&src, "{}, // empty\n")
+				continue
+			}
+			fmt.Fprintf(&src, "{ // %s, from rank 1 (a1-h1) up to rank 8\n", pieceKindName(PieceKind(kind)))
+			for rank := range 8 {
+				fmt.Fprintf(&src, "%s,\n", joinInts(table[rank*8:rank*8+8]))
+			}
+			src.WriteString("},\n")
+		}
+		src.WriteString("},\n")
+	}
+	src.WriteString("}\n")
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+// joinInts formats values as a comma-separated list.
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func pieceKindName(kind PieceKind) string {
+	return [...]string{"empty", "pawn", "rook", "knight", "bishop", "queen", "king"}[kind]
+}
+
+// runTune implements "tune -data FILE [-out FILE] [-method gd|local]", fitting the
+// evaluation parameters to labelled positions and writing them as Go source.
+func runTune(args []string, out io.Writer) error {
+	flags := commandFlags("tune", out)
+	data := flags.String("data", "", "labelled positions, one FEN or EPD with its result per line")
+	output := flags.String("out", "eval_params.go", "Go file to write the tuned parameters to")
+	method := flags.String("method", "gd", "gd (gradient descent) or local (Texel local search)")
+	iterations := flags.Int("iterations", 1000, "epochs of gradient descent or passes of local search")
+	rate := flags.Float64("rate", 1, "gradient descent learning rate, in centipawns")
+	step := flags.Int("step", 1, "local search step, in centipawns")
+	k := flags.Float64("k", 0, "sigmoid scale (0 fits it to the starting parameters)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *data == "" {
+		return errors.New("usage: tune -data FILE [-out FILE] [-method gd|local] [-iterations N]")
+	}
+	f, err := os.Open(*data)
+	if err != nil {
+		return err
+	}
+	positions, err := ReadTuningSet(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", *data, err)
+	}
+
+	tuner := NewTuner(defaultEvalParams, positions)
+	tuner.K = *k
+	if tuner.K <= 0 {
+		tuner.FitK()
+	}
+	fmt.Fprintf(out, "%d positions, K = %.4f, error %.6f\n", len(positions), tuner.K, tuner.Error())
+	progress := func(i int, e float64) {
+		if i%100 == 0 || *method == "local" {
+			fmt.Fprintf(out, "iteration %d: error %.6f\n", i, e)
+		}
+	}
+	switch *method {
+	case "gd":
+		tuner.GradientDescent(*iterations, *rate, progress)
+	case "local":
+		tuner.LocalSearch(*iterations, *step, progress)
+	default:
+		return fmt.Errorf("unknown method %q", *method)
+	}
+	fmt.Fprintf(out, "final error %.6f\n", tuner.Error())
+
+	w, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := WriteEvalParams(w, tuner.Params); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
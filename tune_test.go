@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLabelledFEN(t *testing.T) {
+	cases := []struct {
+		line, fen string
+		result    float64
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 [0.5]", standardStartFEN, 0.5},
+		{"8/8/4k3/8/8/4K3/4P3/8 w - - 0 1 [1.0]", "8/8/4k3/8/8/4K3/4P3/8 w - - 0 1", 1},
+		{`8/8/4k3/8/8/4K3/4P3/8 b - - c9 "0-1";`, "8/8/4k3/8/8/4K3/4P3/8 b - -", 0},
+		{"8/8/4k3/8/8/4K3/4P3/8 w - - 12 40 1/2-1/2", "8/8/4k3/8/8/4K3/4P3/8 w - - 12 40", 0.5},
+	}
+	for _, tc := range cases {
+		fen, result, err := parseLabelledFEN(tc.line)
+		if err != nil || fen != tc.fen || result != tc.result {
+			t.Errorf("%q: got %q %v %v, want %q %v", tc.line, fen, result, err, tc.fen, tc.result)
+		}
+	}
+	for _, bad := range []string{"8/8/4k3/8/8/4K3/4P3/8 w - - 0 1", "1-0", "8/8/8/8 w - - [2]"} {
+		if _, _, err := parseLabelledFEN(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+// randomPositions plays random games and returns every position reached.
+func randomPositions(seed int64, games, plies int) []*Position {
+	rng := rand.New(rand.NewSource(seed))
+	var positions []*Position
+	for range games {
+		pos := NewVariantPosition(Standard)
+		for range plies {
+			legal := generateLegalMoves(pos)
+			if len(legal) == 0 {
+				break
+			}
+			pos = legal[rng.Intn(len(legal))].Position
+			positions = append(positions, pos)
+		}
+	}
+	return positions
+}
+
+func TestEvalTerms_MatchEvaluate(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	params := defaultEvalParams
+	for _, slot := range params.slots() {
+		*slot += rng.Intn(41) - 20
+	}
+	tuner := NewTuner(params, nil)
+	v := tuner.vector()
+	for _, pos := range randomPositions(2, 10, 80) {
+		want := params.Evaluate(pos)
+		if pos.toMove == Black {
+			want = -want
+		}
+		if got := linearEval(evalTerms(pos), v); math.Abs(got-float64(want)) > 1 {
+			t.Fatalf("%s: linear terms give %.2f, Evaluate %d", pos.String(), got, want)
+		}
+	}
+}
+
+func TestEvalBreakdown_MatchesEvaluate(t *testing.T) {
+	for _, pos := range randomPositions(4, 10, 80) {
+		b := defaultEvalParams.Breakdown(pos)
+		if want := Evaluate(pos); b.Score != want {
+			t.Fatalf("%s: breakdown scores %d (%+v), Evaluate %d", pos.FEN(), b.Score, b, want)
+		}
+	}
+	b := defaultEvalParams.Breakdown(NewVariantPosition(Standard))
+	if b.Phase != totalPhase || b.Material != (EvalTerm{}) || b.PieceSquare != (EvalTerm{}) || b.White != 0 {
+		t.Errorf("start position breakdown %+v is not symmetric", b)
+	}
+}
+
+// syntheticSet labels random positions with the expected result under params with knights
+// worth 450, so a tuner starting from the defaults has something to find.
+func syntheticSet() ([]TuningPosition, EvalParams) {
+	truth := defaultEvalParams
+	truth.MaterialMG[Knight], truth.MaterialEG[Knight] = 450, 450
+	var set []TuningPosition
+	for _, pos := range randomPositions(3, 40, 120) {
+		score := truth.Evaluate(pos)
+		if pos.toMove == Black {
+			score = -score
+		}
+		set = append(set, TuningPosition{terms: evalTerms(pos), result: sigmoid(1, float64(score))})
+	}
+	return set, truth
+}
+
+func TestTuner_GradientDescent(t *testing.T) {
+	set, _ := syntheticSet()
+	tuner := NewTuner(defaultEvalParams, set)
+	before := tuner.Error()
+	tuner.GradientDescent(300, 2, nil)
+	after := tuner.Error()
+	knight := tuner.Params.MaterialMG[Knight] + tuner.Params.MaterialEG[Knight]
+	t.Logf("error %.6f -> %.6f, knight %d/%d", before, after, tuner.Params.MaterialMG[Knight], tuner.Params.MaterialEG[Knight])
+	if after > before/4 {
+		t.Errorf("expected the error to drop by three quarters: %.6f -> %.6f", before, after)
+	}
+	if knight < 2*320+100 {
+		t.Errorf("expected the knight value to rise towards 450, got %d/%d", tuner.Params.MaterialMG[Knight], tuner.Params.MaterialEG[Knight])
+	}
+}
+
+func TestTuner_LocalSearchAndFitK(t *testing.T) {
+	set, _ := syntheticSet()
+	tuner := NewTuner(defaultEvalParams, set[:300])
+	if k := tuner.FitK(); k < 0.5 || k > 2 {
+		t.Errorf("expected K near 1 for results generated with K = 1, got %.3f", k)
+	}
+	before := tuner.Error()
+	passes := 0
+	tuner.LocalSearch(3, 5, func(int, float64) { passes++ })
+	if after := tuner.Error(); after >= before || passes == 0 {
+		t.Errorf("expected local search to lower the error: %.6f -> %.6f after %d passes", before, after, passes)
+	}
+}
+
+// TestWriteEvalParams_CheckedIn checks that eval_params.go is exactly what the tuner writes
+// for the compiled-in parameters, so regenerating it only changes the numbers.
+func TestWriteEvalParams_CheckedIn(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEvalParams(&buf, defaultEvalParams); err != nil {
+		t.Fatal(err)
+	}
+	checkedIn, err := os.ReadFile("eval_params.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), checkedIn) {
+		t.Errorf("eval_params.go differs from WriteEvalParams output")
+	}
+}
+
+func TestRunTune(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "positions.epd")
+	lines := []string{
+		"# hand-labelled",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - [0.5]",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNB1KBNR w KQkq - c9 \"0-1\";",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/1NBQKBNR w Kkq - 0 1 [0.0]",
+		"rnbqkbn1/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQq - 0 1 1-0",
+	}
+	if err := os.WriteFile(data, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "eval_params.go")
+	var out strings.Builder
+	if err := runTune([]string{"-data", data, "-out", output, "-iterations", "20", "-method", "local", "-step", "5"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "4 positions") || !strings.Contains(out.String(), "final error") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), output, nil, 0)
+	if err != nil {
+		t.Fatalf("generated file does not parse: %v", err)
+	}
+	if file.Scope.Lookup("defaultEvalParams") == nil {
+		t.Errorf("generated file does not declare defaultEvalParams")
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSearchDepth = 3
+	maxMultiPV         = 256
+	maxHashMB          = 4096
+)
+
+// uciServer speaks the Universal Chess Interface on behalf of Dumbfish. Searches run in the
+// background so "stop", "isready" and "quit" are answered while the engine thinks.
+type uciServer struct {
+	mu        sync.Mutex // serializes writes to out
+	out       io.Writer
+	pos       *Position
+	tablebase *SyzygyTablebase
+	multiPV   int
+	threads   int
+	hash      *TranspositionTable // shared by all searches of the session
+	options   SearchOptions
+	network   *Network
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// RunUCI reads UCI commands from in until "quit" or EOF, writing responses to out.
+func RunUCI(in io.Reader, out io.Writer) error {
+	s := &uciServer{out: out, pos: NewVariantPosition(Standard), threads: 1, hash: NewTranspositionTable(defaultHashMB),
+		options: DefaultSearchOptions()}
+	defer func() {
+		s.stop()
+		if s.tablebase != nil {
+			s.tablebase.Close()
+		}
+	}()
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			s.send("id name chessx")
+			s.send("id author Martin Nyaga")
+			s.send("option name SyzygyPath type string default <empty>")
+			s.send("option name BitbasePath type string default <empty>")
+			s.send("option name EvalFile type string default <empty>")
+			s.send("option name MultiPV type spin default 1 min 1 max %d", maxMultiPV)
+			s.send("option name Threads type spin default 1 min 1 max %d", maxThreads)
+			s.send("option name Hash type spin default %d min 1 max %d", defaultHashMB, maxHashMB)
+			for _, opt := range searchOptionFlags(&s.options) {
+				s.send("option name %s type check default %t", opt.name, *opt.flag)
+			}
+			s.send("uciok")
+		case "isready":
+			s.send("readyok")
+		case "ucinewgame":
+			s.stop()
+			s.pos = NewVariantPosition(Standard)
+			s.hash.Clear()
+		case "setoption":
+			s.stop()
+			s.setOption(fields[1:])
+		case "position":
+			s.stop()
+			if err := s.setPosition(fields[1:]); err != nil {
+				s.send("info string %v", err)
+			}
+		case "go":
+			s.stop()
+			s.goSearch(fields[1:])
+		case "stop":
+			s.stop()
+		case "quit":
+			return nil
+		default:
+			s.send("info string unknown command %q", fields[0])
+		}
+	}
+	// Let a search started just before the end of input finish
+	s.wait()
+	return scanner.Err()
+}
+
+// send writes one line to the GUI.
+func (s *uciServer) send(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, format+"\n", args...)
+}
+
+// stop cancels the running search, if any, and waits for its bestmove to be sent.
+func (s *uciServer) stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wait()
+}
+
+func (s *uciServer) wait() {
+	if s.done != nil {
+		<-s.done
+		s.cancel()
+		s.done, s.cancel = nil, nil
+	}
+}
+
+// setOption handles "setoption name <id> [value <x>]".
+func (s *uciServer) setOption(args []string) {
+	var name, value []string
+	target := &name
+	for _, arg := range args {
+		switch arg {
+		case "name":
+			target = &name
+		case "value":
+			target = &value
+		default:
+			*target = append(*target, arg)
+		}
+	}
+	switch strings.ToLower(strings.Join(name, " ")) {
+	case "syzygypath":
+		if s.tablebase != nil {
+			s.tablebase.Close()
+			s.tablebase = nil
+		}
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			return
+		}
+		tb, err := OpenSyzygy(path)
+		if err != nil {
+			s.send("info string syzygy: %v", err)
+		}
+		s.tablebase = tb
+		s.send("info string found %d tablebase files, up to %d pieces", len(tb.paths), tb.MaxPieces)
+	case "bitbasepath":
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			return
+		}
+		loaded, err := LoadBitbases(path)
+		if err != nil {
+			s.send("info string BitbasePath: %v", err)
+		}
+		s.hash.Clear()
+		s.send("info string loaded bitbases %s", strings.Join(loaded, " "))
+	case "evalfile":
+		// Scores from the old evaluation must not leak into the new one
+		s.network = nil
+		s.hash.Clear()
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			return
+		}
+		network, err := LoadNetwork(path)
+		if err != nil {
+			s.send("info string EvalFile: %v", err)
+			return
+		}
+		s.network = network
+		s.send("info string loaded network %s (%d-%d-%d)", path, network.FTSize, network.Hidden1, network.Hidden2)
+	case "multipv":
+		if n, ok := s.spinValue("MultiPV", value, maxMultiPV); ok {
+			s.multiPV = n
+		}
+	case "threads":
+		if n, ok := s.spinValue("Threads", value, maxThreads); ok {
+			s.threads = n
+		}
+	case "hash":
+		if n, ok := s.spinValue("Hash", value, maxHashMB); ok {
+			s.hash = NewTranspositionTable(n)
+		}
+	default:
+		for _, opt := range searchOptionFlags(&s.options) {
+			if strings.EqualFold(opt.name, strings.Join(name, " ")) {
+				enabled, err := strconv.ParseBool(strings.Join(value, ""))
+				if err != nil {
+					s.send("info string %s: %v", opt.name, err)
+					return
+				}
+				*opt.flag = enabled
+				return
+			}
+		}
+		s.send("info string unknown option %q", strings.Join(name, " "))
+	}
+}
+
+// uciCheckOption is a boolean UCI option bound to the flag it sets.
+type uciCheckOption struct {
+	name string
+	flag *bool
+}
+
+// searchOptionFlags lists the UCI check options that switch the fields of opts.
+func searchOptionFlags(opts *SearchOptions) []uciCheckOption {
+	return []uciCheckOption{
+		{"NullMove", &opts.NullMove},
+		{"LateMoveReduction", &opts.LateMoveReduction},
+		{"Futility", &opts.Futility},
+		{"ReverseFutility", &opts.ReverseFutility},
+		{"CheckExtension", &opts.CheckExtension},
+		{"AspirationWindows", &opts.AspirationWindows},
+	}
+}
+
+// spinValue parses the value of a spin option, clamped to [1, hi].
+func (s *uciServer) spinValue(name string, value []string, hi int) (int, bool) {
+	n, err := strconv.Atoi(strings.Join(value, ""))
+	if err != nil {
+		s.send("info string %s: %v", name, err)
+		return 0, false
+	}
+	return min(max(n, 1), hi), true
+}
+
+// setPosition handles "position (startpos | fen <fen>) [moves <m1> ...]".
+func (s *uciServer) setPosition(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("position: missing arguments")
+	}
+	var pos *Position
+	rest := args[1:]
+	switch args[0] {
+	case "startpos":
+		pos = NewVariantPosition(Standard)
+	case "fen":
+		end := len(rest)
+		for i, arg := range rest {
+			if arg == "moves" {
+				end = i
+				break
+			}
+		}
+		var err error
+		if pos, err = ParseFEN(strings.Join(rest[:end], " ")); err != nil {
+			return err
+		}
+		rest = rest[end:]
+	default:
+		return fmt.Errorf("position: expected startpos or fen, got %q", args[0])
+	}
+	if len(rest) > 0 && rest[0] == "moves" {
+		for _, uci := range rest[1:] {
+			ap, ok := findUCIMove(pos, uci)
+			if !ok {
+				return fmt.Errorf("position: illegal move %q", uci)
+			}
+			pos = ap.Position
+		}
+	}
+	s.pos = pos
+	return nil
+}
+
+// goSearch handles "go" with its search limits, searching in the background and streaming
+// "info" lines. Without limits it searches to the default depth.
+func (s *uciServer) goSearch(args []string) {
+	limits := parseGoLimits(args)
+	if limits.IsZero() {
+		limits.Depth = defaultSearchDepth
+	}
+	limits.MultiPV = s.multiPV
+	options := s.options
+	engine := Dumbfish{Threads: s.threads, Tablebase: s.tablebase, Hash: s.hash, Options: &options, Network: s.network}
+	pos := s.pos
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done = cancel, make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		best, ok := engine.Search(ctx, pos, limits, func(info SearchInfo) {
+			s.send("info %s", info.UCI())
+		})
+		if !ok {
+			s.send("bestmove 0000")
+			return
+		}
+		s.send("bestmove %s", best.Move.UCINotation())
+	}(s.done)
+}
+
+// parseGoLimits reads "go" arguments; times are in milliseconds. Unknown tokens are skipped.
+func parseGoLimits(args []string) SearchLimits {
+	var limits SearchLimits
+	durations := map[string]*time.Duration{
+		"wtime": &limits.WTime, "btime": &limits.BTime,
+		"winc": &limits.WInc, "binc": &limits.BInc,
+		"movetime": &limits.MoveTime,
+	}
+	counts := map[string]*int{
+		"movestogo": &limits.MovesToGo, "depth": &limits.Depth,
+		"nodes": &limits.Nodes, "mate": &limits.Mate,
+	}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "infinite" {
+			limits.Infinite = true
+			continue
+		}
+		if i+1 >= len(args) {
+			break
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			continue
+		}
+		if d, ok := durations[args[i]]; ok {
+			// Clocks can go negative in some GUIs after a late move
+			*d = time.Duration(max(n, 0)) * time.Millisecond
+			i++
+		} else if c, ok := counts[args[i]]; ok {
+			*c = n
+			i++
+		}
+	}
+	return limits
+}
+
+func findUCIMove(pos *Position, uci string) (AppliedMove, bool) {
+	for _, ap := range generateLegalMoves(pos) {
+		if ap.Move.UCINotation() == uci {
+			return ap, true
+		}
+	}
+	return AppliedMove{}, false
+}
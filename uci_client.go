@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uciTimeout bounds how long an external engine may take to answer "uci", "isready" and
+// other commands that should be answered at once.
+var uciTimeout = 10 * time.Second
+
+// ErrEngineExited is returned when an external engine stops answering.
+var ErrEngineExited = errors.New("uci: engine exited")
+
+// UCIOption is an option an external engine declared in its handshake. Min and Max are only
+// set for spin options, and Vars for combo options.
+type UCIOption struct {
+	Name     string
+	Type     string // check, spin, combo, button or string
+	Default  string
+	Min, Max int
+	Vars     []string
+}
+
+// UCIEngine plays through an external program speaking UCI on its standard input and output.
+// A reader goroutine collects the engine's output as it comes, so searches can be followed
+// and stopped while they run. Commands are serialized: the engine thinks about one position
+// at a time.
+type UCIEngine struct {
+	name    string
+	author  string
+	options []UCIOption
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	lines   chan string // lines read from the engine; closed when its output ends
+	mu      sync.Mutex  // held for the duration of a command and its answer
+}
+
+// NewUCIEngine starts cmd, which must not have been started, performs the UCI handshake and
+// sets options, in the order of their names.
+func NewUCIEngine(cmd *exec.Cmd, options map[string]string) (*UCIEngine, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	e := &UCIEngine{name: filepath.Base(cmd.Path), cmd: cmd, stdin: stdin, lines: make(chan string, 64)}
+	go func() {
+		defer close(e.lines)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			e.lines <- scanner.Text()
+		}
+	}()
+
+	if err := e.handshake(); err != nil {
+		e.Close()
+		return nil, err
+	}
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := e.SetOption(name, options[name]); err != nil {
+			e.Close()
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// handshake sends "uci" and reads the engine's id and options up to "uciok".
+func (e *UCIEngine) handshake() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.send("uci"); err != nil {
+		return err
+	}
+	return e.await("uciok", func(fields []string) {
+		switch {
+		case len(fields) > 2 && fields[0] == "id" && fields[1] == "name":
+			e.name = strings.Join(fields[2:], " ")
+		case len(fields) > 2 && fields[0] == "id" && fields[1] == "author":
+			e.author = strings.Join(fields[2:], " ")
+		case len(fields) > 0 && fields[0] == "option":
+			if opt, ok := parseUCIOption(fields[1:]); ok {
+				e.options = append(e.options, opt)
+			}
+		}
+	})
+}
+
+// parseUCIOption reads the arguments of an "option" line. Names and values may contain
+// spaces, so each runs up to the next keyword.
+func parseUCIOption(args []string) (UCIOption, bool) {
+	var opt UCIOption
+	var key string
+	var value []string
+	flush := func() {
+		text := strings.Join(value, " ")
+		switch key {
+		case "name":
+			opt.Name = text
+		case "type":
+			opt.Type = text
+		case "default":
+			opt.Default = text
+		case "min":
+			opt.Min, _ = strconv.Atoi(text)
+		case "max":
+			opt.Max, _ = strconv.Atoi(text)
+		case "var":
+			opt.Vars = append(opt.Vars, text)
+		}
+		value = value[:0]
+	}
+	for _, arg := range args {
+		switch arg {
+		case "name", "type", "default", "min", "max", "var":
+			if key != "" {
+				flush()
+			}
+			key = arg
+		default:
+			value = append(value, arg)
+		}
+	}
+	flush()
+	if opt.Default == "<empty>" {
+		opt.Default = ""
+	}
+	return opt, opt.Name != "" && opt.Type != ""
+}
+
+// send writes one command to the engine.
+func (e *UCIEngine) send(format string, args ...any) error {
+	_, err := fmt.Fprintf(e.stdin, format+"\n", args...)
+	return err
+}
+
+// await reads lines until one starting with token, passing the others to seen (if not nil),
+// and gives up after uciTimeout.
+func (e *UCIEngine) await(token string, seen func(fields []string)) error {
+	timeout := time.After(uciTimeout)
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return ErrEngineExited
+			}
+			fields := strings.Fields(line)
+			if len(fields) > 0 && fields[0] == token {
+				return nil
+			}
+			if seen != nil {
+				seen(fields)
+			}
+		case <-timeout:
+			return fmt.Errorf("uci: no %q from %s after %v", token, e.name, uciTimeout)
+		}
+	}
+}
+
+// Name returns the name the engine gave in the handshake.
+func (e *UCIEngine) Name() string { return e.name }
+
+// Author returns the author the engine gave in the handshake, if any.
+func (e *UCIEngine) Author() string { return e.author }
+
+// Options returns the options the engine declared, in the order it listed them.
+func (e *UCIEngine) Options() []UCIOption { return slices.Clone(e.options) }
+
+// SetOption sets an option the engine declared, matching its name without regard to case,
+// and waits until the engine is ready again. Buttons ignore value.
+func (e *UCIEngine) SetOption(name, value string) error {
+	i := slices.IndexFunc(e.options, func(opt UCIOption) bool { return strings.EqualFold(opt.Name, name) })
+	if i < 0 {
+		return fmt.Errorf("uci: %s has no option %q", e.name, name)
+	}
+	opt := e.options[i]
+	switch opt.Type {
+	case "spin":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < opt.Min || n > opt.Max {
+			return fmt.Errorf("uci: option %s: %q is not in [%d, %d]", opt.Name, value, opt.Min, opt.Max)
+		}
+	case "check":
+		if value != "true" && value != "false" {
+			return fmt.Errorf("uci: option %s: %q is not true or false", opt.Name, value)
+		}
+	case "combo":
+		if !slices.Contains(opt.Vars, value) {
+			return fmt.Errorf("uci: option %s: %q is not one of %s", opt.Name, value, strings.Join(opt.Vars, ", "))
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	command := "setoption name " + opt.Name
+	if opt.Type != "button" {
+		command += " value " + value
+	}
+	if err := e.send("%s", command); err != nil {
+		return err
+	}
+	return e.ready()
+}
+
+// ready sends "isready" and waits for "readyok".
+func (e *UCIEngine) ready() error {
+	if err := e.send("isready"); err != nil {
+		return err
+	}
+	return e.await("readyok", nil)
+}
+
+// UCISearch is a search running in an external engine, started by Go.
+type UCISearch struct {
+	e        *UCIEngine
+	pos      *Position
+	info     func(SearchInfo)
+	stopOnce sync.Once
+	done     chan struct{}
+	best     AppliedMove
+	err      error
+}
+
+// Go sends the position and a "go" command with limits and returns at once. Each scored
+// "info" line is passed to info (if not nil) from another goroutine while the engine
+// thinks. Zero limits search to the default depth. The engine takes no other command until
+// the search is over.
+func (e *UCIEngine) Go(pos *Position, limits SearchLimits, info func(SearchInfo)) (*UCISearch, error) {
+	e.mu.Lock()
+	if limits.IsZero() {
+		limits.Depth = defaultSearchDepth
+	}
+	if err := e.send("position fen %s", pos.FEN()); err != nil {
+		e.mu.Unlock()
+		return nil, err
+	}
+	if err := e.send("go%s", goArguments(limits)); err != nil {
+		e.mu.Unlock()
+		return nil, err
+	}
+	s := &UCISearch{e: e, pos: pos, info: info, done: make(chan struct{})}
+	go func() {
+		defer e.mu.Unlock()
+		defer close(s.done)
+		s.best, s.err = s.read()
+	}()
+	return s, nil
+}
+
+// read follows the engine's output up to the bestmove.
+func (s *UCISearch) read() (AppliedMove, error) {
+	for line := range s.e.lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "info":
+			if report, ok := parseUCIInfo(s.pos, fields[1:]); ok && s.info != nil {
+				s.info(report)
+			}
+		case "bestmove":
+			if len(fields) < 2 {
+				return AppliedMove{}, errors.New("uci: bestmove without a move")
+			}
+			ap, ok := findUCIMove(s.pos, fields[1])
+			if !ok {
+				return AppliedMove{}, fmt.Errorf("uci: %s played %q, which is not legal", s.e.name, fields[1])
+			}
+			return ap, nil
+		}
+	}
+	return AppliedMove{}, ErrEngineExited
+}
+
+// Stop tells the engine to stop thinking and play its move. It does nothing once the search
+// is over.
+func (s *UCISearch) Stop() {
+	s.stopOnce.Do(func() {
+		select {
+		case <-s.done:
+		default:
+			s.e.send("stop")
+		}
+	})
+}
+
+// Done is closed when the engine has played its move.
+func (s *UCISearch) Done() <-chan struct{} { return s.done }
+
+// Wait waits for the engine's move.
+func (s *UCISearch) Wait() (AppliedMove, error) {
+	<-s.done
+	return s.best, s.err
+}
+
+// SelectMove searches to the default depth.
+func (e *UCIEngine) SelectMove(pos *Position) (AppliedMove, bool) {
+	return e.Search(context.Background(), pos, SearchLimits{Depth: defaultSearchDepth}, nil)
+}
+
+// Search runs a search to completion, as Go and Wait do. When ctx is done the engine is told
+// to stop and its move is still returned. It returns false if the engine fails, exits or
+// has no legal move.
+func (e *UCIEngine) Search(ctx context.Context, pos *Position, limits SearchLimits, info func(SearchInfo)) (AppliedMove, bool) {
+	search, err := e.Go(pos, limits, info)
+	if err != nil {
+		return AppliedMove{}, false
+	}
+	select {
+	case <-search.Done():
+	case <-ctx.Done():
+		search.Stop()
+	}
+	best, err := search.Wait()
+	return best, err == nil
+}
+
+// Perft asks the engine to count the leaf nodes depth plies below pos with "go perft",
+// an extension of Stockfish and engines following it, and returns the count below each
+// legal move in UCI notation together with the total.
+func (e *UCIEngine) Perft(pos *Position, depth int) (map[string]int, int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.send("position fen %s", pos.FEN()); err != nil {
+		return nil, 0, err
+	}
+	if err := e.send("go perft %d", depth); err != nil {
+		return nil, 0, err
+	}
+	counts := map[string]int{}
+	for line := range e.lines {
+		move, count, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil {
+			continue
+		}
+		if move == "Nodes searched" {
+			return counts, n, nil
+		}
+		counts[strings.TrimSpace(move)] = n
+	}
+	return nil, 0, ErrEngineExited
+}
+
+// NewGame tells the engine that the next search belongs to a new game.
+func (e *UCIEngine) NewGame() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.send("ucinewgame"); err != nil {
+		return err
+	}
+	return e.ready()
+}
+
+// Close asks the engine to quit and waits for it, killing it if it does not exit in time.
+func (e *UCIEngine) Close() error {
+	e.send("quit")
+	e.stdin.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- e.cmd.Wait() }()
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(uciTimeout):
+		e.cmd.Process.Kill()
+		return <-exited
+	}
+}
+
+// goArguments formats limits as the arguments of a UCI "go" command, with a leading space.
+func goArguments(limits SearchLimits) string {
+	var sb strings.Builder
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{{"wtime", limits.WTime}, {"btime", limits.BTime}, {"winc", limits.WInc}, {"binc", limits.BInc}, {"movetime", limits.MoveTime}} {
+		if d.value > 0 {
+			fmt.Fprintf(&sb, " %s %d", d.name, d.value.Milliseconds())
+		}
+	}
+	for _, c := range []struct {
+		name  string
+		value int
+	}{{"movestogo", limits.MovesToGo}, {"depth", limits.Depth}, {"nodes", limits.Nodes}, {"mate", limits.Mate}} {
+		if c.value > 0 {
+			fmt.Fprintf(&sb, " %s %d", c.name, c.value)
+		}
+	}
+	if limits.Infinite {
+		sb.WriteString(" infinite")
+	}
+	return sb.String()
+}
+
+// parseUCIInfo reads the arguments of an "info" line about pos. It reports false for lines
+// without a score, such as "info string" or "info currmove". The PV is cut at the first
+// move that is not legal.
+func parseUCIInfo(pos *Position, args []string) (SearchInfo, bool) {
+	var info SearchInfo
+	scored := false
+	counts := map[string]*int{
+		"depth": &info.Depth, "seldepth": &info.SelDepth, "multipv": &info.MultiPV,
+		"nodes": &info.Nodes, "nps": &info.NPS, "hashfull": &info.HashFull,
+	}
+	for i := 0; i < len(args); i++ {
+		switch key := args[i]; key {
+		case "string":
+			return info, false
+		case "score":
+			if i+2 >= len(args) {
+				return info, false
+			}
+			n, err := strconv.Atoi(args[i+2])
+			if err != nil {
+				return info, false
+			}
+			switch args[i+1] {
+			case "cp":
+				info.Score, scored = Score{Centipawns: n}, true
+			case "mate":
+				info.Score, scored = Score{Mate: n}, true
+			}
+			i += 2
+		case "time":
+			if i+1 < len(args) {
+				if ms, err := strconv.Atoi(args[i+1]); err == nil {
+					info.Time = time.Duration(ms) * time.Millisecond
+				}
+				i++
+			}
+		case "pv":
+			current := pos
+			for _, uci := range args[i+1:] {
+				ap, ok := findUCIMove(current, uci)
+				if !ok {
+					break
+				}
+				info.PV = append(info.PV, ap.Move)
+				current = ap.Position
+			}
+			i = len(args)
+		default:
+			if c, ok := counts[key]; ok && i+1 < len(args) {
+				if n, err := strconv.Atoi(args[i+1]); err == nil {
+					*c = n
+					i++
+				}
+			}
+		}
+	}
+	return info, scored
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain lets the test binary stand in for an external engine: started with
+// CHESSX_UCI_CHILD=1 it speaks UCI on its standard input and output instead of testing.
+func TestMain(m *testing.M) {
+	if os.Getenv("CHESSX_UCI_CHILD") == "1" {
+		if err := RunUCI(os.Stdin, os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	code := m.Run()
+	if fakeUCI.path != "" {
+		os.RemoveAll(filepath.Dir(fakeUCI.path))
+	}
+	os.Exit(code)
+}
+
+// startChildEngine runs the test binary as a UCI engine.
+func startChildEngine(t *testing.T, options map[string]string) *UCIEngine {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe)
+	cmd.Env = append(os.Environ(), "CHESSX_UCI_CHILD=1")
+	engine, err := NewUCIEngine(cmd, options)
+	if err != nil {
+		t.Fatalf("start engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+var fakeUCI struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// startFakeEngine builds testdata/fakeuci once per test run and starts it with args.
+func startFakeEngine(t *testing.T, options map[string]string, args ...string) (*UCIEngine, error) {
+	t.Helper()
+	fakeUCI.once.Do(func() {
+		dir, err := os.MkdirTemp("", "fakeuci")
+		if err != nil {
+			fakeUCI.err = err
+			return
+		}
+		fakeUCI.path = filepath.Join(dir, "fakeuci")
+		out, err := exec.Command("go", "build", "-o", fakeUCI.path, "./testdata/fakeuci").CombinedOutput()
+		if err != nil {
+			fakeUCI.err = errors.New(string(out))
+		}
+	})
+	if fakeUCI.err != nil {
+		t.Fatalf("build fake engine: %v", fakeUCI.err)
+	}
+	engine, err := NewUCIEngine(exec.Command(fakeUCI.path, args...), options)
+	if err == nil {
+		t.Cleanup(func() { engine.Close() })
+	}
+	return engine, err
+}
+
+func TestUCIEngine_HandshakeAndOptions(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "commands.txt")
+	engine, err := startFakeEngine(t, map[string]string{"style": "Risky", "Hash": "64", "Clear Hash": ""}, "-log", log)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if engine.Name() != "Fake 1.0" || engine.Author() != "The chessx authors" {
+		t.Errorf("id name %q author %q", engine.Name(), engine.Author())
+	}
+	want := []UCIOption{
+		{Name: "Hash", Type: "spin", Default: "16", Min: 1, Max: 1024},
+		{Name: "Ponder", Type: "check", Default: "false"},
+		{Name: "Style", Type: "combo", Default: "Normal", Vars: []string{"Solid", "Normal", "Risky"}},
+		{Name: "Book File", Type: "string"},
+		{Name: "Clear Hash", Type: "button"},
+	}
+	if got := engine.Options(); !slices.EqualFunc(got, want, func(a, b UCIOption) bool {
+		return a.Name == b.Name && a.Type == b.Type && a.Default == b.Default && a.Min == b.Min && a.Max == b.Max && slices.Equal(a.Vars, b.Vars)
+	}) {
+		t.Errorf("options %+v, want %+v", got, want)
+	}
+	if err := engine.SetOption("book file", "/tmp/my book.bin"); err != nil {
+		t.Errorf("set string option: %v", err)
+	}
+	for _, bad := range [][2]string{{"Hash", "0"}, {"Hash", "big"}, {"Ponder", "yes"}, {"Style", "Wild"}, {"Contempt", "10"}} {
+		if err := engine.SetOption(bad[0], bad[1]); err == nil {
+			t.Errorf("setoption %s=%s accepted", bad[0], bad[1])
+		}
+	}
+	engine.Close()
+
+	text, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := strings.Join(strings.Split(strings.TrimSpace(string(text)), "\n"), "|")
+	wantSent := "uci|setoption name Clear Hash|isready|setoption name Hash value 64|isready|" +
+		"setoption name Style value Risky|isready|setoption name Book File value /tmp/my book.bin|isready|quit"
+	if sent != wantSent {
+		t.Errorf("engine received\n%s\nwant\n%s", sent, wantSent)
+	}
+}
+
+func TestUCIEngine_AsyncSearch(t *testing.T) {
+	engine, err := startFakeEngine(t, nil, "-wait-stop", "-infos", "2", "-bestmove", "g1f3")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	infos := make(chan SearchInfo, 4)
+	search, err := engine.Go(NewVariantPosition(Standard), SearchLimits{Infinite: true}, func(info SearchInfo) { infos <- info })
+	if err != nil {
+		t.Fatalf("go: %v", err)
+	}
+	for depth := 1; depth <= 2; depth++ {
+		info := <-infos
+		if info.Depth != depth || info.Score.Centipawns != 10*depth || len(info.PV) != 1 || info.PV[0].UCINotation() != "g1f3" {
+			t.Errorf("info %+v while searching", info)
+		}
+	}
+	select {
+	case <-search.Done():
+		t.Fatal("search ended before stop")
+	case <-time.After(50 * time.Millisecond):
+	}
+	search.Stop()
+	best, err := search.Wait()
+	if err != nil || best.Move.UCINotation() != "g1f3" {
+		t.Fatalf("best %s, err %v", best.Move.UCINotation(), err)
+	}
+	search.Stop() // no effect once over
+	if counts, total, err := engine.Perft(NewVariantPosition(Standard), 2); err != nil || total != 40 || counts["g1f3"] != 20 || len(counts) != 2 {
+		t.Errorf("perft: %v %d %v", counts, total, err)
+	}
+}
+
+func TestUCIEngine_Failures(t *testing.T) {
+	engine, err := startFakeEngine(t, nil, "-crash")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	search, err := engine.Go(NewVariantPosition(Standard), SearchLimits{Depth: 1}, nil)
+	if err != nil {
+		t.Fatalf("go: %v", err)
+	}
+	if _, err := search.Wait(); !errors.Is(err, ErrEngineExited) {
+		t.Errorf("crash during search: %v", err)
+	}
+	if _, ok := engine.SelectMove(NewVariantPosition(Standard)); ok {
+		t.Error("move from an engine that exited")
+	}
+
+	illegal, err := startFakeEngine(t, nil, "-bestmove", "e2e5")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, ok := illegal.SelectMove(NewVariantPosition(Standard)); ok {
+		t.Error("illegal bestmove accepted")
+	}
+
+	defer func(timeout time.Duration) { uciTimeout = timeout }(uciTimeout)
+	uciTimeout = 100 * time.Millisecond
+	if _, err := startFakeEngine(t, nil, "-mute"); err == nil || !strings.Contains(err.Error(), `no "uciok"`) {
+		t.Errorf("mute engine: %v", err)
+	}
+	if _, err := startFakeEngine(t, map[string]string{"Threads": "2"}); err == nil {
+		t.Error("undeclared option accepted")
+	}
+}
+
+func TestUCIEngine_Search(t *testing.T) {
+	engine := startChildEngine(t, map[string]string{"Hash": "1", "MultiPV": "1"})
+	if engine.Name() != "chessx" {
+		t.Errorf("name %q, want chessx", engine.Name())
+	}
+	pos, err := ParseFEN("k7/8/2K5/8/8/8/8/7R w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []SearchInfo
+	best, ok := engine.Search(context.Background(), pos, SearchLimits{Depth: 4}, func(info SearchInfo) {
+		infos = append(infos, info)
+	})
+	if !ok {
+		t.Fatal("no move")
+	}
+	if len(infos) == 0 {
+		t.Fatal("no info lines")
+	}
+	last := infos[len(infos)-1]
+	if last.Depth != 4 || last.Score.Mate != 2 || len(last.PV) == 0 || last.PV[0] != best.Move {
+		t.Errorf("unexpected last info %+v for best move %s", last, best.Move.UCINotation())
+	}
+	if err := engine.NewGame(); err != nil {
+		t.Errorf("new game: %v", err)
+	}
+	if _, ok := engine.SelectMove(NewVariantPosition(Standard)); !ok {
+		t.Error("no move from the start position")
+	}
+}
+
+func TestUCIEngine_StopsWhenCancelled(t *testing.T) {
+	engine := startChildEngine(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, ok := engine.Search(ctx, NewVariantPosition(Standard), SearchLimits{Infinite: true}, nil)
+	if !ok {
+		t.Fatal("no move after stop")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("search took %v after cancellation", elapsed)
+	}
+}
+
+func TestUCIEngine_PlaysMatch(t *testing.T) {
+	engine := startChildEngine(t, nil)
+	opts := MatchOptions{
+		Games:        2,
+		TimeControl:  &TimeControl{Base: time.Second, Increment: 10 * time.Millisecond},
+		Adjudication: Adjudication{MaxMoves: 10},
+	}
+	result, _, err := RunMatch(context.Background(), [2]Engine{engine, Dumbfish{}}, opts, nil)
+	if err != nil {
+		t.Fatalf("match: %v", err)
+	}
+	if result.Games() != 2 {
+		t.Errorf("played %d games", result.Games())
+	}
+}
+
+func TestGoArguments_RoundTrip(t *testing.T) {
+	limits := SearchLimits{
+		WTime: 60 * time.Second, BTime: 55 * time.Second, WInc: time.Second, BInc: time.Second,
+		MovesToGo: 12, Depth: 8, Nodes: 100000, Mate: 3, MoveTime: 500 * time.Millisecond,
+	}
+	args := goArguments(limits)
+	if got := parseGoLimits(strings.Fields(args)); got != limits {
+		t.Errorf("go%s parsed as %+v", args, got)
+	}
+	if args := goArguments(SearchLimits{Infinite: true}); args != " infinite" {
+		t.Errorf("infinite search: go%s", args)
+	}
+}
+
+func TestParseUCIInfo(t *testing.T) {
+	pos := NewVariantPosition(Standard)
+	line := "depth 7 seldepth 11 multipv 2 score cp -35 upperbound nodes 12345 nps 99000 hashfull 12 time 125 pv e2e4 e7e5 g1f3 b1b1 a2a3"
+	info, ok := parseUCIInfo(pos, strings.Fields(line))
+	if !ok {
+		t.Fatal("scored line not accepted")
+	}
+	want := SearchInfo{Depth: 7, SelDepth: 11, MultiPV: 2, Score: Score{Centipawns: -35}, Nodes: 12345, NPS: 99000,
+		HashFull: 12, Time: 125 * time.Millisecond}
+	pv := info.PV
+	info.PV = nil
+	if info.Depth != want.Depth || info.SelDepth != want.SelDepth || info.MultiPV != want.MultiPV ||
+		info.Score != want.Score || info.Nodes != want.Nodes || info.NPS != want.NPS ||
+		info.HashFull != want.HashFull || info.Time != want.Time {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+	if len(pv) != 3 {
+		t.Errorf("PV should stop at the illegal move, got %d moves", len(pv))
+	}
+	if info, ok := parseUCIInfo(pos, strings.Fields("depth 3 score mate -2 pv")); !ok || info.Score.Mate != -2 {
+		t.Errorf("mate score: %+v", info)
+	}
+	for _, line := range []string{"string score cp 10", "currmove e2e4 currmovenumber 1", "depth 3 score cp"} {
+		if _, ok := parseUCIInfo(pos, strings.Fields(line)); ok {
+			t.Errorf("%q accepted", line)
+		}
+	}
+}
+
+func TestOpenEngine(t *testing.T) {
+	engine, closer, err := openEngine("Dumbfish", "Threads=2, NullMove=false,Hash=2")
+	if err != nil || closer != nil {
+		t.Fatalf("open dumbfish: %v", err)
+	}
+	d := engine.(Dumbfish)
+	if d.Threads != 2 || d.Options.NullMove || !d.Options.LateMoveReduction || d.Hash == nil {
+		t.Errorf("options not applied: %+v %+v", d, *d.Options)
+	}
+	for _, options := range []string{"Threads=0", "Hash=x", "NullMove=maybe", "Contempt=10", "Threads"} {
+		if _, _, err := openEngine("dumbfish", options); err == nil {
+			t.Errorf("%q: expected an error", options)
+		}
+	}
+	if _, _, err := openEngine("/nonexistent/engine", ""); err == nil {
+		t.Error("expected an error for a missing engine binary")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Variant identifies the rule set a Position is played under.
+type Variant int
+
+const (
+	Standard Variant = iota
+	Crazyhouse
+	Horde
+	RacingKings
+)
+
+const (
+	standardStartFEN    = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	crazyhouseStartFEN  = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1"
+	hordeStartFEN       = "rnbqkbnr/pppppppp/8/1PP2PP1/PPPPPPPP/PPPPPPPP/PPPPPPPP/PPPPPPPP w kq - 0 1"
+	racingKingsStartFEN = "8/8/8/8/8/8/krbnNBRK/qrbnNBRQ w - - 0 1"
+)
+
+func (v Variant) String() string {
+	switch v {
+	case Crazyhouse:
+		return "crazyhouse"
+	case Horde:
+		return "horde"
+	case RacingKings:
+		return "racingkings"
+	default:
+		return "standard"
+	}
+}
+
+// ParseVariant converts a variant name (as used by UCI_Variant and lichess, e.g. "crazyhouse")
+// to a Variant. Names are case-insensitive; "chess" and "" are accepted for Standard.
+func ParseVariant(name string) (Variant, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "standard", "chess":
+		return Standard, nil
+	case "crazyhouse", "zh":
+		return Crazyhouse, nil
+	case "horde":
+		return Horde, nil
+	case "racingkings", "racing kings", "racing-kings":
+		return RacingKings, nil
+	}
+	return Standard, fmt.Errorf("unknown variant %q", name)
+}
+
+// StartFEN returns the initial position of the variant.
+func (v Variant) StartFEN() string {
+	switch v {
+	case Crazyhouse:
+		return crazyhouseStartFEN
+	case Horde:
+		return hordeStartFEN
+	case RacingKings:
+		return racingKingsStartFEN
+	default:
+		return standardStartFEN
+	}
+}
+
+// NewVariantPosition returns the initial position of the variant with the variant set.
+func NewVariantPosition(v Variant) *Position {
+	pos, err := ParseFEN(v.StartFEN())
+	if err != nil {
+		panic(err)
+	}
+	pos.SetVariant(v)
+	return pos
+}
+
+// pawnStartRanks returns the ranks from which a pawn of the given color may double push.
+// In Horde, white pawns on the first rank may also advance two squares.
+func (v Variant) pawnStartRanks(color Color) (int, int) {
+	if color == White {
+		if v == Horde {
+			return 0, 1
+		}
+		return 1, 1
+	}
+	return 6, 6
+}
+
+// mustHaveKing reports whether the color always has a king on the board in this variant.
+// White plays without a king in Horde.
+func (v Variant) mustHaveKing(color Color) bool {
+	return !(v == Horde && color == White)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"testing"
+)
+
+func variantPerft(pos *Position, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+	legal := generateLegalMoves(pos)
+	if depth == 1 {
+		return len(legal)
+	}
+	nodes := 0
+	for _, ap := range legal {
+		nodes += variantPerft(ap.Position, depth-1)
+	}
+	return nodes
+}
+
+func TestParseVariant(t *testing.T) {
+	cases := map[string]Variant{
+		"":             Standard,
+		"chess":        Standard,
+		"Crazyhouse":   Crazyhouse,
+		"horde":        Horde,
+		"racingkings":  RacingKings,
+		"Racing Kings": RacingKings,
+	}
+	for name, want := range cases {
+		got, err := ParseVariant(name)
+		if err != nil || got != want {
+			t.Errorf("ParseVariant(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseVariant("atomic"); err == nil {
+		t.Errorf("expected error for unsupported variant")
+	}
+}
+
+func TestHorde_StartPositionPerft(t *testing.T) {
+	pos := NewVariantPosition(Horde)
+	for depth, want := range []int{1, 8, 128, 1274} {
+		if got := variantPerft(pos, depth); got != want {
+			t.Fatalf("horde perft(%d) = %d, want %d", depth, got, want)
+		}
+	}
+}
+
+func TestHorde_FirstRankDoublePush(t *testing.T) {
+	pos, err := ParseFEN("4k3/8/8/8/8/8/8/P7 w - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	pos.SetVariant(Horde)
+	moves := map[string]AppliedMove{}
+	for _, ap := range generateLegalMoves(pos) {
+		moves[ap.Move.UCINotation()] = ap
+	}
+	if len(moves) != 2 {
+		t.Fatalf("expected a1a2 and a1a3 for a kingless horde, got %d moves", len(moves))
+	}
+	double, ok := moves["a1a3"]
+	if !ok {
+		t.Fatalf("expected first-rank double push a1a3")
+	}
+	if !double.Position.GetEnpassant().IsEmpty() {
+		t.Fatalf("first-rank double push should not create an en passant square")
+	}
+
+	// Standard chess keeps the usual second-rank-only double push
+	pos.SetVariant(Standard)
+	pos.SetPieceAtSquare("e1", King, White)
+	for _, ap := range generateLegalMoves(pos) {
+		if ap.Move.UCINotation() == "a1a3" {
+			t.Fatalf("a1a3 should not be legal in standard chess")
+		}
+	}
+}
+
+func TestHorde_BlackWinsWhenHordeIsGone(t *testing.T) {
+	pos, err := ParseFEN("4k3/8/8/8/8/8/8/8 w - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	pos.SetVariant(Horde)
+	if out := pos.Outcome(); out.Result != BlackWins {
+		t.Fatalf("expected black to win with no white pieces, got %+v", out)
+	}
+
+	pos.SetPieceAtSquare("a3", Pawn, White)
+	if out := pos.Outcome(); out.IsOver() {
+		t.Fatalf("expected game to continue while white has a pawn, got %+v", out)
+	}
+}
+
+func TestRacingKings_StartPositionPerft(t *testing.T) {
+	pos := NewVariantPosition(RacingKings)
+	for depth, want := range []int{1, 21, 421} {
+		if got := variantPerft(pos, depth); got != want {
+			t.Fatalf("racing kings perft(%d) = %d, want %d", depth, got, want)
+		}
+	}
+}
+
+func TestRacingKings_NoChecks(t *testing.T) {
+	pos, err := ParseFEN("8/8/8/8/8/k7/8/K6R w - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	pos.SetVariant(RacingKings)
+	for _, ap := range generateLegalMoves(pos) {
+		if ap.Position.IsKingInCheck(Black) {
+			t.Fatalf("move %s gives check, which racing kings forbids", ap.Move.UCINotation())
+		}
+	}
+}
+
+func TestRacingKings_Finish(t *testing.T) {
+	// White reaches the eighth rank and black cannot follow: white wins
+	pos, err := ParseFEN("K7/8/8/8/8/8/8/7k b - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	pos.SetVariant(RacingKings)
+	if out := pos.Outcome(); out.Result != WhiteWins {
+		t.Fatalf("expected white win, got %+v", out)
+	}
+	if moves := generateLegalMoves(pos); len(moves) != 0 {
+		t.Fatalf("expected no legal moves after the finish, got %d", len(moves))
+	}
+
+	// Black can still reach the eighth rank on its reply: the game goes on
+	pos, err = ParseFEN("K7/7k/8/8/8/8/8/8 b - - 0 1")
+	if err != nil {
+		t.Fatalf("failed to parse fen: %v", err)
+	}
+	pos.SetVariant(RacingKings)
+	if out := pos.Outcome(); out.IsOver() {
+		t.Fatalf("expected black to get a reply, got %+v", out)
+	}
+	var drawn *Position
+	for _, ap := range generateLegalMoves(pos) {
+		if ap.Move.UCINotation() == "h7h8" {
+			drawn = ap.Position
+		}
+	}
+	if drawn == nil {
+		t.Fatalf("expected h7h8 to be legal")
+	}
+	if out := drawn.Outcome(); out.Result != Draw {
+		t.Fatalf("expected draw when both kings finish, got %+v", out)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// dialWebSocket opens a WebSocket to the ws:// or http:// URL, as a browser would.
+func dialWebSocket(t *testing.T, url string) *wsConn {
+	t.Helper()
+	url = strings.TrimPrefix(strings.TrimPrefix(url, "ws://"), "http://")
+	host, path, _ := strings.Cut(url, "/")
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET /%s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", path, host, key)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		t.Fatalf("handshake: %s %v", resp.Status, resp.Header)
+	}
+	c := &wsConn{conn: conn, r: r, client: true}
+	t.Cleanup(func() { conn.Close() })
+	return c
+}
+
+// echoServer echoes every message back until the client closes.
+func echoServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := acceptWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			op, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.writeFrame(op, message)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebSocketAccept(t *testing.T) {
+	// The example of RFC 6455, section 1.3
+	if got := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestWebSocket_Echo(t *testing.T) {
+	c := dialWebSocket(t, echoServer(t).URL)
+	long := strings.Repeat("x", 1000)
+	for _, text := range []string{"hello", long} {
+		if err := c.WriteText([]byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		if op, message, err := c.ReadMessage(); err != nil || op != wsText || string(message) != text {
+			t.Fatalf("echo of %d bytes: %d %d bytes %v", len(text), op, len(message), err)
+		}
+	}
+
+	// A fragmented message with a ping in between, masked with a zero key
+	frames := []byte{0x01, 0x80 | 3, 0, 0, 0, 0, 'a', 'b', 'c'}
+	frames = append(frames, 0x80|wsPing, 0x80|2, 0, 0, 0, 0, 'h', 'i')
+	frames = append(frames, 0x80|wsContinuation, 0x80|2, 0, 0, 0, 0, 'd', 'e')
+	if _, err := c.conn.Write(frames); err != nil {
+		t.Fatal(err)
+	}
+	fin, op, payload, err := c.readFrame()
+	if err != nil || !fin || op != wsPong || string(payload) != "hi" {
+		t.Errorf("pong: %v %d %q %v", fin, op, payload, err)
+	}
+	if op, message, err := c.ReadMessage(); err != nil || op != wsText || string(message) != "abcde" {
+		t.Errorf("reassembled message: %d %q %v", op, message, err)
+	}
+
+	// Closing is echoed and reported as EOF
+	c.writeFrame(wsClose, binary.BigEndian.AppendUint16(nil, 1000))
+	if _, _, err := c.ReadMessage(); err != io.EOF {
+		t.Errorf("after close: %v", err)
+	}
+}
+
+func TestWebSocket_RejectsOversizedAndUnmaskedFrames(t *testing.T) {
+	server := echoServer(t)
+	c := dialWebSocket(t, server.URL)
+	if err := c.WriteText(bytes.Repeat([]byte("x"), maxWebSocketMessage+1)); err != nil {
+		t.Fatal(err)
+	}
+	fin, op, payload, err := c.readFrame()
+	if err != nil || !fin || op != wsClose || binary.BigEndian.Uint16(payload) != 1009 {
+		t.Errorf("expected a 1009 close, got %d %v %v", op, payload, err)
+	}
+
+	c = dialWebSocket(t, server.URL)
+	c.conn.Write([]byte{0x80 | wsText, 2, 'h', 'i'})
+	if _, _, err := c.ReadMessage(); err == nil {
+		t.Error("server accepted an unmasked frame")
+	}
+}
+
+func TestWebSocket_BadHandshakes(t *testing.T) {
+	server := echoServer(t)
+	for _, c := range []struct {
+		headers map[string]string
+		status  int
+	}{
+		{map[string]string{}, http.StatusBadRequest},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": "x"}, http.StatusUpgradeRequired},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13"}, http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		for name, value := range c.headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("headers %v: status %d, want %d", c.headers, resp.StatusCode, c.status)
+		}
+	}
+}
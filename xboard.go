@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// xboardMateScore is how CECP thinking output encodes mates: 100000+N for mate in N moves.
+const xboardMateScore = 100000
+
+// xboardServer speaks the Chess Engine Communication Protocol (CECP, version 2) of XBoard and
+// WinBoard on behalf of an Engine. Moves go both ways in coordinate notation, as in UCI.
+// The engine thinks in the background so that "?" can make it move at once.
+type xboardServer struct {
+	mu  sync.Mutex // serializes writes to out and guards discard
+	out io.Writer
+
+	engine  Engine
+	history []*Position // positions of the game so far, the current one last
+	color   Color       // the side the engine plays
+	force   bool        // the engine plays neither side
+	post    bool        // send thinking output
+
+	depth    int           // "sd" limit (0 = none)
+	moveTime time.Duration // "st" limit (0 = none)
+	level    *TimeControl  // "level" time control, if any
+	clock    time.Duration // engine's time left, from "time"
+	opponent time.Duration // opponent's time left, from "otim"
+
+	cancel  context.CancelFunc
+	done    chan struct{}
+	discard bool // the running search's move must not be played
+}
+
+// RunXBoard reads CECP commands from in until "quit" or EOF, playing engine and writing
+// responses to out.
+func RunXBoard(in io.Reader, out io.Writer, engine Engine) error {
+	s := &xboardServer{out: out, engine: engine}
+	s.newGame()
+	defer s.abandon()
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		args := fields[1:]
+		switch fields[0] {
+		case "xboard", "accepted", "rejected", "random", "hard", "easy", "computer", "name", "rating", "ics", "draw":
+			// Nothing to do
+		case "protover":
+			s.send(`feature myname="chessx %s" setboard=1 usermove=1 ping=1 time=1 playother=1 colors=0 `+
+				`sigint=0 sigterm=0 reuse=1 analyze=0 variants="normal" done=1`, s.engine.Name())
+		case "new":
+			s.abandon()
+			s.newGame()
+		case "force":
+			s.abandon()
+			s.force = true
+		case "go":
+			s.abandon()
+			s.force = false
+			s.color = s.pos().toMove
+			s.think()
+		case "playother":
+			s.abandon()
+			s.force = false
+			s.color = s.pos().toMove.Opponent()
+		case "usermove":
+			s.abandon()
+			if len(args) != 1 {
+				s.send("Error (usermove needs one move): %s", line)
+				continue
+			}
+			s.userMove(args[0])
+		case "setboard":
+			s.abandon()
+			pos, err := ParseFEN(strings.Join(args, " "))
+			if err != nil {
+				s.send("tellusererror Illegal position: %v", err)
+				continue
+			}
+			s.history = []*Position{pos}
+		case "undo", "remove":
+			s.abandon()
+			plies := 1
+			if fields[0] == "remove" {
+				plies = 2
+			}
+			if len(s.history) <= plies {
+				s.send("Error (no move to take back): %s", fields[0])
+				continue
+			}
+			s.history = s.history[:len(s.history)-plies]
+		case "result":
+			s.abandon()
+			s.force = true
+		case "level":
+			if err := s.setLevel(args); err != nil {
+				s.send("Error (%v): %s", err, line)
+			}
+		case "st":
+			seconds, err := parseSeconds(strings.Join(args, ""))
+			if err != nil || seconds <= 0 {
+				s.send("Error (bad time): %s", line)
+				continue
+			}
+			s.moveTime = seconds
+		case "sd":
+			depth, err := strconv.Atoi(strings.Join(args, ""))
+			if err != nil || depth <= 0 {
+				s.send("Error (bad depth): %s", line)
+				continue
+			}
+			s.depth = depth
+		case "time", "otim":
+			centiseconds, err := strconv.Atoi(strings.Join(args, ""))
+			if err != nil {
+				s.send("Error (bad time): %s", line)
+				continue
+			}
+			clock := time.Duration(max(centiseconds, 0)) * 10 * time.Millisecond
+			if fields[0] == "time" {
+				s.clock = clock
+			} else {
+				s.opponent = clock
+			}
+		case "post":
+			s.post = true
+		case "nopost":
+			s.post = false
+		case "ping":
+			// The pong vouches for every earlier command, so it follows a move being thought about
+			s.wait()
+			s.send("pong %s", strings.Join(args, " "))
+		case "?":
+			s.moveNow()
+		case "quit":
+			return nil
+		default:
+			// Without usermove=1 moves arrive bare; accept those too
+			if len(fields) == 1 && isCoordinateMove(fields[0]) {
+				s.abandon()
+				s.userMove(fields[0])
+				continue
+			}
+			s.send("Error (unknown command): %s", fields[0])
+		}
+	}
+	// Let a search started just before the end of input finish
+	s.wait()
+	return scanner.Err()
+}
+
+// send writes one line to the interface.
+func (s *xboardServer) send(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, format+"\n", args...)
+}
+
+// pos returns the current position.
+func (s *xboardServer) pos() *Position { return s.history[len(s.history)-1] }
+
+// newGame handles "new": the standard position with the engine playing Black, no depth or
+// move time limit, and a fresh engine.
+func (s *xboardServer) newGame() {
+	s.history = []*Position{NewVariantPosition(Standard)}
+	s.color, s.force = Black, false
+	s.depth, s.moveTime = 0, 0
+	if g, ok := s.engine.(newGamer); ok {
+		if err := g.NewGame(); err != nil {
+			s.send("tellusererror %s: %v", s.engine.Name(), err)
+		}
+	}
+}
+
+// setLevel handles "level MPS BASE INC", where BASE is minutes or minutes:seconds and INC
+// is seconds.
+func (s *xboardServer) setLevel(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("level needs 3 arguments")
+	}
+	moves, err := strconv.Atoi(args[0])
+	if err != nil || moves < 0 {
+		return fmt.Errorf("bad moves per session")
+	}
+	minutes, secs, _ := strings.Cut(args[1], ":")
+	base, err := parseSeconds(minutes)
+	if err != nil {
+		return fmt.Errorf("bad base time")
+	}
+	base *= 60
+	if secs != "" {
+		extra, err := parseSeconds(secs)
+		if err != nil {
+			return fmt.Errorf("bad base time")
+		}
+		base += extra
+	}
+	inc, err := parseSeconds(args[2])
+	if err != nil || inc < 0 {
+		return fmt.Errorf("bad increment")
+	}
+	s.level = &TimeControl{Moves: moves, Base: base, Increment: inc}
+	s.clock, s.opponent = base, base
+	s.moveTime = 0
+	return nil
+}
+
+// userMove plays the opponent's move and lets the engine answer when it is its turn.
+func (s *xboardServer) userMove(uci string) {
+	ap, ok := findUCIMove(s.pos(), uci)
+	if !ok {
+		s.send("Illegal move: %s", uci)
+		return
+	}
+	s.history = append(s.history, ap.Position)
+	if s.gameOver() {
+		return
+	}
+	if !s.force && s.pos().toMove == s.color {
+		s.think()
+	}
+}
+
+// gameOver announces the result if the game has ended in the current position.
+func (s *xboardServer) gameOver() bool {
+	outcome := s.pos().Outcome()
+	if !outcome.IsOver() && s.repetitions() >= 3 {
+		outcome = Outcome{Result: Draw, Reason: "threefold repetition"}
+	}
+	if !outcome.IsOver() {
+		return false
+	}
+	s.send("%s {%s}", outcome.Result, outcome.Reason)
+	return true
+}
+
+// repetitions counts the occurrences of the current position in the game.
+func (s *xboardServer) repetitions() int {
+	key := searchKey(s.pos())
+	n := 0
+	for _, pos := range s.history {
+		if searchKey(pos) == key {
+			n++
+		}
+	}
+	return n
+}
+
+// limits returns the limits of the engine's next search: "sd" and "st" when set, otherwise
+// the clocks under the "level" time control, otherwise the default depth.
+func (s *xboardServer) limits() SearchLimits {
+	var limits SearchLimits
+	limits.Depth = s.depth
+	switch {
+	case s.moveTime > 0:
+		limits.MoveTime = s.moveTime
+	case s.level != nil:
+		limits.WTime, limits.BTime = s.clock, s.opponent
+		if s.color == Black {
+			limits.WTime, limits.BTime = s.opponent, s.clock
+		}
+		limits.WInc, limits.BInc = s.level.Increment, s.level.Increment
+		if s.level.Moves > 0 {
+			limits.MovesToGo = s.level.Moves - (s.pos().moveNumber-1)%s.level.Moves
+		}
+	}
+	if limits.IsZero() {
+		limits.Depth = defaultSearchDepth
+	}
+	return limits
+}
+
+// think searches the current position in the background and plays the engine's move,
+// unless the search is abandoned first.
+func (s *xboardServer) think() {
+	pos, limits, post := s.pos(), s.limits(), s.post
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done, s.discard = cancel, make(chan struct{}), false
+	go func(done chan struct{}) {
+		defer close(done)
+		best, ok := s.engine.Search(ctx, pos, limits, func(info SearchInfo) {
+			if post && info.MultiPV <= 1 {
+				s.send("%s", xboardThinking(info))
+			}
+		})
+		s.mu.Lock()
+		discard := s.discard
+		s.mu.Unlock()
+		if discard || !ok {
+			return
+		}
+		s.send("move %s", best.Move.UCINotation())
+		s.history = append(s.history, best.Position)
+		s.gameOver()
+	}(s.done)
+}
+
+// moveNow handles "?": the engine stops thinking and plays the best move found so far.
+func (s *xboardServer) moveNow() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wait()
+}
+
+// abandon stops the running search, if any, without playing its move.
+func (s *xboardServer) abandon() {
+	if s.cancel == nil {
+		return
+	}
+	s.mu.Lock()
+	s.discard = true
+	s.mu.Unlock()
+	s.cancel()
+	s.wait()
+}
+
+func (s *xboardServer) wait() {
+	if s.done != nil {
+		<-s.done
+		s.cancel()
+		s.done, s.cancel = nil, nil
+	}
+}
+
+// xboardThinking formats a progress report as CECP thinking output: depth, score in
+// centipawns, time in centiseconds, nodes and the principal variation.
+func xboardThinking(info SearchInfo) string {
+	score := info.Score.Centipawns
+	switch {
+	case info.Score.Mate > 0:
+		score = xboardMateScore + info.Score.Mate
+	case info.Score.Mate < 0:
+		score = -xboardMateScore + info.Score.Mate
+	}
+	pv := make([]string, len(info.PV))
+	for i, move := range info.PV {
+		pv[i] = move.UCINotation()
+	}
+	return fmt.Sprintf("%d %d %d %d %s", info.Depth, score, info.Time.Milliseconds()/10, info.Nodes, strings.Join(pv, " "))
+}
+
+// isCoordinateMove reports whether s looks like a move in coordinate notation, such as
+// "e2e4" or "e7e8q".
+func isCoordinateMove(s string) bool {
+	if len(s) != 4 && len(s) != 5 {
+		return false
+	}
+	for i := 0; i < 4; i += 2 {
+		if s[i] < 'a' || s[i] > 'h' || s[i+1] < '1' || s[i+1] > '8' {
+			return false
+		}
+	}
+	return len(s) == 4 || strings.ContainsRune("qrbn", rune(s[4]))
+}
+
+// runXBoard implements "xboard [-engine SPEC] [-options Name=Value,...]", speaking CECP on
+// behalf of Dumbfish or, with -engine, an external UCI engine.
+func runXBoard(args []string, in io.Reader, out io.Writer) error {
+	flags := commandFlags("xboard", out)
+	spec := flags.String("engine", "dumbfish", engineFlagHelp)
+	options := flags.String("options", "", "UCI options as Name=Value,...")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	engine, closer, err := openEngine(*spec, *options)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer()
+	}
+	return RunXBoard(in, out, engine)
+}
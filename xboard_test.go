@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runXBoardScript feeds commands to a CECP session with engine and returns its output lines.
+func runXBoardScript(t *testing.T, engine Engine, commands ...string) []string {
+	t.Helper()
+	var out strings.Builder
+	if err := RunXBoard(strings.NewReader(strings.Join(commands, "\n")+"\n"), &out, engine); err != nil {
+		t.Fatalf("xboard: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+func TestXBoard_HandshakeAndGame(t *testing.T) {
+	lines := runXBoardScript(t, Dumbfish{Depth: 1}, "xboard", "protover 2", "accepted setboard", "new", "sd 2", "post",
+		"usermove e2e4", "ping 7")
+	if !strings.HasPrefix(lines[0], `feature myname="chessx Dumbfish" setboard=1 usermove=1 ping=1`) || !strings.HasSuffix(lines[0], "done=1") {
+		t.Errorf("features: %s", lines[0])
+	}
+	var move string
+	for _, line := range lines[1:] {
+		if after, ok := strings.CutPrefix(line, "move "); ok {
+			move = after
+		}
+	}
+	pos := NewVariantPosition(Standard)
+	pos = mustUCIMove(t, pos, "e2e4").Position
+	if _, ok := findUCIMove(pos, move); !ok {
+		t.Errorf("engine replied %q, not a legal move for Black; output %q", move, lines)
+	}
+	// Thinking output: ply score time nodes pv
+	if fields := strings.Fields(lines[1]); len(fields) < 5 || fields[0] != "1" {
+		t.Errorf("thinking output %q", lines[1])
+	}
+	if last := lines[len(lines)-1]; last != "pong 7" {
+		t.Errorf("last line %q, want pong 7", last)
+	}
+}
+
+func TestXBoard_ForceUndoAndSetboard(t *testing.T) {
+	lines := runXBoardScript(t, Dumbfish{},
+		"new", "force", "usermove e2e4", "usermove e7e5", "usermove e2e4", "e1e2", "remove", "undo", "undo",
+		"setboard 8/8/8/8/8/8/8/k1K4R x", "setboard 7k/8/6K1/8/8/8/8/R7 w - - 0 1", "frobnicate", "go")
+	want := []string{
+		"Illegal move: e2e4",
+		"Error (no move to take back): undo",
+		"tellusererror Illegal position: ",
+		"Error (unknown command): frobnicate",
+		"move a1a8",
+		"1-0 {checkmate}",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("output %q, want %q", lines, want)
+	}
+	for i := range want {
+		if !strings.HasPrefix(lines[i], want[i]) {
+			t.Errorf("line %d: %q, want %q", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestXBoard_Limits(t *testing.T) {
+	var limits []SearchLimits
+	recorder := searchRecorder{limits: &limits}
+	runXBoardScript(t, recorder,
+		"new", "level 40 5:30 2", "time 30000", "otim 29000", "usermove e2e4", "ping 1",
+		"force", "usermove g1f3", "st 1.5", "sd 6", "go", "ping 2",
+		"new", "force", "usermove e2e4", "usermove e7e5", "playother", "usermove g1f3")
+	if len(limits) != 3 {
+		t.Fatalf("expected 3 searches, got %+v", limits)
+	}
+	want := SearchLimits{WTime: 290 * time.Second, BTime: 300 * time.Second, WInc: 2 * time.Second, BInc: 2 * time.Second, MovesToGo: 40}
+	if limits[0] != want {
+		t.Errorf("clock limits %+v, want %+v", limits[0], want)
+	}
+	if limits[1] != (SearchLimits{Depth: 6, MoveTime: 1500 * time.Millisecond}) {
+		t.Errorf("st and sd limits %+v", limits[1])
+	}
+	// "new" clears sd and st but keeps the level
+	if limits[2].Depth != 0 || limits[2].MoveTime != 0 || limits[2].MovesToGo != 39 {
+		t.Errorf("limits after new %+v", limits[2])
+	}
+}
+
+func TestXBoard_MoveNow(t *testing.T) {
+	in, feed := io.Pipe()
+	out, output := io.Pipe()
+	go func() {
+		RunXBoard(in, output, Dumbfish{})
+		output.Close()
+	}()
+	lines := bufio.NewScanner(out)
+	io.WriteString(feed, "new\nst 60\nusermove d2d4\n")
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	io.WriteString(feed, "?\n")
+	if !lines.Scan() || !strings.HasPrefix(lines.Text(), "move ") {
+		t.Fatalf("expected a move, got %q", lines.Text())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("moved %v after ?", elapsed)
+	}
+	feed.Close()
+	for lines.Scan() {
+	}
+}
+
+func TestXBoardThinking(t *testing.T) {
+	pos := NewVariantPosition(Standard)
+	e4 := mustUCIMove(t, pos, "e2e4")
+	e5 := mustUCIMove(t, e4.Position, "e7e5")
+	info := SearchInfo{Depth: 5, Score: Score{Centipawns: -12}, Time: 1234 * time.Millisecond, Nodes: 4321, PV: []GeneratedMove{e4.Move, e5.Move}}
+	if got := xboardThinking(info); got != "5 -12 123 4321 e2e4 e7e5" {
+		t.Errorf("got %q", got)
+	}
+	info.Score = Score{Mate: 3}
+	if got := xboardThinking(info); !strings.HasPrefix(got, "5 100003 ") {
+		t.Errorf("mate: %q", got)
+	}
+	info.Score = Score{Mate: -2}
+	if got := xboardThinking(info); !strings.HasPrefix(got, "5 -100002 ") {
+		t.Errorf("mated: %q", got)
+	}
+}
+
+func mustUCIMove(t *testing.T, pos *Position, uci string) AppliedMove {
+	t.Helper()
+	ap, ok := findUCIMove(pos, uci)
+	if !ok {
+		t.Fatalf("%s is not legal in %s", uci, pos.FEN())
+	}
+	return ap
+}